@@ -0,0 +1,245 @@
+// Package acl keeps the users allowed to connect and the commands, keys and channels each of them can access
+package acl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"go-redis/config"
+)
+
+// DefaultUser is the user of connections which did not authenticate with a user name,
+// it has the password of requirePass if any
+const DefaultUser = "default"
+
+// ClusterUser is the user cluster nodes relay commands as, so relaying does not depend on the rules of the default user.
+// It can do anything and has the password of requirePass, which the nodes of a cluster share, it does not exist
+// without requirePass. The user is not listed nor saved, and can not be changed by ACL SETUSER or ACL DELUSER.
+const ClusterUser = "__cluster__"
+
+var (
+	mu    sync.RWMutex
+	users = make(map[string]*User)
+	// cluster is the ClusterUser, nil without requirePass
+	cluster *User
+)
+
+// Init creates the default user and loads the users of the ACL file if aclFile is set
+func Init() error {
+	mu.Lock()
+	users = map[string]*User{DefaultUser: newDefaultUser()}
+	cluster = newClusterUser()
+	mu.Unlock()
+	config.OnChange("requirepass", applyRequirePass)
+	if config.Properties.AclFile == "" {
+		return nil
+	}
+	return Load()
+}
+
+// newDefaultUser creates the default user, who can do anything, with the password of requirePass if any
+func newDefaultUser() *User {
+	u := NewUser(DefaultUser)
+	for _, rule := range []string{"on", "nopass", "~*", "&*", "+@all"} {
+		_ = u.SetRule(rule)
+	}
+	if requirePass := config.Snapshot().RequirePass; requirePass != "" {
+		_ = u.SetRule(">" + requirePass)
+	}
+	return u
+}
+
+// newClusterUser creates the ClusterUser with the password of requirePass, nil without requirePass
+func newClusterUser() *User {
+	requirePass := config.Snapshot().RequirePass
+	if requirePass == "" {
+		return nil
+	}
+	u := NewUser(ClusterUser)
+	for _, rule := range []string{"on", ">" + requirePass, "~*", "&*", "+@all"} {
+		_ = u.SetRule(rule)
+	}
+	return u
+}
+
+// applyRequirePass makes requirePass the only password of the default user and of the ClusterUser
+// after CONFIG SET requirepass, an empty requirePass lets the default user in without password
+func applyRequirePass() error {
+	mu.Lock()
+	cluster = newClusterUser()
+	mu.Unlock()
+	requirePass := config.Snapshot().RequirePass
+	if requirePass == "" {
+		return SetUser(DefaultUser, []string{"nopass"})
+	}
+	return SetUser(DefaultUser, []string{"resetpass", ">" + requirePass})
+}
+
+// GetUser returns the user, nil if it does not exist.
+// The user must not be changed, SetUser replaces it instead.
+func GetUser(name string) *User {
+	mu.RLock()
+	defer mu.RUnlock()
+	if name == ClusterUser {
+		return cluster
+	}
+	return users[name]
+}
+
+var errReservedUser = fmt.Errorf("The '%s' user is reserved for cluster nodes", ClusterUser)
+
+// SetUser applies the rules to the user, creating it if it does not exist.
+// No rule is applied if any of them is invalid.
+func SetUser(name string, rules []string) error {
+	if name == ClusterUser {
+		return errReservedUser
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	u, ok := users[name]
+	if ok {
+		u = u.clone()
+	} else {
+		u = NewUser(name)
+	}
+	for _, rule := range rules {
+		if err := u.SetRule(rule); err != nil {
+			return fmt.Errorf("Error in ACL SETUSER modifier '%s': %v", rule, err)
+		}
+	}
+	users[name] = u
+	return nil
+}
+
+// DelUsers removes the users, returns the number of users removed
+func DelUsers(names []string) (int, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, name := range names {
+		if name == DefaultUser {
+			return 0, fmt.Errorf("The '%s' user cannot be removed", DefaultUser)
+		}
+		if name == ClusterUser {
+			return 0, errReservedUser
+		}
+	}
+	deleted := 0
+	for _, name := range names {
+		if _, ok := users[name]; ok {
+			delete(users, name)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// Users returns all users ordered by name
+func Users() []*User {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]*User, 0, len(users))
+	for _, u := range users {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+	return list
+}
+
+// Authenticate tells whether the user exists, is enabled and has the password
+func Authenticate(name string, password string) bool {
+	u := GetUser(name)
+	return u != nil && u.CheckPassword(password)
+}
+
+// Load replaces all users by the users of the ACL file, nothing changes if the file is invalid.
+// The default user is created as if the file did not exist unless the file defines it.
+func Load() error {
+	filename := config.Properties.AclFile
+	if filename == "" {
+		return errNoAclFile
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	loaded := make(map[string]*User)
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if fields[0] != "user" || len(fields) < 2 {
+			return fmt.Errorf("%s:%d: should start with user keyword", filename, lineNum)
+		}
+		if fields[1] == ClusterUser {
+			return fmt.Errorf("%s:%d: %v", filename, lineNum, errReservedUser)
+		}
+		if _, ok := loaded[fields[1]]; ok {
+			return fmt.Errorf("%s:%d: duplicate user '%s' found", filename, lineNum, fields[1])
+		}
+		u := NewUser(fields[1])
+		for _, rule := range fields[2:] {
+			if err := u.SetRule(rule); err != nil {
+				return fmt.Errorf("%s:%d: Error in user declaration '%s': %v", filename, lineNum, rule, err)
+			}
+		}
+		loaded[u.Name] = u
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if _, ok := loaded[DefaultUser]; !ok {
+		loaded[DefaultUser] = newDefaultUser()
+	}
+
+	mu.Lock()
+	users = loaded
+	mu.Unlock()
+	return nil
+}
+
+var errNoAclFile = errors.New("This Redis instance is not configured to use an ACL file. You may want to " +
+	"specify users via the ACL SETUSER command and then issue a CONFIG REWRITE (assuming you have a Redis " +
+	"configuration file set) in order to store users in the Redis configuration.")
+
+// Save writes all users into a temporary file which then replaces the ACL file
+func Save() error {
+	filename := config.Properties.AclFile
+	if filename == "" {
+		return errNoAclFile
+	}
+	var sb strings.Builder
+	for _, u := range Users() {
+		sb.WriteString(u.Describe())
+		sb.WriteString("\n")
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), "temp-acl-*.acl")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.WriteString(sb.String()); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filename)
+}
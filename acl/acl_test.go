@@ -0,0 +1,197 @@
+package acl
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go-redis/config"
+)
+
+// useRequirePass initializes the users with the requirePass, the former properties are restored after the test
+func useRequirePass(t *testing.T, requirePass string) {
+	t.Helper()
+	former := config.Properties
+	props := *former
+	props.RequirePass = requirePass
+	props.AclFile = ""
+	config.Properties = &props
+	t.Cleanup(func() {
+		config.Properties = former
+	})
+	if err := Init(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUserPermissions(t *testing.T) {
+	useRequirePass(t, "")
+	if err := SetUser("alice", []string{"on", ">pw", "~cache:*", "%R~shared:*", "&news", "+@read", "+set", "-get"}); err != nil {
+		t.Fatal(err)
+	}
+	u := GetUser("alice")
+	if !Authenticate("alice", "pw") || Authenticate("alice", "wrong") {
+		t.Error("alice should authenticate with pw only")
+	}
+	if !u.CanRun("set", "") || !u.CanRun("mget", "") || u.CanRun("get", "") || u.CanRun("del", "") {
+		t.Error("unexpected command permissions")
+	}
+	if _, ok := u.CanAccessKeys([]string{"cache:1"}, []string{"shared:1"}); !ok {
+		t.Error("alice should write cache:* and read shared:*")
+	}
+	if key, ok := u.CanAccessKeys([]string{"shared:1"}, nil); ok || key != "shared:1" {
+		t.Error("alice should not write shared:*")
+	}
+	if !u.CanAccessChannel("news", false) || u.CanAccessChannel("sports", false) {
+		t.Error("unexpected channel permissions")
+	}
+	if err := SetUser("alice", []string{"bogus"}); err == nil {
+		t.Error("invalid rule accepted")
+	}
+	if !GetUser("alice").CanRun("set", "") {
+		t.Error("invalid rule changed the user")
+	}
+}
+
+func TestDefaultUser(t *testing.T) {
+	useRequirePass(t, "")
+	if !Authenticate(DefaultUser, "anything") {
+		t.Error("default user should need no password without requirePass")
+	}
+	if _, err := DelUsers([]string{DefaultUser}); err == nil {
+		t.Error("default user removed")
+	}
+	useRequirePass(t, "secret")
+	if Authenticate(DefaultUser, "anything") || !Authenticate(DefaultUser, "secret") {
+		t.Error("default user should need requirePass")
+	}
+}
+
+func TestClusterUser(t *testing.T) {
+	useRequirePass(t, "")
+	if GetUser(ClusterUser) != nil {
+		t.Error("cluster user exists without requirePass")
+	}
+
+	useRequirePass(t, "secret")
+	if err := SetUser(DefaultUser, []string{"off"}); err != nil {
+		t.Fatal(err)
+	}
+	if !Authenticate(ClusterUser, "secret") || Authenticate(ClusterUser, "wrong") {
+		t.Error("cluster user should authenticate with requirePass")
+	}
+	if u := GetUser(ClusterUser); !u.CanRun("flushall", "") || !u.CanAccessChannel("any", false) {
+		t.Error("cluster user should do anything")
+	}
+	if err := SetUser(ClusterUser, []string{"off"}); err == nil {
+		t.Error("cluster user changed by SetUser")
+	}
+	if _, err := DelUsers([]string{ClusterUser}); err == nil {
+		t.Error("cluster user removed")
+	}
+	for _, u := range Users() {
+		if u.Name == ClusterUser {
+			t.Error("cluster user listed")
+		}
+	}
+
+	config.Properties.RequirePass = "changed"
+	if err := applyRequirePass(); err != nil {
+		t.Fatal(err)
+	}
+	if !Authenticate(ClusterUser, "changed") {
+		t.Error("cluster user should follow requirePass")
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	useRequirePass(t, "")
+	aclFile := filepath.Join(t.TempDir(), "users.acl")
+	if err := Save(); err != errNoAclFile {
+		t.Errorf("expected saving refused without aclFile, got %v", err)
+	}
+	config.Properties.AclFile = aclFile
+	if err := SetUser("alice", []string{"on", ">pw", "~cache:*", "%R~shared:*", "&news", "+@read", "-get"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Save(); err != nil {
+		t.Fatal(err)
+	}
+	described := GetUser("alice").Describe()
+	if _, err := DelUsers([]string{"alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if u := GetUser("alice"); u == nil || u.Describe() != described || !Authenticate("alice", "pw") {
+		t.Fatalf("expected alice loaded as saved: %s", described)
+	}
+
+	// the default user is created unless the file defines it
+	writeACLFile(t, aclFile, "# users\n\nuser bob on nopass ~* +@all\n")
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if GetUser("alice") != nil || GetUser("bob") == nil || !Authenticate(DefaultUser, "any") {
+		t.Errorf("expected the users of the file and the default user, got %d users", len(Users()))
+	}
+	writeACLFile(t, aclFile, "user default off\n")
+	if err := Load(); err != nil {
+		t.Fatal(err)
+	}
+	if GetUser(DefaultUser).Enabled {
+		t.Error("expected the default user of the file")
+	}
+
+	// nothing changes if the file is invalid
+	for content, expected := range map[string]string{
+		"user bob on\nuser bob off\n":   ":2: duplicate user 'bob' found",
+		"bob on\n":                      ":1: should start with user keyword",
+		"user carol on bogus\n":         ":1: Error in user declaration 'bogus': Syntax error",
+		"user " + ClusterUser + " on\n": ":1: The '" + ClusterUser + "' user is reserved for cluster nodes",
+	} {
+		writeACLFile(t, aclFile, content)
+		if err := Load(); err == nil || err.Error() != aclFile+expected {
+			t.Errorf("expected %s%s, got %v", aclFile, expected, err)
+		}
+	}
+	if GetUser(DefaultUser).Enabled {
+		t.Error("expected the users kept after an invalid file")
+	}
+}
+
+func writeACLFile(t *testing.T, filename string, content string) {
+	t.Helper()
+	if err := os.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLog(t *testing.T) {
+	useRequirePass(t, "")
+	config.Properties.AclLogMaxLen = 2
+	ResetLogs()
+	t.Cleanup(ResetLogs)
+	LogDenied(ReasonCommand, "toplevel", "get", "alice", "id=1")
+	LogDenied(ReasonKey, "multi", "k", "alice", "id=1")
+	LogDenied(ReasonCommand, "toplevel", "get", "alice", "id=2")
+
+	// the repeated denial updates its entry and moves it first
+	entries := Logs(-1)
+	if len(entries) != 2 || entries[0].Object != "get" || entries[0].Count != 2 || entries[0].ClientInfo != "id=2" {
+		t.Fatalf("unexpected entries %+v", entries)
+	}
+	if entries[1].Reason != ReasonKey || entries[1].EntryID != entries[0].EntryID+1 {
+		t.Errorf("unexpected entry %+v", entries[1])
+	}
+
+	// the oldest entries are dropped beyond aclLogMaxLen
+	LogDenied(ReasonChannel, "toplevel", "news", "alice", "id=1")
+	if entries = Logs(10); len(entries) != 2 || entries[0].Object != "news" || entries[1].Object != "get" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+	if len(Logs(1)) != 1 {
+		t.Error("expected a single entry")
+	}
+}
@@ -0,0 +1,94 @@
+package acl
+
+import "sort"
+
+// categoryCommands lists the commands of each category, a command may belong to several categories.
+// Commands missing here are allowed by +@all only.
+var categoryCommands = map[string][]string{
+	"keyspace": {"del", "exists", "type", "keys", "rename", "renamenx", "expire", "pexpire", "expireat",
+		"pexpireat", "ttl", "pttl", "expiretime", "pexpiretime", "persist", "flushdb", "dump", "restore",
+		"restore-asking", "migrate", "select"},
+	"read": {"get", "mget", "strlen", "exists", "type", "keys", "ttl", "pttl", "expiretime", "pexpiretime", "dump",
+		"hget", "hmget", "hexists", "hlen", "hstrlen", "hkeys", "hvals", "hgetall", "hrandfield", "hscan",
+		"llen", "lindex", "lrange", "lpos",
+		"sismember", "smismember", "scard", "smembers", "srandmember", "sscan", "sinter", "sunion", "sdiff",
+		"zscore", "zmscore", "zcard", "zcount", "zlexcount", "zrank", "zrevrank", "zrange", "zrevrange",
+		"zrangebyscore", "zrevrangebyscore", "zrangebylex", "zrevrangebylex", "zscan", "zunion", "zinter"},
+	"write": {"set", "setnx", "getset", "mset", "incr", "incrby", "decr", "decrby", "incrbyfloat",
+		"del", "rename", "renamenx", "expire", "pexpire", "expireat", "pexpireat", "persist", "flushdb",
+		"restore", "restore-asking", "migrate",
+		"hset", "hsetnx", "hmset", "hdel", "hincrby", "hincrbyfloat",
+		"lpush", "lpushx", "rpush", "rpushx", "lpop", "rpop", "lset", "lrem", "ltrim", "linsert", "lmove", "rpoplpush",
+		"sadd", "srem", "spop", "smove", "sinterstore", "sunionstore", "sdiffstore",
+		"zadd", "zincrby", "zrem", "zremrangebyrank", "zremrangebyscore", "zremrangebylex", "zpopmin", "zpopmax",
+		"zunionstore", "zinterstore"},
+	"string": {"get", "set", "setnx", "getset", "mget", "mset", "strlen", "incr", "incrby", "decr", "decrby",
+		"incrbyfloat"},
+	"hash": {"hset", "hsetnx", "hmset", "hget", "hmget", "hexists", "hdel", "hlen", "hstrlen", "hkeys", "hvals",
+		"hgetall", "hincrby", "hincrbyfloat", "hrandfield", "hscan"},
+	"list": {"lpush", "lpushx", "rpush", "rpushx", "lpop", "rpop", "llen", "lindex", "lset", "lrange", "lrem",
+		"ltrim", "linsert", "lpos", "lmove", "rpoplpush"},
+	"set": {"sadd", "srem", "sismember", "smismember", "scard", "smembers", "srandmember", "spop", "sscan",
+		"smove", "sinter", "sunion", "sdiff", "sinterstore", "sunionstore", "sdiffstore"},
+	"sortedset": {"zadd", "zincrby", "zscore", "zmscore", "zcard", "zcount", "zlexcount", "zrank", "zrevrank",
+		"zrange", "zrevrange", "zrangebyscore", "zrevrangebyscore", "zrangebylex", "zrevrangebylex", "zrem",
+		"zremrangebyrank", "zremrangebyscore", "zremrangebylex", "zpopmin", "zpopmax", "zscan", "zunionstore",
+		"zinterstore", "zunion", "zinter"},
+	"pubsub": {"subscribe", "unsubscribe", "psubscribe", "punsubscribe", "publish", "pubsub"},
+	"admin": {"bgrewriteaof", "save", "bgsave", "lastsave", "replicaof", "slaveof", "psync", "replconf", "acl",
+		"cluster", "client", "config", "migrate", "_prepare", "_commit", "_rollback", "_publish"},
+	"dangerous": {"flushdb", "keys", "bgrewriteaof", "save", "bgsave", "lastsave", "replicaof", "slaveof", "psync",
+		"replconf", "acl", "cluster", "client", "config", "migrate", "restore", "restore-asking", "info", "role",
+		"_prepare", "_commit", "_rollback", "_publish"},
+	"connection":  {"ping", "select", "auth", "hello", "quit", "asking", "client"},
+	"transaction": {"multi", "exec", "discard", "watch", "unwatch"},
+	"fast": {"get", "set", "setnx", "getset", "strlen", "incr", "incrby", "decr", "decrby", "incrbyfloat",
+		"exists", "type", "ttl", "pttl", "expiretime", "pexpiretime", "expire", "pexpire", "expireat", "pexpireat",
+		"persist", "hset", "hsetnx", "hget", "hexists", "hdel", "hlen", "hstrlen", "hincrby", "hincrbyfloat",
+		"lpush", "lpushx", "rpush", "rpushx", "lpop", "rpop", "llen", "sadd", "srem", "sismember", "smismember",
+		"scard", "smove", "zadd", "zincrby", "zscore", "zmscore", "zcard", "zrank", "zrevrank",
+		"ping", "select", "auth", "hello", "asking", "multi", "discard", "watch", "unwatch", "lastsave", "role"},
+}
+
+// commandCategories maps each command to its categories, filled from categoryCommands,
+// commands which are not fast are slow
+var commandCategories = make(map[string]map[string]bool)
+
+func init() {
+	for category, commands := range categoryCommands {
+		for _, cmd := range commands {
+			if commandCategories[cmd] == nil {
+				commandCategories[cmd] = make(map[string]bool)
+			}
+			commandCategories[cmd][category] = true
+		}
+	}
+	for cmd, categories := range commandCategories {
+		if !categories["fast"] {
+			categories["slow"] = true
+			categoryCommands["slow"] = append(categoryCommands["slow"], cmd)
+		}
+	}
+}
+
+// Categories returns the names of all categories in order
+func Categories() []string {
+	categories := make([]string, 0, len(categoryCommands))
+	for category := range categoryCommands {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return categories
+}
+
+// CommandsOf returns the commands of the category in order, nil if the category does not exist
+func CommandsOf(category string) []string {
+	commands, ok := categoryCommands[category]
+	if !ok {
+		return nil
+	}
+	sorted := make([]string, len(commands))
+	copy(sorted, commands)
+	sort.Strings(sorted)
+	return sorted
+}
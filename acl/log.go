@@ -0,0 +1,95 @@
+package acl
+
+import (
+	"sync"
+	"time"
+
+	"go-redis/config"
+)
+
+// reasons of denied commands recorded by ACL LOG
+const (
+	ReasonAuth    = "auth"
+	ReasonCommand = "command"
+	ReasonKey     = "key"
+	ReasonChannel = "channel"
+)
+
+// LogEntry records commands denied by the same reason, an entry counts the repeated denials
+// happening within a minute of each other
+type LogEntry struct {
+	Count       int
+	Reason      string
+	Context     string // toplevel or multi
+	Object      string // command, key or channel denied
+	Username    string
+	ClientInfo  string
+	EntryID     int64
+	CreatedAt   time.Time
+	LastUpdated time.Time
+}
+
+// logGroupTime is the time within which the same denial updates the entry rather than adding a new one
+const logGroupTime = time.Minute
+
+var (
+	logMu     sync.Mutex
+	logs      []*LogEntry // latest first
+	nextLogID int64
+)
+
+// LogDenied records a denied command or authentication
+func LogDenied(reason, context, object, username, clientInfo string) {
+	logMu.Lock()
+	defer logMu.Unlock()
+	now := time.Now()
+	for i, entry := range logs {
+		if entry.Reason == reason && entry.Context == context && entry.Object == object &&
+			entry.Username == username && now.Sub(entry.LastUpdated) < logGroupTime {
+			entry.Count++
+			entry.LastUpdated = now
+			entry.ClientInfo = clientInfo
+			// move to the front
+			copy(logs[1:i+1], logs[:i])
+			logs[0] = entry
+			return
+		}
+	}
+	entry := &LogEntry{
+		Count:       1,
+		Reason:      reason,
+		Context:     context,
+		Object:      object,
+		Username:    username,
+		ClientInfo:  clientInfo,
+		EntryID:     nextLogID,
+		CreatedAt:   now,
+		LastUpdated: now,
+	}
+	nextLogID++
+	logs = append([]*LogEntry{entry}, logs...)
+	if max := config.Snapshot().AclLogMaxLen; len(logs) > max {
+		logs = logs[:max]
+	}
+}
+
+// Logs returns at most count entries, latest first
+func Logs(count int) []LogEntry {
+	logMu.Lock()
+	defer logMu.Unlock()
+	if count > len(logs) || count < 0 {
+		count = len(logs)
+	}
+	entries := make([]LogEntry, count)
+	for i := range entries {
+		entries[i] = *logs[i]
+	}
+	return entries
+}
+
+// ResetLogs clears the log
+func ResetLogs() {
+	logMu.Lock()
+	defer logMu.Unlock()
+	logs = nil
+}
@@ -0,0 +1,372 @@
+package acl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+
+	"go-redis/lib/wildcard"
+)
+
+// User is an ACL user, the rules of the user are applied in order and later rules override earlier ones
+type User struct {
+	Name    string
+	Enabled bool
+	// NoPass accepts any password
+	NoPass bool
+	// sha256 hashes of the passwords in hex
+	passwords map[string]struct{}
+	// commandRules are +@category, -@category, +command, -command or +command|subcommand, -command|subcommand,
+	// the last rule matching a command decides whether the command is allowed
+	commandRules []string
+	keys         []*keyPattern
+	channels     []*channelPattern
+}
+
+// keyPattern allows to read or write the keys matching the pattern
+type keyPattern struct {
+	pattern string
+	read    bool
+	write   bool
+	matcher *wildcard.Pattern
+}
+
+// channelPattern allows to publish or subscribe the channels matching the pattern
+type channelPattern struct {
+	pattern string
+	matcher *wildcard.Pattern
+}
+
+// NewUser creates a disabled user who can not run any command
+func NewUser(name string) *User {
+	return &User{
+		Name:      name,
+		passwords: make(map[string]struct{}),
+	}
+}
+
+// clone returns a copy which can be changed without affecting the user
+func (u *User) clone() *User {
+	c := &User{
+		Name:         u.Name,
+		Enabled:      u.Enabled,
+		NoPass:       u.NoPass,
+		passwords:    make(map[string]struct{}, len(u.passwords)),
+		commandRules: append([]string(nil), u.commandRules...),
+		keys:         append([]*keyPattern(nil), u.keys...),
+		channels:     append([]*channelPattern(nil), u.channels...),
+	}
+	for hash := range u.passwords {
+		c.passwords[hash] = struct{}{}
+	}
+	return c
+}
+
+// hashPassword returns the hash of the password stored in users and ACL files
+func hashPassword(password string) string {
+	sum := sha256.Sum256([]byte(password))
+	return hex.EncodeToString(sum[:])
+}
+
+var errSyntax = errors.New("Syntax error")
+
+// SetRule applies a rule of ACL SETUSER to the user
+func (u *User) SetRule(rule string) error {
+	switch strings.ToLower(rule) {
+	case "on":
+		u.Enabled = true
+		return nil
+	case "off":
+		u.Enabled = false
+		return nil
+	case "nopass":
+		u.NoPass = true
+		u.passwords = make(map[string]struct{})
+		return nil
+	case "resetpass":
+		u.NoPass = false
+		u.passwords = make(map[string]struct{})
+		return nil
+	case "allkeys":
+		return u.SetRule("~*")
+	case "resetkeys":
+		u.keys = nil
+		return nil
+	case "allchannels":
+		return u.SetRule("&*")
+	case "resetchannels":
+		u.channels = nil
+		return nil
+	case "allcommands":
+		return u.SetRule("+@all")
+	case "nocommands":
+		return u.SetRule("-@all")
+	case "reset":
+		for _, r := range []string{"resetpass", "resetkeys", "resetchannels", "off", "-@all"} {
+			_ = u.SetRule(r)
+		}
+		return nil
+	}
+	if rule == "" {
+		return errSyntax
+	}
+
+	switch rule[0] {
+	case '>':
+		u.passwords[hashPassword(rule[1:])] = struct{}{}
+		u.NoPass = false
+		return nil
+	case '<':
+		hash := hashPassword(rule[1:])
+		if _, ok := u.passwords[hash]; !ok {
+			return errors.New("The password you are trying to remove from the user does not exist")
+		}
+		delete(u.passwords, hash)
+		return nil
+	case '#', '!':
+		hash := rule[1:]
+		if !isPasswordHash(hash) {
+			return errors.New("The password hash must be exactly 64 characters and contain only lowercase " +
+				"hexadecimal characters")
+		}
+		if rule[0] == '#' {
+			u.passwords[hash] = struct{}{}
+			u.NoPass = false
+			return nil
+		}
+		if _, ok := u.passwords[hash]; !ok {
+			return errors.New("The password you are trying to remove from the user does not exist")
+		}
+		delete(u.passwords, hash)
+		return nil
+	case '~', '%':
+		return u.addKeyPattern(rule)
+	case '&':
+		pattern := rule[1:]
+		if pattern == "*" {
+			u.channels = nil
+		}
+		u.channels = append(u.channels, &channelPattern{pattern: pattern, matcher: wildcard.CompilePattern(pattern)})
+		return nil
+	case '+', '-':
+		return u.addCommandRule(rule)
+	}
+	return errSyntax
+}
+
+// addKeyPattern adds ~pattern, or %R~pattern %W~pattern %RW~pattern allowing to read or write only
+func (u *User) addKeyPattern(rule string) error {
+	p := &keyPattern{read: true, write: true}
+	if rule[0] == '%' {
+		i := strings.IndexByte(rule, '~')
+		if i < 2 {
+			return errSyntax
+		}
+		p.read, p.write = false, false
+		for _, c := range strings.ToUpper(rule[1:i]) {
+			switch c {
+			case 'R':
+				p.read = true
+			case 'W':
+				p.write = true
+			default:
+				return errSyntax
+			}
+		}
+		rule = rule[i:]
+	}
+	p.pattern = rule[1:]
+	p.matcher = wildcard.CompilePattern(p.pattern)
+	if p.pattern == "*" && p.read && p.write {
+		// every other pattern is covered
+		u.keys = nil
+	}
+	u.keys = append(u.keys, p)
+	return nil
+}
+
+// addCommandRule adds +@category, -@category, +command, -command, +command|subcommand or -command|subcommand
+func (u *User) addCommandRule(rule string) error {
+	name := strings.ToLower(rule[1:])
+	if strings.HasPrefix(name, "@") {
+		if name == "@all" {
+			// every earlier rule is overridden
+			u.commandRules = []string{rule[:1] + name}
+			return nil
+		}
+		if _, ok := categoryCommands[name[1:]]; !ok {
+			return errors.New("Unknown command or category name in ACL")
+		}
+	} else {
+		cmd := name
+		if i := strings.IndexByte(name, '|'); i >= 0 {
+			cmd = name[:i]
+			if i == len(name)-1 {
+				return errSyntax
+			}
+		}
+		if _, ok := commandCategories[cmd]; !ok {
+			return errors.New("Unknown command or category name in ACL")
+		}
+	}
+	u.commandRules = append(u.commandRules, rule[:1]+name)
+	return nil
+}
+
+func isPasswordHash(hash string) bool {
+	if len(hash) != 64 {
+		return false
+	}
+	for _, c := range hash {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckPassword tells whether the user can authenticate with the password
+func (u *User) CheckPassword(password string) bool {
+	if !u.Enabled {
+		return false
+	}
+	if u.NoPass {
+		return true
+	}
+	_, ok := u.passwords[hashPassword(password)]
+	return ok
+}
+
+// CanRun tells whether the user can run the command, subCmd is the first argument of the command if any
+func (u *User) CanRun(cmd string, subCmd string) bool {
+	allowed := false
+	for _, rule := range u.commandRules {
+		name := rule[1:]
+		var matched bool
+		switch {
+		case name == "@all":
+			matched = true
+		case strings.HasPrefix(name, "@"):
+			matched = commandCategories[cmd][name[1:]]
+		case strings.IndexByte(name, '|') >= 0:
+			matched = name == cmd+"|"+subCmd
+		default:
+			matched = name == cmd
+		}
+		if matched {
+			allowed = rule[0] == '+'
+		}
+	}
+	return allowed
+}
+
+// CanAccessKeys returns the first key the user can not access, empty if all keys can be accessed
+func (u *User) CanAccessKeys(writeKeys []string, readKeys []string) (string, bool) {
+	for _, key := range writeKeys {
+		if !u.canAccessKey(key, false) {
+			return key, false
+		}
+	}
+	for _, key := range readKeys {
+		if !u.canAccessKey(key, true) {
+			return key, false
+		}
+	}
+	return "", true
+}
+
+func (u *User) canAccessKey(key string, read bool) bool {
+	for _, p := range u.keys {
+		if (read && p.read || !read && p.write) && p.matcher.IsMatch(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessChannel tells whether the user can publish or subscribe the channel,
+// a pattern subscribed by PSUBSCRIBE must be one of the patterns of the user
+func (u *User) CanAccessChannel(channel string, isPattern bool) bool {
+	for _, p := range u.channels {
+		if p.pattern == "*" || (isPattern && p.pattern == channel) || (!isPattern && p.matcher.IsMatch(channel)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Flags returns the flags of ACL GETUSER
+func (u *User) Flags() []string {
+	flags := []string{"off"}
+	if u.Enabled {
+		flags[0] = "on"
+	}
+	if u.NoPass {
+		flags = append(flags, "nopass")
+	}
+	return flags
+}
+
+// PasswordHashes returns the hashes of the passwords in order
+func (u *User) PasswordHashes() []string {
+	hashes := make([]string, 0, len(u.passwords))
+	for hash := range u.passwords {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return hashes
+}
+
+// CommandRules describes the commands allowed, e.g. "+@all -@dangerous"
+func (u *User) CommandRules() string {
+	if len(u.commandRules) == 0 {
+		return "-@all"
+	}
+	return strings.Join(u.commandRules, " ")
+}
+
+// KeyRules describes the keys allowed, e.g. "~cache:* %R~app:*"
+func (u *User) KeyRules() string {
+	rules := make([]string, len(u.keys))
+	for i, p := range u.keys {
+		switch {
+		case p.read && p.write:
+			rules[i] = "~" + p.pattern
+		case p.read:
+			rules[i] = "%R~" + p.pattern
+		default:
+			rules[i] = "%W~" + p.pattern
+		}
+	}
+	return strings.Join(rules, " ")
+}
+
+// ChannelRules describes the channels allowed, e.g. "&news.*"
+func (u *User) ChannelRules() string {
+	rules := make([]string, len(u.channels))
+	for i, p := range u.channels {
+		rules[i] = "&" + p.pattern
+	}
+	return strings.Join(rules, " ")
+}
+
+// Describe returns the rules creating the user, the format of ACL LIST and ACL files
+func (u *User) Describe() string {
+	fields := []string{"user", u.Name}
+	fields = append(fields, u.Flags()...)
+	for _, hash := range u.PasswordHashes() {
+		fields = append(fields, "#"+hash)
+	}
+	if keys := u.KeyRules(); keys != "" {
+		fields = append(fields, keys)
+	}
+	if channels := u.ChannelRules(); channels != "" {
+		fields = append(fields, channels)
+	} else {
+		fields = append(fields, "resetchannels")
+	}
+	fields = append(fields, u.CommandRules())
+	return strings.Join(fields, " ")
+}
@@ -1,12 +1,16 @@
 package aof
 
 import (
+	"errors"
 	"io"
 	"os"
 	"strconv"
+	"sync"
+	"time"
 
 	"go-redis/config"
 	"go-redis/lib/logger"
+	"go-redis/lib/sync/atomic"
 	"go-redis/lib/utils"
 	"go-redis/resp/connection"
 	"go-redis/resp/parser"
@@ -20,85 +24,256 @@ type CmdLine [][]byte
 
 const (
 	aofQueueSize = 1 << 16
+
+	// cronInterval is the interval between two fsync of everysec policy and checks of the aof growth
+	cronInterval = time.Second
+)
+
+const (
+	// FsyncAlways flushes aof file after every write, the writing command waits until the record is durable
+	FsyncAlways = "always"
+	// FsyncEverySec flushes aof file every second, at most about one second of writes are lost on crash
+	FsyncEverySec = "everysec"
+	// FsyncNo leaves flushing to the operating system
+	FsyncNo = "no"
 )
 
 type payload struct {
-	cmdLine CmdLine
-	dbIndex int
+	cmdLines []CmdLine // written next to each other, e.g. a MULTI ... EXEC block
+	dbIndex  int
+	done     chan struct{} // closed once the payload is durable, only used by always policy
 }
 
 // Handler receives messages from channel and write to AOF file
 type Handler struct {
 	db          databaseface.Database
+	tmpDBMaker  func() databaseface.DBEngine // makes an empty database to replay aof while rewriting
 	aofChan     chan *payload
 	aofFile     *os.File
 	aofFilename string
 	currentDB   int
+
+	// pausingAof is held while writing a payload, rewrite holds it to take the aof file over
+	pausingAof sync.Mutex
+	// rewriteBuffer keeps the payloads written since the rewrite started, nil if not rewriting
+	rewriteBuffer []*payload
+	rewriting     atomic.Boolean
+
+	// aofBaseSize is the size of aof file after the last rewrite, or at startup
+	aofBaseSize int64
+	// aofCurrentSize is the size of aof file, guarded by pausingAof
+	aofCurrentSize int64
+
+	// lastFsync is the time of the last successful fsync, guarded by pausingAof
+	lastFsync time.Time
+	// pendingSince is the time of the oldest write not flushed yet, zero if all writes are durable
+	pendingSince time.Time
+	// writeSeq counts writes, so fsync knows whether writes happened while it was running
+	writeSeq uint64
+
+	// sendMu is held by AddAof while sending to aofChan, Close holds it to stop accepting writes
+	sendMu    sync.RWMutex
+	stopped   bool          // guarded by sendMu, set once aofChan is closed
+	drained   chan struct{} // closed once handleAof wrote all payloads of aofChan
+	closeOnce sync.Once
+	closed    chan struct{} // stops background jobs
+}
+
+// NewAofHandler creates a new aof Handler, aof file is replayed into db first
+func NewAofHandler(db databaseface.Database, tmpDBMaker func() databaseface.DBEngine) (*Handler, error) {
+	return newAofHandler(db, tmpDBMaker, true)
+}
+
+// OpenAofHandler creates a new aof Handler appending to aof file, which already holds the dataset of db
+func OpenAofHandler(db databaseface.Database, tmpDBMaker func() databaseface.DBEngine) (*Handler, error) {
+	return newAofHandler(db, tmpDBMaker, false)
 }
 
-// NewAofHandler creates a new aof Handler
-func NewAofHandler(db databaseface.Database) (*Handler, error) {
-	handler := &Handler{}
+func newAofHandler(db databaseface.Database, tmpDBMaker func() databaseface.DBEngine, load bool) (*Handler, error) {
+	handler := &Handler{
+		tmpDBMaker: tmpDBMaker,
+		drained:    make(chan struct{}),
+		closed:     make(chan struct{}),
+	}
 	handler.aofFilename = config.Properties.AppendFilename
 	handler.db = db
 
-	handler.loadAof()
+	if load {
+		handler.loadAof(db, 0)
+	}
 
 	aofFile, err := os.OpenFile(handler.aofFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
 	if err != nil {
 		return nil, err
 	}
 	handler.aofFile = aofFile
+	if info, err := aofFile.Stat(); err == nil {
+		handler.aofBaseSize = info.Size()
+		handler.aofCurrentSize = info.Size()
+	}
+	handler.lastFsync = time.Now()
 
 	handler.aofChan = make(chan *payload, aofQueueSize)
 	go func() {
 		handler.handleAof()
 	}()
+	go handler.cron()
 
 	return handler, nil
 }
 
-// AddAof send command to aof goroutine through channel
-func (handler *Handler) AddAof(dbIndex int, cmdLine CmdLine) {
-	if config.Properties.AppendOnly && handler.aofChan != nil {
-		handler.aofChan <- &payload{
-			cmdLine: cmdLine,
-			dbIndex: dbIndex,
+// AddAof send commands to aof goroutine through channel, commands sent together are never interleaved with others.
+// With always policy it returns after the commands are flushed to disk. Commands are dropped once the handler is closed
+func (handler *Handler) AddAof(dbIndex int, cmdLines ...CmdLine) {
+	props := config.Snapshot()
+	if props.AppendOnly && handler.aofChan != nil && len(cmdLines) > 0 {
+		p := &payload{
+			cmdLines: cmdLines,
+			dbIndex:  dbIndex,
+		}
+		if props.AppendFsync == FsyncAlways {
+			p.done = make(chan struct{})
+		}
+		handler.sendMu.RLock()
+		if handler.stopped {
+			handler.sendMu.RUnlock()
+			return
+		}
+		handler.aofChan <- p
+		handler.sendMu.RUnlock()
+		if p.done != nil {
+			<-p.done
 		}
 	}
 }
 
-// handleAof listens aof channel and write into file
+// handleAof listens aof channel and write into file until the channel is closed
 func (handler *Handler) handleAof() {
+	defer close(handler.drained)
 	handler.currentDB = 0
 	for p := range handler.aofChan {
-		if p.dbIndex != handler.currentDB {
-			// select db
-			data := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(p.dbIndex))).ToBytes()
-			_, err := handler.aofFile.Write(data)
-			if err != nil {
-				logger.Warn(err)
-				continue // skip this command
-			}
-			handler.currentDB = p.dbIndex
+		handler.pausingAof.Lock()
+		handler.writePayload(p)
+		if p.done != nil {
+			handler.fsync0()
+			close(p.done)
 		}
-		data := reply.MakeMultiBulkReply(p.cmdLine).ToBytes()
-		_, err := handler.aofFile.Write(data)
+		handler.pausingAof.Unlock()
+	}
+}
+
+// writePayload writes a payload into aof file, the caller holds pausingAof
+func (handler *Handler) writePayload(p *payload) {
+	if handler.rewriting.Get() {
+		handler.rewriteBuffer = append(handler.rewriteBuffer, p)
+	}
+	if p.dbIndex != handler.currentDB {
+		// select db
+		data := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(p.dbIndex))).ToBytes()
+		n, err := handler.aofFile.Write(data)
+		handler.aofCurrentSize += int64(n)
 		if err != nil {
 			logger.Warn(err)
+			return // skip this command
+		}
+		handler.currentDB = p.dbIndex
+	}
+	var data []byte
+	for _, cmdLine := range p.cmdLines {
+		data = append(data, reply.MakeMultiBulkReply(cmdLine).ToBytes()...)
+	}
+	n, err := handler.aofFile.Write(data)
+	handler.aofCurrentSize += int64(n)
+	if err != nil {
+		logger.Warn(err)
+	}
+	handler.writeSeq++
+	if handler.pendingSince.IsZero() {
+		handler.pendingSince = time.Now()
+	}
+}
+
+// fsync0 flushes aof file to disk, the caller holds pausingAof
+func (handler *Handler) fsync0() {
+	if err := handler.aofFile.Sync(); err != nil {
+		logger.Warn(err)
+		return
+	}
+	handler.lastFsync = time.Now()
+	handler.pendingSince = time.Time{}
+}
+
+// fsyncInBackground flushes aof file to disk without blocking writing during the fsync
+func (handler *Handler) fsyncInBackground() {
+	handler.pausingAof.Lock()
+	file := handler.aofFile
+	seq := handler.writeSeq
+	pending := !handler.pendingSince.IsZero()
+	handler.pausingAof.Unlock()
+	if !pending {
+		return
+	}
+
+	start := time.Now()
+	if err := file.Sync(); err != nil {
+		if !errors.Is(err, os.ErrClosed) { // aof file was replaced by rewrite, which flushed the new file
+			logger.Warn(err)
 		}
+		return
+	}
+
+	handler.pausingAof.Lock()
+	defer handler.pausingAof.Unlock()
+	if file != handler.aofFile {
+		return
+	}
+	handler.lastFsync = time.Now()
+	if handler.writeSeq == seq {
+		handler.pendingSince = time.Time{}
+	} else {
+		// writes during the fsync may not be durable
+		handler.pendingSince = start
+	}
+}
+
+// FsyncLag returns how long the oldest write not flushed to disk has been waiting
+func (handler *Handler) FsyncLag() time.Duration {
+	handler.pausingAof.Lock()
+	defer handler.pausingAof.Unlock()
+	if handler.pendingSince.IsZero() {
+		return 0
 	}
+	return time.Since(handler.pendingSince)
+}
+
+// AofSizes returns the size of aof file after the last rewrite and the current size
+func (handler *Handler) AofSizes() (base int64, current int64) {
+	handler.pausingAof.Lock()
+	defer handler.pausingAof.Unlock()
+	return handler.aofBaseSize, handler.aofCurrentSize
+}
+
+// LastFsync returns the time of the last successful fsync
+func (handler *Handler) LastFsync() time.Time {
+	handler.pausingAof.Lock()
+	defer handler.pausingAof.Unlock()
+	return handler.lastFsync
 }
 
-// loadAof replays aof file when redis starts
-func (handler *Handler) loadAof() {
+// loadAof replays aof file into db, at most maxBytes are read if maxBytes is positive
+func (handler *Handler) loadAof(db databaseface.Database, maxBytes int64) {
 	file, err := os.Open(handler.aofFilename)
 	if err != nil {
 		logger.Warn(err)
 		return
 	}
 	defer file.Close()
-	ch := parser.ParseStream(file)
+
+	var reader io.Reader = file
+	if maxBytes > 0 {
+		reader = io.LimitReader(file, maxBytes)
+	}
+	ch := parser.ParseStream(reader)
 	fakeConn := &connection.Connection{} // only used for save dbIndex
 	for p := range ch {
 		if p.Err != nil {
@@ -117,9 +292,71 @@ func (handler *Handler) loadAof() {
 			logger.Error("require multi bulk reply")
 			continue
 		}
-		ret := handler.db.Exec(fakeConn, r.Args)
-		if reply.IsErrReply(ret) {
-			logger.Error("exec err", err)
+		ret := db.Exec(fakeConn, r.Args)
+		if ret == nil {
+			// Exec recovered from a panic
+			logger.Error("exec err: no reply to " + string(r.Args[0]))
+		} else if reply.IsErrReply(ret) {
+			logger.Error("exec err", string(ret.ToBytes()))
 		}
 	}
 }
+
+// cron flushes aof file every second with everysec policy,
+// and rewrites aof file once it grows enough since the last rewrite
+func (handler *Handler) cron() {
+	ticker := time.NewTicker(cronInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if config.Snapshot().AppendFsync == FsyncEverySec {
+				handler.fsyncInBackground()
+			}
+			if handler.needRewrite() {
+				logger.Info("starting automatic aof rewrite")
+				if err := handler.BGRewrite(); err != nil && err != ErrRewriteInProgress {
+					logger.Error("auto aof rewrite failed: " + err.Error())
+				}
+			}
+		case <-handler.closed:
+			return
+		}
+	}
+}
+
+// needRewrite checks the growth of aof file against autoAofRewritePercentage and autoAofRewriteMinSize
+func (handler *Handler) needRewrite() bool {
+	percentage := config.Snapshot().AutoAofRewritePercentage
+	if percentage <= 0 || handler.rewriting.Get() {
+		return false
+	}
+	handler.pausingAof.Lock()
+	base, current := handler.aofBaseSize, handler.aofCurrentSize
+	handler.pausingAof.Unlock()
+
+	if current < config.Snapshot().AutoAofRewriteMinSize {
+		return false
+	}
+	if base <= 0 {
+		base = 1
+	}
+	growth := (current - base) * 100 / base
+	return growth >= int64(percentage)
+}
+
+// Close stops accepting writes, waits until the queued ones are written, then stops background jobs and flushes aof file
+func (handler *Handler) Close() {
+	handler.closeOnce.Do(func() {
+		handler.sendMu.Lock()
+		handler.stopped = true
+		close(handler.aofChan)
+		handler.sendMu.Unlock()
+		<-handler.drained
+
+		close(handler.closed)
+		handler.pausingAof.Lock()
+		defer handler.pausingAof.Unlock()
+		handler.fsync0()
+	})
+}
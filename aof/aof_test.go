@@ -0,0 +1,182 @@
+package aof
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+)
+
+// recordingDB records the commands replayed into it
+type recordingDB struct {
+	cmds []string
+}
+
+func (db *recordingDB) Exec(client resp.Connection, args [][]byte) resp.Reply {
+	s := make([]string, len(args))
+	for i, arg := range args {
+		s[i] = string(arg)
+	}
+	db.cmds = append(db.cmds, strings.Join(s, " "))
+	return reply.MakeOKReply()
+}
+
+func (db *recordingDB) Close() error {
+	return nil
+}
+
+func (db *recordingDB) AfterClientClose(client resp.Connection) error {
+	return nil
+}
+
+// useTestConfig keeps the aof file of the test in a temp dir, the former properties are restored after it
+func useTestConfig(t *testing.T, fsync string) *config.ServerProperties {
+	t.Helper()
+	former := config.Properties
+	config.Properties = &config.ServerProperties{
+		AppendOnly:     true,
+		AppendFilename: filepath.Join(t.TempDir(), "appendonly.aof"),
+		AppendFsync:    fsync,
+		Databases:      16,
+	}
+	t.Cleanup(func() {
+		config.Properties = former
+	})
+	return config.Properties
+}
+
+func newTestHandler(t *testing.T, db *recordingDB) *Handler {
+	t.Helper()
+	handler, err := NewAofHandler(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(handler.Close)
+	return handler
+}
+
+// waitWritten waits until the aof file grows to size
+func waitWritten(t *testing.T, handler *Handler, size int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, current := handler.AofSizes(); current >= size {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("aof file did not grow to %d bytes", size)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAofReplay(t *testing.T) {
+	useTestConfig(t, FsyncAlways)
+	handler := newTestHandler(t, &recordingDB{})
+	handler.AddAof(0, utils.ToCmdLine("SET", "a", "1"))
+	handler.AddAof(2, utils.ToCmdLine("SET", "b", "2"), utils.ToCmdLine("SET", "c", "3"))
+	handler.AddAof(0, utils.ToCmdLine("DEL", "a"))
+
+	db := &recordingDB{}
+	newTestHandler(t, db)
+	expected := []string{"SET a 1", "SELECT 2", "SET b 2", "SET c 3", "SELECT 0", "DEL a"}
+	if strings.Join(db.cmds, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected replaying %q, got %q", expected, db.cmds)
+	}
+}
+
+func TestCloseDrains(t *testing.T) {
+	useTestConfig(t, FsyncNo)
+	handler := newTestHandler(t, &recordingDB{})
+	// queued writes are written by Close, later ones are dropped
+	n := 1000
+	for i := 0; i < n; i++ {
+		handler.AddAof(0, utils.ToCmdLine("INCR", "counter"))
+	}
+	handler.Close()
+	handler.AddAof(0, utils.ToCmdLine("DEL", "counter"))
+	if lag := handler.FsyncLag(); lag != 0 {
+		t.Errorf("expected nothing waiting for fsync after Close, got a lag of %v", lag)
+	}
+
+	db := &recordingDB{}
+	newTestHandler(t, db)
+	if len(db.cmds) != n {
+		t.Fatalf("expected replaying %d commands, got %d", n, len(db.cmds))
+	}
+	if db.cmds[n-1] != "INCR counter" {
+		t.Errorf("expected replaying INCR last, got %q", db.cmds[n-1])
+	}
+}
+
+func TestFsyncAlways(t *testing.T) {
+	useTestConfig(t, FsyncAlways)
+	handler := newTestHandler(t, &recordingDB{})
+	before := handler.LastFsync()
+	time.Sleep(time.Millisecond)
+	// AddAof returns once the command is flushed
+	handler.AddAof(0, utils.ToCmdLine("SET", "a", "1"))
+	if lag := handler.FsyncLag(); lag != 0 {
+		t.Errorf("expected nothing waiting for fsync, got a lag of %v", lag)
+	}
+	if !handler.LastFsync().After(before) {
+		t.Error("expected the last fsync updated")
+	}
+}
+
+func TestFsyncEverySec(t *testing.T) {
+	useTestConfig(t, FsyncEverySec)
+	handler := newTestHandler(t, &recordingDB{})
+	handler.AddAof(0, utils.ToCmdLine("SET", "a", "1"))
+	waitWritten(t, handler, 1)
+	time.Sleep(time.Millisecond)
+	if handler.FsyncLag() == 0 {
+		t.Error("expected the write waiting for fsync")
+	}
+	handler.fsyncInBackground()
+	if lag := handler.FsyncLag(); lag != 0 {
+		t.Errorf("expected nothing waiting for fsync, got a lag of %v", lag)
+	}
+}
+
+func TestAppendOnlyOff(t *testing.T) {
+	useTestConfig(t, FsyncAlways)
+	handler := newTestHandler(t, &recordingDB{})
+	config.Properties.AppendOnly = false
+	handler.AddAof(0, utils.ToCmdLine("SET", "a", "1"))
+	if _, current := handler.AofSizes(); current != 0 {
+		t.Errorf("expected nothing written with appendonly off, got %d bytes", current)
+	}
+}
+
+func TestNeedRewrite(t *testing.T) {
+	props := useTestConfig(t, FsyncNo)
+	props.AutoAofRewritePercentage = 100
+	props.AutoAofRewriteMinSize = 1000
+	handler := newTestHandler(t, &recordingDB{})
+	for _, c := range []struct {
+		base, current int64
+		expected      bool
+	}{
+		{0, 999, false}, // smaller than the min size
+		{0, 1000, true}, // an empty aof file at startup grows from 1 byte
+		{800, 1599, false},
+		{800, 1600, true},
+	} {
+		handler.pausingAof.Lock()
+		handler.aofBaseSize, handler.aofCurrentSize = c.base, c.current
+		handler.pausingAof.Unlock()
+		if actual := handler.needRewrite(); actual != c.expected {
+			t.Errorf("expected needRewrite %v growing from %d to %d bytes", c.expected, c.base, c.current)
+		}
+	}
+	props.AutoAofRewritePercentage = 0
+	if handler.needRewrite() {
+		t.Error("expected no automatic rewrite with 0 percentage")
+	}
+}
@@ -0,0 +1,80 @@
+package aof
+
+import (
+	"strconv"
+	"time"
+
+	"go-redis/datastruct/dict"
+	"go-redis/datastruct/list"
+	"go-redis/datastruct/set"
+	"go-redis/datastruct/sortedset"
+	"go-redis/interface/database"
+	"go-redis/lib/utils"
+)
+
+// MakeExpireCmd generates a PEXPIREAT command line with an absolute unix time in milliseconds,
+// so replaying the aof file later never extends the lifetime of the key
+func MakeExpireCmd(key string, expireAt time.Time) [][]byte {
+	return utils.ToCmdLine("PEXPIREAT", key, strconv.FormatInt(expireAt.UnixNano()/int64(time.Millisecond), 10))
+}
+
+// EntityToCmd serializes a data entity into the command line which recreates it
+func EntityToCmd(key string, entity *database.DataEntity) [][]byte {
+	if entity == nil {
+		return nil
+	}
+	switch val := entity.Data.(type) {
+	case []byte:
+		return utils.ToCmdLine2("SET", []byte(key), val)
+	case list.List:
+		return listToCmd(key, val)
+	case *set.Set:
+		return setToCmd(key, val)
+	case dict.Dict:
+		return hashToCmd(key, val)
+	case *sortedset.SortedSet:
+		return zSetToCmd(key, val)
+	}
+	return nil
+}
+
+func listToCmd(key string, l list.List) [][]byte {
+	args := make([][]byte, 0, 1+l.Len())
+	args = append(args, []byte(key))
+	l.ForEach(func(i int, val interface{}) bool {
+		args = append(args, val.([]byte))
+		return true
+	})
+	return utils.ToCmdLine2("RPUSH", args...)
+}
+
+func setToCmd(key string, s *set.Set) [][]byte {
+	args := make([][]byte, 0, 1+s.Len())
+	args = append(args, []byte(key))
+	s.ForEach(func(member string) bool {
+		args = append(args, []byte(member))
+		return true
+	})
+	return utils.ToCmdLine2("SADD", args...)
+}
+
+func hashToCmd(key string, hash dict.Dict) [][]byte {
+	args := make([][]byte, 0, 1+2*hash.Len())
+	args = append(args, []byte(key))
+	hash.Foreach(func(field string, val interface{}) bool {
+		args = append(args, []byte(field), val.([]byte))
+		return true
+	})
+	return utils.ToCmdLine2("HSET", args...)
+}
+
+func zSetToCmd(key string, zset *sortedset.SortedSet) [][]byte {
+	args := make([][]byte, 0, 1+2*zset.Len())
+	args = append(args, []byte(key))
+	zset.ForEachByRank(0, zset.Len(), false, func(element *sortedset.Element) bool {
+		// the shortest representation which parses back to the same float
+		args = append(args, []byte(strconv.FormatFloat(element.Score, 'f', -1, 64)), []byte(element.Member))
+		return true
+	})
+	return utils.ToCmdLine2("ZADD", args...)
+}
@@ -0,0 +1,57 @@
+package aof
+
+import (
+	"testing"
+	"time"
+
+	"go-redis/datastruct/dict"
+	"go-redis/datastruct/list"
+	"go-redis/datastruct/set"
+	"go-redis/datastruct/sortedset"
+	"go-redis/interface/database"
+	"go-redis/resp/reply"
+)
+
+func cmdString(cmdLine [][]byte) string {
+	return string(reply.MakeMultiBulkReply(cmdLine).ToBytes())
+}
+
+func assertCmd(t *testing.T, cmdLine [][]byte, expected ...string) {
+	t.Helper()
+	expectedCmd := make([][]byte, len(expected))
+	for i, arg := range expected {
+		expectedCmd[i] = []byte(arg)
+	}
+	if actual := cmdString(cmdLine); actual != cmdString(expectedCmd) {
+		t.Errorf("expected %q, got %q", cmdString(expectedCmd), actual)
+	}
+}
+
+func TestEntityToCmd(t *testing.T) {
+	assertCmd(t, EntityToCmd("s", &database.DataEntity{Data: []byte("v")}), "SET", "s", "v")
+
+	l := list.NewQuickList()
+	l.Add([]byte("a"))
+	l.Add([]byte("b"))
+	assertCmd(t, EntityToCmd("l", &database.DataEntity{Data: l}), "RPUSH", "l", "a", "b")
+
+	assertCmd(t, EntityToCmd("set", &database.DataEntity{Data: set.Make("2", "1")}), "SADD", "set", "1", "2")
+
+	h := dict.MakeSimpleDict()
+	h.Put("f", []byte("v"))
+	assertCmd(t, EntityToCmd("h", &database.DataEntity{Data: h}), "HSET", "h", "f", "v")
+
+	z := sortedset.Make()
+	z.Add("b", 0.1)
+	z.Add("a", 2)
+	assertCmd(t, EntityToCmd("z", &database.DataEntity{Data: z}), "ZADD", "z", "0.1", "b", "2", "a")
+
+	if EntityToCmd("nil", nil) != nil {
+		t.Error("expected no command for a nil entity")
+	}
+}
+
+func TestMakeExpireCmd(t *testing.T) {
+	expireAt := time.Unix(1700000000, 123456789)
+	assertCmd(t, MakeExpireCmd("k", expireAt), "PEXPIREAT", "k", "1700000000123")
+}
@@ -0,0 +1,225 @@
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"go-redis/config"
+	"go-redis/interface/database"
+	"go-redis/lib/logger"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+)
+
+// ErrRewriteInProgress is returned if a rewrite starts while another one is running
+var ErrRewriteInProgress = errors.New("ERR Background append only file rewriting already in progress")
+
+// rewriteCtx holds the state of a running rewrite
+type rewriteCtx struct {
+	tmpFile  *os.File
+	fileSize int64 // size of aof file when the rewrite started, the content before it is compacted
+}
+
+// Rewrite compacts aof file into the minimal commands recreating the current dataset.
+// Commands written during the rewrite are kept in rewriteBuffer and appended to the new file,
+// which then replaces the old one atomically
+func (handler *Handler) Rewrite() error {
+	ctx, err := handler.startRewrite()
+	if err != nil {
+		return err
+	}
+	return handler.rewrite(ctx)
+}
+
+// BGRewrite starts a rewrite in background, ErrRewriteInProgress is returned if a rewrite is running
+func (handler *Handler) BGRewrite() error {
+	ctx, err := handler.startRewrite()
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := handler.rewrite(ctx); err != nil {
+			logger.Error("aof rewrite failed: " + err.Error())
+		}
+	}()
+	return nil
+}
+
+func (handler *Handler) rewrite(ctx *rewriteCtx) error {
+	if err := handler.doRewrite(ctx); err != nil {
+		handler.abortRewrite(ctx)
+		return err
+	}
+	return handler.finishRewrite(ctx)
+}
+
+// IsRewriting tells whether a rewrite is running
+func (handler *Handler) IsRewriting() bool {
+	return handler.rewriting.Get()
+}
+
+// startRewrite records the size of aof file and starts buffering commands,
+// both happen while writing is paused so every command is either before the size or in the buffer
+func (handler *Handler) startRewrite() (*rewriteCtx, error) {
+	handler.pausingAof.Lock()
+	defer handler.pausingAof.Unlock()
+
+	if handler.rewriting.Get() {
+		return nil, ErrRewriteInProgress
+	}
+	if err := handler.aofFile.Sync(); err != nil {
+		return nil, err
+	}
+	info, err := handler.aofFile.Stat()
+	if err != nil {
+		return nil, err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(handler.aofFilename), "temp-rewriteaof-*.aof")
+	if err != nil {
+		return nil, err
+	}
+
+	handler.rewriteBuffer = make([]*payload, 0)
+	handler.rewriting.Set(true)
+	return &rewriteCtx{
+		tmpFile:  tmpFile,
+		fileSize: info.Size(),
+	}, nil
+}
+
+// doRewrite replays aof file before ctx.fileSize into a temporary database and dumps it into the temp file
+func (handler *Handler) doRewrite(ctx *rewriteCtx) error {
+	tmpDB := handler.tmpDBMaker()
+	defer func() {
+		_ = tmpDB.Close()
+	}()
+	handler.loadAof(tmpDB, ctx.fileSize)
+	return WriteDataset(ctx.tmpFile, tmpDB)
+}
+
+// WriteDataset writes the commands recreating the keys of db which are not expired
+func WriteDataset(w io.Writer, db database.DBEngine) error {
+	writer := bufio.NewWriter(w)
+	now := time.Now()
+	for i := 0; i < config.Properties.Databases; i++ {
+		var err error
+		written := false
+		db.ForEach(i, func(key string, entity *database.DataEntity, expiration *time.Time) bool {
+			if expiration != nil && expiration.Before(now) {
+				return true
+			}
+			if !written {
+				// select db only if it is not empty
+				_, err = writer.Write(reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(i))).ToBytes())
+				if err != nil {
+					return false
+				}
+				written = true
+			}
+			cmd := EntityToCmd(key, entity)
+			if cmd == nil {
+				return true
+			}
+			if _, err = writer.Write(reply.MakeMultiBulkReply(cmd).ToBytes()); err != nil {
+				return false
+			}
+			if expiration != nil {
+				_, err = writer.Write(reply.MakeMultiBulkReply(MakeExpireCmd(key, *expiration)).ToBytes())
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return writer.Flush()
+}
+
+// finishRewrite appends the buffered commands to the temp file and replaces aof file with it
+func (handler *Handler) finishRewrite(ctx *rewriteCtx) error {
+	handler.pausingAof.Lock()
+	defer handler.pausingAof.Unlock()
+
+	writer := bufio.NewWriter(ctx.tmpFile)
+	currentDB := -1
+	for _, p := range handler.rewriteBuffer {
+		if p.dbIndex != currentDB {
+			data := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(p.dbIndex))).ToBytes()
+			if _, err := writer.Write(data); err != nil {
+				handler.abortRewrite0(ctx)
+				return err
+			}
+			currentDB = p.dbIndex
+		}
+		for _, cmdLine := range p.cmdLines {
+			if _, err := writer.Write(reply.MakeMultiBulkReply(cmdLine).ToBytes()); err != nil {
+				handler.abortRewrite0(ctx)
+				return err
+			}
+		}
+	}
+	if currentDB == -1 {
+		// the dump may end with any db, make later commands start from a known one
+		data := reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", "0")).ToBytes()
+		if _, err := writer.Write(data); err != nil {
+			handler.abortRewrite0(ctx)
+			return err
+		}
+		currentDB = 0
+	}
+	if err := writer.Flush(); err != nil {
+		handler.abortRewrite0(ctx)
+		return err
+	}
+	if err := ctx.tmpFile.Sync(); err != nil {
+		handler.abortRewrite0(ctx)
+		return err
+	}
+	_ = ctx.tmpFile.Close()
+
+	// replace aof file
+	if err := os.Rename(ctx.tmpFile.Name(), handler.aofFilename); err != nil {
+		handler.abortRewrite0(ctx)
+		return err
+	}
+	_ = handler.aofFile.Close()
+	aofFile, err := os.OpenFile(handler.aofFilename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		// nothing else can be done, aof file is lost until restart
+		panic(err)
+	}
+	handler.aofFile = aofFile
+	handler.currentDB = currentDB
+	if info, err := aofFile.Stat(); err == nil {
+		handler.aofBaseSize = info.Size()
+		handler.aofCurrentSize = info.Size()
+	}
+	// the new file was flushed before the rename
+	handler.lastFsync = time.Now()
+	handler.pendingSince = time.Time{}
+
+	handler.rewriteBuffer = nil
+	handler.rewriting.Set(false)
+	logger.Info("aof rewrite finished")
+	return nil
+}
+
+// abortRewrite discards a failed rewrite
+func (handler *Handler) abortRewrite(ctx *rewriteCtx) {
+	handler.pausingAof.Lock()
+	defer handler.pausingAof.Unlock()
+	handler.abortRewrite0(ctx)
+}
+
+// abortRewrite0 discards a failed rewrite, the caller holds pausingAof
+func (handler *Handler) abortRewrite0(ctx *rewriteCtx) {
+	_ = ctx.tmpFile.Close()
+	_ = os.Remove(ctx.tmpFile.Name())
+	handler.rewriteBuffer = nil
+	handler.rewriting.Set(false)
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 
+	"go-redis/acl"
+	"go-redis/config"
 	"go-redis/resp/client"
 
 	pool "github.com/jolestar/go-commons-pool/v2"
@@ -18,7 +20,10 @@ type connectionFactory struct {
 }
 
 func (cf connectionFactory) MakeObject(ctx context.Context) (*pool.PooledObject, error) {
-	redisClient, err := client.MakeClient(cf.Peer)
+	// nodes of a cluster share requirePass, each connection authenticates once as the cluster user, reconnections included
+	redisClient, err := client.MakeAuthClient(cf.Peer, func() (string, string) {
+		return acl.ClusterUser, config.Snapshot().RequirePass
+	})
 	if err != nil {
 		return nil, err
 	}
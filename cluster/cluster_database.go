@@ -2,9 +2,17 @@ package cluster
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"net"
 	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
+	"go-redis/acl"
 	"go-redis/config"
 	"go-redis/interface/database"
 	"go-redis/interface/resp"
@@ -23,26 +31,47 @@ type Database struct {
 	// self name
 	self string
 
-	// cluster nodes
-	nodes []string
-
 	// node selector
 	peerPicker *consistenthash.NodeMap
 
 	// connection pool
+	peerMu         sync.RWMutex
 	peerConnection map[string]*pool.ObjectPool
 
+	// slots served by each node, nil unless clusterMode is "slots"
+	slots *slotTable
+
+	// other nodes known by gossip, by address, and the nodes forgotten recently
+	membersMu  sync.RWMutex
+	members    map[string]*member
+	forgotten  map[string]time.Time
+	gossipStop chan struct{}
+	gossipDone chan struct{}
+
+	// parts of transactions spanning nodes executed by the current node, by id
+	txMu         sync.Mutex
+	transactions map[string]*transaction
+
 	// inner db
-	db database.Database
+	db database.DBEngine
 }
 
 // MakeClusterDatabase creates a cluster database
 func MakeClusterDatabase() *Database {
+	self := config.Properties.Self
+	if self == "" {
+		self = net.JoinHostPort(config.Properties.Bind, strconv.Itoa(config.Properties.Port))
+	}
 	cluster := &Database{
-		self:           config.Properties.Self,
+		self:           self,
 		db:             database2.NewStandaloneDatabase(),
-		peerPicker:     consistenthash.NewNodeMap(nil),
+		peerPicker:     consistenthash.NewNodeMap(config.Properties.PeerReplicas, nil),
 		peerConnection: make(map[string]*pool.ObjectPool),
+		members:        make(map[string]*member),
+		forgotten:      make(map[string]time.Time),
+		gossipStop:     make(chan struct{}),
+		gossipDone:     make(chan struct{}),
+		transactions:   make(map[string]*transaction),
 	}
 
 	// nodes
@@ -50,23 +79,135 @@ func MakeClusterDatabase() *Database {
 	for _, peer := range config.Properties.Peers {
 		nodes = append(nodes, peer)
 	}
-	nodes = append(nodes, config.Properties.Self)
-	cluster.nodes = nodes
+	nodes = append(nodes, cluster.self)
+
+	switch config.Properties.ClusterMode {
+	case "", "relay":
+	case "slots":
+		slots, err := loadSlotTable(config.Properties.ClusterConfigFile, cluster.self, nodes)
+		if err != nil {
+			panic("load cluster config file: " + err.Error())
+		}
+		cluster.slots = slots
+		// nodes met at runtime are recorded in the cluster config file
+		for _, node := range slots.sortedNodes() {
+			nodes = append(nodes, node.addr)
+		}
+	default:
+		panic("unknown clusterMode " + config.Properties.ClusterMode + ", expected relay or slots")
+	}
 
 	// peerPicker
-	cluster.peerPicker.AddNode(nodes...)
+	if cluster.slots == nil {
+		for _, node := range nodes {
+			cluster.peerPicker.AddWeightedNode(node, peerWeight(node))
+		}
+		if cluster.peerPicker.IsEmpty() {
+			panic("every node has weight 0, no node serves keys")
+		}
+		logDistribution(cluster.peerPicker)
+	}
 
 	// node pool
-	ctx := context.Background()
-	for _, peer := range config.Properties.Peers {
-		cluster.peerConnection[peer] = pool.NewObjectPoolWithDefaultConfig(ctx, &connectionFactory{
-			Peer: peer,
-		})
+	for _, node := range nodes {
+		cluster.addMember(node)
 	}
 
+	cluster.startGossip()
 	return cluster
 }
 
+// peerWeight returns the weight of the node in relay mode
+func peerWeight(node string) int {
+	weight, ok := config.Properties.PeerWeights[node]
+	if !ok {
+		weight = 1
+	}
+	if weight < 0 {
+		panic("negative weight of peer " + node)
+	}
+	return weight
+}
+
+// addPeer starts relaying commands to the node
+func (cdb *Database) addPeer(peer string) {
+	cdb.peerMu.Lock()
+	cdb.peerConnection[peer] = pool.NewObjectPoolWithDefaultConfig(context.Background(), &connectionFactory{
+		Peer: peer,
+	})
+	cdb.peerMu.Unlock()
+
+	if cdb.slots != nil {
+		cdb.slots.mu.Lock()
+		_, ok := cdb.slots.nodes[peer]
+		if !ok {
+			cdb.slots.nodes[peer] = makeClusterNode(peer)
+		}
+		cdb.slots.mu.Unlock()
+		if !ok {
+			if err := cdb.slots.save(config.Properties.ClusterConfigFile, cdb.self); err != nil {
+				logger.Error("save cluster config file: " + err.Error())
+			}
+		}
+		return
+	}
+	if _, ok := cdb.peerPicker.Nodes()[peer]; !ok {
+		cdb.peerPicker.AddWeightedNode(peer, peerWeight(peer))
+		logDistribution(cdb.peerPicker)
+	}
+}
+
+// removePeer stops relaying commands to the node, a node still serving slots can not be removed
+func (cdb *Database) removePeer(peer string) error {
+	if cdb.slots != nil {
+		cdb.slots.mu.Lock()
+		for slot := 0; slot < slotCount; slot++ {
+			if cdb.slots.owners[slot] == peer {
+				cdb.slots.mu.Unlock()
+				return errors.New("ERR Can't forget a node still serving hash slot " + strconv.Itoa(slot))
+			}
+		}
+		for _, moving := range []map[int]string{cdb.slots.migrating, cdb.slots.importing} {
+			for slot, addr := range moving {
+				if addr == peer {
+					cdb.slots.mu.Unlock()
+					return errors.New("ERR Can't forget a node hash slot " + strconv.Itoa(slot) + " is moving with")
+				}
+			}
+		}
+		delete(cdb.slots.nodes, peer)
+		cdb.slots.mu.Unlock()
+		if err := cdb.slots.save(config.Properties.ClusterConfigFile, cdb.self); err != nil {
+			logger.Error("save cluster config file: " + err.Error())
+		}
+	} else {
+		cdb.peerPicker.RemoveNode(peer)
+		logDistribution(cdb.peerPicker)
+	}
+
+	cdb.peerMu.Lock()
+	p := cdb.peerConnection[peer]
+	delete(cdb.peerConnection, peer)
+	cdb.peerMu.Unlock()
+	if p != nil {
+		go p.Close(context.Background())
+	}
+	return nil
+}
+
+// logDistribution logs the share of keys each node is expected to serve
+func logDistribution(picker *consistenthash.NodeMap) {
+	shares := picker.Distribution()
+	nodes := make([]string, 0, len(shares))
+	for node := range shares {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		logger.Info(fmt.Sprintf("node %s serves %.1f%% of keys", node, shares[node]*100))
+	}
+}
+
 var router = makeRouter()
 
 func (cdb *Database) Exec(c resp.Connection, args [][]byte) (result resp.Reply) {
@@ -78,8 +219,23 @@ func (cdb *Database) Exec(c resp.Connection, args [][]byte) (result resp.Reply)
 		}
 	}()
 
+	cmdName := strings.ToLower(string(args[0]))
+	if internalCommands[cmdName] && !isClusterNode(c) {
+		return reply.MakeStandardErrReply("NOPERM this user has no permissions to run the '" + cmdName + "' command")
+	}
+
+	// a subscriber is served by the current node only, which rejects commands not allowed to subscribers
+	if c.SubsCount() > 0 {
+		return cdb.db.Exec(c, args)
+	}
+
+	// clients are redirected to the node serving the keys instead of relaying
+	if cdb.slots != nil {
+		return cdb.execWithSlots(c, args)
+	}
+
 	// get command func
-	cmdFunc, ok := router[strings.ToLower(string(args[0]))]
+	cmdFunc, ok := router[cmdName]
 	if !ok {
 		return reply.MakeStandardErrReply("ERR command unsupported: " + string(args[0]))
 	}
@@ -88,7 +244,27 @@ func (cdb *Database) Exec(c resp.Connection, args [][]byte) (result resp.Reply)
 	return
 }
 
+// internalCommands are sent by the nodes of the cluster to each other, clients can not run them
+var internalCommands = map[string]bool{
+	relayPublish: true,
+	prepareCmd:   true,
+	commitCmd:    true,
+	rollbackCmd:  true,
+	releaseCmd:   true,
+}
+
+// isClusterNode tells whether the client may be another node of the cluster, nodes authenticate as the ClusterUser
+// with requirePass. Without requirePass nodes do not authenticate, so clients which did not either are trusted.
+func isClusterNode(c resp.Connection) bool {
+	user := c.GetUser()
+	if config.Snapshot().RequirePass == "" {
+		return user == "" || user == acl.DefaultUser
+	}
+	return user == acl.ClusterUser
+}
+
 func (cdb *Database) Close() error {
+	cdb.stopGossip()
 	return cdb.db.Close()
 }
 
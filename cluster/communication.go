@@ -13,7 +13,9 @@ import (
 
 // getPeerClient gets a connection client from pool
 func (cdb *Database) getPeerClient(peer string) (*client.Client, error) {
+	cdb.peerMu.RLock()
 	pool, ok := cdb.peerConnection[peer]
+	cdb.peerMu.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("connection not found")
 	}
@@ -32,7 +34,9 @@ func (cdb *Database) getPeerClient(peer string) (*client.Client, error) {
 
 // returnPeerClient sends connection client back to pool
 func (cdb *Database) returnPeerClient(peer string, c *client.Client) error {
+	cdb.peerMu.RLock()
 	pool, ok := cdb.peerConnection[peer]
+	cdb.peerMu.RUnlock()
 	if !ok {
 		return fmt.Errorf("connection not found")
 	}
@@ -48,6 +52,11 @@ func (cdb *Database) relay(peer string, c resp.Connection, args [][]byte) resp.R
 		return cdb.db.Exec(c, args)
 	}
 
+	// fail fast rather than waiting for the connection to a failing node to time out
+	if cdb.isFailing(peer) {
+		return reply.MakeStandardErrReply("CLUSTERDOWN node " + peer + " is failing")
+	}
+
 	// call peer node
 	peerClient, err := cdb.getPeerClient(peer)
 	if err != nil {
@@ -68,7 +77,7 @@ func (cdb *Database) relay(peer string, c resp.Connection, args [][]byte) resp.R
 func (cdb *Database) broadcast(c resp.Connection, args [][]byte) map[string]resp.Reply {
 	res := make(map[string]resp.Reply)
 
-	for _, node := range cdb.nodes {
+	for _, node := range cdb.nodeAddrs() {
 		result := cdb.relay(node, c, args)
 		res[node] = result
 	}
@@ -5,28 +5,37 @@ import (
 	"go-redis/resp/reply"
 )
 
+// delFunc deletes the keys of every node, replies the total number of keys deleted
+// DEL k1 [k2 ...]
 func delFunc(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
-	replies := cdb.broadcast(c, cmdArgs)
+	return sumPerNode(cdb, c, cmdArgs)
+}
+
+// existsFunc counts the existing keys of every node
+// EXISTS k1 [k2 ...]
+func existsFunc(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	return sumPerNode(cdb, c, cmdArgs)
+}
 
-	var delCount int64 = 0
+// sumPerNode relays the keys of the command to their nodes and sums the integer replies
+func sumPerNode(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	if len(cmdArgs) < 2 {
+		return reply.MakeArgNumErrReply(string(cmdArgs[0]))
+	}
+	groups := cdb.groupByNode(cmdArgs[1:])
+	replies := cdb.relayGroups(c, cmdArgs[0], groups)
 
-	var errReply reply.ErrorReply
-	for _, r := range replies {
+	var sum int64
+	for _, group := range groups {
+		r := replies[group.node]
 		if reply.IsErrReply(r) {
-			errReply = r.(reply.ErrorReply)
-			break
+			return r
 		}
 		intReply, ok := r.(*reply.IntReply)
 		if !ok {
-			errReply = reply.MakeStandardErrReply("error")
-			break
+			return reply.MakeStandardErrReply("ERR bad reply of " + group.node)
 		}
-		delCount += intReply.Code
-	}
-
-	if errReply != nil {
-		return reply.MakeStandardErrReply("error: " + errReply.Error())
+		sum += intReply.Code
 	}
-	
-	return reply.MakeIntReply(delCount)
+	return reply.MakeIntReply(sum)
 }
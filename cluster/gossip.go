@@ -0,0 +1,564 @@
+package cluster
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/lib/logger"
+	"go-redis/lib/sync/atomic"
+	"go-redis/lib/utils"
+	"go-redis/resp/parser"
+	"go-redis/resp/reply"
+
+	"go-redis/tcp"
+)
+
+// Nodes watch each other over the cluster bus, which listens on the client port + 10000 like redis cluster.
+// Every second a node pings each node it knows, pings and the pongs replying them carry the state
+// the sender sees of every node, so nodes learn about each other by gossip:
+//
+//	PING <sender> [<node> <flags> ...]    replied by PONG <sender> [<node> <flags> ...]
+//	MEET <sender> [<node> <flags> ...]    the same as PING, the receiver adds the sender if unknown
+//	FAIL <sender> <node>                  the node is failing
+//	AUTH <password>                       sent first on every connection with requirePass
+//
+// The nodes of a cluster share requirePass, with requirePass a connection must authenticate before sending
+// any other message, a node sending a wrong password or no password is disconnected.
+//
+// A node not replying within clusterNodeTimeout is PFAIL (possibly failing) for the node pinging it,
+// it becomes FAIL once a majority of the nodes report it failing, the node seeing the majority
+// broadcasts FAIL to the others. A failing node recovers as soon as it replies a ping.
+
+const (
+	busPortOffset  = 10000
+	gossipInterval = time.Second
+	// forgetBanTime is how long a node removed by CLUSTER FORGET is not added back by gossip
+	forgetBanTime = time.Minute
+
+	busPing = "ping"
+	busPong = "pong"
+	busMeet = "meet"
+	busFail = "fail"
+	busAuth = "auth"
+
+	flagNone  = "-"
+	flagPFail = "pfail"
+	flagFail  = "fail"
+)
+
+// member is another node of the cluster as seen by the current node
+type member struct {
+	addr string
+	// met is false until the node replied MEET, which adds the current node to the members of the node
+	met          bool
+	pfail        bool
+	fail         bool
+	pingSent     time.Time // time of the oldest ping not replied yet, zero if none
+	pongReceived time.Time
+	pinging      bool
+	// failReports records when each other node last reported the node failing
+	failReports map[string]time.Time
+	link        *busLink
+}
+
+func makeMember(addr string) *member {
+	return &member{
+		addr:        addr,
+		failReports: make(map[string]time.Time),
+		link:        &busLink{addr: busAddr(addr)},
+	}
+}
+
+// flags returns the state of the node sent in gossip
+func (m *member) flags() string {
+	switch {
+	case m.fail:
+		return flagFail
+	case m.pfail:
+		return flagPFail
+	}
+	return flagNone
+}
+
+// busAddr returns the address of the cluster bus of the node
+func busAddr(addr string) string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	p, _ := strconv.Atoi(port)
+	return net.JoinHostPort(host, strconv.Itoa(p+busPortOffset))
+}
+
+func nodeTimeout() time.Duration {
+	return time.Duration(config.Snapshot().ClusterNodeTimeout) * time.Millisecond
+}
+
+// busLink is the connection sending messages to the cluster bus of a node, one message at a time
+type busLink struct {
+	addr    string
+	mu      sync.Mutex
+	conn    net.Conn
+	replies <-chan *parser.Payload
+}
+
+// send sends the message and waits for the reply, the connection is dropped on any error
+func (l *busLink) send(args [][]byte, timeout time.Duration) (resp.Reply, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conn == nil {
+		if err := l.connect(timeout); err != nil {
+			return nil, err
+		}
+	}
+	return l.exchange(args, timeout)
+}
+
+// connect dials the node and authenticates with requirePass if any, the caller holds mu
+func (l *busLink) connect(timeout time.Duration) error {
+	conn, err := net.DialTimeout("tcp", l.addr, timeout)
+	if err != nil {
+		return err
+	}
+	l.conn = conn
+	l.replies = parser.ParseStream(conn)
+	password := config.Snapshot().RequirePass
+	if password == "" {
+		return nil
+	}
+	r, err := l.exchange(utils.ToCmdLine(busAuth, password), timeout)
+	if err != nil {
+		return err
+	}
+	if ret := string(r.ToBytes()); ret != "+OK\r\n" {
+		l.closeLocked()
+		return errors.New("cluster bus authentication failed: " + strings.TrimSpace(ret))
+	}
+	return nil
+}
+
+// exchange sends the message on the connection and waits for the reply, the caller holds mu
+func (l *busLink) exchange(args [][]byte, timeout time.Duration) (resp.Reply, error) {
+	_ = l.conn.SetWriteDeadline(time.Now().Add(timeout))
+	if _, err := l.conn.Write(reply.MakeMultiBulkReply(args).ToBytes()); err != nil {
+		l.closeLocked()
+		return nil, err
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case payload, ok := <-l.replies:
+		if !ok {
+			l.closeLocked()
+			return nil, errors.New("connection closed")
+		}
+		if payload.Err != nil {
+			l.closeLocked()
+			return nil, payload.Err
+		}
+		return payload.Data, nil
+	case <-timer.C:
+		l.closeLocked()
+		return nil, errors.New("timeout")
+	}
+}
+
+func (l *busLink) connected() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.conn != nil
+}
+
+func (l *busLink) close() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closeLocked()
+}
+
+func (l *busLink) closeLocked() {
+	if l.conn == nil {
+		return
+	}
+	_ = l.conn.Close()
+	// the parser stops once it reports the closed connection
+	go func(replies <-chan *parser.Payload) {
+		for range replies {
+		}
+	}(l.replies)
+	l.conn = nil
+	l.replies = nil
+}
+
+// startGossip serves the cluster bus and starts pinging the other nodes
+func (cdb *Database) startGossip() {
+	addr := net.JoinHostPort(config.Properties.Bind, strconv.Itoa(config.Properties.Port+busPortOffset))
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		panic("listen cluster bus: " + err.Error())
+	}
+	logger.Info("cluster bus listens on", addr)
+	go tcp.ListenAndServe(listener, &busHandler{cdb: cdb}, cdb.gossipStop)
+
+	go func() {
+		ticker := time.NewTicker(gossipInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				cdb.gossipCron()
+			case <-cdb.gossipDone:
+				return
+			}
+		}
+	}()
+}
+
+// stopGossip stops the cluster bus and closes the links to other nodes
+func (cdb *Database) stopGossip() {
+	close(cdb.gossipStop)
+	close(cdb.gossipDone)
+	cdb.membersMu.Lock()
+	defer cdb.membersMu.Unlock()
+	for _, m := range cdb.members {
+		m.link.close()
+	}
+}
+
+// gossipCron pings every node and marks nodes not replying for clusterNodeTimeout as PFAIL
+func (cdb *Database) gossipCron() {
+	now := time.Now()
+	cdb.membersMu.Lock()
+	defer cdb.membersMu.Unlock()
+	for addr, until := range cdb.forgotten {
+		if now.After(until) {
+			delete(cdb.forgotten, addr)
+		}
+	}
+	for _, m := range cdb.members {
+		if !m.pingSent.IsZero() && now.Sub(m.pingSent) > nodeTimeout() && !m.pfail {
+			m.pfail = true
+			logger.Info("node " + m.addr + " is not reachable, marked as PFAIL")
+		}
+		cdb.checkFail(m)
+		if !m.pinging {
+			m.pinging = true
+			if m.pingSent.IsZero() {
+				m.pingSent = now
+			}
+			go cdb.ping(m)
+		}
+	}
+}
+
+// ping sends PING, or MEET if the node has not met the current node yet, and processes the gossip of the pong
+func (cdb *Database) ping(m *member) {
+	cdb.membersMu.Lock()
+	msg := busPing
+	if !m.met {
+		msg = busMeet
+	}
+	args := cdb.gossipArgs(msg)
+	cdb.membersMu.Unlock()
+
+	timeout := nodeTimeout() / 2
+	if timeout > gossipInterval {
+		timeout = gossipInterval
+	}
+	r, err := m.link.send(args, timeout)
+
+	cdb.membersMu.Lock()
+	defer cdb.membersMu.Unlock()
+	m.pinging = false
+	if err != nil {
+		return
+	}
+	pong, ok := r.(*reply.MultiBulkReply)
+	if !ok || len(pong.Args) < 2 || strings.ToLower(string(pong.Args[0])) != busPong {
+		if reply.IsErrReply(r) && m.met {
+			// the node lost the current node, e.g. it restarted without it in its peers
+			logger.Info("node " + m.addr + " rejected " + msg + ", meeting it again")
+			m.met = false
+		}
+		return
+	}
+	if cdb.members[m.addr] != m {
+		// forgotten meanwhile
+		return
+	}
+	m.met = true
+	m.pingSent = time.Time{}
+	m.pongReceived = time.Now()
+	if m.pfail || m.fail {
+		m.pfail, m.fail = false, false
+		m.failReports = make(map[string]time.Time)
+		logger.Info("node " + m.addr + " is reachable again")
+	}
+	cdb.processGossip(m.addr, pong.Args[2:])
+}
+
+// gossipArgs builds a message carrying the state of every node, the caller holds membersMu
+func (cdb *Database) gossipArgs(msg string) [][]byte {
+	args := make([][]byte, 0, 2+2*len(cdb.members))
+	args = append(args, []byte(msg), []byte(cdb.self))
+	for _, m := range cdb.members {
+		args = append(args, []byte(m.addr), []byte(m.flags()))
+	}
+	return args
+}
+
+// processGossip updates the nodes from the state the sender sees, unknown nodes are added,
+// the caller holds membersMu
+func (cdb *Database) processGossip(sender string, gossip [][]byte) {
+	now := time.Now()
+	for i := 0; i+1 < len(gossip); i += 2 {
+		addr, flags := string(gossip[i]), string(gossip[i+1])
+		if addr == cdb.self || addr == sender {
+			continue
+		}
+		m, ok := cdb.members[addr]
+		if !ok {
+			if flags == flagFail || !cdb.addMember(addr) {
+				continue
+			}
+			logger.Info("node " + sender + " introduced node " + addr)
+			m = cdb.members[addr]
+		}
+		if flags == flagPFail || flags == flagFail {
+			m.failReports[sender] = now
+		} else {
+			delete(m.failReports, sender)
+		}
+		cdb.checkFail(m)
+	}
+}
+
+// checkFail marks the PFAIL node as FAIL if a majority of the nodes see it failing,
+// then tells every node, the caller holds membersMu
+func (cdb *Database) checkFail(m *member) {
+	if !m.pfail || m.fail {
+		return
+	}
+	now := time.Now()
+	reports := 1 // the current node
+	for reporter, reportTime := range m.failReports {
+		if now.Sub(reportTime) > 2*nodeTimeout() {
+			delete(m.failReports, reporter)
+			continue
+		}
+		reports++
+	}
+	// majority of all nodes including the current one
+	if reports < (len(cdb.members)+1)/2+1 {
+		return
+	}
+	cdb.markFail(m)
+	args := utils.ToCmdLine(busFail, cdb.self, m.addr)
+	for _, other := range cdb.members {
+		if other != m && !other.fail {
+			go func(link *busLink) {
+				_, _ = link.send(args, gossipInterval)
+			}(other.link)
+		}
+	}
+}
+
+// markFail marks the node as FAIL, relaying to it fails fast until it recovers, the caller holds membersMu
+func (cdb *Database) markFail(m *member) {
+	m.pfail, m.fail = true, true
+	logger.Info("node " + m.addr + " is failing, marked as FAIL")
+	cdb.peerMu.RLock()
+	defer cdb.peerMu.RUnlock()
+	if p, ok := cdb.peerConnection[m.addr]; ok {
+		// the pooled connections are broken
+		p.Clear(context.Background())
+	}
+}
+
+// addMember adds the node unless it is forgotten recently, the caller holds membersMu
+func (cdb *Database) addMember(addr string) bool {
+	if addr == cdb.self {
+		return false
+	}
+	if _, ok := cdb.members[addr]; ok {
+		return true
+	}
+	if _, ok := cdb.forgotten[addr]; ok {
+		return false
+	}
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		return false
+	}
+	cdb.members[addr] = makeMember(addr)
+	cdb.addPeer(addr)
+	return true
+}
+
+// isFailing tells whether the node is marked as FAIL
+func (cdb *Database) isFailing(addr string) bool {
+	cdb.membersMu.RLock()
+	defer cdb.membersMu.RUnlock()
+	m, ok := cdb.members[addr]
+	return ok && m.fail
+}
+
+// nodeAddrs returns the addresses of all nodes including the current one, in order
+func (cdb *Database) nodeAddrs() []string {
+	cdb.membersMu.RLock()
+	defer cdb.membersMu.RUnlock()
+	addrs := make([]string, 0, len(cdb.members)+1)
+	addrs = append(addrs, cdb.self)
+	for addr := range cdb.members {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	return addrs
+}
+
+// clusterMeet CLUSTER MEET ip port, the node is met by the next ping
+func clusterMeet(cdb *Database, args [][]byte) resp.Reply {
+	port, err := strconv.Atoi(string(args[1]))
+	if err != nil || port <= 0 || port+busPortOffset > 65535 {
+		return reply.MakeStandardErrReply("ERR Invalid base port specified: " + string(args[1]))
+	}
+	if net.ParseIP(string(args[0])) == nil {
+		return reply.MakeStandardErrReply("ERR Invalid node address specified: " +
+			string(args[0]) + ":" + string(args[1]))
+	}
+	addr := net.JoinHostPort(string(args[0]), strconv.Itoa(port))
+	cdb.membersMu.Lock()
+	defer cdb.membersMu.Unlock()
+	// meeting a node again is explicit, so it is no longer banned
+	delete(cdb.forgotten, addr)
+	cdb.addMember(addr)
+	return reply.MakeOKReply()
+}
+
+// clusterForget CLUSTER FORGET node-id, gossip does not add the node back for a minute
+func clusterForget(cdb *Database, id string) resp.Reply {
+	cdb.membersMu.Lock()
+	defer cdb.membersMu.Unlock()
+	if id == makeClusterNode(cdb.self).id {
+		return reply.MakeStandardErrReply("ERR I tried hard but I can't forget myself...")
+	}
+	var m *member
+	for _, candidate := range cdb.members {
+		if makeClusterNode(candidate.addr).id == id {
+			m = candidate
+			break
+		}
+	}
+	if m == nil {
+		return reply.MakeStandardErrReply("ERR Unknown node " + id)
+	}
+	if err := cdb.removePeer(m.addr); err != nil {
+		return reply.MakeStandardErrReply(err.Error())
+	}
+	delete(cdb.members, m.addr)
+	cdb.forgotten[m.addr] = time.Now().Add(forgetBanTime)
+	m.link.close()
+	for _, other := range cdb.members {
+		delete(other.failReports, m.addr)
+	}
+	return reply.MakeOKReply()
+}
+
+// busHandler serves the messages other nodes send to the cluster bus
+type busHandler struct {
+	cdb        *Database
+	activeConn sync.Map
+	closing    atomic.Boolean
+}
+
+func (h *busHandler) Handle(ctx context.Context, conn net.Conn) {
+	if h.closing.Get() {
+		_ = conn.Close()
+		return
+	}
+	h.activeConn.Store(conn, struct{}{})
+	defer func() {
+		h.activeConn.Delete(conn)
+		_ = conn.Close()
+	}()
+	authenticated := false
+	for payload := range parser.ParseStream(conn) {
+		if payload.Err != nil {
+			// the parser closes the channel on io errors
+			continue
+		}
+		msg, ok := payload.Data.(*reply.MultiBulkReply)
+		if !ok || len(msg.Args) < 2 {
+			_, _ = conn.Write(reply.MakeStandardErrReply("ERR invalid cluster bus message").ToBytes())
+			continue
+		}
+		password := config.Snapshot().RequirePass
+		if strings.ToLower(string(msg.Args[0])) == busAuth {
+			if password == "" || subtle.ConstantTimeCompare(msg.Args[1], []byte(password)) != 1 {
+				logger.Warn("cluster bus: wrong password of " + conn.RemoteAddr().String())
+				_, _ = conn.Write(reply.MakeStandardErrReply("WRONGPASS invalid password").ToBytes())
+				return
+			}
+			authenticated = true
+			if _, err := conn.Write(reply.MakeOKReply().ToBytes()); err != nil {
+				return
+			}
+			continue
+		}
+		if password != "" && !authenticated {
+			logger.Warn("cluster bus: unauthenticated message of " + conn.RemoteAddr().String())
+			_, _ = conn.Write(reply.MakeStandardErrReply("NOAUTH Authentication required.").ToBytes())
+			return
+		}
+		if _, err := conn.Write(h.cdb.handleBusMessage(msg.Args).ToBytes()); err != nil {
+			return
+		}
+	}
+}
+
+func (h *busHandler) Close() error {
+	h.closing.Set(true)
+	h.activeConn.Range(func(key, _ interface{}) bool {
+		_ = key.(net.Conn).Close()
+		return true
+	})
+	return nil
+}
+
+// handleBusMessage handles a message from another node
+func (cdb *Database) handleBusMessage(args [][]byte) resp.Reply {
+	msg, sender := strings.ToLower(string(args[0])), string(args[1])
+	cdb.membersMu.Lock()
+	defer cdb.membersMu.Unlock()
+	switch msg {
+	case busMeet, busPing:
+		if msg == busMeet && cdb.addMember(sender) {
+			if m := cdb.members[sender]; !m.met {
+				logger.Info("met node " + sender)
+				// the sender knows the current node already
+				m.met = true
+			}
+		}
+		if _, ok := cdb.members[sender]; !ok {
+			return reply.MakeStandardErrReply("ERR unknown node " + sender + ", send MEET first")
+		}
+		cdb.processGossip(sender, args[2:])
+		return reply.MakeMultiBulkReply(cdb.gossipArgs(busPong))
+	case busFail:
+		if len(args) != 3 {
+			return reply.MakeArgNumErrReply(msg)
+		}
+		if m, ok := cdb.members[string(args[2])]; ok && !m.fail {
+			cdb.markFail(m)
+		}
+		return reply.MakeOKReply()
+	}
+	return reply.MakeStandardErrReply("ERR unknown cluster bus message " + msg)
+}
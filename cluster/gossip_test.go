@@ -0,0 +1,245 @@
+package cluster
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"go-redis/config"
+	"go-redis/lib/consistenthash"
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+	"go-redis/resp/reply"
+
+	pool "github.com/jolestar/go-commons-pool/v2"
+)
+
+// newGossipDatabase makes the node self knowing the members, the members are not dialed unless pinged
+func newGossipDatabase(t *testing.T, self string, members ...string) *Database {
+	t.Helper()
+	former := config.Properties
+	config.Properties = &config.ServerProperties{ClusterNodeTimeout: 100}
+	t.Cleanup(func() {
+		config.Properties = former
+	})
+	cdb := &Database{
+		self:           self,
+		peerPicker:     consistenthash.NewNodeMap(0, nil),
+		peerConnection: make(map[string]*pool.ObjectPool),
+		members:        make(map[string]*member),
+		forgotten:      make(map[string]time.Time),
+	}
+	cdb.peerPicker.AddNode(self)
+	cdb.membersMu.Lock()
+	for _, addr := range members {
+		cdb.addMember(addr)
+	}
+	cdb.membersMu.Unlock()
+	return cdb
+}
+
+func busMessage(cdb *Database, args ...string) string {
+	return string(cdb.handleBusMessage(utils.ToCmdLine(args...)).ToBytes())
+}
+
+func TestBusMeet(t *testing.T) {
+	cdb := newGossipDatabase(t, "127.0.0.1:7001")
+	assertReply(t, busMessage(cdb, "PING", "127.0.0.1:7002"),
+		"-ERR unknown node 127.0.0.1:7002, send MEET first\r\n")
+	assertReply(t, busMessage(cdb, "HELLO", "127.0.0.1:7002"),
+		"-ERR unknown cluster bus message hello\r\n")
+
+	// the sender introduces the nodes it knows, except the failing ones
+	pong := busMessage(cdb, "MEET", "127.0.0.1:7002", "127.0.0.1:7003", flagNone, "127.0.0.1:7004", flagFail)
+	if !strings.Contains(pong, "pong") || !strings.Contains(pong, "127.0.0.1:7001") {
+		t.Errorf("expected a pong of the node, got %q", pong)
+	}
+	assertReply(t, strings.Join(cdb.nodeAddrs(), ","), "127.0.0.1:7001,127.0.0.1:7002,127.0.0.1:7003")
+	if !cdb.members["127.0.0.1:7002"].met || cdb.members["127.0.0.1:7003"].met {
+		t.Error("expected the sender met only")
+	}
+	if _, ok := cdb.peerPicker.Nodes()["127.0.0.1:7003"]; !ok {
+		t.Error("expected keys relayed to the introduced node")
+	}
+	// a pong carries the sender and the state of each node it knows
+	pong = busMessage(cdb, "PING", "127.0.0.1:7002")
+	if !strings.HasPrefix(pong, "*6\r\n$4\r\npong\r\n$14\r\n127.0.0.1:7001\r\n") ||
+		!strings.Contains(pong, "127.0.0.1:7003\r\n$1\r\n-\r\n") {
+		t.Errorf("unexpected pong %q", pong)
+	}
+}
+
+func TestFailDetection(t *testing.T) {
+	cdb := newGossipDatabase(t, "127.0.0.1:7001", "127.0.0.1:7002", "127.0.0.1:7003")
+	failing := cdb.members["127.0.0.1:7002"]
+
+	// the node not replying for clusterNodeTimeout is PFAIL
+	cdb.membersMu.Lock()
+	failing.pinging = true
+	failing.pingSent = time.Now().Add(-time.Second)
+	cdb.members["127.0.0.1:7003"].pinging = true
+	cdb.membersMu.Unlock()
+	cdb.gossipCron()
+	if !failing.pfail || failing.fail {
+		t.Fatalf("expected the node PFAIL only, got flags %s", failing.flags())
+	}
+
+	// with another node seeing it failing, a majority of the 3 nodes does
+	busMessage(cdb, "PING", "127.0.0.1:7003", "127.0.0.1:7002", flagPFail)
+	if !failing.fail {
+		t.Fatalf("expected the node FAIL, got flags %s", failing.flags())
+	}
+	assertReply(t, string(cdb.relay("127.0.0.1:7002", &connection.Connection{}, utils.ToCmdLine("GET", "k")).ToBytes()),
+		"-CLUSTERDOWN node 127.0.0.1:7002 is failing\r\n")
+
+	// FAIL from another node is trusted at once
+	assertReply(t, busMessage(cdb, "FAIL", "127.0.0.1:7002", "127.0.0.1:7003"), "+OK\r\n")
+	if !cdb.isFailing("127.0.0.1:7003") {
+		t.Error("expected the node FAIL after the FAIL message")
+	}
+	assertReply(t, busMessage(cdb, "FAIL", "127.0.0.1:7002"), "-ERR wrong number of arguments for 'fail' command\r\n")
+}
+
+// TestPing pings a node serving its cluster bus, the pong clears the failure and introduces the nodes it knows
+func TestPing(t *testing.T) {
+	peer := newGossipDatabase(t, "127.0.0.1:7002", "127.0.0.1:7003")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &busHandler{cdb: peer}
+	defer func() {
+		_ = listener.Close()
+		_ = handler.Close()
+	}()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go handler.Handle(context.Background(), conn)
+		}
+	}()
+
+	cdb := newGossipDatabase(t, "127.0.0.1:7001", "127.0.0.1:7002")
+	m := cdb.members["127.0.0.1:7002"]
+	m.link.addr = listener.Addr().String()
+	defer m.link.close()
+	m.pfail, m.fail = true, true
+	cdb.ping(m)
+	if !m.met || m.fail || m.pfail || m.pongReceived.IsZero() {
+		t.Errorf("expected the node met and reachable, got met %v flags %s", m.met, m.flags())
+	}
+	if !peer.members["127.0.0.1:7001"].met {
+		t.Error("expected MEET to add the sender to the peer")
+	}
+	if _, ok := cdb.members["127.0.0.1:7003"]; !ok {
+		t.Error("expected the pong to introduce the other node")
+	}
+}
+
+func TestMeetForget(t *testing.T) {
+	cdb := newGossipDatabase(t, "127.0.0.1:7001", "127.0.0.1:7002")
+	assertReply(t, string(clusterMeet(cdb, utils.ToCmdLine("127.0.0.1", "60000")).ToBytes()),
+		"-ERR Invalid base port specified: 60000\r\n")
+	assertReply(t, string(clusterMeet(cdb, utils.ToCmdLine("localhost", "7003")).ToBytes()),
+		"-ERR Invalid node address specified: localhost:7003\r\n")
+
+	id := makeClusterNode("127.0.0.1:7002").id
+	assertReply(t, string(clusterForget(cdb, makeClusterNode("127.0.0.1:7001").id).ToBytes()),
+		"-ERR I tried hard but I can't forget myself...\r\n")
+	assertReply(t, string(clusterForget(cdb, id).ToBytes()), "+OK\r\n")
+	assertReply(t, string(clusterForget(cdb, id).ToBytes()), "-ERR Unknown node "+id+"\r\n")
+	if _, ok := cdb.peerPicker.Nodes()["127.0.0.1:7002"]; ok {
+		t.Error("expected keys no longer relayed to the forgotten node")
+	}
+
+	// gossip does not add the forgotten node back, meeting it does
+	busMessage(cdb, "MEET", "127.0.0.1:7003", "127.0.0.1:7002", flagNone)
+	if _, ok := cdb.members["127.0.0.1:7002"]; ok {
+		t.Error("expected the forgotten node banned from gossip")
+	}
+	assertReply(t, string(clusterMeet(cdb, utils.ToCmdLine("127.0.0.1", "7002")).ToBytes()), "+OK\r\n")
+	if _, ok := cdb.members["127.0.0.1:7002"]; !ok {
+		t.Error("expected the node met again")
+	}
+}
+
+// serveBus serves the cluster bus of the node on a local port
+func serveBus(t *testing.T, cdb *Database) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &busHandler{cdb: cdb}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go h.Handle(context.Background(), conn)
+		}
+	}()
+	t.Cleanup(func() {
+		_ = listener.Close()
+		_ = h.Close()
+	})
+	return listener.Addr().String()
+}
+
+func TestBusAuth(t *testing.T) {
+	cdb := newGossipDatabase(t, "127.0.0.1:7001")
+	config.Properties.RequirePass = "secret"
+	addr := serveBus(t, cdb)
+
+	// senders not authenticated are disconnected
+	for _, first := range [][]string{{"MEET", "127.0.0.1:7002"}, {"AUTH", "wrong"}} {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = conn.SetDeadline(time.Now().Add(time.Second))
+		_, _ = conn.Write(reply.MakeMultiBulkReply(utils.ToCmdLine(first...)).ToBytes())
+		r := bufio.NewReader(conn)
+		line, _ := r.ReadString('\n')
+		if !strings.HasPrefix(line, "-NOAUTH") && !strings.HasPrefix(line, "-WRONGPASS") {
+			t.Errorf("expected %q refused, got %q", first, line)
+		}
+		if _, err := r.ReadByte(); err != io.EOF {
+			t.Errorf("expected the connection closed after %q, got %v", first, err)
+		}
+		_ = conn.Close()
+	}
+	if _, ok := cdb.members["127.0.0.1:7002"]; ok {
+		t.Error("expected the unauthenticated MEET ignored")
+	}
+
+	// a node with the password authenticates once per connection
+	link := &busLink{addr: addr}
+	defer link.close()
+	for i := 0; i < 2; i++ {
+		r, err := link.send(utils.ToCmdLine("MEET", "127.0.0.1:7002"), time.Second)
+		if err != nil || !strings.Contains(string(r.ToBytes()), "pong") {
+			t.Fatalf("expected a pong, got %v, %v", r, err)
+		}
+	}
+	cdb.membersMu.RLock()
+	_, ok := cdb.members["127.0.0.1:7002"]
+	cdb.membersMu.RUnlock()
+	if !ok {
+		t.Error("expected the authenticated node met")
+	}
+
+	config.Properties.RequirePass = "other"
+	link.close()
+	if _, err := link.send(utils.ToCmdLine("PING", "127.0.0.1:7002"), time.Second); err != nil {
+		t.Errorf("expected the new password accepted, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package cluster
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+)
+
+// relayWithinNode relays the command to the node serving all the given keys,
+// the command can not be executed if the keys are served by different nodes
+func relayWithinNode(cdb *Database, c resp.Connection, cmdArgs [][]byte, keys ...string) resp.Reply {
+	node := cdb.peerPicker.PickNode(keys[0])
+	for _, key := range keys[1:] {
+		if cdb.peerPicker.PickNode(key) != node {
+			cmdName := strings.ToLower(string(cmdArgs[0]))
+			return reply.MakeStandardErrReply("ERR keys of '" + cmdName + "' command are served by different nodes")
+		}
+	}
+	return cdb.relay(node, c, cmdArgs)
+}
+
+// multiKeyFunc relays the command whose arguments are all keys
+// SINTER k1 k2 ...
+// SUNIONSTORE dst k1 k2 ...
+func multiKeyFunc(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	if len(cmdArgs) < 2 {
+		return reply.MakeArgNumErrReply(string(cmdArgs[0]))
+	}
+	keys := make([]string, len(cmdArgs)-1)
+	for i, arg := range cmdArgs[1:] {
+		keys[i] = string(arg)
+	}
+	return relayWithinNode(cdb, c, cmdArgs, keys...)
+}
+
+// srcDstFunc relays the command whose first two arguments are source and destination keys
+// LMOVE src dst LEFT|RIGHT LEFT|RIGHT
+// SMOVE src dst member
+func srcDstFunc(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	if len(cmdArgs) < 3 {
+		return reply.MakeArgNumErrReply(string(cmdArgs[0]))
+	}
+	return relayWithinNode(cdb, c, cmdArgs, string(cmdArgs[1]), string(cmdArgs[2]))
+}
+
+// numKeysFunc relays the command whose keys are preceded by the number of keys
+// ZUNION 2 k1 k2 [WITHSCORES]
+func numKeysFunc(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	keys, errReply := parseNumKeys(cmdArgs, 1)
+	if errReply != nil {
+		return errReply
+	}
+	return relayWithinNode(cdb, c, cmdArgs, keys...)
+}
+
+// storeNumKeysFunc relays the command whose destination is followed by the number of keys and keys
+// ZUNIONSTORE dst 2 k1 k2 [WEIGHTS w1 w2]
+func storeNumKeysFunc(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	if len(cmdArgs) < 2 {
+		return reply.MakeArgNumErrReply(string(cmdArgs[0]))
+	}
+	keys, errReply := parseNumKeys(cmdArgs, 2)
+	if errReply != nil {
+		return errReply
+	}
+	return relayWithinNode(cdb, c, cmdArgs, append([]string{string(cmdArgs[1])}, keys...)...)
+}
+
+// parseNumKeys returns the keys following the number of keys at cmdArgs[pos]
+func parseNumKeys(cmdArgs [][]byte, pos int) ([]string, resp.Reply) {
+	if len(cmdArgs) < pos+2 {
+		return nil, reply.MakeArgNumErrReply(string(cmdArgs[0]))
+	}
+	numKeys, err := strconv.Atoi(string(cmdArgs[pos]))
+	if err != nil {
+		return nil, reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys < 1 || numKeys > len(cmdArgs)-pos-1 {
+		return nil, reply.MakeSyntaxErrReply()
+	}
+	keys := make([]string, numKeys)
+	for i, arg := range cmdArgs[pos+1 : pos+1+numKeys] {
+		keys[i] = string(arg)
+	}
+	return keys, nil
+}
+
+// keyGroup is the keys of a command served by the same node, with their positions in the command
+type keyGroup struct {
+	node      string
+	keys      [][]byte
+	positions []int
+}
+
+// groupByNode groups the keys by the node serving them, in the order nodes first appear
+func (cdb *Database) groupByNode(keys [][]byte) []*keyGroup {
+	var groups []*keyGroup
+	groupOfNode := make(map[string]*keyGroup)
+	for i, key := range keys {
+		node := cdb.peerPicker.PickNode(string(key))
+		group, ok := groupOfNode[node]
+		if !ok {
+			group = &keyGroup{node: node}
+			groupOfNode[node] = group
+			groups = append(groups, group)
+		}
+		group.keys = append(group.keys, key)
+		group.positions = append(group.positions, i)
+	}
+	return groups
+}
+
+// relayGroups relays the command with the keys of each group to its node in parallel
+func (cdb *Database) relayGroups(c resp.Connection, cmdName []byte, groups []*keyGroup) map[string]resp.Reply {
+	if len(groups) == 1 {
+		return map[string]resp.Reply{
+			groups[0].node: cdb.relay(groups[0].node, c, utils.ToCmdLine2(string(cmdName), groups[0].keys...)),
+		}
+	}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	replies := make(map[string]resp.Reply, len(groups))
+	for _, group := range groups {
+		wg.Add(1)
+		go func(group *keyGroup) {
+			defer wg.Done()
+			r := cdb.relay(group.node, c, utils.ToCmdLine2(string(cmdName), group.keys...))
+			mu.Lock()
+			replies[group.node] = r
+			mu.Unlock()
+		}(group)
+	}
+	wg.Wait()
+	return replies
+}
+
+// mgetFunc gets the keys of every node, values are replied in the order of the keys
+// MGET k1 [k2 ...]
+func mgetFunc(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	if len(cmdArgs) < 2 {
+		return reply.MakeArgNumErrReply("mget")
+	}
+	groups := cdb.groupByNode(cmdArgs[1:])
+	replies := cdb.relayGroups(c, cmdArgs[0], groups)
+
+	values := make([][]byte, len(cmdArgs)-1)
+	for _, group := range groups {
+		r := replies[group.node]
+		if reply.IsErrReply(r) {
+			return r
+		}
+		multiBulk, ok := r.(*reply.MultiBulkReply)
+		if !ok || len(multiBulk.Args) != len(group.keys) {
+			return reply.MakeStandardErrReply("ERR bad reply of " + group.node)
+		}
+		for i, value := range multiBulk.Args {
+			values[group.positions[i]] = value
+		}
+	}
+	return reply.MakeMultiBulkReply(values)
+}
@@ -0,0 +1,264 @@
+package cluster
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-redis/acl"
+	"go-redis/config"
+	"go-redis/lib/consistenthash"
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+	"go-redis/resp/parser"
+	"go-redis/resp/reply"
+
+	database2 "go-redis/database"
+
+	pool "github.com/jolestar/go-commons-pool/v2"
+)
+
+// newRelayCluster makes a cluster of n nodes in relay mode, each served on a local port, without gossip
+func newRelayCluster(t *testing.T, n int) []*Database {
+	t.Helper()
+	former := config.Properties
+	dir := t.TempDir()
+	config.Properties = &config.ServerProperties{
+		Databases:  16,
+		DBFilename: filepath.Join(dir, "dump.rdb"),
+	}
+	listeners := make([]net.Listener, n)
+	addrs := make([]string, n)
+	for i := range listeners {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		listeners[i] = listener
+		addrs[i] = listener.Addr().String()
+	}
+	nodes := make([]*Database, n)
+	for i := range nodes {
+		cdb := &Database{
+			self:           addrs[i],
+			db:             database2.NewStandaloneDatabase(),
+			peerPicker:     consistenthash.NewNodeMap(0, nil),
+			peerConnection: make(map[string]*pool.ObjectPool),
+			members:        make(map[string]*member),
+			forgotten:      make(map[string]time.Time),
+			transactions:   make(map[string]*transaction),
+		}
+		cdb.peerPicker.AddNode(addrs...)
+		cdb.membersMu.Lock()
+		for _, addr := range addrs {
+			cdb.addMember(addr)
+		}
+		cdb.membersMu.Unlock()
+		nodes[i] = cdb
+		go serveNode(listeners[i], cdb)
+	}
+	t.Cleanup(func() {
+		for i, cdb := range nodes {
+			_ = listeners[i].Close()
+			for _, p := range cdb.peerConnection {
+				p.Close(context.Background())
+			}
+			_ = cdb.db.Close()
+		}
+		config.Properties = former
+	})
+	return nodes
+}
+
+// serveNode executes the commands of every connection on the node until the listener is closed
+func serveNode(listener net.Listener, cdb *Database) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			client := &connection.Connection{}
+			for p := range parser.ParseStream(conn) {
+				if p.Err != nil {
+					return
+				}
+				if r, ok := p.Data.(*reply.MultiBulkReply); ok {
+					_, _ = conn.Write(cdb.Exec(client, r.Args).ToBytes())
+				}
+			}
+		}()
+	}
+}
+
+// keyOn returns a key with the prefix served by the node
+func keyOn(cdb *Database, node *Database, prefix string) string {
+	for i := 0; ; i++ {
+		key := prefix + strconv.Itoa(i)
+		if cdb.peerPicker.PickNode(key) == node.self {
+			return key
+		}
+	}
+}
+
+// execLocally executes the command on the inner db of the node, without relaying
+func execLocally(cdb *Database, c *connection.Connection, args ...string) string {
+	return string(cdb.db.Exec(c, utils.ToCmdLine(args...)).ToBytes())
+}
+
+func multiBulk(values ...string) string {
+	args := make([][]byte, len(values))
+	for i, v := range values {
+		if v != "" {
+			args[i] = []byte(v)
+		}
+	}
+	return string(reply.MakeMultiBulkReply(args).ToBytes())
+}
+
+func TestMultiKeyAcrossNodes(t *testing.T) {
+	nodes := newRelayCluster(t, 2)
+	coordinator, peer := nodes[0], nodes[1]
+	local1, local2 := keyOn(coordinator, coordinator, "l"), keyOn(coordinator, coordinator, "m")
+	remote1, remote2 := keyOn(coordinator, peer, "r"), keyOn(coordinator, peer, "s")
+
+	client := &connection.Connection{}
+	execOn(coordinator, client, "SELECT", "2")
+	assertReply(t, execOn(coordinator, client, "MSET", remote1, "1", local1, "2", remote2, "3"), "+OK\r\n")
+	assertReply(t, execOn(coordinator, client, "MGET", local1, remote1, local2, remote2), multiBulk("2", "1", "", "3"))
+	assertReply(t, execOn(coordinator, client, "EXISTS", local1, remote1, local2, remote2, remote1), ":4\r\n")
+
+	// the keys are written in the db the client selected on the node serving them
+	peerClient := &connection.Connection{}
+	peerClient.SelectDB(2)
+	assertReply(t, execLocally(peer, peerClient, "MGET", remote1, remote2), multiBulk("1", "3"))
+	assertReply(t, execLocally(peer, &connection.Connection{}, "EXISTS", remote1), ":0\r\n")
+	assertReply(t, execLocally(coordinator, peerClient, "GET", remote1), "$-1\r\n")
+
+	assertReply(t, execOn(coordinator, client, "DEL", remote1, local1, local2), ":2\r\n")
+	assertReply(t, execOn(coordinator, client, "MGET", local1, remote1, remote2), multiBulk("", "", "3"))
+	assertReply(t, execOn(coordinator, client, "MSET", local1), "-ERR wrong number of arguments for 'mset' command\r\n")
+	if ret := execOn(coordinator, client, "SUNION", local1, remote1); !strings.Contains(ret, "different nodes") {
+		t.Errorf("expected keys of different nodes refused, got %q", ret)
+	}
+}
+
+func TestRenameAcrossNodes(t *testing.T) {
+	nodes := newRelayCluster(t, 2)
+	coordinator, peer := nodes[0], nodes[1]
+	src, dst := keyOn(coordinator, coordinator, "src"), keyOn(coordinator, peer, "dst")
+	client := &connection.Connection{}
+
+	execOn(coordinator, client, "RPUSH", src, "a", "b")
+	execOn(coordinator, client, "EXPIRE", src, "100")
+	execOn(coordinator, client, "SET", dst, "old")
+	assertReply(t, execOn(coordinator, client, "RENAMENX", src, dst), ":0\r\n")
+	assertReply(t, execOn(coordinator, client, "GET", dst), "$3\r\nold\r\n")
+
+	assertReply(t, execOn(coordinator, client, "RENAME", src, dst), "+OK\r\n")
+	assertReply(t, execLocally(coordinator, client, "EXISTS", src), ":0\r\n")
+	assertReply(t, execLocally(peer, client, "LRANGE", dst, "0", "-1"), multiBulk("a", "b"))
+	if ttl := execOn(coordinator, client, "TTL", dst); ttl != ":100\r\n" && ttl != ":99\r\n" {
+		t.Errorf("expected ttl moved with the key, got %q", ttl)
+	}
+
+	// back to the first node, which has no key of the name
+	assertReply(t, execOn(coordinator, client, "RENAMENX", dst, src), ":1\r\n")
+	assertReply(t, execOn(coordinator, client, "LRANGE", src, "0", "-1"), multiBulk("a", "b"))
+	assertReply(t, execOn(coordinator, client, "RENAME", dst, src), "-ERR no such key\r\n")
+}
+
+func TestTransactionRollback(t *testing.T) {
+	nodes := newRelayCluster(t, 1)
+	cdb := nodes[0]
+	client := &connection.Connection{}
+	execOn(cdb, client, "SET", "k", "old")
+
+	// a committed transaction is undone by rollback until it is released
+	assertReply(t, execOn(cdb, client, prepareCmd, "tx1", "SET", "k", "new"), "+OK\r\n")
+	assertReply(t, execOn(cdb, client, prepareCmd, "tx1", "SET", "k", "new"), "-ERR transaction tx1 already exists\r\n")
+	assertReply(t, execOn(cdb, client, commitCmd, "tx1"), "+OK\r\n")
+	assertReply(t, execOn(cdb, client, rollbackCmd, "tx1"), "+OK\r\n")
+	assertReply(t, execOn(cdb, client, releaseCmd, "tx1"), "-ERR transaction tx1 is not committed\r\n")
+	assertReply(t, execOn(cdb, client, "GET", "k"), "$3\r\nold\r\n")
+
+	// the keys of a committed transaction are locked until it is released, it can not be rolled back afterwards
+	assertReply(t, execOn(cdb, client, prepareCmd, "tx5", "SET", "k", "new"), "+OK\r\n")
+	assertReply(t, execOn(cdb, client, commitCmd, "tx5"), "+OK\r\n")
+	got := make(chan string)
+	go func() {
+		got <- execOn(cdb, &connection.Connection{}, "GET", "k")
+	}()
+	select {
+	case r := <-got:
+		t.Fatalf("expected GET waiting for the release, got %q", r)
+	case <-time.After(50 * time.Millisecond):
+	}
+	assertReply(t, execOn(cdb, client, releaseCmd, "tx5"), "+OK\r\n")
+	assertReply(t, <-got, "$3\r\nnew\r\n")
+	assertReply(t, execOn(cdb, client, rollbackCmd, "tx5"), "+OK\r\n")
+	assertReply(t, execOn(cdb, client, "GET", "k"), "$3\r\nnew\r\n")
+	execOn(cdb, client, "SET", "k", "old")
+
+	// a prepared transaction releases its keys on rollback and can not be committed any more
+	assertReply(t, execOn(cdb, client, prepareCmd, "tx2", "DEL", "k"), "+OK\r\n")
+	assertReply(t, execOn(cdb, client, rollbackCmd, "tx2"), "+OK\r\n")
+	assertReply(t, execOn(cdb, client, commitCmd, "tx2"), "-ERR transaction tx2 is not prepared\r\n")
+	assertReply(t, execOn(cdb, client, "GET", "k"), "$3\r\nold\r\n")
+
+	// a rollback overtaking its prepare makes the prepare fail
+	assertReply(t, execOn(cdb, client, rollbackCmd, "tx3"), "+OK\r\n")
+	assertReply(t, execOn(cdb, client, prepareCmd, "tx3", "SET", "k", "v"), "-ERR transaction tx3 already exists\r\n")
+	assertReply(t, execOn(cdb, client, commitCmd, "none"), "-ERR transaction none not found\r\n")
+	assertReply(t, execOn(cdb, client, prepareCmd, "tx4", "PING"), "-ERR command can not be prepared: PING\r\n")
+}
+
+func TestInternalCommands(t *testing.T) {
+	nodes := newRelayCluster(t, 1)
+	cdb := nodes[0]
+	alice := &connection.Connection{}
+	alice.SetUser("alice")
+	assertReply(t, execOn(cdb, alice, prepareCmd, "tx1", "SET", "k", "v"),
+		"-NOPERM this user has no permissions to run the '_prepare' command\r\n")
+
+	// with requirePass only the other nodes, authenticated as the cluster user, run them
+	config.Properties.RequirePass = "secret"
+	client := &connection.Connection{}
+	client.SetUser(acl.DefaultUser)
+	for _, args := range [][]string{
+		{prepareCmd, "tx1", "SET", "k", "v"}, {commitCmd, "tx1"}, {rollbackCmd, "tx1"}, {releaseCmd, "tx1"},
+		{relayPublish, "news", "m"},
+	} {
+		assertReply(t, execOn(cdb, client, args...),
+			"-NOPERM this user has no permissions to run the '"+args[0]+"' command\r\n")
+	}
+	assertReply(t, execOn(cdb, client, "EXISTS", "k"), ":0\r\n")
+
+	node := &connection.Connection{}
+	node.SetUser(acl.ClusterUser)
+	assertReply(t, execOn(cdb, node, prepareCmd, "tx1", "SET", "k", "v"), "+OK\r\n")
+	assertReply(t, execOn(cdb, node, commitCmd, "tx1"), "+OK\r\n")
+	assertReply(t, execOn(cdb, node, releaseCmd, "tx1"), "+OK\r\n")
+	assertReply(t, execOn(cdb, client, "GET", "k"), "$1\r\nv\r\n")
+}
+
+func TestSetOptionsRelayed(t *testing.T) {
+	nodes := newRelayCluster(t, 2)
+	coordinator, peer := nodes[0], nodes[1]
+	remote := keyOn(coordinator, peer, "r")
+	client := &connection.Connection{}
+	assertReply(t, execOn(coordinator, client, "SET", remote, "v1", "EX", "100", "NX"), "+OK\r\n")
+	assertReply(t, execOn(coordinator, client, "SET", remote, "v2", "NX", "GET"), "$2\r\nv1\r\n")
+	assertReply(t, execOn(coordinator, client, "SET", remote, "v3", "XX", "KEEPTTL"), "+OK\r\n")
+	// the options apply on the node serving the key
+	assertReply(t, execLocally(peer, &connection.Connection{}, "GET", remote), "$2\r\nv3\r\n")
+	if ttl := execLocally(peer, &connection.Connection{}, "TTL", remote); ttl != ":100\r\n" && ttl != ":99\r\n" {
+		t.Errorf("expected the ttl kept on the node serving the key, got %q", ttl)
+	}
+	assertReply(t, execOn(coordinator, client, "SET", remote, "v", "EX"), "-Err syntax error\r\n")
+}
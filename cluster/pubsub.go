@@ -0,0 +1,52 @@
+package cluster
+
+import (
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+)
+
+const relayPublish = "_publish"
+
+// localFunc executes the command on the current node,
+// subscriptions are kept by the node the subscriber connects to
+func localFunc(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	return cdb.db.Exec(c, cmdArgs)
+}
+
+// publishFunc broadcasts the message to all nodes, so subscribers connected to any node receive it,
+// replies the total number of receivers
+// PUBLISH channel message
+func publishFunc(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	if len(cmdArgs) != 3 {
+		return reply.MakeArgNumErrReply("publish")
+	}
+	relayArgs := make([][]byte, len(cmdArgs))
+	copy(relayArgs, cmdArgs)
+	relayArgs[0] = []byte(relayPublish)
+
+	var receivers int64
+	for _, node := range cdb.nodeAddrs() {
+		var r resp.Reply
+		if node == cdb.self {
+			r = cdb.db.Exec(c, cmdArgs)
+		} else {
+			r = cdb.relay(node, c, relayArgs)
+		}
+		if reply.IsErrReply(r) {
+			return r
+		}
+		if intReply, ok := r.(*reply.IntReply); ok {
+			receivers += intReply.Code
+		}
+	}
+	return reply.MakeIntReply(receivers)
+}
+
+// relayPublishFunc publishes the message relayed by another node to the subscribers of the current node
+// _PUBLISH channel message
+func relayPublishFunc(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	args := make([][]byte, len(cmdArgs))
+	copy(args, cmdArgs)
+	args[0] = []byte("publish")
+	return cdb.db.Exec(c, args)
+}
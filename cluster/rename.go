@@ -5,11 +5,11 @@ import (
 	"go-redis/resp/reply"
 )
 
-// renameFunc RENAME k1 k2
+// renameFunc RENAME k1 k2, RENAMENX k1 k2
 func renameFunc(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
 
 	if len(cmdArgs) != 3 {
-		return reply.MakeArgNumErrReply("rename")
+		return reply.MakeArgNumErrReply(string(cmdArgs[0]))
 	}
 
 	src := string(cmdArgs[1])
@@ -19,7 +19,7 @@ func renameFunc(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
 	dstNode := cdb.peerPicker.PickNode(dst)
 
 	if srcNode != dstNode {
-		return reply.MakeStandardErrReply("ERR rename must within on redis node")
+		return renameAcrossNodes(cdb, c, srcNode, dstNode, cmdArgs)
 	}
 
 	return cdb.relay(srcNode, c, cmdArgs)
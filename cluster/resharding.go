@@ -0,0 +1,283 @@
+package cluster
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+)
+
+// Slots are moved between nodes the same way as in redis cluster:
+//
+//	CLUSTER SETSLOT <slot> IMPORTING <source-id>     on the target
+//	CLUSTER SETSLOT <slot> MIGRATING <target-id>     on the source
+//	CLUSTER GETKEYSINSLOT <slot> <count>             on the source, then MIGRATE the keys, until no key is left
+//	CLUSTER SETSLOT <slot> NODE <target-id>          on the target, the source and the other nodes
+//
+// Meanwhile the source serves the keys it still holds and redirects clients to the target by ASK
+// for keys already moved, the target serves the slot to clients which sent ASKING.
+
+// loadSlotTable reads the slot table from the cluster config file, or assigns slots to the nodes evenly
+// if there is none yet. Nodes unknown to the file are added without any slot, so does a node started
+// without peers, which joins a cluster by CLUSTER MEET and serves the slots moved to it.
+func loadSlotTable(filename string, self string, addrs []string) (*slotTable, error) {
+	table, err := readSlotTable(filename, self)
+	if err != nil {
+		return nil, err
+	}
+	if table == nil {
+		if len(addrs) > 1 {
+			table = makeSlotTable(addrs)
+		} else {
+			table = makeSlotTable(nil)
+			table.nodes[self] = makeClusterNode(self)
+		}
+		return table, table.save(filename, self)
+	}
+	for _, addr := range addrs {
+		if _, ok := table.nodes[addr]; !ok {
+			table.nodes[addr] = makeClusterNode(addr)
+		}
+	}
+	return table, nil
+}
+
+// readSlotTable parses the cluster config file, returns nil if it does not exist.
+// Each line is a node followed by the slot ranges it serves, the current node also lists
+// the slots moving to [slot->-addr] or from [slot-<-addr] another node.
+func readSlotTable(filename string, self string) (*slotTable, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	table := &slotTable{
+		nodes:     make(map[string]*clusterNode),
+		migrating: make(map[int]string),
+		importing: make(map[int]string),
+	}
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		addr := fields[0]
+		table.nodes[addr] = makeClusterNode(addr)
+		for _, field := range fields[1:] {
+			if err := table.parseSlots(addr, self, field); err != nil {
+				return nil, fmt.Errorf("%s line %d: %v", filename, lineNum, err)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for _, moving := range []map[int]string{table.migrating, table.importing} {
+		for _, addr := range moving {
+			if _, ok := table.nodes[addr]; !ok {
+				table.nodes[addr] = makeClusterNode(addr)
+			}
+		}
+	}
+	return table, nil
+}
+
+// parseSlots parses a slot, a slot range or a moving slot of the node
+func (table *slotTable) parseSlots(addr string, self string, field string) error {
+	if strings.HasPrefix(field, "[") && strings.HasSuffix(field, "]") {
+		field = field[1 : len(field)-1]
+		if addr != self {
+			return nil
+		}
+		if i := strings.Index(field, "->-"); i > 0 {
+			slot, err := parseSlot([]byte(field[:i]))
+			if err != nil {
+				return err
+			}
+			table.migrating[slot] = field[i+3:]
+			return nil
+		}
+		if i := strings.Index(field, "-<-"); i > 0 {
+			slot, err := parseSlot([]byte(field[:i]))
+			if err != nil {
+				return err
+			}
+			table.importing[slot] = field[i+3:]
+			return nil
+		}
+		return fmt.Errorf("invalid moving slot %q", field)
+	}
+	start, end := field, field
+	if i := strings.IndexByte(field, '-'); i > 0 {
+		start, end = field[:i], field[i+1:]
+	}
+	first, err := parseSlot([]byte(start))
+	if err != nil {
+		return fmt.Errorf("invalid slot range %q", field)
+	}
+	last, err := parseSlot([]byte(end))
+	if err != nil || last < first {
+		return fmt.Errorf("invalid slot range %q", field)
+	}
+	for slot := first; slot <= last; slot++ {
+		table.owners[slot] = addr
+	}
+	return nil
+}
+
+// save writes the slot table into a temporary file which then replaces the cluster config file,
+// so a crash never leaves a partial file
+func (table *slotTable) save(filename string, self string) error {
+	rangesOfNode := make(map[string][]string)
+	for _, r := range table.ranges() {
+		s := strconv.Itoa(r.start)
+		if r.end != r.start {
+			s += "-" + strconv.Itoa(r.end)
+		}
+		rangesOfNode[r.node.addr] = append(rangesOfNode[r.node.addr], s)
+	}
+	table.mu.RLock()
+	for slot, addr := range table.migrating {
+		rangesOfNode[self] = append(rangesOfNode[self], "["+strconv.Itoa(slot)+"->-"+addr+"]")
+	}
+	for slot, addr := range table.importing {
+		rangesOfNode[self] = append(rangesOfNode[self], "["+strconv.Itoa(slot)+"-<-"+addr+"]")
+	}
+	table.mu.RUnlock()
+
+	var sb strings.Builder
+	sb.WriteString("# slots served by each node, rewritten by the node whenever a slot moves\n")
+	for _, node := range table.sortedNodes() {
+		sb.WriteString(strings.Join(append([]string{node.addr}, rangesOfNode[node.addr]...), " "))
+		sb.WriteString("\n")
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), "temp-nodes-*.conf")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.WriteString(sb.String()); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filename)
+}
+
+// nodeByID finds a node by its id, nil if unknown
+func (table *slotTable) nodeByID(id string) *clusterNode {
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+	for _, node := range table.nodes {
+		if node.id == id {
+			return node
+		}
+	}
+	return nil
+}
+
+// execClusterSetSlot CLUSTER SETSLOT slot IMPORTING node-id | MIGRATING node-id | NODE node-id | STABLE
+func execClusterSetSlot(cdb *Database, args [][]byte) resp.Reply {
+	slot, err := parseSlot(args[0])
+	if err != nil {
+		return reply.MakeStandardErrReply(err.Error())
+	}
+	action := strings.ToLower(string(args[1]))
+	var node *clusterNode
+	switch action {
+	case "importing", "migrating", "node":
+		if len(args) != 3 {
+			return reply.MakeSyntaxErrReply()
+		}
+		node = cdb.slots.nodeByID(string(args[2]))
+		if node == nil {
+			return reply.MakeStandardErrReply("ERR I don't know about node " + string(args[2]))
+		}
+	case "stable":
+		if len(args) != 2 {
+			return reply.MakeSyntaxErrReply()
+		}
+	default:
+		return reply.MakeStandardErrReply("ERR Invalid CLUSTER SETSLOT action or number of arguments. Try CLUSTER HELP")
+	}
+	if action == "node" && node.addr != cdb.self && cdb.slots.ownedBy(slot, cdb.self) && cdb.countKeysInSlot(slot) > 0 {
+		return reply.MakeStandardErrReply("ERR Can't assign hashslot " + strconv.Itoa(slot) +
+			" to a different node while I still hold keys for this hash slot.")
+	}
+
+	table := cdb.slots
+	table.mu.Lock()
+	switch action {
+	case "importing":
+		if table.owners[slot] == cdb.self {
+			table.mu.Unlock()
+			return reply.MakeStandardErrReply("ERR I'm already the owner of hash slot " + strconv.Itoa(slot))
+		}
+		if node.addr == cdb.self {
+			table.mu.Unlock()
+			return reply.MakeStandardErrReply("ERR I can't import hash slot " + strconv.Itoa(slot) + " from myself")
+		}
+		table.importing[slot] = node.addr
+	case "migrating":
+		if table.owners[slot] != cdb.self {
+			table.mu.Unlock()
+			return reply.MakeStandardErrReply("ERR I'm not the owner of hash slot " + strconv.Itoa(slot))
+		}
+		if node.addr == cdb.self {
+			table.mu.Unlock()
+			return reply.MakeStandardErrReply("ERR I can't migrate hash slot " + strconv.Itoa(slot) + " to myself")
+		}
+		table.migrating[slot] = node.addr
+	case "node":
+		table.owners[slot] = node.addr
+		if node.addr != cdb.self {
+			delete(table.migrating, slot)
+		} else {
+			// the migration is done, clients are no longer required to send ASKING
+			delete(table.importing, slot)
+		}
+	case "stable":
+		delete(table.migrating, slot)
+		delete(table.importing, slot)
+	}
+	table.mu.Unlock()
+
+	if err := table.save(config.Properties.ClusterConfigFile, cdb.self); err != nil {
+		return reply.MakeStandardErrReply("ERR saving the cluster config file: " + err.Error())
+	}
+	return reply.MakeOKReply()
+}
+
+// ownedBy tells whether the slot is served by the node
+func (table *slotTable) ownedBy(slot int, addr string) bool {
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+	return table.owners[slot] == addr
+}
+
+// countKeysInSlot counts the keys of the slot in all dbs of the current node
+func (cdb *Database) countKeysInSlot(slot int) int {
+	count := 0
+	for i := 0; i < config.Properties.Databases; i++ {
+		count += len(cdb.keysInSlot(i, slot, -1))
+	}
+	return count
+}
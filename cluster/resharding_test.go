@@ -0,0 +1,52 @@
+package cluster
+
+import (
+	"strconv"
+	"testing"
+
+	"go-redis/config"
+	"go-redis/resp/connection"
+)
+
+func TestSetSlot(t *testing.T) {
+	self, other := "127.0.0.1:7001", "127.0.0.1:7002"
+	cdb := newSlotsDatabase(t, self, other)
+	c := &connection.Connection{}
+	selfID, otherID := makeClusterNode(self).id, makeClusterNode(other).id
+	slot := strconv.Itoa(getSlot("b")) // served by self
+	execOn(cdb, c, "SET", "{b}k", "v")
+
+	assertReply(t, execOn(cdb, c, "CLUSTER", "SETSLOT", slot, "MIGRATING", selfID), "-ERR I can't migrate hash slot "+slot+" to myself\r\n")
+	assertReply(t, execOn(cdb, c, "CLUSTER", "SETSLOT", slot, "IMPORTING", otherID), "-ERR I'm already the owner of hash slot "+slot+"\r\n")
+	assertReply(t, execOn(cdb, c, "CLUSTER", "SETSLOT", slot, "MIGRATING", "nope"), "-ERR I don't know about node nope\r\n")
+	assertReply(t, execOn(cdb, c, "CLUSTER", "SETSLOT", "12182", "MIGRATING", otherID), "-ERR I'm not the owner of hash slot 12182\r\n")
+	assertReply(t, execOn(cdb, c, "CLUSTER", "SETSLOT", slot, "MIGRATING", otherID), "+OK\r\n")
+
+	// the migrating slot is kept by the cluster config file
+	table, err := loadSlotTable(config.Properties.ClusterConfigFile, self, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner, migratingTo, _ := table.route(getSlot("b")); owner != self || migratingTo != other {
+		t.Errorf("expected slot %s migrating from %s to %s, got %s to %s", slot, self, other, owner, migratingTo)
+	}
+
+	// the slot can not be given away while the current node holds its keys
+	assertReply(t, execOn(cdb, c, "CLUSTER", "SETSLOT", slot, "NODE", otherID),
+		"-ERR Can't assign hashslot "+slot+" to a different node while I still hold keys for this hash slot.\r\n")
+	execOn(cdb, c, "DEL", "{b}k")
+	assertReply(t, execOn(cdb, c, "CLUSTER", "SETSLOT", slot, "NODE", otherID), "+OK\r\n")
+	if owner, migratingTo, _ := cdb.slots.route(getSlot("b")); owner != other || migratingTo != "" {
+		t.Errorf("expected slot %s served by %s, got %s migrating to %q", slot, other, owner, migratingTo)
+	}
+	assertReply(t, execOn(cdb, c, "GET", "{b}k"), "-MOVED "+slot+" "+other+"\r\n")
+
+	assertReply(t, execOn(cdb, c, "CLUSTER", "SETSLOT", slot, "IMPORTING", otherID), "+OK\r\n")
+	assertReply(t, execOn(cdb, c, "CLUSTER", "SETSLOT", slot, "STABLE"), "+OK\r\n")
+	if _, _, importingFrom := cdb.slots.route(getSlot("b")); importingFrom != "" {
+		t.Errorf("expected slot %s stable, got importing from %s", slot, importingFrom)
+	}
+	assertReply(t, execOn(cdb, c, "CLUSTER", "SETSLOT", slot, "NODE", selfID), "+OK\r\n")
+	assertReply(t, execOn(cdb, c, "CLUSTER", "SETSLOT", slot, "MOVE"),
+		"-ERR Invalid CLUSTER SETSLOT action or number of arguments. Try CLUSTER HELP\r\n")
+}
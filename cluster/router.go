@@ -14,20 +14,146 @@ func makeRouter() map[string]CmdFunc {
 	// need relay
 	m["rename"] = renameFunc   // rename src dst
 	m["renamenx"] = renameFunc // renamenx src dst
-	m["exists"] = defaultFunc  // exists k1
+	m["exists"] = existsFunc   // exists k1 [k2 ...], keys are split by node
 	m["get"] = defaultFunc     // get k1
-	m["set"] = defaultFunc     // set k1 v1
+	m["set"] = defaultFunc     // set k1 v1 [NX|XX] [GET] [EX|PX|EXAT|PXAT|KEEPTTL], options are relayed as is
 	m["setnx"] = defaultFunc   // setnx k1 v1
+	m["mset"] = msetFunc       // mset k1 v1 [k2 v2 ...], atomic across nodes
+	m["mget"] = mgetFunc       // mget k1 [k2 ...], keys are split by node
 	m["getset"] = defaultFunc  // getset k1 v1
 	m["type"] = defaultFunc    // type k1
 
+	m["incr"] = defaultFunc        // incr k1
+	m["incrby"] = defaultFunc      // incrby k1 5
+	m["decr"] = defaultFunc        // decr k1
+	m["decrby"] = defaultFunc      // decrby k1 5
+	m["incrbyfloat"] = defaultFunc // incrbyfloat k1 1.5
+
+	m["expire"] = defaultFunc      // expire k1 seconds
+	m["pexpire"] = defaultFunc     // pexpire k1 milliseconds
+	m["expireat"] = defaultFunc    // expireat k1 timestamp
+	m["pexpireat"] = defaultFunc   // pexpireat k1 timestamp
+	m["ttl"] = defaultFunc         // ttl k1
+	m["pttl"] = defaultFunc        // pttl k1
+	m["expiretime"] = defaultFunc  // expiretime k1
+	m["pexpiretime"] = defaultFunc // pexpiretime k1
+	m["persist"] = defaultFunc     // persist k1
+
+	m["dump"] = defaultFunc           // dump k1
+	m["restore"] = defaultFunc        // restore k1 ttl payload [REPLACE] [ABSTTL]
+	m["restore-asking"] = defaultFunc // restore-asking k1 ttl payload [REPLACE] [ABSTTL]
+
+	m["hset"] = defaultFunc         // hset k1 f1 v1 [f2 v2 ...]
+	m["hsetnx"] = defaultFunc       // hsetnx k1 f1 v1
+	m["hmset"] = defaultFunc        // hmset k1 f1 v1 [f2 v2 ...]
+	m["hget"] = defaultFunc         // hget k1 f1
+	m["hmget"] = defaultFunc        // hmget k1 f1 [f2 ...]
+	m["hexists"] = defaultFunc      // hexists k1 f1
+	m["hdel"] = defaultFunc         // hdel k1 f1 [f2 ...]
+	m["hlen"] = defaultFunc         // hlen k1
+	m["hstrlen"] = defaultFunc      // hstrlen k1 f1
+	m["hkeys"] = defaultFunc        // hkeys k1
+	m["hvals"] = defaultFunc        // hvals k1
+	m["hgetall"] = defaultFunc      // hgetall k1
+	m["hincrby"] = defaultFunc      // hincrby k1 f1 1
+	m["hincrbyfloat"] = defaultFunc // hincrbyfloat k1 f1 1.5
+	m["hrandfield"] = defaultFunc   // hrandfield k1 [count [WITHVALUES]]
+	m["hscan"] = defaultFunc        // hscan k1 0 [MATCH pattern] [COUNT count]
+
+	m["lpush"] = defaultFunc    // lpush k1 e1 [e2 ...]
+	m["lpushx"] = defaultFunc   // lpushx k1 e1 [e2 ...]
+	m["rpush"] = defaultFunc    // rpush k1 e1 [e2 ...]
+	m["rpushx"] = defaultFunc   // rpushx k1 e1 [e2 ...]
+	m["lpop"] = defaultFunc     // lpop k1 [count]
+	m["rpop"] = defaultFunc     // rpop k1 [count]
+	m["llen"] = defaultFunc     // llen k1
+	m["lindex"] = defaultFunc   // lindex k1 0
+	m["lset"] = defaultFunc     // lset k1 0 e1
+	m["lrange"] = defaultFunc   // lrange k1 0 -1
+	m["lrem"] = defaultFunc     // lrem k1 0 e1
+	m["ltrim"] = defaultFunc    // ltrim k1 0 -1
+	m["linsert"] = defaultFunc  // linsert k1 BEFORE|AFTER pivot e1
+	m["lpos"] = defaultFunc     // lpos k1 e1 [RANK rank] [COUNT count] [MAXLEN len]
+	m["lmove"] = srcDstFunc     // lmove src dst LEFT|RIGHT LEFT|RIGHT
+	m["rpoplpush"] = srcDstFunc // rpoplpush src dst
+
+	m["sadd"] = defaultFunc         // sadd k1 m1 [m2 ...]
+	m["srem"] = defaultFunc         // srem k1 m1 [m2 ...]
+	m["sismember"] = defaultFunc    // sismember k1 m1
+	m["smismember"] = defaultFunc   // smismember k1 m1 [m2 ...]
+	m["scard"] = defaultFunc        // scard k1
+	m["smembers"] = defaultFunc     // smembers k1
+	m["srandmember"] = defaultFunc  // srandmember k1 [count]
+	m["spop"] = defaultFunc         // spop k1 [count]
+	m["sscan"] = defaultFunc        // sscan k1 0 [MATCH pattern] [COUNT count]
+	m["smove"] = srcDstFunc         // smove src dst m1
+	m["sinter"] = multiKeyFunc      // sinter k1 [k2 ...]
+	m["sunion"] = multiKeyFunc      // sunion k1 [k2 ...]
+	m["sdiff"] = multiKeyFunc       // sdiff k1 [k2 ...]
+	m["sinterstore"] = multiKeyFunc // sinterstore dst k1 [k2 ...]
+	m["sunionstore"] = multiKeyFunc // sunionstore dst k1 [k2 ...]
+	m["sdiffstore"] = multiKeyFunc  // sdiffstore dst k1 [k2 ...]
+
+	m["zadd"] = defaultFunc             // zadd k1 [NX|XX] [GT|LT] [CH] [INCR] score m1 [score m2 ...]
+	m["zincrby"] = defaultFunc          // zincrby k1 1.5 m1
+	m["zscore"] = defaultFunc           // zscore k1 m1
+	m["zmscore"] = defaultFunc          // zmscore k1 m1 [m2 ...]
+	m["zcard"] = defaultFunc            // zcard k1
+	m["zcount"] = defaultFunc           // zcount k1 min max
+	m["zlexcount"] = defaultFunc        // zlexcount k1 min max
+	m["zrank"] = defaultFunc            // zrank k1 m1 [WITHSCORE]
+	m["zrevrank"] = defaultFunc         // zrevrank k1 m1 [WITHSCORE]
+	m["zrange"] = defaultFunc           // zrange k1 start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+	m["zrevrange"] = defaultFunc        // zrevrange k1 start stop [WITHSCORES]
+	m["zrangebyscore"] = defaultFunc    // zrangebyscore k1 min max [WITHSCORES] [LIMIT offset count]
+	m["zrevrangebyscore"] = defaultFunc // zrevrangebyscore k1 max min [WITHSCORES] [LIMIT offset count]
+	m["zrangebylex"] = defaultFunc      // zrangebylex k1 min max [LIMIT offset count]
+	m["zrevrangebylex"] = defaultFunc   // zrevrangebylex k1 max min [LIMIT offset count]
+	m["zrem"] = defaultFunc             // zrem k1 m1 [m2 ...]
+	m["zremrangebyrank"] = defaultFunc  // zremrangebyrank k1 start stop
+	m["zremrangebyscore"] = defaultFunc // zremrangebyscore k1 min max
+	m["zremrangebylex"] = defaultFunc   // zremrangebylex k1 min max
+	m["zpopmin"] = defaultFunc          // zpopmin k1 [count]
+	m["zpopmax"] = defaultFunc          // zpopmax k1 [count]
+	m["zscan"] = defaultFunc            // zscan k1 0 [MATCH pattern] [COUNT count]
+	m["zunionstore"] = storeNumKeysFunc // zunionstore dst 2 k1 k2 [WEIGHTS w1 w2] [AGGREGATE SUM|MIN|MAX]
+	m["zinterstore"] = storeNumKeysFunc // zinterstore dst 2 k1 k2 [WEIGHTS w1 w2] [AGGREGATE SUM|MIN|MAX]
+	m["zunion"] = numKeysFunc           // zunion 2 k1 k2 [WEIGHTS w1 w2] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+	m["zinter"] = numKeysFunc           // zinter 2 k1 k2 [WEIGHTS w1 w2] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+
 	// need not relay
 	m["ping"] = pingFunc     // ping
 	m["select"] = selectFunc // select 1
 
+	m["subscribe"] = localFunc    // subscribe ch1 [ch2 ...]
+	m["unsubscribe"] = localFunc  // unsubscribe [ch1 ...]
+	m["psubscribe"] = localFunc   // psubscribe p1 [p2 ...]
+	m["punsubscribe"] = localFunc // punsubscribe [p1 ...]
+	m["pubsub"] = localFunc       // pubsub CHANNELS [pattern] | NUMSUB [ch1 ...] | NUMPAT
+
+	m["bgrewriteaof"] = localFunc // bgrewriteaof, every node rewrites its own aof
+	m["save"] = localFunc         // save, every node saves its own snapshot
+	m["bgsave"] = localFunc       // bgsave
+	m["lastsave"] = localFunc     // lastsave
+	m["info"] = localFunc         // info [section ...]
+	m["role"] = localFunc         // role, replication is per node
+	m["migrate"] = localFunc      // migrate host port k1|"" db timeout [COPY] [REPLACE] [KEYS k1 ...], moves keys of the current node
+	m["cluster"] = execCluster    // cluster MEET ip port | FORGET id | NODES | MYID | INFO, membership of the current node
+
 	// need to broadcast
 	m["flushdb"] = flushdbFunc // flushdb
-	m["delete"] = delFunc      // delete k1 k2 k3 ...
+
+	// split by node
+	m["del"] = delFunc // del k1 [k2 ...]
+
+	m["publish"] = publishFunc         // publish ch1 msg
+	m[relayPublish] = relayPublishFunc // _publish ch1 msg, relayed by another node
+
+	// transactions spanning nodes
+	m[prepareCmd] = execPrepare   // _prepare txid cmd [args ...]
+	m[commitCmd] = execCommit     // _commit txid
+	m[rollbackCmd] = execRollback // _rollback txid
+	m[releaseCmd] = execRelease   // _release txid
 
 	return m
 }
@@ -0,0 +1,541 @@
+package cluster
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/crc16"
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+	"go-redis/resp/reply"
+
+	database2 "go-redis/database"
+)
+
+// slotCount is the number of slots keys are mapped to, the same as redis cluster
+const slotCount = 16384
+
+// getSlot returns the slot of the key, only the part within the first {...} is hashed if it is not empty,
+// so keys sharing a hash tag are always served by the same node, e.g. {user1}.name and {user1}.age
+func getSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16.Checksum([]byte(key)) % slotCount)
+}
+
+// clusterNode is a node of the cluster as seen by clients
+type clusterNode struct {
+	id   string // 40 characters, derived from the address so every node agrees on it
+	addr string
+	ip   string
+	port int
+}
+
+func makeClusterNode(addr string) *clusterNode {
+	sum := sha1.Sum([]byte(addr))
+	node := &clusterNode{
+		id:   hex.EncodeToString(sum[:]),
+		addr: addr,
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err == nil {
+		node.ip = host
+		node.port, _ = strconv.Atoi(port)
+	}
+	return node
+}
+
+// slotTable records the node serving each slot and the slots moving between nodes
+type slotTable struct {
+	mu        sync.RWMutex
+	nodes     map[string]*clusterNode // address -> node
+	owners    [slotCount]string       // slot -> address of the node serving it
+	migrating map[int]string          // slot served by the current node -> address of the node it moves to
+	importing map[int]string          // slot moving to the current node -> address of the node it moves from
+}
+
+// makeSlotTable assigns continuous ranges of slots to the nodes ordered by address,
+// so every node computes the same table from the same node list
+func makeSlotTable(addrs []string) *slotTable {
+	table := &slotTable{
+		nodes:     make(map[string]*clusterNode),
+		migrating: make(map[int]string),
+		importing: make(map[int]string),
+	}
+	sorted := make([]string, len(addrs))
+	copy(sorted, addrs)
+	sort.Strings(sorted)
+	for i, addr := range sorted {
+		table.nodes[addr] = makeClusterNode(addr)
+		start, end := i*slotCount/len(sorted), (i+1)*slotCount/len(sorted)
+		for slot := start; slot < end; slot++ {
+			table.owners[slot] = addr
+		}
+	}
+	return table
+}
+
+// route returns the node serving the slot and the nodes it moves to or from
+func (table *slotTable) route(slot int) (owner, migratingTo, importingFrom string) {
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+	return table.owners[slot], table.migrating[slot], table.importing[slot]
+}
+
+// slotRange is a continuous range of slots served by the same node
+type slotRange struct {
+	start, end int
+	node       *clusterNode
+}
+
+// ranges returns the slot ranges in ascending order
+func (table *slotTable) ranges() []*slotRange {
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+	var ranges []*slotRange
+	for slot := 0; slot < slotCount; slot++ {
+		owner := table.owners[slot]
+		if owner == "" {
+			continue
+		}
+		if n := len(ranges); n > 0 && ranges[n-1].node.addr == owner && ranges[n-1].end == slot-1 {
+			ranges[n-1].end = slot
+			continue
+		}
+		ranges = append(ranges, &slotRange{start: slot, end: slot, node: table.nodes[owner]})
+	}
+	return ranges
+}
+
+// sortedNodes returns all nodes ordered by address
+func (table *slotTable) sortedNodes() []*clusterNode {
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+	nodes := make([]*clusterNode, 0, len(table.nodes))
+	for _, node := range table.nodes {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		return nodes[i].addr < nodes[j].addr
+	})
+	return nodes
+}
+
+// execWithSlots executes the command if the current node serves the slot of its keys,
+// or redirects the client to the node serving it by MOVED or ASK
+func (cdb *Database) execWithSlots(c resp.Connection, args [][]byte) resp.Reply {
+	cmdName := strings.ToLower(string(args[0]))
+	switch cmdName {
+	case "cluster":
+		return execCluster(cdb, c, args)
+	case "asking":
+		if len(args) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		c.SetAsking(true)
+		return reply.MakeOKReply()
+	case "publish":
+		return publishFunc(cdb, c, args)
+	case relayPublish:
+		return relayPublishFunc(cdb, c, args)
+	}
+
+	// ASKING is valid for the next command only
+	asking := c.IsAsking()
+	c.SetAsking(false)
+	keys, ok := database2.GetRelatedKeys(args)
+	if !ok || len(keys) == 0 {
+		return cdb.db.Exec(c, args)
+	}
+	if errReply := cdb.checkSlot(c, cmdName, keys, asking); errReply != nil {
+		if c.InMultiState() {
+			c.AddTxError(errReply)
+		}
+		return errReply
+	}
+	return cdb.db.Exec(c, args)
+}
+
+// checkSlot returns an error reply if the keys are not served by the current node
+func (cdb *Database) checkSlot(c resp.Connection, cmdName string, keys []string, asking bool) reply.ErrorReply {
+	slot := getSlot(keys[0])
+	for _, key := range keys[1:] {
+		if getSlot(key) != slot {
+			return reply.MakeStandardErrReply("CROSSSLOT Keys in request don't hash to the same slot")
+		}
+	}
+	owner, migratingTo, importingFrom := cdb.slots.route(slot)
+	if owner == cdb.self {
+		// MIGRATE moves the keys still held, keys already moved are served by the node importing the slot
+		if migratingTo != "" && cmdName != "migrate" {
+			switch cdb.countLocally(c.GetDBIndex(), keys) {
+			case len(keys):
+			case 0:
+				return reply.MakeStandardErrReply("ASK " + strconv.Itoa(slot) + " " + migratingTo)
+			default:
+				return errTryAgain
+			}
+		}
+		return nil
+	}
+	if importingFrom != "" && (asking || cmdName == "restore-asking") {
+		// part of the keys may not have been moved yet
+		if len(keys) > 1 && cdb.countLocally(c.GetDBIndex(), keys) != len(keys) {
+			return errTryAgain
+		}
+		return nil
+	}
+	if owner == "" {
+		return reply.MakeStandardErrReply("CLUSTERDOWN Hash slot not served")
+	}
+	return reply.MakeStandardErrReply("MOVED " + strconv.Itoa(slot) + " " + owner)
+}
+
+// errTryAgain is returned while the keys of a multi-key command are split between the two nodes of a moving slot
+var errTryAgain = reply.MakeStandardErrReply("TRYAGAIN Multiple keys request during rehashing of slot")
+
+// countLocally counts the keys existing in the db of the current node
+func (cdb *Database) countLocally(dbIndex int, keys []string) int {
+	conn := &connection.Connection{}
+	conn.SelectDB(dbIndex)
+	r := cdb.db.Exec(conn, utils.ToCmdLine2("exists", toBytes(keys)...))
+	if intReply, ok := r.(*reply.IntReply); ok {
+		return int(intReply.Code)
+	}
+	return 0
+}
+
+func toBytes(keys []string) [][]byte {
+	args := make([][]byte, len(keys))
+	for i, key := range keys {
+		args[i] = []byte(key)
+	}
+	return args
+}
+
+// execCluster CLUSTER subcommand [args ...]
+func execCluster(cdb *Database, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("cluster")
+	}
+	subCmd := strings.ToLower(string(args[1]))
+	argNumErr := reply.MakeStandardErrReply("ERR wrong number of arguments for 'cluster|" + subCmd + "' command")
+	switch subCmd {
+	case "nodes":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		return reply.MakeBulkReply([]byte(clusterNodes(cdb)))
+	case "myid":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		return reply.MakeBulkReply([]byte(makeClusterNode(cdb.self).id))
+	case "info":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		return reply.MakeBulkReply([]byte(clusterInfo(cdb)))
+	case "meet":
+		if len(args) != 4 {
+			return argNumErr
+		}
+		return clusterMeet(cdb, args[2:])
+	case "forget":
+		if len(args) != 3 {
+			return argNumErr
+		}
+		return clusterForget(cdb, string(args[2]))
+	}
+	if cdb.slots == nil {
+		return reply.MakeStandardErrReply("ERR CLUSTER " + strings.ToUpper(subCmd) +
+			" requires clusterMode slots, keys are spread by consistent hashing in relay mode")
+	}
+	switch subCmd {
+	case "keyslot":
+		if len(args) != 3 {
+			return argNumErr
+		}
+		return reply.MakeIntReply(int64(getSlot(string(args[2]))))
+	case "countkeysinslot":
+		if len(args) != 3 {
+			return argNumErr
+		}
+		slot, err := parseSlot(args[2])
+		if err != nil {
+			return reply.MakeStandardErrReply(err.Error())
+		}
+		return reply.MakeIntReply(int64(len(cdb.keysInSlot(c.GetDBIndex(), slot, -1))))
+	case "getkeysinslot":
+		if len(args) != 4 {
+			return argNumErr
+		}
+		slot, err := parseSlot(args[2])
+		if err != nil {
+			return reply.MakeStandardErrReply(err.Error())
+		}
+		count, err := strconv.Atoi(string(args[3]))
+		if err != nil || count < 0 {
+			return reply.MakeStandardErrReply("ERR Invalid number of keys")
+		}
+		keys := cdb.keysInSlot(c.GetDBIndex(), slot, count)
+		return reply.MakeMultiBulkReply(toBytes(keys))
+	case "slots":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		return execClusterSlots(cdb)
+	case "shards":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		return execClusterShards(cdb)
+	case "setslot":
+		if len(args) < 4 {
+			return argNumErr
+		}
+		return execClusterSetSlot(cdb, args[2:])
+	}
+	return reply.MakeStandardErrReply("ERR unknown subcommand '" + subCmd + "'. Try CLUSTER HELP.")
+}
+
+var errInvalidSlot = errors.New("ERR Invalid slot")
+
+func parseSlot(arg []byte) (int, error) {
+	slot, err := strconv.Atoi(string(arg))
+	if err != nil || slot < 0 || slot >= slotCount {
+		return 0, errInvalidSlot
+	}
+	return slot, nil
+}
+
+// keysInSlot returns at most count keys of the current node in the slot, all keys if count is negative
+func (cdb *Database) keysInSlot(dbIndex int, slot int, count int) []string {
+	keys := make([]string, 0)
+	if count == 0 {
+		return keys
+	}
+	cdb.db.ForEach(dbIndex, func(key string, _ *database.DataEntity, _ *time.Time) bool {
+		if getSlot(key) == slot {
+			keys = append(keys, key)
+		}
+		return count < 0 || len(keys) < count
+	})
+	return keys
+}
+
+// execClusterSlots CLUSTER SLOTS
+func execClusterSlots(cdb *Database) resp.Reply {
+	ranges := cdb.slots.ranges()
+	replies := make([]resp.Reply, len(ranges))
+	for i, r := range ranges {
+		replies[i] = reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeIntReply(int64(r.start)),
+			reply.MakeIntReply(int64(r.end)),
+			reply.MakeMultiRawReply([]resp.Reply{
+				reply.MakeBulkReply([]byte(r.node.ip)),
+				reply.MakeIntReply(int64(r.node.port)),
+				reply.MakeBulkReply([]byte(r.node.id)),
+			}),
+		})
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+// execClusterShards CLUSTER SHARDS, every node is a shard of its own as there are no replicas in the cluster
+func execClusterShards(cdb *Database) resp.Reply {
+	slotsOfNode := make(map[string][]resp.Reply)
+	for _, r := range cdb.slots.ranges() {
+		slotsOfNode[r.node.addr] = append(slotsOfNode[r.node.addr],
+			reply.MakeIntReply(int64(r.start)), reply.MakeIntReply(int64(r.end)))
+	}
+	nodes := cdb.slots.sortedNodes()
+	shards := make([]resp.Reply, len(nodes))
+	for i, node := range nodes {
+		slots := slotsOfNode[node.addr]
+		if slots == nil {
+			slots = []resp.Reply{}
+		}
+		shards[i] = reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("slots")),
+			reply.MakeMultiRawReply(slots),
+			reply.MakeBulkReply([]byte("nodes")),
+			reply.MakeMultiRawReply([]resp.Reply{
+				reply.MakeMultiRawReply([]resp.Reply{
+					reply.MakeBulkReply([]byte("id")),
+					reply.MakeBulkReply([]byte(node.id)),
+					reply.MakeBulkReply([]byte("port")),
+					reply.MakeIntReply(int64(node.port)),
+					reply.MakeBulkReply([]byte("ip")),
+					reply.MakeBulkReply([]byte(node.ip)),
+					reply.MakeBulkReply([]byte("endpoint")),
+					reply.MakeBulkReply([]byte(node.ip)),
+					reply.MakeBulkReply([]byte("role")),
+					reply.MakeBulkReply([]byte("master")),
+					reply.MakeBulkReply([]byte("replication-offset")),
+					reply.MakeIntReply(0),
+					reply.MakeBulkReply([]byte("health")),
+					reply.MakeBulkReply([]byte("online")),
+				}),
+			}),
+		})
+	}
+	return reply.MakeMultiRawReply(shards)
+}
+
+// clusterNodes generates CLUSTER NODES, one line per node:
+// <id> <ip:port@cport> <flags> <master> <ping-sent> <pong-recv> <config-epoch> <link-state> <slot> ...
+func clusterNodes(cdb *Database) string {
+	rangesOfNode := make(map[string][]string)
+	if cdb.slots != nil {
+		for _, r := range cdb.slots.ranges() {
+			s := strconv.Itoa(r.start)
+			if r.end != r.start {
+				s += "-" + strconv.Itoa(r.end)
+			}
+			rangesOfNode[r.node.addr] = append(rangesOfNode[r.node.addr], s)
+		}
+		cdb.slots.mu.RLock()
+		for slot, addr := range cdb.slots.migrating {
+			rangesOfNode[cdb.self] = append(rangesOfNode[cdb.self],
+				"["+strconv.Itoa(slot)+"->-"+makeClusterNode(addr).id+"]")
+		}
+		for slot, addr := range cdb.slots.importing {
+			rangesOfNode[cdb.self] = append(rangesOfNode[cdb.self],
+				"["+strconv.Itoa(slot)+"-<-"+makeClusterNode(addr).id+"]")
+		}
+		cdb.slots.mu.RUnlock()
+	}
+
+	var sb strings.Builder
+	for _, addr := range cdb.nodeAddrs() {
+		node := makeClusterNode(addr)
+		flags, pingSent, pongReceived, linkState := "myself,master", "0", unixMilli(time.Now()), "connected"
+		if addr != cdb.self {
+			cdb.membersMu.RLock()
+			m, ok := cdb.members[addr]
+			if ok {
+				flags = "master"
+				switch {
+				case m.fail:
+					flags += ",fail"
+				case m.pfail:
+					flags += ",fail?"
+				}
+				if !m.met {
+					flags += ",handshake"
+				}
+				pingSent, pongReceived = unixMilli(m.pingSent), unixMilli(m.pongReceived)
+				if !m.link.connected() {
+					linkState = "disconnected"
+				}
+			}
+			cdb.membersMu.RUnlock()
+			if !ok {
+				// forgotten meanwhile
+				continue
+			}
+		}
+		fields := []string{
+			node.id,
+			node.ip + ":" + strconv.Itoa(node.port) + "@" + strconv.Itoa(node.port+busPortOffset),
+			flags, "-", pingSent, pongReceived, "0", linkState,
+		}
+		fields = append(fields, rangesOfNode[node.addr]...)
+		sb.WriteString(strings.Join(fields, " "))
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// unixMilli returns the unix time in milliseconds, 0 for the zero time
+func unixMilli(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+// clusterInfo generates CLUSTER INFO, the cluster is down while a slot is not assigned or served by a failing node,
+// or in relay mode while a node serving keys is failing
+func clusterInfo(cdb *Database) string {
+	cdb.membersMu.RLock()
+	failing := make(map[string]string)
+	for addr, m := range cdb.members {
+		switch {
+		case m.fail:
+			failing[addr] = flagFail
+		case m.pfail:
+			failing[addr] = flagPFail
+		}
+	}
+	cdb.membersMu.RUnlock()
+
+	assigned, pfail, fail := 0, 0, 0
+	if cdb.slots != nil {
+		for _, r := range cdb.slots.ranges() {
+			n := r.end - r.start + 1
+			assigned += n
+			switch failing[r.node.addr] {
+			case flagFail:
+				fail += n
+			case flagPFail:
+				pfail += n
+			}
+		}
+	}
+	state := "ok"
+	if cdb.slots != nil && (assigned < slotCount || fail > 0) {
+		state = "fail"
+	}
+	if cdb.slots == nil {
+		for node, weight := range cdb.peerPicker.Nodes() {
+			if weight > 0 && failing[node] == flagFail {
+				state = "fail"
+			}
+		}
+	}
+	nodes := len(cdb.nodeAddrs())
+	size := nodes
+	if cdb.slots != nil {
+		size = len(cdb.slots.servingNodes())
+	}
+	lines := []string{
+		"cluster_enabled:1",
+		"cluster_state:" + state,
+		"cluster_slots_assigned:" + strconv.Itoa(assigned),
+		"cluster_slots_ok:" + strconv.Itoa(assigned-pfail-fail),
+		"cluster_slots_pfail:" + strconv.Itoa(pfail),
+		"cluster_slots_fail:" + strconv.Itoa(fail),
+		"cluster_known_nodes:" + strconv.Itoa(nodes),
+		"cluster_size:" + strconv.Itoa(size),
+		"cluster_current_epoch:0",
+		"cluster_my_epoch:0",
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+// servingNodes returns the addresses of the nodes serving at least one slot
+func (table *slotTable) servingNodes() map[string]struct{} {
+	table.mu.RLock()
+	defer table.mu.RUnlock()
+	nodes := make(map[string]struct{})
+	for _, owner := range table.owners {
+		if owner != "" {
+			nodes[owner] = struct{}{}
+		}
+	}
+	return nodes
+}
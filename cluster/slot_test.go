@@ -0,0 +1,124 @@
+package cluster
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go-redis/config"
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+
+	database2 "go-redis/database"
+)
+
+// newSlotsDatabase makes the node self of a cluster of the nodes in slots mode, without gossip nor peers
+func newSlotsDatabase(t *testing.T, self string, nodes ...string) *Database {
+	t.Helper()
+	former := config.Properties
+	dir := t.TempDir()
+	config.Properties = &config.ServerProperties{
+		Databases:         16,
+		DBFilename:        filepath.Join(dir, "dump.rdb"),
+		ClusterConfigFile: filepath.Join(dir, "nodes.conf"),
+	}
+	db := database2.NewStandaloneDatabase()
+	t.Cleanup(func() {
+		_ = db.Close()
+		config.Properties = former
+	})
+	return &Database{
+		self:  self,
+		db:    db,
+		slots: makeSlotTable(append(nodes, self)),
+	}
+}
+
+func execOn(cdb *Database, c *connection.Connection, args ...string) string {
+	return string(cdb.Exec(c, utils.ToCmdLine(args...)).ToBytes())
+}
+
+func assertReply(t *testing.T, actual string, expected string) {
+	t.Helper()
+	if actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestGetSlot(t *testing.T) {
+	for key, expected := range map[string]int{
+		"foo":                  12182,
+		"{user1000}.following": getSlot("user1000"),
+		"a{b}c{d}":             getSlot("b"),
+		"{}foo":                getSlot("{}foo"), // an empty hash tag hashes the whole key
+		"foo{":                 getSlot("foo{"),
+	} {
+		if actual := getSlot(key); actual != expected {
+			t.Errorf("expected slot %d of %s, got %d", expected, key, actual)
+		}
+	}
+	if getSlot("{}foo") == getSlot("foo") {
+		t.Error("expected {}foo not to hash foo only")
+	}
+}
+
+func TestSlotTable(t *testing.T) {
+	// the same ranges as redis-cli --cluster create assigns to 3 nodes
+	table := makeSlotTable([]string{"127.0.0.1:7003", "127.0.0.1:7001", "127.0.0.1:7002"})
+	ranges := table.ranges()
+	expected := [][2]int{{0, 5460}, {5461, 10921}, {10922, 16383}}
+	if len(ranges) != len(expected) {
+		t.Fatalf("expected %d ranges, got %d", len(expected), len(ranges))
+	}
+	for i, r := range ranges {
+		if r.start != expected[i][0] || r.end != expected[i][1] || r.node.addr != "127.0.0.1:700"+string(rune('1'+i)) {
+			t.Errorf("expected slots %v on node %d, got %d-%d on %s", expected[i], i+1, r.start, r.end, r.node.addr)
+		}
+	}
+	if node := makeClusterNode("127.0.0.1:7001"); len(node.id) != 40 || node.port != 7001 || node.ip != "127.0.0.1" {
+		t.Errorf("unexpected node %+v", node)
+	}
+}
+
+func TestMovedRedirect(t *testing.T) {
+	self, other := "127.0.0.1:7001", "127.0.0.1:7002"
+	cdb := newSlotsDatabase(t, self, other)
+	c := &connection.Connection{}
+	// foo is in slot 12182 served by the second node, {b} in slot 3300 by the first one
+	assertReply(t, execOn(cdb, c, "SET", "foo", "v"), "-MOVED 12182 "+other+"\r\n")
+	assertReply(t, execOn(cdb, c, "SET", "{b}1", "v"), "+OK\r\n")
+	assertReply(t, execOn(cdb, c, "MSET", "{b}1", "v", "{a}2", "v"), "-CROSSSLOT Keys in request don't hash to the same slot\r\n")
+	assertReply(t, execOn(cdb, c, "CLUSTER", "KEYSLOT", "foo"), ":12182\r\n")
+	assertReply(t, execOn(cdb, c, "CLUSTER", "COUNTKEYSINSLOT", "3300"), ":1\r\n")
+	assertReply(t, execOn(cdb, c, "CLUSTER", "GETKEYSINSLOT", "3300", "10"), "*1\r\n$4\r\n{b}1\r\n")
+	assertReply(t, execOn(cdb, c, "CLUSTER", "COUNTKEYSINSLOT", "16384"), "-ERR Invalid slot\r\n")
+	// commands without keys are served by any node
+	assertReply(t, execOn(cdb, c, "PING"), "+PONG\r\n")
+
+	// a transaction with a key of another node is aborted
+	execOn(cdb, c, "MULTI")
+	execOn(cdb, c, "GET", "foo")
+	assertReply(t, execOn(cdb, c, "EXEC"), "-EXECABORT Transaction discarded because of previous errors.\r\n")
+}
+
+func TestAskRedirect(t *testing.T) {
+	self, other := "127.0.0.1:7001", "127.0.0.1:7002"
+	slot := getSlot("b")
+
+	// the slot of b moves from the current node to the other node
+	cdb := newSlotsDatabase(t, self, other)
+	c := &connection.Connection{}
+	execOn(cdb, c, "SET", "{b}kept", "v")
+	cdb.slots.migrating[slot] = other
+	assertReply(t, execOn(cdb, c, "GET", "{b}kept"), "$1\r\nv\r\n")
+	assertReply(t, execOn(cdb, c, "GET", "{b}moved"), "-ASK 3300 "+other+"\r\n")
+	assertReply(t, execOn(cdb, c, "MGET", "{b}kept", "{b}moved"), "-TRYAGAIN Multiple keys request during rehashing of slot\r\n")
+
+	// the other node imports the slot, it serves the slot only after ASKING
+	importing := newSlotsDatabase(t, other, self)
+	importing.slots.importing[slot] = self
+	assertReply(t, execOn(importing, c, "SET", "{b}moved", "v"), "-MOVED 3300 "+self+"\r\n")
+	assertReply(t, execOn(importing, c, "ASKING"), "+OK\r\n")
+	assertReply(t, execOn(importing, c, "SET", "{b}moved", "v"), "+OK\r\n")
+	// ASKING is valid for the next command only
+	assertReply(t, execOn(importing, c, "GET", "{b}moved"), "-MOVED 3300 "+self+"\r\n")
+}
@@ -0,0 +1,457 @@
+package cluster
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+	"go-redis/resp/reply"
+
+	database2 "go-redis/database"
+)
+
+// A command whose keys are served by several nodes is made atomic by a two phase commit.
+// The coordinator, the node the client is connected to, prepares the part of the command of every node,
+// which locks its keys, checks them and records undo logs. Once every node is prepared they all commit,
+// otherwise the prepared nodes roll back. Committing keeps the keys locked, they are released once every node
+// committed, so no client sees the command applied on some nodes only and a rollback after a failed commit
+// never overwrites later writes. A node rolls back by itself a transaction not committed in time and releases
+// a transaction not released in time, so keys are never locked forever by a coordinator which failed.
+
+const (
+	prepareCmd  = "_prepare"  // _prepare txid cmd [args ...]
+	commitCmd   = "_commit"   // _commit txid
+	rollbackCmd = "_rollback" // _rollback txid
+	releaseCmd  = "_release"  // _release txid
+
+	// txLockTimeout bounds the time prepare waits for keys locked by other transactions,
+	// so transactions locking keys of several nodes in different orders never wait for each other forever
+	txLockTimeout = time.Second
+
+	// txMaxLockTime is the time a prepared transaction waits for commit before it is rolled back,
+	// a finished transaction is forgotten after the same time
+	txMaxLockTime = 3 * time.Second
+)
+
+// renameFrom is prepared on the node serving the source key of RENAME when the destination is served by
+// another node, prepare replies the value of the key and its expiration in unix ms, commit removes the key
+const renameFrom = "renamefrom"
+
+type txStatus int
+
+const (
+	txPreparing txStatus = iota
+	txPrepared
+	txCommitted // the keys are still locked until released
+	txReleased
+	txRolledBack
+)
+
+// transaction is the part of a command spanning nodes executed by the current node
+type transaction struct {
+	id      string
+	cdb     *Database
+	conn    resp.Connection // selects the db of the coordinator
+	cmdLine [][]byte        // executed on commit
+	keys    []string
+	undoLog [][][]byte
+
+	mu     sync.Mutex // guards the fields below
+	status txStatus
+	timer  *time.Timer
+}
+
+var txCounter uint64
+
+// newTxID returns an id unique across the cluster
+func (cdb *Database) newTxID() string {
+	return cdb.self + "-" + strconv.FormatInt(time.Now().UnixNano(), 36) + "-" +
+		strconv.FormatUint(atomic.AddUint64(&txCounter, 1), 10)
+}
+
+// execPrepare _PREPARE txid cmd [args ...]
+func execPrepare(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	if len(cmdArgs) < 3 {
+		return reply.MakeArgNumErrReply(prepareCmd)
+	}
+	txID := string(cmdArgs[1])
+	cmdLine := cmdArgs[2:]
+	conn := &connection.Connection{}
+	conn.SelectDB(c.GetDBIndex())
+	tx := &transaction{
+		id:      txID,
+		cdb:     cdb,
+		conn:    conn,
+		cmdLine: cmdLine,
+	}
+	if strings.ToLower(string(cmdLine[0])) == renameFrom {
+		if len(cmdLine) != 2 {
+			return reply.MakeArgNumErrReply(renameFrom)
+		}
+		tx.cmdLine = utils.ToCmdLine2("del", cmdLine[1])
+	}
+	keys, ok := database2.GetRelatedKeys(tx.cmdLine)
+	if !ok || len(keys) == 0 {
+		return reply.MakeStandardErrReply("ERR command can not be prepared: " + string(cmdLine[0]))
+	}
+	tx.keys = keys
+
+	cdb.txMu.Lock()
+	if _, exists := cdb.transactions[txID]; exists {
+		cdb.txMu.Unlock()
+		return reply.MakeStandardErrReply("ERR transaction " + txID + " already exists")
+	}
+	cdb.transactions[txID] = tx
+	cdb.txMu.Unlock()
+	return tx.prepare(strings.ToLower(string(cmdLine[0])) == renameFrom)
+}
+
+// prepare locks the keys and records undo logs, the keys stay locked until commit or rollback
+func (tx *transaction) prepare(renaming bool) resp.Reply {
+	db := tx.cdb.db
+	dbIndex := tx.conn.GetDBIndex()
+	locked := make(chan struct{})
+	go func() {
+		db.RWLocks(dbIndex, tx.keys, nil)
+		close(locked)
+	}()
+	timer := time.NewTimer(txLockTimeout)
+	defer timer.Stop()
+	select {
+	case <-locked:
+	case <-timer.C:
+		tx.mu.Lock()
+		tx.status = txRolledBack
+		tx.mu.Unlock()
+		tx.forgetLater()
+		// the keys are released as soon as they are locked
+		go func() {
+			<-locked
+			db.RWUnLocks(dbIndex, tx.keys, nil)
+		}()
+		return reply.MakeStandardErrReply("ERR timeout waiting for keys locked by another transaction")
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.status == txRolledBack {
+		// rolled back by the coordinator while waiting for the keys
+		db.RWUnLocks(dbIndex, tx.keys, nil)
+		return reply.MakeStandardErrReply("ERR transaction " + tx.id + " is rolled back")
+	}
+	result := tx.check(renaming)
+	if reply.IsErrReply(result) {
+		tx.status = txRolledBack
+		db.RWUnLocks(dbIndex, tx.keys, nil)
+		tx.forgetLater()
+		return result
+	}
+	tx.undoLog = db.GetUndoLogs(dbIndex, tx.cmdLine)
+	tx.status = txPrepared
+	tx.timer = time.AfterFunc(txMaxLockTime, func() {
+		tx.rollback()
+	})
+	return result
+}
+
+// check validates the command once its keys are locked, its result is the reply of prepare.
+// The source of RENAME replies its value and its expiration in unix ms, 0 if it has no ttl,
+// RESTORE without REPLACE fails at once if the key exists.
+func (tx *transaction) check(renaming bool) resp.Reply {
+	db := tx.cdb.db
+	key := tx.keys[0]
+	if renaming {
+		dumped := db.ExecWithLock(tx.conn, utils.ToCmdLine("dump", key))
+		payload, ok := dumped.(*reply.BulkReply)
+		if !ok {
+			if reply.IsErrReply(dumped) {
+				return dumped
+			}
+			return reply.MakeStandardErrReply("ERR no such key")
+		}
+		expireAt := int64(0)
+		if r, ok := db.ExecWithLock(tx.conn, utils.ToCmdLine("pexpiretime", key)).(*reply.IntReply); ok && r.Code > 0 {
+			expireAt = r.Code
+		}
+		return reply.MakeMultiBulkReply([][]byte{payload.Arg, []byte(strconv.FormatInt(expireAt, 10))})
+	}
+	if strings.ToLower(string(tx.cmdLine[0])) == "restore" && !hasArg(tx.cmdLine[4:], "replace") {
+		if r, ok := db.ExecWithLock(tx.conn, utils.ToCmdLine("exists", key)).(*reply.IntReply); ok && r.Code > 0 {
+			return reply.MakeStandardErrReply("BUSYKEY Target key name already exists.")
+		}
+	}
+	return reply.MakeOKReply()
+}
+
+func hasArg(args [][]byte, arg string) bool {
+	for _, a := range args {
+		if strings.EqualFold(string(a), arg) {
+			return true
+		}
+	}
+	return false
+}
+
+// execCommit _COMMIT txid
+func execCommit(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	if len(cmdArgs) != 2 {
+		return reply.MakeArgNumErrReply(commitCmd)
+	}
+	tx := cdb.getTransaction(string(cmdArgs[1]))
+	if tx == nil {
+		return reply.MakeStandardErrReply("ERR transaction " + string(cmdArgs[1]) + " not found")
+	}
+	return tx.commit()
+}
+
+// commit executes the command, the keys stay locked until release, the keys of a failed command are released
+func (tx *transaction) commit() resp.Reply {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.status != txPrepared {
+		return reply.MakeStandardErrReply("ERR transaction " + tx.id + " is not prepared")
+	}
+	tx.timer.Stop()
+	result := tx.cdb.db.ExecWithLock(tx.conn, tx.cmdLine)
+	if reply.IsErrReply(result) {
+		tx.status = txRolledBack
+		tx.cdb.db.RWUnLocks(tx.conn.GetDBIndex(), tx.keys, nil)
+		tx.forgetLater()
+		return result
+	}
+	tx.status = txCommitted
+	tx.timer = time.AfterFunc(txMaxLockTime, func() {
+		tx.release()
+	})
+	return result
+}
+
+// execRelease _RELEASE txid
+func execRelease(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	if len(cmdArgs) != 2 {
+		return reply.MakeArgNumErrReply(releaseCmd)
+	}
+	tx := cdb.getTransaction(string(cmdArgs[1]))
+	if tx == nil {
+		return reply.MakeStandardErrReply("ERR transaction " + string(cmdArgs[1]) + " not found")
+	}
+	return tx.release()
+}
+
+// release unlocks the keys of a committed transaction, it can not be rolled back any more
+func (tx *transaction) release() resp.Reply {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	if tx.status != txCommitted {
+		return reply.MakeStandardErrReply("ERR transaction " + tx.id + " is not committed")
+	}
+	tx.timer.Stop()
+	tx.cdb.db.RWUnLocks(tx.conn.GetDBIndex(), tx.keys, nil)
+	tx.status = txReleased
+	tx.forgetLater()
+	return reply.MakeOKReply()
+}
+
+// execRollback _ROLLBACK txid
+func execRollback(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	if len(cmdArgs) != 2 {
+		return reply.MakeArgNumErrReply(rollbackCmd)
+	}
+	txID := string(cmdArgs[1])
+	cdb.txMu.Lock()
+	tx, ok := cdb.transactions[txID]
+	if !ok {
+		// the rollback overtook the prepare, which fails once it arrives
+		tx = &transaction{id: txID, cdb: cdb, status: txRolledBack}
+		cdb.transactions[txID] = tx
+		tx.forgetLater()
+	}
+	cdb.txMu.Unlock()
+	tx.rollback()
+	return reply.MakeOKReply()
+}
+
+// rollback releases the keys of a prepared transaction, or restores the keys written by a committed one
+// which still holds them
+func (tx *transaction) rollback() {
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+	db := tx.cdb.db
+	switch tx.status {
+	case txPreparing:
+		// prepare releases the keys once it locked them
+	case txPrepared:
+		tx.timer.Stop()
+		db.RWUnLocks(tx.conn.GetDBIndex(), tx.keys, nil)
+		tx.forgetLater()
+	case txCommitted:
+		tx.timer.Stop()
+		for _, line := range tx.undoLog {
+			db.ExecWithLock(tx.conn, line)
+		}
+		db.RWUnLocks(tx.conn.GetDBIndex(), tx.keys, nil)
+		tx.forgetLater()
+	case txReleased, txRolledBack:
+		return
+	}
+	tx.status = txRolledBack
+}
+
+func (cdb *Database) getTransaction(txID string) *transaction {
+	cdb.txMu.Lock()
+	defer cdb.txMu.Unlock()
+	return cdb.transactions[txID]
+}
+
+// forgetLater removes the finished transaction, it is kept for a while so late messages of the coordinator
+// find it rolled back instead of starting it again
+func (tx *transaction) forgetLater() {
+	time.AfterFunc(txMaxLockTime, func() {
+		tx.cdb.txMu.Lock()
+		if tx.cdb.transactions[tx.id] == tx {
+			delete(tx.cdb.transactions, tx.id)
+		}
+		tx.cdb.txMu.Unlock()
+	})
+}
+
+// sendTx sends a message of the transaction to the node, the current node handles its own part directly
+func (cdb *Database) sendTx(node string, c resp.Connection, args [][]byte) resp.Reply {
+	if node != cdb.self {
+		return cdb.relay(node, c, args)
+	}
+	switch string(args[0]) {
+	case prepareCmd:
+		return execPrepare(cdb, c, args)
+	case commitCmd:
+		return execCommit(cdb, c, args)
+	case releaseCmd:
+		return execRelease(cdb, c, args)
+	default:
+		return execRollback(cdb, c, args)
+	}
+}
+
+// prepareTx prepares the command on the node
+func (cdb *Database) prepareTx(c resp.Connection, txID string, node string, cmdLine [][]byte) resp.Reply {
+	return cdb.sendTx(node, c, append(utils.ToCmdLine(prepareCmd, txID), cmdLine...))
+}
+
+// commitTx commits the transaction on all nodes in parallel, all nodes are rolled back if any fails,
+// otherwise they release the keys
+func (cdb *Database) commitTx(c resp.Connection, txID string, nodes []string) resp.Reply {
+	results := cdb.sendTxToAll(c, utils.ToCmdLine(commitCmd, txID), nodes)
+	for _, node := range nodes {
+		if reply.IsErrReply(results[node]) {
+			cdb.rollbackTx(c, txID, nodes)
+			return results[node]
+		}
+	}
+	cdb.sendTxToAll(c, utils.ToCmdLine(releaseCmd, txID), nodes)
+	return nil
+}
+
+// rollbackTx rolls the transaction back on all nodes in parallel
+func (cdb *Database) rollbackTx(c resp.Connection, txID string, nodes []string) {
+	cdb.sendTxToAll(c, utils.ToCmdLine(rollbackCmd, txID), nodes)
+}
+
+func (cdb *Database) sendTxToAll(c resp.Connection, args [][]byte, nodes []string) map[string]resp.Reply {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	results := make(map[string]resp.Reply, len(nodes))
+	for _, node := range nodes {
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			r := cdb.sendTx(node, c, args)
+			mu.Lock()
+			results[node] = r
+			mu.Unlock()
+		}(node)
+	}
+	wg.Wait()
+	return results
+}
+
+// msetFunc sets the keys of every node atomically
+// MSET k1 v1 [k2 v2 ...]
+func msetFunc(cdb *Database, c resp.Connection, cmdArgs [][]byte) resp.Reply {
+	if len(cmdArgs) < 3 || len(cmdArgs)%2 == 0 {
+		return reply.MakeArgNumErrReply("mset")
+	}
+	argsOfNode := make(map[string][][]byte)
+	for i := 1; i < len(cmdArgs); i += 2 {
+		node := cdb.peerPicker.PickNode(string(cmdArgs[i]))
+		argsOfNode[node] = append(argsOfNode[node], cmdArgs[i], cmdArgs[i+1])
+	}
+	if len(argsOfNode) == 1 {
+		for node := range argsOfNode {
+			return cdb.relay(node, c, cmdArgs)
+		}
+	}
+	// nodes are prepared in the same order by every coordinator, so transactions rarely wait for each other
+	nodes := make([]string, 0, len(argsOfNode))
+	for node := range argsOfNode {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	txID := cdb.newTxID()
+	for i, node := range nodes {
+		r := cdb.prepareTx(c, txID, node, utils.ToCmdLine2("mset", argsOfNode[node]...))
+		if reply.IsErrReply(r) {
+			cdb.rollbackTx(c, txID, nodes[:i+1])
+			return r
+		}
+	}
+	if errReply := cdb.commitTx(c, txID, nodes); errReply != nil {
+		return errReply
+	}
+	return reply.MakeOKReply()
+}
+
+// renameAcrossNodes moves the source key to the node serving the destination atomically,
+// the source is prepared first to get its value which the destination restores on commit
+func renameAcrossNodes(cdb *Database, c resp.Connection, srcNode, dstNode string, cmdArgs [][]byte) resp.Reply {
+	isRenameNX := strings.ToLower(string(cmdArgs[0])) == "renamenx"
+	txID := cdb.newTxID()
+	nodes := []string{srcNode, dstNode}
+	r := cdb.prepareTx(c, txID, srcNode, utils.ToCmdLine2(renameFrom, cmdArgs[1]))
+	if reply.IsErrReply(r) {
+		cdb.rollbackTx(c, txID, nodes[:1])
+		return r
+	}
+	dumped, ok := r.(*reply.MultiBulkReply)
+	if !ok || len(dumped.Args) != 2 {
+		cdb.rollbackTx(c, txID, nodes[:1])
+		return reply.MakeStandardErrReply("ERR bad reply of " + srcNode + " to prepare")
+	}
+
+	// RESTORE without REPLACE fails if the destination exists, which is what RENAMENX expects
+	restore := utils.ToCmdLine2("restore", cmdArgs[2], dumped.Args[1], dumped.Args[0], []byte("ABSTTL"))
+	if !isRenameNX {
+		restore = append(restore, []byte("REPLACE"))
+	}
+	r = cdb.prepareTx(c, txID, dstNode, restore)
+	if reply.IsErrReply(r) {
+		cdb.rollbackTx(c, txID, nodes)
+		if isRenameNX && strings.HasPrefix(string(r.ToBytes()), "-BUSYKEY") {
+			return reply.MakeIntReply(0)
+		}
+		return r
+	}
+	if errReply := cdb.commitTx(c, txID, nodes); errReply != nil {
+		return errReply
+	}
+	if isRenameNX {
+		return reply.MakeIntReply(1)
+	}
+	return reply.MakeOKReply()
+}
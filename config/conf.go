@@ -0,0 +1,280 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// envPrefix prefixes the environment variables overriding settings, e.g. REDIS_PORT=6380 or REDIS_APPENDONLY=yes
+const envPrefix = "REDIS_"
+
+// loader applies directives to properties, collecting the errors of all of them
+type loader struct {
+	props *ServerProperties
+	errs  []string
+	// set records the list settings assigned by the current source, the first directive of a source replaces
+	// the value of the previous source and the following ones append to it, as save does in redis.conf
+	set map[*setting]bool
+	// including is the set of files being read, a file including itself directly or indirectly is an error
+	including map[string]bool
+}
+
+func newLoader(props *ServerProperties) *loader {
+	return &loader{props: props, including: make(map[string]bool)}
+}
+
+func (l *loader) failed(source string, directive string, reason string) {
+	l.errs = append(l.errs, fmt.Sprintf("%s: '%s': %s", source, directive, reason))
+}
+
+// beginSource starts a new source of directives: a config file with the files it includes, the environment
+// or the command line
+func (l *loader) beginSource() {
+	l.set = make(map[*setting]bool)
+}
+
+// apply applies a directive, e.g. port 6380
+func (l *loader) apply(source string, directive string, args []string) {
+	s := findSetting(args[0])
+	if s == nil {
+		l.failed(source, directive, "Bad directive or wrong number of arguments")
+		return
+	}
+	if err := s.setArgs(l.props, args[1:], !l.set[s]); err != nil {
+		l.failed(source, directive, err.Error())
+		return
+	}
+	l.set[s] = true
+}
+
+// loadConf reads a config file in the redis.conf format, one directive per line, blank lines and lines starting
+// with # are ignored. "include <file>" reads another file in place, relative to the directory of the including file.
+func (l *loader) loadConf(filename string) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		l.errs = append(l.errs, err.Error())
+		return
+	}
+	l.loadConfData(filename, data)
+}
+
+// loadConfData reads the content of a config file in the redis.conf format
+func (l *loader) loadConfData(filename string, data []byte) {
+	abs, _ := filepath.Abs(filename)
+	l.including[abs] = true
+	defer delete(l.including, abs)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		source := fmt.Sprintf("%s:%d", filename, lineNum)
+		args, err := splitArgs(line)
+		if err != nil {
+			l.failed(source, line, err.Error())
+			continue
+		}
+		if strings.ToLower(args[0]) != "include" {
+			l.apply(source, line, args)
+			continue
+		}
+		if len(args) != 2 {
+			l.failed(source, line, "Bad directive or wrong number of arguments")
+			continue
+		}
+		included := args[1]
+		if !filepath.IsAbs(included) {
+			included = filepath.Join(filepath.Dir(filename), included)
+		}
+		if abs, _ := filepath.Abs(included); l.including[abs] {
+			l.failed(source, line, "the file includes itself")
+			continue
+		}
+		l.loadConf(included)
+	}
+	if err := scanner.Err(); err != nil {
+		l.errs = append(l.errs, fmt.Sprintf("%s: %v", filename, err))
+	}
+}
+
+// loadEnv applies the environment variables named after settings, e.g. REDIS_MAXMEMORY=64mb.
+// Values are split like the arguments of a directive in redis.conf.
+func (l *loader) loadEnv() {
+	for _, s := range settings {
+		name := envPrefix + strings.ToUpper(strings.ReplaceAll(s.name, "-", "_"))
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		args, err := splitArgs(value)
+		if err != nil {
+			l.failed(name, value, err.Error())
+			continue
+		}
+		if len(args) == 0 {
+			// an empty variable sets an empty value, e.g. REDIS_SAVE= disables snapshots
+			args = []string{""}
+		}
+		l.apply(name, s.name+" "+value, append([]string{s.name}, args...))
+	}
+}
+
+// loadArgs applies the options of the command line, each "--<setting>" is followed by its arguments,
+// e.g. --port 6380 --save 3600 1 --save 300 100
+func (l *loader) loadArgs(options []string) {
+	var args []string
+	flush := func() {
+		if len(args) == 1 {
+			// an option without argument sets an empty value
+			args = append(args, "")
+		}
+		if len(args) > 0 {
+			l.apply("command line", "--"+strings.Join(args, " "), args)
+		}
+		args = nil
+	}
+	for _, option := range options {
+		if strings.HasPrefix(option, "--") && len(option) > 2 {
+			flush()
+			args = []string{option[2:]}
+			continue
+		}
+		if len(args) == 0 {
+			l.failed("command line", option, "options must start with --")
+			continue
+		}
+		args = append(args, option)
+	}
+	flush()
+}
+
+// splitArgs splits a line of redis.conf into arguments separated by spaces. Arguments in double quotes may contain
+// escapes like \n and \x41, arguments in single quotes may contain \' only.
+func splitArgs(line string) ([]string, error) {
+	var args []string
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) {
+			i++
+		}
+		if i == len(line) {
+			return args, nil
+		}
+		var arg strings.Builder
+		inDouble, inSingle := false, false
+		for done := false; !done; {
+			if i == len(line) {
+				if inDouble || inSingle {
+					return nil, errors.New("unbalanced quotes in configuration line")
+				}
+				break
+			}
+			c := line[i]
+			switch {
+			case inDouble:
+				switch {
+				case c == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHex(line[i+2]) && isHex(line[i+3]):
+					b, _ := strconv.ParseUint(line[i+2:i+4], 16, 8)
+					arg.WriteByte(byte(b))
+					i += 3
+				case c == '\\' && i+1 < len(line):
+					i++
+					switch line[i] {
+					case 'n':
+						arg.WriteByte('\n')
+					case 'r':
+						arg.WriteByte('\r')
+					case 't':
+						arg.WriteByte('\t')
+					case 'b':
+						arg.WriteByte('\b')
+					case 'a':
+						arg.WriteByte('\a')
+					default:
+						arg.WriteByte(line[i])
+					}
+				case c == '"':
+					// the closing quote must be followed by a space or the end of the line
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errors.New("closing quote must be followed by a space")
+					}
+					done = true
+				default:
+					arg.WriteByte(c)
+				}
+			case inSingle:
+				switch {
+				case c == '\\' && i+1 < len(line) && line[i+1] == '\'':
+					arg.WriteByte('\'')
+					i++
+				case c == '\'':
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, errors.New("closing quote must be followed by a space")
+					}
+					done = true
+				default:
+					arg.WriteByte(c)
+				}
+			case isSpace(c):
+				done = true
+			case c == '"' && arg.Len() == 0:
+				inDouble = true
+			case c == '\'' && arg.Len() == 0:
+				inSingle = true
+			default:
+				arg.WriteByte(c)
+			}
+			i++
+		}
+		args = append(args, arg.String())
+	}
+}
+
+// quoteArg quotes the argument if splitArgs would not read it back as is
+func quoteArg(arg string) string {
+	needQuote := arg == ""
+	for i := 0; i < len(arg) && !needQuote; i++ {
+		c := arg[i]
+		needQuote = c <= ' ' || c > '~' || c == '"' || c == '\'' || c == '\\' || c == '#'
+	}
+	if !needQuote {
+		return arg
+	}
+	var quoted strings.Builder
+	quoted.WriteByte('"')
+	for i := 0; i < len(arg); i++ {
+		switch c := arg[i]; {
+		case c == '"' || c == '\\':
+			quoted.WriteByte('\\')
+			quoted.WriteByte(c)
+		case c == '\n':
+			quoted.WriteString(`\n`)
+		case c == '\r':
+			quoted.WriteString(`\r`)
+		case c == '\t':
+			quoted.WriteString(`\t`)
+		case c < ' ' || c > '~':
+			fmt.Fprintf(&quoted, `\x%02x`, c)
+		default:
+			quoted.WriteByte(c)
+		}
+	}
+	quoted.WriteByte('"')
+	return quoted.String()
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
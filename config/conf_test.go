@@ -0,0 +1,128 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	for line, expected := range map[string][]string{
+		`port 6380`:                {"port", "6380"},
+		`  save   3600 1  `:        {"save", "3600", "1"},
+		`requirepass "a b\"c\x41"`: {"requirepass", `a b"cA`},
+		`requirepass 'it\'s'`:      {"requirepass", "it's"},
+		`save ""`:                  {"save", ""},
+		`a"b`:                      {`a"b`},
+	} {
+		if actual, err := splitArgs(line); err != nil || !reflect.DeepEqual(actual, expected) {
+			t.Errorf("splitArgs(%s) = %q, %v, expected %q", line, actual, err, expected)
+		}
+	}
+	for _, line := range []string{`requirepass "open`, `requirepass 'open`, `requirepass "a"b`} {
+		if _, err := splitArgs(line); err == nil {
+			t.Errorf("expected %s refused", line)
+		}
+	}
+}
+
+func TestQuoteArg(t *testing.T) {
+	for _, arg := range []string{"plain", "", "a b", `q"uote`, "it's", `back\slash`, "#hash", "new\nline", "\x01bin\xff"} {
+		args, err := splitArgs("x " + quoteArg(arg))
+		if err != nil || len(args) != 2 || args[1] != arg {
+			t.Errorf("%q quoted as %s is read back as %q, %v", arg, quoteArg(arg), args, err)
+		}
+	}
+}
+
+func TestLoadConf(t *testing.T) {
+	dir := t.TempDir()
+	writeTestFile(t, filepath.Join(dir, "extra.conf"), "maxmemory 64mb\nslave-read-only no\n")
+	loadTestConfig(t, "redis.conf", `# comment
+port 6380
+include `+filepath.Join(dir, "extra.conf")+`
+save 3600 1
+save 300 100
+peers a:1 b:2
+peer-weights a:1 2
+appendonly yes
+`)
+	if Properties.Port != 6380 || Properties.MaxMemory != 64<<20 || Properties.ReplicaReadOnly || !Properties.AppendOnly {
+		t.Errorf("unexpected properties %+v", Properties)
+	}
+	if Properties.Save != "3600 1 300 100" {
+		t.Errorf("expected save lines appended, got %s", Properties.Save)
+	}
+	if !reflect.DeepEqual(Properties.Peers, []string{"a:1", "b:2"}) || !reflect.DeepEqual(Properties.PeerWeights, map[string]int{"a:1": 2}) {
+		t.Errorf("unexpected peers %v %v", Properties.Peers, Properties.PeerWeights)
+	}
+	if Properties.Bind != "127.0.0.1" {
+		t.Errorf("expected default bind, got %s", Properties.Bind)
+	}
+}
+
+func TestLoadOverrides(t *testing.T) {
+	setEnv(t, "REDIS_PORT", "6381")
+	setEnv(t, "REDIS_MAXMEMORY", "1mb")
+	setEnv(t, "REDIS_SAVE", "")
+	loadTestConfig(t, "redis.conf", "port 6380\nmaxmemory 2mb\nsave 3600 1\n", "--port", "6382", "--save", "60", "10", "--save", "30", "5")
+	if Properties.Port != 6382 {
+		t.Errorf("expected the command line to override port, got %d", Properties.Port)
+	}
+	if Properties.MaxMemory != 1<<20 {
+		t.Errorf("expected the environment to override maxmemory, got %d", Properties.MaxMemory)
+	}
+	if Properties.Save != "60 10 30 5" {
+		t.Errorf("expected the command line to replace save, got %s", Properties.Save)
+	}
+}
+
+func TestLoadYAML(t *testing.T) {
+	loadTestConfig(t, "config.yaml", "port: 6380\nappendOnly: yes\npeers:\n  - a:1\n", "--maxclients", "7")
+	if Properties.Port != 6380 || !Properties.AppendOnly || Properties.MaxClient != 7 || len(Properties.Peers) != 1 {
+		t.Errorf("unexpected properties %+v", Properties)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	formerProps := Properties
+	dir := t.TempDir()
+	conf := filepath.Join(dir, "redis.conf")
+	writeTestFile(t, conf, `port abc
+appendfsync sometimes
+bogus 1
+save 1
+requirepass "open
+include redis.conf
+`)
+	err := Load(conf, []string{"--timeout", "x"})
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, expected := range []string{"redis.conf:1: 'port abc'", "redis.conf:2:", "redis.conf:3:", "redis.conf:4:",
+		"redis.conf:5:", "redis.conf:6: 'include redis.conf': the file includes itself", "command line: '--timeout x'"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %s", expected, err)
+		}
+	}
+	if Properties != formerProps {
+		t.Error("invalid config changed the properties")
+	}
+
+	yamlFile := filepath.Join(dir, "config.yaml")
+	writeTestFile(t, yamlFile, "port: x\ndatabases: 0\nunknownKey: 1\n")
+	err = Load(yamlFile, nil)
+	if err == nil {
+		t.Fatal("expected errors")
+	}
+	for _, expected := range []string{"line 1", "unknownKey", "'databases 0'"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("expected %q in %s", expected, err)
+		}
+	}
+
+	if err := Load(filepath.Join(dir, "missing.conf"), nil); err == nil || !strings.Contains(err.Error(), "no such file") {
+		t.Errorf("expected missing file error, got %v", err)
+	}
+}
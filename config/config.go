@@ -1,9 +1,15 @@
 package config
 
 import (
-	"io/ioutil"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 
-	"go-redis/lib/file"
 	"go-redis/lib/logger"
 
 	"gopkg.in/yaml.v3"
@@ -18,36 +24,191 @@ type ServerProperties struct {
 	RequirePass    string `yaml:"requirePass"`
 	Databases      int    `yaml:"databases"`
 
+	// MaxClient above is the number of clients connected at the same time, more clients are rejected, 0 for no limit.
+	// Timeout is the number of seconds after which a client sending no command is closed, 0 never closes clients,
+	// subscribers are never closed as they only receive messages.
+	Timeout int `yaml:"timeout"`
+	// TcpKeepalive is the number of seconds between TCP keepalive probes sent to idle clients,
+	// so dead peers are detected and the connection stays alive in network equipment, 0 disables keepalive
+	TcpKeepalive int `yaml:"tcpKeepalive"`
+
+	// the aof file is rewritten automatically once it grows by AutoAofRewritePercentage
+	// since the last rewrite and is at least AutoAofRewriteMinSize bytes, 0 percentage disables it
+	AutoAofRewritePercentage int   `yaml:"autoAofRewritePercentage"`
+	AutoAofRewriteMinSize    int64 `yaml:"autoAofRewriteMinSize"`
+	// AppendFsync is the policy of flushing aof file to disk: always, everysec or no
+	AppendFsync string `yaml:"appendFsync"`
+
+	// Save lists "<seconds> <changes>" pairs, e.g. "3600 1 300 100", a snapshot is saved in background
+	// once at least changes writes happened within seconds, empty disables automatic snapshots
+	Save       string `yaml:"save"`
+	DBFilename string `yaml:"dbFilename"`
+
+	// ReplicaOf is "<host> <port>" of the master to replicate at startup, empty for a master
+	ReplicaOf  string `yaml:"replicaOf"`
+	MasterAuth string `yaml:"masterAuth"`
+	// ReplicaReadOnly rejects writes of clients other than the master on a replica
+	ReplicaReadOnly bool `yaml:"replicaReadOnly"`
+	// ReplBacklogSize is the number of bytes of the replication stream kept for partial resync
+	ReplBacklogSize int64 `yaml:"replBacklogSize"`
+	// ReplTimeout is the number of seconds without any data after which the replication link is dropped
+	ReplTimeout int `yaml:"replTimeout"`
+	// ReplPingReplicaPeriod is the number of seconds between two pings the master sends to replicas
+	ReplPingReplicaPeriod int `yaml:"replPingReplicaPeriod"`
+
 	Peers []string `yaml:"peers"`
 	Self  string   `yaml:"self"`
+	// PeerReplicas is the number of points each node of weight 1 is placed on the hash ring in relay mode,
+	// more points spread keys more evenly across nodes
+	PeerReplicas int `yaml:"peerReplicas"`
+	// PeerWeights maps nodes to their weight in relay mode, a node serves keys in proportion to its weight,
+	// nodes missing here have weight 1
+	PeerWeights map[string]int `yaml:"peerWeights"`
+	// ClusterMode is "relay" to forward commands to the node serving the key,
+	// or "slots" to map keys to the 16384 slots of redis cluster and redirect clients by MOVED and ASK
+	ClusterMode string `yaml:"clusterMode"`
+	// ClusterConfigFile records the node serving each slot in slots mode, so slots moved by resharding
+	// and nodes added to peers later do not change the owners of existing slots
+	ClusterConfigFile string `yaml:"clusterConfigFile"`
+	// AclFile lists the ACL users, one "user <name> <rules ...>" line each, loaded at startup and by ACL LOAD
+	// and written by ACL SAVE. Cluster nodes relay commands to each other as an internal user with requirePass,
+	// the permissions of clients are checked by the node they are connected to.
+	AclFile string `yaml:"aclFile"`
+	// AclLogMaxLen is the number of entries ACL LOG keeps
+	AclLogMaxLen int `yaml:"aclLogMaxLen"`
+
+	// ClusterEnabled starts the node in cluster mode even without peers, so other nodes can join it by CLUSTER MEET
+	ClusterEnabled bool `yaml:"clusterEnabled"`
+	// ClusterNodeTimeout is the number of milliseconds a node does not reply pings before it is considered failing
+	ClusterNodeTimeout int `yaml:"clusterNodeTimeout"`
+
+	// MaxMemory is the number of bytes of memory in use beyond which write commands are refused, 0 for no limit
+	MaxMemory int64 `yaml:"maxMemory"`
+	// LogLevel is the lowest level logged: debug, info, warn or error
+	LogLevel string `yaml:"logLevel"`
 }
 
-// Properties holds global config properties
+// Properties holds global config properties, the ones CONFIG SET changes are read through Snapshot
 var Properties *ServerProperties
 
+// ConfigFile is the absolute path of the config file loaded, empty if none
+var ConfigFile string
+
 func init() {
-	// default config
-	Properties = &ServerProperties{
+	Properties = defaultProperties()
+}
+
+// defaultProperties returns the properties used when the config file does not set them
+func defaultProperties() *ServerProperties {
+	return &ServerProperties{
 		Bind:       "127.0.0.1",
 		Port:       6379,
 		AppendOnly: false,
+		MaxClient:  10000,
+		Databases:  16,
+
+		TcpKeepalive:             300,
+		AutoAofRewritePercentage: 100,
+		AutoAofRewriteMinSize:    64 << 20,
+		AppendFsync:              "everysec",
+		DBFilename:               "dump.rdb",
+		ReplicaReadOnly:          true,
+		ReplBacklogSize:          1 << 20,
+		ReplTimeout:              60,
+		ReplPingReplicaPeriod:    10,
+		PeerReplicas:             100,
+		ClusterMode:              "relay",
+		ClusterConfigFile:        "nodes.conf",
+		ClusterNodeTimeout:       15000,
+		AclLogMaxLen:             128,
+		LogLevel:                 "info",
 	}
 }
 
-// SetupConfig reads config file and stores properties into Properties
-func SetupConfig(filename, dir string) {
+// Load reads the config file, then applies the environment variables and the options of the command line
+// overriding it, see loadEnv and loadArgs. Files ending with .yaml or .yml hold the properties in YAML,
+// other files are in the redis.conf format. Without a config file the defaults are overridden only.
+// Properties are not changed if any value is invalid, the error lists all of them.
+func Load(filename string, options []string) error {
+	props := defaultProperties()
+	l := newLoader(props)
+	configFile := ""
+	if filename != "" {
+		abs, err := filepath.Abs(filename)
+		if err != nil {
+			return err
+		}
+		configFile = abs
+		l.beginSource()
+		if isYAML(filename) {
+			l.loadYAML(filename)
+		} else {
+			l.loadConf(filename)
+		}
+	}
+	l.beginSource()
+	l.loadEnv()
+	l.beginSource()
+	l.loadArgs(options)
+	l.validate()
+	if len(l.errs) > 0 {
+		return errors.New("*** FATAL CONFIG ERROR ***\n" + strings.Join(l.errs, "\n"))
+	}
+
+	Properties = props
+	ConfigFile = configFile
+	return logger.SetLevel(Properties.LogLevel)
+}
+
+func isYAML(filename string) bool {
+	ext := strings.ToLower(filepath.Ext(filename))
+	return ext == ".yaml" || ext == ".yml"
+}
 
-	f, err := file.OpenFile(filename, dir)
+// loadYAML reads the properties of a YAML config file, unknown properties are errors
+func (l *loader) loadYAML(filename string) {
+	data, err := os.ReadFile(filename)
 	if err != nil {
-		logger.Fatal(err)
+		l.errs = append(l.errs, err.Error())
+		return
 	}
-	bs, err := ioutil.ReadAll(f)
-	if err != nil {
-		logger.Fatal(err)
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	err = decoder.Decode(l.props)
+	var typeErr *yaml.TypeError
+	switch {
+	case err == nil || err == io.EOF:
+	case errors.As(err, &typeErr):
+		for _, msg := range typeErr.Errors {
+			l.errs = append(l.errs, filename+": "+msg)
+		}
+	default:
+		l.errs = append(l.errs, filename+": "+err.Error())
 	}
+}
 
-	err = yaml.Unmarshal(bs, Properties)
-	if err != nil {
-		logger.Fatal(err)
+// validate checks the values which were not parsed as directives, i.e. the ones of YAML files
+func (l *loader) validate() {
+	for _, s := range settings {
+		v := s.field(l.props)
+		switch {
+		case s.list:
+			if err := s.setArgs(l.props, s.args(l.props), true); err != nil {
+				l.errs = append(l.errs, fmt.Sprintf("'%s %s': %v", s.name, s.format(l.props), err))
+			}
+		case v.Kind() == reflect.Int || v.Kind() == reflect.Int64 || len(s.enum) > 0:
+			value, err := s.parse(l.props, s.format(l.props))
+			if err != nil {
+				l.errs = append(l.errs, fmt.Sprintf("'%s %s': %v", s.name, s.format(l.props), err))
+				continue
+			}
+			v.Set(value)
+		}
+	}
+	if l.props.Port > 65535 {
+		l.errs = append(l.errs, fmt.Sprintf("'port %d': argument must be between 0 and 65535 inclusive", l.props.Port))
+	}
+	if l.props.Databases < 1 {
+		l.errs = append(l.errs, fmt.Sprintf("'databases %d': argument must be at least 1", l.props.Databases))
 	}
 }
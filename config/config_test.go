@@ -0,0 +1,57 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// loadTestConfig writes the content into a config file named filename in a temp dir and loads it with the options,
+// the former properties are restored after the test
+func loadTestConfig(t *testing.T, filename string, content string, options ...string) string {
+	t.Helper()
+	formerProps, formerFile := Properties, ConfigFile
+	t.Cleanup(func() {
+		Properties, ConfigFile = formerProps, formerFile
+	})
+	filename = filepath.Join(t.TempDir(), filename)
+	writeTestFile(t, filename, content)
+	if err := Load(filename, options); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func writeTestFile(t *testing.T, filename string, content string) {
+	t.Helper()
+	if err := os.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertFile(t *testing.T, filename string, expected string) {
+	t.Helper()
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != expected {
+		t.Errorf("expected file:\n%s\ngot:\n%s", expected, data)
+	}
+}
+
+// setEnv sets the environment variable during the test
+func setEnv(t *testing.T, key string, value string) {
+	t.Helper()
+	former, ok := os.LookupEnv(key)
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if ok {
+			_ = os.Setenv(key, former)
+		} else {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
@@ -0,0 +1,267 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// rewriteMarker precedes the directives CONFIG REWRITE appends to a redis.conf file
+const rewriteMarker = "# Generated by CONFIG REWRITE"
+
+// Rewrite writes the current properties into the config file loaded at startup, see CONFIG REWRITE.
+// Only the settings whose value differs from the one the file loads are written, the other lines of the file,
+// blank lines and comments included, are kept as is. Settings the file does not have are appended.
+func Rewrite() error {
+	if ConfigFile == "" {
+		return errors.New("The server is running without a config file")
+	}
+	setMu.Lock()
+	defer setMu.Unlock()
+
+	data, err := os.ReadFile(ConfigFile)
+	if err != nil {
+		return err
+	}
+	if isYAML(ConfigFile) {
+		data, err = rewriteYAML(data)
+	} else {
+		data = rewriteConf(data)
+	}
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(ConfigFile, data)
+}
+
+// changedSettings returns the settings whose current value differs from the value in props
+func changedSettings(props *ServerProperties) map[*setting]bool {
+	changed := make(map[*setting]bool)
+	for _, s := range settings {
+		if s.format(Properties) != s.format(props) {
+			changed[s] = true
+		}
+	}
+	return changed
+}
+
+// splitLines splits the content of a file into lines without the line breaks
+func splitLines(data []byte) []string {
+	content := strings.TrimSuffix(string(data), "\n")
+	if content == "" {
+		return nil
+	}
+	return strings.Split(content, "\n")
+}
+
+// loadConfLines returns the properties a redis.conf file with the lines loads, invalid lines are ignored
+func loadConfLines(lines []string) *ServerProperties {
+	l := newLoader(defaultProperties())
+	l.beginSource()
+	l.loadConfData(ConfigFile, []byte(strings.Join(lines, "\n")))
+	return l.props
+}
+
+// confDirectives returns the lines of the directive setting the current value, each pair of save takes a line.
+// With reset set, a list first clears the value the lines before may have set.
+func confDirectives(s *setting, reset bool) []string {
+	args := s.args(Properties)
+	for i, arg := range args {
+		args[i] = quoteArg(arg)
+	}
+	if len(args) == 0 {
+		return []string{s.name + ` ""`}
+	}
+	var lines []string
+	if reset && s.isList() {
+		lines = append(lines, s.name+` ""`)
+	}
+	if s.list {
+		for i := 0; i+1 < len(args); i += 2 {
+			lines = append(lines, s.name+" "+args[i]+" "+args[i+1])
+		}
+		return lines
+	}
+	return append(lines, s.name+" "+strings.Join(args, " "))
+}
+
+// rewriteConf rewrites a redis.conf file, the lines of a changed setting are replaced by its directives
+// at the first of them. Included files are left as is, settings they set to other values are appended
+// to the main file to override them.
+func rewriteConf(data []byte) []byte {
+	original := splitLines(data)
+	changed := changedSettings(loadConfLines(original))
+
+	lines := make([]string, 0, len(original))
+	written := make(map[*setting]bool)
+	hasMarker := false
+	for _, line := range original {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == rewriteMarker {
+			hasMarker = true
+		}
+		var s *setting
+		if trimmed != "" && trimmed[0] != '#' {
+			if args, err := splitArgs(trimmed); err == nil && len(args) > 0 {
+				s = findSetting(args[0])
+			}
+		}
+		switch {
+		case s == nil || !changed[s]:
+			lines = append(lines, line)
+		case !written[s]:
+			lines = append(lines, confDirectives(s, false)...)
+			written[s] = true
+		}
+	}
+
+	// the settings still differing are missing in the file or overridden by an included file
+	differing := changedSettings(loadConfLines(lines))
+	for _, s := range settings {
+		if !differing[s] {
+			continue
+		}
+		if !hasMarker {
+			lines = append(lines, rewriteMarker)
+			hasMarker = true
+		}
+		lines = append(lines, confDirectives(s, true)...)
+	}
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+// rewriteYAML rewrites a YAML file, the lines of a changed property are replaced, keeping its line comment
+func rewriteYAML(data []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	var root *yaml.Node
+	if doc.Kind == yaml.DocumentNode && len(doc.Content) > 0 {
+		root = doc.Content[0]
+		if root.Kind != yaml.MappingNode || root.Style&yaml.FlowStyle != 0 {
+			return nil, errors.New("the config file is not a block mapping of properties")
+		}
+	}
+	loaded := defaultProperties()
+	_ = yaml.Unmarshal(data, loaded)
+	changed := changedSettings(loaded)
+
+	lines := splitLines(data)
+	type replacement struct {
+		start, end int // lines replaced
+		text       []string
+	}
+	var replacements []replacement
+	present := make(map[*setting]bool)
+	for i := 0; root != nil && i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i], root.Content[i+1]
+		s := findSettingByKey(key.Value)
+		if s == nil {
+			continue
+		}
+		present[s] = true
+		if !changed[s] {
+			continue
+		}
+		start, end := key.Line-1, len(lines)
+		if i+2 < len(root.Content) {
+			end = root.Content[i+2].Line - 1
+		}
+		// blank lines and comments before the next property are kept
+		for end > start+1 && isBlankOrComment(lines[end-1]) {
+			end--
+		}
+		comment := value.LineComment
+		if comment == "" {
+			comment = key.LineComment
+		}
+		text, err := yamlProperty(s, comment)
+		if err != nil {
+			return nil, err
+		}
+		replacements = append(replacements, replacement{start: start, end: end, text: text})
+	}
+	// replace from the bottom so line numbers above stay valid
+	sort.Slice(replacements, func(i, j int) bool {
+		return replacements[i].start > replacements[j].start
+	})
+	for _, r := range replacements {
+		tail := append(append([]string(nil), r.text...), lines[r.end:]...)
+		lines = append(lines[:r.start], tail...)
+	}
+
+	for _, s := range settings {
+		if !changed[s] || present[s] {
+			continue
+		}
+		text, err := yamlProperty(s, "")
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, text...)
+	}
+	return []byte(strings.Join(lines, "\n") + "\n"), nil
+}
+
+func findSettingByKey(key string) *setting {
+	for _, s := range settings {
+		if s.key == key {
+			return s
+		}
+	}
+	return nil
+}
+
+func isBlankOrComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" || trimmed[0] == '#'
+}
+
+// yamlProperty returns the lines of the current value of the property, a single line keeps the comment
+func yamlProperty(s *setting, comment string) ([]string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	property := map[string]interface{}{s.key: s.field(Properties).Interface()}
+	if err := encoder.Encode(property); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	lines := splitLines(buf.Bytes())
+	if len(lines) == 1 && comment != "" {
+		lines[0] += " " + comment
+	}
+	return lines, nil
+}
+
+// writeFileAtomically writes a temporary file which then replaces the file, keeping its permissions
+func writeFileAtomically(filename string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), "temp-config-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if info, err := os.Stat(filename); err == nil {
+		_ = tmpFile.Chmod(info.Mode())
+	}
+	if _, err := tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filename)
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRewriteConfKeepsLayout(t *testing.T) {
+	content := `# server
+
+port 6380
+
+save 3600 1
+save 300 100
+
+# end
+`
+	filename := loadTestConfig(t, "redis.conf", content)
+	if err := Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, filename, content)
+
+	if err := Set([][2]string{{"maxmemory", "1mb"}, {"timeout", "30"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, filename, content+`# Generated by CONFIG REWRITE
+maxmemory 1048576
+timeout 30
+`)
+}
+
+func TestRewriteConfChangedSetting(t *testing.T) {
+	filename := loadTestConfig(t, "redis.conf", `port 6380
+save 3600 1
+
+save 300 100
+requirepass old
+`)
+	Properties.Save = "60 10"
+	if err := Set([][2]string{{"requirepass", "new pass"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, filename, `port 6380
+save 60 10
+
+requirepass "new pass"
+`)
+}
+
+func TestRewriteConfOverridesInclude(t *testing.T) {
+	extra := filepath.Join(t.TempDir(), "extra.conf")
+	writeTestFile(t, extra, "maxmemory 64mb\n")
+	filename := loadTestConfig(t, "redis.conf", "include "+extra+"\n")
+	if err := Set([][2]string{{"maxmemory", "0"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, filename, "include "+extra+`
+# Generated by CONFIG REWRITE
+maxmemory 0
+`)
+}
+
+func TestRewriteYAMLKeepsLayout(t *testing.T) {
+	content := `# server
+bind: 127.0.0.1
+
+port: 6380 # the port
+peers:
+  - a:1
+  - b:2
+
+# persistence
+appendOnly: yes
+`
+	filename := loadTestConfig(t, "config.yaml", content)
+	if err := Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, filename, content)
+
+	if err := Set([][2]string{{"timeout", "30"}}); err != nil {
+		t.Fatal(err)
+	}
+	Properties.Port = 6381
+	Properties.Peers = []string{"c:3"}
+	if err := Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, filename, `# server
+bind: 127.0.0.1
+
+port: 6381 # the port
+peers:
+  - c:3
+
+# persistence
+appendOnly: yes
+timeout: 30
+`)
+}
+
+func TestRewriteWithoutConfigFile(t *testing.T) {
+	former := ConfigFile
+	ConfigFile = ""
+	defer func() {
+		ConfigFile = former
+	}()
+	if err := Rewrite(); err == nil {
+		t.Error("expected error without config file")
+	}
+}
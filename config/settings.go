@@ -0,0 +1,401 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go-redis/lib/logger"
+	"go-redis/lib/wildcard"
+)
+
+// setting is a property of ServerProperties exposed by CONFIG GET and CONFIG SET under the name redis uses
+type setting struct {
+	name string
+	key  string // yaml key of the property
+	// mutable settings can be changed by CONFIG SET, the others are read once at startup
+	mutable bool
+	// memory values accept units, e.g. 64mb
+	memory bool
+	// enum lists the values accepted, any value of the type is accepted if empty
+	enum []string
+	// list settings are strings of fields a directive of redis.conf appends to, e.g. save 3600 1
+	list bool
+}
+
+// settings are ordered by name
+var settings = []*setting{
+	{name: "aclfile", key: "aclFile"},
+	{name: "acllog-max-len", key: "aclLogMaxLen", mutable: true},
+	{name: "appendfilename", key: "appendFilename"},
+	{name: "appendfsync", key: "appendFsync", mutable: true, enum: []string{"always", "everysec", "no"}},
+	{name: "appendonly", key: "appendOnly", mutable: true},
+	{name: "auto-aof-rewrite-min-size", key: "autoAofRewriteMinSize", mutable: true, memory: true},
+	{name: "auto-aof-rewrite-percentage", key: "autoAofRewritePercentage", mutable: true},
+	{name: "bind", key: "bind"},
+	{name: "cluster-config-file", key: "clusterConfigFile"},
+	{name: "cluster-enabled", key: "clusterEnabled"},
+	{name: "cluster-mode", key: "clusterMode", enum: []string{"relay", "slots"}},
+	{name: "cluster-node-timeout", key: "clusterNodeTimeout", mutable: true},
+	{name: "databases", key: "databases"},
+	{name: "dbfilename", key: "dbFilename"},
+	{name: "loglevel", key: "logLevel", mutable: true, enum: []string{"debug", "info", "warn", "error"}},
+	{name: "masterauth", key: "masterAuth", mutable: true},
+	{name: "maxclients", key: "maxClient", mutable: true},
+	{name: "maxmemory", key: "maxMemory", mutable: true, memory: true},
+	{name: "peer-replicas", key: "peerReplicas"},
+	{name: "peer-weights", key: "peerWeights"},
+	{name: "peers", key: "peers"},
+	{name: "port", key: "port"},
+	{name: "repl-backlog-size", key: "replBacklogSize", memory: true},
+	{name: "repl-ping-replica-period", key: "replPingReplicaPeriod", mutable: true},
+	{name: "repl-timeout", key: "replTimeout", mutable: true},
+	{name: "replica-read-only", key: "replicaReadOnly", mutable: true},
+	{name: "replicaof", key: "replicaOf"},
+	{name: "requirepass", key: "requirePass", mutable: true},
+	{name: "save", key: "save", list: true},
+	{name: "self", key: "self"},
+	{name: "tcp-keepalive", key: "tcpKeepalive", mutable: true},
+	{name: "timeout", key: "timeout", mutable: true},
+}
+
+// aliases are the former names of settings still accepted in redis.conf
+var aliases = map[string]string{
+	"slaveof":                "replicaof",
+	"slave-read-only":        "replica-read-only",
+	"repl-ping-slave-period": "repl-ping-replica-period",
+}
+
+var (
+	// setMu serializes CONFIG SET and CONFIG REWRITE
+	setMu sync.Mutex
+	// propsMu guards the mutable settings of Properties, which are read through Snapshot
+	propsMu sync.RWMutex
+	// onChange maps settings to the callbacks applying their new value
+	onChange = make(map[string]func() error)
+)
+
+func init() {
+	OnChange("loglevel", func() error {
+		return logger.SetLevel(Properties.LogLevel)
+	})
+}
+
+// OnChange sets the callback applying a new value of the setting after CONFIG SET changed Properties,
+// the change is reverted if the callback fails. It replaces the previous callback of the setting.
+func OnChange(name string, callback func() error) {
+	setMu.Lock()
+	onChange[name] = callback
+	setMu.Unlock()
+}
+
+// Snapshot returns a copy of Properties, settings CONFIG SET may change at any time must be read from it
+func Snapshot() ServerProperties {
+	propsMu.RLock()
+	defer propsMu.RUnlock()
+	return *Properties
+}
+
+func findSetting(name string) *setting {
+	name = strings.ToLower(name)
+	if alias, ok := aliases[name]; ok {
+		name = alias
+	}
+	for _, s := range settings {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// field returns the property of the setting in props
+func (s *setting) field(props *ServerProperties) reflect.Value {
+	v := reflect.ValueOf(props).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("yaml") == s.key {
+			return v.Field(i)
+		}
+	}
+	panic("no property has yaml key " + s.key)
+}
+
+// format returns the value of the setting the way CONFIG GET replies it
+func (s *setting) format(props *ServerProperties) string {
+	v := s.field(props)
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return "yes"
+		}
+		return "no"
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.String:
+		return v.String()
+	case reflect.Slice, reflect.Map:
+		return strings.Join(s.args(props), " ")
+	}
+	return ""
+}
+
+// isList tells whether the setting takes any number of arguments
+func (s *setting) isList() bool {
+	kind := s.field(&ServerProperties{}).Kind()
+	return s.list || kind == reflect.Slice || kind == reflect.Map
+}
+
+// args returns the value of the setting as the arguments of its directive in redis.conf
+func (s *setting) args(props *ServerProperties) []string {
+	v := s.field(props)
+	switch {
+	case v.Kind() == reflect.Slice:
+		return append([]string(nil), v.Interface().([]string)...)
+	case v.Kind() == reflect.Map:
+		weights := v.Interface().(map[string]int)
+		nodes := make([]string, 0, len(weights))
+		for node := range weights {
+			nodes = append(nodes, node)
+		}
+		sort.Strings(nodes)
+		fields := make([]string, 0, 2*len(nodes))
+		for _, node := range nodes {
+			fields = append(fields, node, strconv.Itoa(weights[node]))
+		}
+		return fields
+	case s.list:
+		return strings.Fields(v.String())
+	}
+	return []string{s.format(props)}
+}
+
+// setArgs sets the setting to the arguments of its directive in redis.conf, the command line or the environment.
+// Lists and maps take any number of arguments, which are appended to the current value unless reset is set,
+// a single empty argument clears them, e.g. save "".
+func (s *setting) setArgs(props *ServerProperties, args []string, reset bool) error {
+	v := s.field(props)
+	if len(args) == 1 && args[0] == "" && s.isList() {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch {
+	case v.Kind() == reflect.Slice:
+		var values []string
+		if !reset {
+			values = append(values, v.Interface().([]string)...)
+		}
+		for _, arg := range args {
+			if arg != "" {
+				values = append(values, arg)
+			}
+		}
+		v.Set(reflect.ValueOf(values))
+		return nil
+	case v.Kind() == reflect.Map:
+		fields := strings.Fields(strings.Join(args, " "))
+		if len(fields)%2 != 0 {
+			return errors.New("arguments must be <node> <weight> pairs")
+		}
+		weights := make(map[string]int)
+		if !reset {
+			for node, weight := range v.Interface().(map[string]int) {
+				weights[node] = weight
+			}
+		}
+		for i := 0; i < len(fields); i += 2 {
+			weight, err := strconv.Atoi(fields[i+1])
+			if err != nil || weight < 0 {
+				return fmt.Errorf("invalid weight '%s' of node %s", fields[i+1], fields[i])
+			}
+			weights[fields[i]] = weight
+		}
+		v.Set(reflect.ValueOf(weights))
+		return nil
+	case s.list:
+		fields := strings.Fields(strings.Join(args, " "))
+		if len(fields)%2 != 0 {
+			return errors.New("arguments must be <seconds> <changes> pairs")
+		}
+		for _, field := range fields {
+			if n, err := strconv.ParseInt(field, 10, 64); err != nil || n < 0 {
+				return fmt.Errorf("invalid number '%s'", field)
+			}
+		}
+		if !reset {
+			fields = append(strings.Fields(v.String()), fields...)
+		}
+		v.SetString(strings.Join(fields, " "))
+		return nil
+	}
+	if len(args) != 1 {
+		return errors.New("wrong number of arguments")
+	}
+	value, err := s.parse(props, args[0])
+	if err != nil {
+		return err
+	}
+	v.Set(value)
+	return nil
+}
+
+// parse converts the value of CONFIG SET to the type of the property
+func (s *setting) parse(props *ServerProperties, value string) (reflect.Value, error) {
+	v := s.field(props)
+	switch v.Kind() {
+	case reflect.Bool:
+		switch strings.ToLower(value) {
+		case "yes":
+			return reflect.ValueOf(true), nil
+		case "no":
+			return reflect.ValueOf(false), nil
+		}
+		return reflect.Value{}, errors.New("argument must be 'yes' or 'no'")
+	case reflect.Int, reflect.Int64:
+		var n int64
+		var err error
+		if s.memory {
+			n, err = ParseMemory(value)
+			if err != nil {
+				return reflect.Value{}, errors.New("argument must be a memory value")
+			}
+		} else {
+			n, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return reflect.Value{}, errors.New("argument couldn't be parsed into an integer")
+			}
+		}
+		if n < 0 {
+			return reflect.Value{}, errors.New("argument must be between 0 and 9223372036854775807 inclusive")
+		}
+		parsed := reflect.New(v.Type()).Elem()
+		parsed.SetInt(n)
+		return parsed, nil
+	case reflect.String:
+		if len(s.enum) > 0 {
+			value = strings.ToLower(value)
+			for _, allowed := range s.enum {
+				if value == allowed {
+					return reflect.ValueOf(value), nil
+				}
+			}
+			return reflect.Value{}, errors.New("argument(s) must be one of the following: " + strings.Join(s.enum, ", "))
+		}
+		return reflect.ValueOf(value), nil
+	}
+	return reflect.Value{}, errors.New("can't set config of this type")
+}
+
+// ParseMemory parses a number of bytes with an optional unit: k, kb, m, mb, g or gb, e.g. 64mb.
+// k is 1000 bytes while kb is 1024 bytes, and so on.
+func ParseMemory(value string) (int64, error) {
+	lower := strings.ToLower(value)
+	units := []struct {
+		suffix string
+		bytes  int64
+	}{
+		{"gb", 1 << 30}, {"mb", 1 << 20}, {"kb", 1 << 10},
+		{"g", 1000 * 1000 * 1000}, {"m", 1000 * 1000}, {"k", 1000}, {"b", 1},
+	}
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(lower, unit.suffix) {
+			lower = strings.TrimSuffix(lower, unit.suffix)
+			multiplier = unit.bytes
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * multiplier, nil
+}
+
+// Get returns the names and values of the settings matching any of the glob patterns, ordered by name
+func Get(patterns []string) [][2]string {
+	matchers := make([]*wildcard.Pattern, len(patterns))
+	for i, pattern := range patterns {
+		matchers[i] = wildcard.CompilePattern(strings.ToLower(pattern))
+	}
+	propsMu.RLock()
+	defer propsMu.RUnlock()
+	var result [][2]string
+	for _, s := range settings {
+		for _, matcher := range matchers {
+			if matcher.IsMatch(s.name) {
+				result = append(result, [2]string{s.name, s.format(Properties)})
+				break
+			}
+		}
+	}
+	return result
+}
+
+// Set changes the settings of name value pairs at once, nothing changes if any value is invalid
+// or any callback applying a value fails
+func Set(pairs [][2]string) error {
+	setMu.Lock()
+	defer setMu.Unlock()
+
+	type change struct {
+		s        *setting
+		old, new reflect.Value
+	}
+	changes := make([]change, 0, len(pairs))
+	seen := make(map[*setting]bool)
+	for _, pair := range pairs {
+		s := findSetting(pair[0])
+		if s == nil {
+			return fmt.Errorf("Unknown option or number of arguments for CONFIG SET - '%s'", pair[0])
+		}
+		failed := func(reason string) error {
+			return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - %s", pair[0], reason)
+		}
+		if !s.mutable {
+			return failed("can't set immutable config")
+		}
+		if seen[s] {
+			return failed("duplicate parameter")
+		}
+		seen[s] = true
+		value, err := s.parse(Properties, pair[1])
+		if err != nil {
+			return failed(err.Error())
+		}
+		old := reflect.New(value.Type()).Elem()
+		old.Set(s.field(Properties))
+		changes = append(changes, change{s: s, old: old, new: value})
+	}
+
+	propsMu.Lock()
+	for _, c := range changes {
+		c.s.field(Properties).Set(c.new)
+	}
+	propsMu.Unlock()
+	for i, c := range changes {
+		callback := onChange[c.s.name]
+		if callback == nil {
+			continue
+		}
+		if err := callback(); err != nil {
+			// revert all values, then apply the old values again
+			propsMu.Lock()
+			for _, c := range changes {
+				c.s.field(Properties).Set(c.old)
+			}
+			propsMu.Unlock()
+			for _, applied := range changes[:i] {
+				if callback := onChange[applied.s.name]; callback != nil {
+					_ = callback()
+				}
+			}
+			return fmt.Errorf("CONFIG SET failed (possibly related to argument '%s') - %v", c.s.name, err)
+		}
+	}
+	return nil
+}
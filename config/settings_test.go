@@ -0,0 +1,87 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	loadTestConfig(t, "redis.conf", "maxclients 50\nsave 3600 1 300 100\npeer-weights b:2 3 a:1 2\n")
+	expected := [][2]string{{"maxclients", "50"}, {"maxmemory", "0"}, {"peer-weights", "a:1 2 b:2 3"}, {"save", "3600 1 300 100"}}
+	if actual := Get([]string{"MAX*", "save", "peer-weights", "maxclients"}); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("expected %v, got %v", expected, actual)
+	}
+	if actual := Get([]string{"bogus"}); len(actual) != 0 {
+		t.Errorf("expected nothing, got %v", actual)
+	}
+}
+
+func TestSet(t *testing.T) {
+	loadTestConfig(t, "redis.conf", "")
+	if err := Set([][2]string{{"maxmemory", "64mb"}, {"appendonly", "YES"}, {"appendfsync", "Always"}}); err != nil {
+		t.Fatal(err)
+	}
+	if Properties.MaxMemory != 64<<20 || !Properties.AppendOnly || Properties.AppendFsync != "always" {
+		t.Errorf("unexpected properties %+v", Properties)
+	}
+	if err := Set([][2]string{{"maxmemory", "2k"}}); err != nil || Properties.MaxMemory != 2000 {
+		t.Errorf("expected 2000 bytes, got %d (%v)", Properties.MaxMemory, err)
+	}
+}
+
+func TestSetInvalid(t *testing.T) {
+	loadTestConfig(t, "redis.conf", "timeout 10\n")
+	for _, pairs := range [][][2]string{
+		{{"timeout", "20"}, {"bogus", "1"}},
+		{{"timeout", "20"}, {"port", "1"}},
+		{{"timeout", "20"}, {"timeout", "30"}},
+		{{"timeout", "20"}, {"maxmemory", "1x"}},
+		{{"timeout", "20"}, {"appendonly", "maybe"}},
+		{{"timeout", "20"}, {"appendfsync", "sometimes"}},
+		{{"timeout", "-1"}},
+	} {
+		if err := Set(pairs); err == nil {
+			t.Errorf("expected %v refused", pairs)
+		}
+		if Properties.Timeout != 10 {
+			t.Fatalf("%v changed timeout to %d", pairs, Properties.Timeout)
+		}
+	}
+}
+
+func TestSetRevertsFailedCallback(t *testing.T) {
+	loadTestConfig(t, "redis.conf", "timeout 10\nmaxclients 5\n")
+	var applied []int
+	OnChange("timeout", func() error {
+		applied = append(applied, Properties.Timeout)
+		return nil
+	})
+	OnChange("maxclients", func() error {
+		return errors.New("failed")
+	})
+	defer func() {
+		delete(onChange, "timeout")
+		delete(onChange, "maxclients")
+	}()
+	if err := Set([][2]string{{"timeout", "20"}, {"maxclients", "6"}}); err == nil {
+		t.Fatal("expected the failed callback to fail Set")
+	}
+	if Properties.Timeout != 10 || Properties.MaxClient != 5 {
+		t.Errorf("expected the values reverted, got timeout %d maxclients %d", Properties.Timeout, Properties.MaxClient)
+	}
+	if !reflect.DeepEqual(applied, []int{20, 10}) {
+		t.Errorf("expected the old timeout applied again, got %v", applied)
+	}
+}
+
+func TestParseMemory(t *testing.T) {
+	for value, expected := range map[string]int64{"100": 100, "1b": 1, "1k": 1000, "1kb": 1024, "2MB": 2 << 20, "1g": 1000 * 1000 * 1000, "1gb": 1 << 30} {
+		if actual, err := ParseMemory(value); err != nil || actual != expected {
+			t.Errorf("ParseMemory(%s) = %d, %v, expected %d", value, actual, err, expected)
+		}
+	}
+	if _, err := ParseMemory("1xb"); err == nil {
+		t.Error("expected 1xb refused")
+	}
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"go-redis/resp/connection"
+)
+
+func TestAofReload(t *testing.T) {
+	useTestConfig(t).AppendOnly = true
+	database := newTestDatabase(t)
+	assertReply(t, execCmd(database, "SET", "k", "v"), "+OK\r\n")
+	assertReply(t, execCmd(database, "RPUSH", "l", "a", "b"), ":2\r\n")
+	assertReply(t, execCmd(database, "SET", "t", "v", "EX", "100"), "+OK\r\n")
+	_ = database.Close()
+
+	database = newTestDatabase(t)
+	assertReply(t, execCmd(database, "GET", "k"), "$1\r\nv\r\n")
+	assertReply(t, execCmd(database, "LRANGE", "l", "0", "-1"), "*2\r\n$1\r\na\r\n$1\r\nb\r\n")
+	if ttl := execCmd(database, "TTL", "t"); ttl != ":100\r\n" && ttl != ":99\r\n" {
+		t.Errorf("expected ttl of t kept, got %q", ttl)
+	}
+}
+
+func TestAofRewrite(t *testing.T) {
+	useTestConfig(t).AppendOnly = true
+	database := newTestDatabase(t)
+	for i := 0; i < 10; i++ {
+		execCmd(database, "INCR", "counter")
+	}
+	execCmd(database, "SET", "deleted", "v")
+	execCmd(database, "DEL", "deleted")
+	if err := database.aofHandler.Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	execCmd(database, "SET", "after", "v")
+	_ = database.Close()
+
+	database = newTestDatabase(t)
+	assertReply(t, execCmd(database, "GET", "counter"), "$2\r\n10\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "deleted"), ":0\r\n")
+	assertReply(t, execCmd(database, "GET", "after"), "$1\r\nv\r\n")
+}
+
+func TestAofRewriteDataset(t *testing.T) {
+	useTestConfig(t).AppendOnly = true
+	database := newTestDatabase(t)
+	client := &connection.Connection{}
+	execOn(database, client, "SELECT", "3")
+	execOn(database, client, "RPUSH", "l", "a", "b", "c")
+	execOn(database, client, "LPOP", "l")
+	execOn(database, client, "SADD", "s", "1", "x")
+	execOn(database, client, "HSET", "h", "f", "v")
+	execOn(database, client, "ZADD", "z", "1.5", "m")
+	execOn(database, client, "SET", "ttl", "v", "EX", "100")
+	execOn(database, client, "SET", "expired", "v", "PX", "10")
+	time.Sleep(20 * time.Millisecond)
+	if err := database.aofHandler.Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	_ = database.Close()
+
+	database = newTestDatabase(t)
+	execOn(database, client, "SELECT", "3")
+	assertReply(t, execOn(database, client, "LRANGE", "l", "0", "-1"), multiBulk("b", "c"))
+	assertReply(t, execOn(database, client, "SCARD", "s"), ":2\r\n")
+	assertReply(t, execOn(database, client, "HGET", "h", "f"), "$1\r\nv\r\n")
+	assertReply(t, execOn(database, client, "ZSCORE", "z", "m"), "$3\r\n1.5\r\n")
+	if ttl := execOn(database, client, "TTL", "ttl"); ttl != ":100\r\n" && ttl != ":99\r\n" {
+		t.Errorf("expected ttl kept by the rewrite, got %q", ttl)
+	}
+	assertReply(t, execOn(database, client, "EXISTS", "expired"), ":0\r\n")
+	assertReply(t, execCmd(database, "KEYS", "*"), "*0\r\n")
+}
+
+// TestBGRewriteWrites checks the writes while rewriting in background are kept
+func TestBGRewriteWrites(t *testing.T) {
+	useTestConfig(t).AppendOnly = true
+	database := newTestDatabase(t)
+	for i := 0; i < 1000; i++ {
+		execCmd(database, "INCR", "n")
+	}
+	if err := database.aofHandler.BGRewrite(); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		execCmd(database, "INCR", "n")
+	}
+	for database.aofHandler.IsRewriting() {
+		time.Sleep(time.Millisecond)
+	}
+	execCmd(database, "INCR", "n")
+	_ = database.Close()
+
+	database = newTestDatabase(t)
+	assertReply(t, execCmd(database, "GET", "n"), "$4\r\n2001\r\n")
+}
@@ -8,14 +8,85 @@ var cmdTable = make(map[string]*command)
 // command redis command wrapper
 type command struct {
 	executor ExecFun // command executor
+	prepare  PreFunc // returns keys to lock before executing
 	arity    int     // arg count
 }
 
+// PreFunc analyses command line and returns the keys to be written and read,
+// Exec locks these keys so the executor runs atomically against other commands
+type PreFunc func(args [][]byte) ([]string, []string)
+
 // RegisterCommand adds a command to cmdTable
-func RegisterCommand(name string, executor ExecFun, arity int) {
+func RegisterCommand(name string, executor ExecFun, prepare PreFunc, arity int) {
 	name = strings.ToLower(name)
 	cmdTable[name] = &command{
 		executor: executor,
+		prepare:  prepare,
 		arity:    arity,
 	}
 }
+
+// noPrepare is used by commands which touch no key
+func noPrepare(args [][]byte) ([]string, []string) {
+	return nil, nil
+}
+
+// writeFirstKey is used by commands which only write the first key
+func writeFirstKey(args [][]byte) ([]string, []string) {
+	return []string{string(args[0])}, nil
+}
+
+// readFirstKey is used by commands which only read the first key
+func readFirstKey(args [][]byte) ([]string, []string) {
+	return nil, []string{string(args[0])}
+}
+
+// writeAllKeys is used by commands whose arguments are all keys to be written
+func writeAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return keys, nil
+}
+
+// readAllKeys is used by commands whose arguments are all keys to be read
+func readAllKeys(args [][]byte) ([]string, []string) {
+	keys := make([]string, len(args))
+	for i, v := range args {
+		keys[i] = string(v)
+	}
+	return nil, keys
+}
+
+// writeFirstTwoKeys is used by commands moving data from the first key to the second one
+func writeFirstTwoKeys(args [][]byte) ([]string, []string) {
+	return []string{string(args[0]), string(args[1])}, nil
+}
+
+// writeFirstReadOthers is used by commands storing the result computed from other keys into the first key
+func writeFirstReadOthers(args [][]byte) ([]string, []string) {
+	_, readKeys := readAllKeys(args[1:])
+	return []string{string(args[0])}, readKeys
+}
+
+// GetRelatedKeys returns the keys written or read by the command,
+// ok is false if the command is not a key command or has a wrong number of arguments
+func GetRelatedKeys(cmdLine [][]byte) (keys []string, ok bool) {
+	writeKeys, readKeys, ok := GetKeys(cmdLine)
+	if !ok {
+		return nil, false
+	}
+	return append(writeKeys, readKeys...), true
+}
+
+// GetKeys returns the keys written and the keys read by the command,
+// ok is false if the command is not a key command or has a wrong number of arguments
+func GetKeys(cmdLine [][]byte) (writeKeys []string, readKeys []string, ok bool) {
+	cmd, exists := cmdTable[strings.ToLower(string(cmdLine[0]))]
+	if !exists || !validateArity(cmd.arity, cmdLine) {
+		return nil, nil, false
+	}
+	writeKeys, readKeys = cmd.prepare(cmdLine[1:])
+	return writeKeys, readKeys, true
+}
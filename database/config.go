@@ -0,0 +1,77 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+
+	"go-redis/aof"
+	"go-redis/config"
+	"go-redis/lib/logger"
+)
+
+// errOOM is replied to write commands while more memory than maxMemory is in use
+var errOOM = errors.New("OOM command not allowed when used memory > 'maxmemory'.")
+
+// overMaxMemory tells whether more memory than maxMemory is in use, as sampled by statsCron
+func (database *StandaloneDatabase) overMaxMemory() bool {
+	maxMemory := config.Snapshot().MaxMemory
+	return maxMemory > 0 && database.stats != nil && database.stats.usedMemory.Get() > maxMemory
+}
+
+// applyMaxMemory samples the memory in use at once after CONFIG SET maxmemory, statsCron samples it afterwards
+func (database *StandaloneDatabase) applyMaxMemory() error {
+	if config.Snapshot().MaxMemory > 0 {
+		database.stats.sampleMemory()
+	}
+	return nil
+}
+
+// applyAppendOnly starts or stops appending writes to aof file after CONFIG SET appendonly.
+// Starting writes the whole dataset into a new aof file first, commands wait meanwhile.
+func (database *StandaloneDatabase) applyAppendOnly() error {
+	database.barrier.Lock()
+	defer database.barrier.Unlock()
+	if !config.Snapshot().AppendOnly {
+		if database.aofHandler != nil {
+			database.aofHandler.Close()
+			database.aofHandler = nil
+			logger.Info("append only file disabled")
+		}
+		return nil
+	}
+	if database.aofHandler != nil {
+		return nil
+	}
+
+	filename := config.Properties.AppendFilename
+	if filename == "" {
+		return errors.New("appendFilename is not set")
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), "temp-appendonly-*.aof")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if err := aof.WriteDataset(tmpFile, database); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpFile.Name(), filename); err != nil {
+		return err
+	}
+	handler, err := aof.OpenAofHandler(database, makeTmpDB)
+	if err != nil {
+		return err
+	}
+	database.aofHandler = handler
+	logger.Info("append only file enabled")
+	return nil
+}
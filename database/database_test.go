@@ -0,0 +1,72 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+	"go-redis/resp/reply"
+)
+
+// useTestConfig makes the properties of the test keep their files in a temp dir, the former ones are restored after it
+func useTestConfig(t *testing.T) *config.ServerProperties {
+	t.Helper()
+	dir := t.TempDir()
+	former := config.Properties
+	config.Properties = &config.ServerProperties{
+		Databases:       16,
+		AppendFilename:  filepath.Join(dir, "appendonly.aof"),
+		AppendFsync:     "always",
+		DBFilename:      filepath.Join(dir, "dump.rdb"),
+		ReplicaReadOnly: true,
+		ReplBacklogSize: 1 << 20,
+	}
+	t.Cleanup(func() {
+		config.Properties = former
+	})
+	return config.Properties
+}
+
+// newTestDatabase makes a database closed after the test
+func newTestDatabase(t *testing.T) *StandaloneDatabase {
+	t.Helper()
+	database := NewStandaloneDatabase()
+	t.Cleanup(func() {
+		_ = database.Close()
+	})
+	return database
+}
+
+// newMemoryDatabase makes a database without aof and background jobs, so expired keys are only removed lazily
+func newMemoryDatabase(t *testing.T) *StandaloneDatabase {
+	t.Helper()
+	useTestConfig(t)
+	return newBasicDatabase()
+}
+
+func execOn(database *StandaloneDatabase, client resp.Connection, args ...string) string {
+	ret := database.Exec(client, utils.ToCmdLine(args...))
+	if ret == nil {
+		return "<nil>"
+	}
+	return string(ret.ToBytes())
+}
+
+func execCmd(database *StandaloneDatabase, args ...string) string {
+	return execOn(database, &connection.Connection{}, args...)
+}
+
+func assertReply(t *testing.T, actual string, expected string) {
+	t.Helper()
+	if actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+// multiBulk returns the multi bulk reply of the strings
+func multiBulk(values ...string) string {
+	return string(reply.MakeMultiBulkReply(utils.ToCmdLine(values...)).ToBytes())
+}
@@ -2,25 +2,64 @@ package database
 
 import (
 	"strings"
+	"sync"
+	"time"
 
 	"go-redis/datastruct/dict"
 	"go-redis/interface/database"
 	"go-redis/interface/resp"
+	"go-redis/lib/sync/atomic"
+	"go-redis/lib/sync/lock"
 	"go-redis/resp/reply"
 )
 
+const (
+	// activeExpireSampleSize is the number of keys with ttl sampled in one round
+	activeExpireSampleSize = 20
+
+	// activeExpireTimeLimit bounds the time a single active expire cycle may take
+	activeExpireTimeLimit = 25 * time.Millisecond
+
+	// lockerSize is the number of mutexes keys are spread over
+	lockerSize = 1024
+)
+
 // DB represent a redis database
 type DB struct {
 	index  int
 	data   dict.Dict
-	addAof func(CmdLine)
+	ttlMap dict.Dict        // key -> expire time.Time
+	addAof func(...CmdLine) // lines added together are written next to each other
+
+	// versionMap records how many times a key was written, WATCH compares it to detect changes
+	versionMap dict.Dict // key -> uint32
+
+	// locker serializes commands touching the same keys,
+	// so a read-modify-write command is atomic although data only provides atomic Get and Put
+	locker *lock.Locks
+
+	// loading is set while replaying persisted commands,
+	// keys never expire during loading so later commands see the same keys as they did originally
+	loading atomic.Boolean
+
+	// barrier is held shared by commands and exclusively to start or stop a snapshot,
+	// so a snapshot never sees part of a command. It is shared by all dbs of a server.
+	barrier *sync.RWMutex
+	// snapshot is the running snapshot, nil if none, guarded by barrier
+	snapshot *snapshot
+	// stats is shared by all dbs of a server, nil if the db serves no client
+	stats *serverStats
 }
 
 // makeDB creates the first redis database
 func makeDB() *DB {
 	db := &DB{
-		data:   dict.MakeSyncDict(),
-		addAof: func(line CmdLine) {}, // avoid writing aof again while loadAof
+		data:       dict.MakeSyncDict(),
+		ttlMap:     dict.MakeSyncDict(),
+		versionMap: dict.MakeSyncDict(),
+		addAof:     func(lines ...CmdLine) {}, // avoid writing aof again while loadAof
+		locker:     lock.Make(lockerSize),
+		barrier:    &sync.RWMutex{},
 	}
 	return db
 }
@@ -31,8 +70,44 @@ type ExecFun func(db *DB, args [][]byte) resp.Reply
 // CmdLine redis command
 type CmdLine [][]byte
 
-// Exec runs redis command
+// Exec runs redis command, commands of a transaction are queued until EXEC
 func (db *DB) Exec(c resp.Connection, cmdLine CmdLine) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	switch cmdName {
+	case "multi":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return startMulti(c)
+	case "discard":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return discardMulti(c)
+	case "exec":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return db.execMulti(c)
+	case "watch":
+		if !validateArity(-2, cmdLine) {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return db.watch(c, cmdLine[1:])
+	case "unwatch":
+		if len(cmdLine) != 1 {
+			return reply.MakeArgNumErrReply(cmdName)
+		}
+		return unwatch(c)
+	}
+	if c.InMultiState() {
+		return enqueueCmd(c, cmdLine)
+	}
+	return db.execNormalCommand(cmdLine)
+}
+
+// execNormalCommand runs a command out of transaction
+func (db *DB) execNormalCommand(cmdLine CmdLine) resp.Reply {
 	if len(cmdTable) <= 0 {
 		return reply.MakeStandardErrReply("ERR empty cmd")
 	}
@@ -45,15 +120,35 @@ func (db *DB) Exec(c resp.Connection, cmdLine CmdLine) resp.Reply {
 	if !validateArity(cmd.arity, cmdLine) {
 		return reply.MakeArgNumErrReply(cmdName) // SET key
 	}
-	return cmd.executor(db, cmdLine[1:]) // SET k v -> k v
+	args := cmdLine[1:] // SET k v -> k v
+	if exclusiveCommands[cmdName] {
+		db.barrier.Lock()
+		defer db.barrier.Unlock()
+	} else {
+		db.barrier.RLock()
+		defer db.barrier.RUnlock()
+	}
+	writeKeys, readKeys := cmd.prepare(args)
+	db.locker.RWLocks(writeKeys, readKeys)
+	defer db.locker.RWUnLocks(writeKeys, readKeys)
+	defer db.addVersion(writeKeys...)
+	db.beforeWrite(writeKeys...)
+	return cmd.executor(db, args)
 }
 
-// GetEntity gets data entity bay key
+// GetEntity gets data entity bay key, an expired key is removed lazily.
+// Lookups are counted as keyspace hits and misses of INFO.
 func (db *DB) GetEntity(key string) (*database.DataEntity, bool) {
 	val, exists := db.data.Get(key)
-	if !exists {
+	if !exists || db.IsExpired(key) {
+		if db.stats != nil {
+			db.stats.misses.Add(1)
+		}
 		return nil, false
 	}
+	if db.stats != nil {
+		db.stats.hits.Add(1)
+	}
 	entity, _ := val.(*database.DataEntity)
 	return entity, true
 }
@@ -73,23 +168,138 @@ func (db *DB) PutIfAbsent(key string, entity *database.DataEntity) int {
 	return db.data.PutIfAbsent(key, entity)
 }
 
-// Remove removes a key
+// Remove removes a key together with its ttl
 func (db *DB) Remove(key string) int {
+	db.ttlMap.Remove(key)
 	return db.data.Remove(key)
 }
 
-// Removes removes a list of keys
+// Removes removes a list of keys, returns the number of keys removed which were not expired
 func (db *DB) Removes(keys ...string) int {
 	deleted := 0
 	for _, key := range keys {
-		deleted += db.data.Remove(key)
+		if db.IsExpired(key) {
+			continue
+		}
+		deleted += db.Remove(key)
 	}
 	return deleted
 }
 
 // Flush clears the DB
 func (db *DB) Flush() {
+	if db.snapshot != nil {
+		// runs exclusively, keys are copied into the snapshot and removed one by one,
+		// as the snapshot may be iterating over data
+		db.data.Foreach(func(key string, val interface{}) bool {
+			db.snapshot.preserve(db, key)
+			db.addVersion(key)
+			db.Remove(key)
+			return true
+		})
+		return
+	}
+	db.data.Foreach(func(key string, val interface{}) bool {
+		db.addVersion(key)
+		return true
+	})
 	db.data.Clear()
+	db.ttlMap.Clear()
+}
+
+// Expire sets the time at which the key will be removed
+func (db *DB) Expire(key string, expireTime time.Time) {
+	db.ttlMap.Put(key, expireTime)
+}
+
+// Persist removes the ttl of the key, returns 1 if the key had one
+func (db *DB) Persist(key string) int {
+	return db.ttlMap.Remove(key)
+}
+
+// ExpireTime returns the time at which the key will be removed
+func (db *DB) ExpireTime(key string) (time.Time, bool) {
+	raw, exists := db.ttlMap.Get(key)
+	if !exists {
+		return time.Time{}, false
+	}
+	expireTime, _ := raw.(time.Time)
+	return expireTime, true
+}
+
+// IsExpired checks whether the key is expired, an expired key is removed
+func (db *DB) IsExpired(key string) bool {
+	if db.loading.Get() {
+		return false
+	}
+	expireTime, exists := db.ExpireTime(key)
+	if !exists {
+		return false
+	}
+	expired := time.Now().After(expireTime)
+	if expired {
+		db.Remove(key)
+		db.addVersion(key)
+		if db.stats != nil {
+			db.stats.expired.Add(1)
+		}
+	}
+	return expired
+}
+
+// activeExpire samples keys with ttl and removes the expired ones,
+// it keeps sampling while more than a quarter of a sample is expired
+func (db *DB) activeExpire() {
+	start := time.Now()
+	for time.Since(start) < activeExpireTimeLimit {
+		keys := db.ttlMap.RandomDistinctKeys(activeExpireSampleSize)
+		if len(keys) == 0 {
+			return
+		}
+		expired := 0
+		for _, key := range keys {
+			db.locker.Lock(key)
+			if db.IsExpired(key) {
+				expired++
+			}
+			db.locker.UnLock(key)
+		}
+		if expired*4 <= len(keys) {
+			return
+		}
+	}
+}
+
+// ForEach visits keys which are not expired, expiration is nil if the key has no ttl
+func (db *DB) ForEach(cb func(key string, data *database.DataEntity, expiration *time.Time) bool) {
+	now := time.Now()
+	db.data.Foreach(func(key string, raw interface{}) bool {
+		entity, _ := raw.(*database.DataEntity)
+		var expiration *time.Time
+		if expireTime, exists := db.ExpireTime(key); exists {
+			if expireTime.Before(now) {
+				return true
+			}
+			expiration = &expireTime
+		}
+		return cb(key, entity, expiration)
+	})
+}
+
+// addVersion marks keys as modified
+func (db *DB) addVersion(keys ...string) {
+	for _, key := range keys {
+		db.versionMap.Put(key, db.GetVersion(key)+1)
+	}
+}
+
+// GetVersion returns how many times the key was written
+func (db *DB) GetVersion(key string) uint32 {
+	raw, exists := db.versionMap.Get(key)
+	if !exists {
+		return 0
+	}
+	return raw.(uint32)
 }
 
 // validateArity checks arity validation
@@ -0,0 +1,490 @@
+package database
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-redis/datastruct/dict"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/lib/wildcard"
+	"go-redis/resp/reply"
+)
+
+func init() {
+	RegisterCommand("hset", execHSet, writeFirstKey, -4)
+	RegisterCommand("hsetnx", execHSetNX, writeFirstKey, 4)
+	RegisterCommand("hmset", execHMSet, writeFirstKey, -4)
+	RegisterCommand("hget", execHGet, readFirstKey, 3)
+	RegisterCommand("hmget", execHMGet, readFirstKey, -3)
+	RegisterCommand("hexists", execHExists, readFirstKey, 3)
+	RegisterCommand("hdel", execHDel, writeFirstKey, -3)
+	RegisterCommand("hlen", execHLen, readFirstKey, 2)
+	RegisterCommand("hstrlen", execHStrLen, readFirstKey, 3)
+	RegisterCommand("hkeys", execHKeys, readFirstKey, 2)
+	RegisterCommand("hvals", execHVals, readFirstKey, 2)
+	RegisterCommand("hgetall", execHGetAll, readFirstKey, 2)
+	RegisterCommand("hincrby", execHIncrBy, writeFirstKey, 4)
+	RegisterCommand("hincrbyfloat", execHIncrByFloat, writeFirstKey, 4)
+	RegisterCommand("hrandfield", execHRandField, readFirstKey, -2)
+	RegisterCommand("hscan", execHScan, readFirstKey, -3)
+}
+
+// defaultScanCount is the default COUNT of SCAN family commands
+const defaultScanCount = 10
+
+// maxRandomCount bounds the negative count of HRANDFIELD and SRANDMEMBER, which returns as many elements
+// however small the key is, so the reply can not exhaust memory
+const maxRandomCount = 1 << 24
+
+// parseRandomCount parses the count of HRANDFIELD and SRANDMEMBER
+func parseRandomCount(arg []byte) (int64, reply.ErrorReply) {
+	count, err := strconv.ParseInt(string(arg), 10, 64)
+	if err != nil {
+		return 0, reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if count < -maxRandomCount {
+		return 0, reply.MakeStandardErrReply("ERR value is out of range")
+	}
+	return count, nil
+}
+
+// getAsDict returns the hash stored at key, dict is nil if the key does not exist
+func (db *DB) getAsDict(key string) (dict.Dict, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	d, ok := entity.Data.(dict.Dict)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	return d, nil
+}
+
+// getOrInitDict returns the hash stored at key, creates an empty one if the key does not exist
+func (db *DB) getOrInitDict(key string) (d dict.Dict, inited bool, errReply reply.ErrorReply) {
+	d, errReply = db.getAsDict(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	if d == nil {
+		d = dict.MakeSimpleDict()
+		db.PutEntity(key, &database.DataEntity{
+			Data: d,
+		})
+		inited = true
+	}
+	return d, inited, nil
+}
+
+// execHSet HSET key field value [field value ...]
+func execHSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 1 {
+		return reply.MakeArgNumErrReply("hset")
+	}
+	key := string(args[0])
+	d, _, errReply := db.getOrInitDict(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	added := 0
+	for i := 1; i < len(args); i += 2 {
+		added += d.Put(string(args[i]), args[i+1])
+	}
+	db.addAof(utils.ToCmdLine2("hset", args...))
+	return reply.MakeIntReply(int64(added))
+}
+
+// execHSetNX HSETNX key field value
+func execHSetNX(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	d, _, errReply := db.getOrInitDict(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	result := d.PutIfAbsent(string(args[1]), args[2])
+	if result > 0 {
+		db.addAof(utils.ToCmdLine2("hsetnx", args...))
+	}
+	return reply.MakeIntReply(int64(result))
+}
+
+// execHMSet HMSET key field value [field value ...]
+func execHMSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 1 {
+		return reply.MakeArgNumErrReply("hmset")
+	}
+	key := string(args[0])
+	d, _, errReply := db.getOrInitDict(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	for i := 1; i < len(args); i += 2 {
+		d.Put(string(args[i]), args[i+1])
+	}
+	db.addAof(utils.ToCmdLine2("hmset", args...))
+	return reply.MakeOKReply()
+}
+
+// execHGet HGET key field
+func execHGet(db *DB, args [][]byte) resp.Reply {
+	d, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return reply.MakeNullBulkReply()
+	}
+
+	val, exists := d.Get(string(args[1]))
+	if !exists {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(val.([]byte))
+}
+
+// execHMGet HMGET key field [field ...]
+func execHMGet(db *DB, args [][]byte) resp.Reply {
+	d, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+
+	result := make([][]byte, len(args)-1)
+	if d == nil {
+		return reply.MakeMultiBulkReply(result)
+	}
+	for i, field := range args[1:] {
+		val, exists := d.Get(string(field))
+		if exists {
+			result[i] = val.([]byte)
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execHExists HEXISTS key field
+func execHExists(db *DB, args [][]byte) resp.Reply {
+	d, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	_, exists := d.Get(string(args[1]))
+	if exists {
+		return reply.MakeIntReply(1)
+	}
+	return reply.MakeIntReply(0)
+}
+
+// execHDel HDEL key field [field ...]
+func execHDel(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	deleted := 0
+	for _, field := range args[1:] {
+		deleted += d.Remove(string(field))
+	}
+	if d.Len() == 0 {
+		db.Remove(key)
+	}
+	if deleted > 0 {
+		db.addAof(utils.ToCmdLine2("hdel", args...))
+	}
+	return reply.MakeIntReply(int64(deleted))
+}
+
+// execHLen HLEN key
+func execHLen(db *DB, args [][]byte) resp.Reply {
+	d, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(d.Len()))
+}
+
+// execHStrLen HSTRLEN key field
+func execHStrLen(db *DB, args [][]byte) resp.Reply {
+	d, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	val, exists := d.Get(string(args[1]))
+	if !exists {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(len(val.([]byte))))
+}
+
+// execHKeys HKEYS key
+func execHKeys(db *DB, args [][]byte) resp.Reply {
+	d, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+
+	fields := make([][]byte, 0, d.Len())
+	d.Foreach(func(key string, val interface{}) bool {
+		fields = append(fields, []byte(key))
+		return true
+	})
+	return reply.MakeMultiBulkReply(fields)
+}
+
+// execHVals HVALS key
+func execHVals(db *DB, args [][]byte) resp.Reply {
+	d, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+
+	values := make([][]byte, 0, d.Len())
+	d.Foreach(func(key string, val interface{}) bool {
+		values = append(values, val.([]byte))
+		return true
+	})
+	return reply.MakeMultiBulkReply(values)
+}
+
+// execHGetAll HGETALL key
+func execHGetAll(db *DB, args [][]byte) resp.Reply {
+	d, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+
+	result := make([][]byte, 0, d.Len()*2)
+	d.Foreach(func(key string, val interface{}) bool {
+		result = append(result, []byte(key), val.([]byte))
+		return true
+	})
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execHIncrBy HINCRBY key field increment
+func execHIncrBy(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	var current int64
+	if d != nil {
+		if val, exists := d.Get(field); exists {
+			current, err = strconv.ParseInt(string(val.([]byte)), 10, 64)
+			if err != nil {
+				return reply.MakeStandardErrReply("ERR hash value is not an integer")
+			}
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return reply.MakeStandardErrReply("ERR increment or decrement would overflow")
+	}
+
+	if d == nil {
+		d, _, _ = db.getOrInitDict(key)
+	}
+	result := current + delta
+	d.Put(field, []byte(strconv.FormatInt(result, 10)))
+	db.addAof(utils.ToCmdLine2("hincrby", args...))
+	return reply.MakeIntReply(result)
+}
+
+// execHIncrByFloat HINCRBYFLOAT key field increment
+func execHIncrByFloat(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	field := string(args[1])
+	delta, err := strconv.ParseFloat(string(args[2]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return reply.MakeStandardErrReply("ERR value is not a valid float")
+	}
+
+	d, errReply := db.getAsDict(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	var current float64
+	if d != nil {
+		if val, exists := d.Get(field); exists {
+			current, err = strconv.ParseFloat(string(val.([]byte)), 64)
+			if err != nil {
+				return reply.MakeStandardErrReply("ERR hash value is not a float")
+			}
+		}
+	}
+	result := current + delta
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return reply.MakeStandardErrReply("ERR increment would produce NaN or Infinity")
+	}
+
+	if d == nil {
+		d, _, _ = db.getOrInitDict(key)
+	}
+	resultBytes := formatFloat(result)
+	d.Put(field, resultBytes)
+	// writes the result rather than the increment, so float rounding can not drift while replaying
+	db.addAof(utils.ToCmdLine2("hset", args[0], args[1], resultBytes))
+	return reply.MakeBulkReply(resultBytes)
+}
+
+// execHRandField HRANDFIELD key [count [WITHVALUES]]
+func execHRandField(db *DB, args [][]byte) resp.Reply {
+	if len(args) > 3 {
+		return reply.MakeSyntaxErrReply()
+	}
+	d, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+
+	if len(args) == 1 {
+		if d == nil {
+			return reply.MakeNullBulkReply()
+		}
+		fields := d.RandomKeys(1)
+		return reply.MakeBulkReply([]byte(fields[0]))
+	}
+
+	count, errReply := parseRandomCount(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	withValues := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2])) != "WITHVALUES" {
+			return reply.MakeSyntaxErrReply()
+		}
+		withValues = true
+	}
+	if d == nil || count == 0 {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+
+	// a positive count returns distinct fields, a negative count allows repeated fields
+	var fields []string
+	if count > 0 {
+		fields = d.RandomDistinctKeys(int(count))
+	} else {
+		fields = d.RandomKeys(int(-count))
+	}
+	result := make([][]byte, 0, len(fields)*2)
+	for _, field := range fields {
+		result = append(result, []byte(field))
+		if withValues {
+			val, _ := d.Get(field)
+			result = append(result, val.([]byte))
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execHScan HSCAN key cursor [MATCH pattern] [COUNT count] [NOVALUES]
+// the cursor is an offset into the sorted fields, so it stays valid while the hash is unchanged
+func execHScan(db *DB, args [][]byte) resp.Reply {
+	cursor, err := strconv.Atoi(string(args[1]))
+	if err != nil || cursor < 0 {
+		return reply.MakeStandardErrReply("ERR invalid cursor")
+	}
+	var pattern *wildcard.Pattern
+	count := defaultScanCount
+	noValues := false
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "MATCH" && i+1 < len(args):
+			pattern = wildcard.CompilePattern(string(args[i+1]))
+			i++
+		case option == "COUNT" && i+1 < len(args):
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return reply.MakeSyntaxErrReply()
+			}
+			i++
+		case option == "NOVALUES":
+			noValues = true
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	d, errReply := db.getAsDict(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if d == nil {
+		return makeScanReply(0, nil)
+	}
+
+	fields := d.Keys()
+	sort.Strings(fields)
+	end := cursor + count
+	next := end
+	if end >= len(fields) {
+		end = len(fields)
+		next = 0
+	}
+	result := make([][]byte, 0)
+	for i := cursor; i < end; i++ {
+		if pattern != nil && !pattern.IsMatch(fields[i]) {
+			continue
+		}
+		result = append(result, []byte(fields[i]))
+		if !noValues {
+			val, _ := d.Get(fields[i])
+			result = append(result, val.([]byte))
+		}
+	}
+	return makeScanReply(next, result)
+}
+
+// makeScanReply replies the next cursor and the elements scanned
+func makeScanReply(cursor int, elements [][]byte) resp.Reply {
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(strconv.Itoa(cursor))),
+		reply.MakeMultiBulkReply(elements),
+	})
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestHashFields(t *testing.T) {
+	database := newMemoryDatabase(t)
+	assertReply(t, execCmd(database, "HSET", "h", "a", "1", "b", "2"), ":2\r\n")
+	assertReply(t, execCmd(database, "HSET", "h", "a", "3", "c", "4"), ":1\r\n")
+	assertReply(t, execCmd(database, "HSETNX", "h", "a", "5"), ":0\r\n")
+	assertReply(t, execCmd(database, "HGET", "h", "a"), "$1\r\n3\r\n")
+	assertReply(t, execCmd(database, "HGET", "h", "x"), "$-1\r\n")
+	assertReply(t, execCmd(database, "HMGET", "h", "b", "x", "c"), "*3\r\n$1\r\n2\r\n$-1\r\n$1\r\n4\r\n")
+	assertReply(t, execCmd(database, "HLEN", "h"), ":3\r\n")
+	assertReply(t, execCmd(database, "HSTRLEN", "h", "c"), ":1\r\n")
+	assertReply(t, execCmd(database, "HEXISTS", "h", "b"), ":1\r\n")
+	assertReply(t, execCmd(database, "HDEL", "h", "b", "x"), ":1\r\n")
+	assertReply(t, execCmd(database, "HEXISTS", "h", "b"), ":0\r\n")
+
+	// the key is removed with its last field
+	assertReply(t, execCmd(database, "HDEL", "h", "a", "c"), ":2\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "h"), ":0\r\n")
+
+	execCmd(database, "SET", "s", "v")
+	assertReply(t, execCmd(database, "HGET", "s", "a"), "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+}
+
+func TestHashIncr(t *testing.T) {
+	database := newMemoryDatabase(t)
+	assertReply(t, execCmd(database, "HINCRBY", "h", "n", "5"), ":5\r\n")
+	assertReply(t, execCmd(database, "HINCRBY", "h", "n", "-7"), ":-2\r\n")
+	assertReply(t, execCmd(database, "HINCRBY", "h", "n", "x"), "-ERR value is not an integer or out of range\r\n")
+	execCmd(database, "HSET", "h", "max", "9223372036854775807")
+	assertReply(t, execCmd(database, "HINCRBY", "h", "max", "1"), "-ERR increment or decrement would overflow\r\n")
+	assertReply(t, execCmd(database, "HINCRBYFLOAT", "h", "f", "1.5"), "$3\r\n1.5\r\n")
+	assertReply(t, execCmd(database, "HINCRBYFLOAT", "h", "f", "0.25"), "$4\r\n1.75\r\n")
+	assertReply(t, execCmd(database, "HINCRBYFLOAT", "h", "big", "1e300"), "$6\r\n1e+300\r\n")
+	assertReply(t, execCmd(database, "HINCRBYFLOAT", "h", "small", "1e-5"), "$5\r\n1e-05\r\n")
+	execCmd(database, "HSET", "h", "s", "abc")
+	assertReply(t, execCmd(database, "HINCRBY", "h", "s", "1"), "-ERR hash value is not an integer\r\n")
+	assertReply(t, execCmd(database, "HINCRBYFLOAT", "h", "s", "1"), "-ERR hash value is not a float\r\n")
+}
+
+func TestHashScan(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "HSET", "h", "a1", "1", "a2", "2", "b1", "3", "b2", "4", "c1", "5")
+	assertReply(t, execCmd(database, "HSCAN", "h", "0", "COUNT", "2"), "*2\r\n$1\r\n2\r\n"+multiBulk("a1", "1", "a2", "2"))
+	assertReply(t, execCmd(database, "HSCAN", "h", "2", "COUNT", "2", "NOVALUES"), "*2\r\n$1\r\n4\r\n"+multiBulk("b1", "b2"))
+	assertReply(t, execCmd(database, "HSCAN", "h", "4", "COUNT", "2"), "*2\r\n$1\r\n0\r\n"+multiBulk("c1", "5"))
+	assertReply(t, execCmd(database, "HSCAN", "h", "0", "MATCH", "*1", "NOVALUES"), "*2\r\n$1\r\n0\r\n"+multiBulk("a1", "b1", "c1"))
+	assertReply(t, execCmd(database, "HSCAN", "none", "0"), "*2\r\n$1\r\n0\r\n*0\r\n")
+	assertReply(t, execCmd(database, "HSCAN", "h", "0", "COUNT", "0"), "-Err syntax error\r\n")
+}
+
+func TestHashRandField(t *testing.T) {
+	database := newMemoryDatabase(t)
+	assertReply(t, execCmd(database, "HRANDFIELD", "h"), "$-1\r\n")
+	execCmd(database, "HSET", "h", "a", "1", "b", "2")
+	// a positive count larger than the hash returns every field once
+	reply := execCmd(database, "HRANDFIELD", "h", "5", "WITHVALUES")
+	if reply != multiBulk("a", "1", "b", "2") && reply != multiBulk("b", "2", "a", "1") {
+		t.Errorf("expected all fields with values, got %q", reply)
+	}
+	if reply := execCmd(database, "HRANDFIELD", "h", "-5"); len(reply) < 4 || reply[:4] != "*5\r\n" {
+		t.Errorf("expected 5 fields, got %q", reply)
+	}
+	// huge negative counts are refused before allocating the reply, the lowest one can not be negated
+	for _, count := range []string{"-100000000000", "-9223372036854775808"} {
+		assertReply(t, execCmd(database, "HRANDFIELD", "h", count), "-ERR value is out of range\r\n")
+	}
+	assertReply(t, execCmd(database, "HRANDFIELD", "h", "1x"), "-ERR value is not an integer or out of range\r\n")
+}
@@ -0,0 +1,267 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+)
+
+// RedisVersion is the version of redis whose commands are served, reported to clients by HELLO and INFO
+const RedisVersion = "7.0.0"
+
+// infoSection generates the lines of an INFO section
+type infoSection struct {
+	name     string // lower case name used to select the section
+	title    string
+	generate func(database *StandaloneDatabase) string
+}
+
+// infoSections are listed in the order INFO replies them
+var infoSections = []infoSection{
+	{name: "server", title: "Server", generate: serverInfo},
+	{name: "clients", title: "Clients", generate: clientsInfo},
+	{name: "memory", title: "Memory", generate: memoryInfo},
+	{name: "persistence", title: "Persistence", generate: persistenceInfo},
+	{name: "stats", title: "Stats", generate: statsInfo},
+	{name: "replication", title: "Replication", generate: replicationInfo},
+	{name: "cpu", title: "CPU", generate: cpuInfo},
+	{name: "cluster", title: "Cluster", generate: clusterInfo},
+	{name: "keyspace", title: "Keyspace", generate: keyspaceInfo},
+}
+
+func init() {
+	registerServerCommand("Info", execInfo, -1)
+}
+
+// execInfo INFO [section ...], unknown sections are ignored
+func execInfo(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	wanted := make(map[string]bool)
+	all := len(args) == 0
+	for _, arg := range args {
+		section := strings.ToLower(string(arg))
+		if section == "all" || section == "default" || section == "everything" {
+			all = true
+		}
+		wanted[section] = true
+	}
+
+	var buf bytes.Buffer
+	for _, section := range infoSections {
+		if !all && !wanted[section.name] {
+			continue
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("# " + section.title + "\r\n")
+		buf.WriteString(section.generate(database))
+	}
+	// an empty bulk string rather than nil if no section is selected
+	return reply.MakeBulkReply([]byte(buf.String()))
+}
+
+// infoWriter writes the field:value lines of an INFO section
+type infoWriter struct {
+	buf bytes.Buffer
+}
+
+func (w *infoWriter) write(field string, value interface{}) {
+	w.buf.WriteString(fmt.Sprintf("%s:%v\r\n", field, value))
+}
+
+func serverInfo(database *StandaloneDatabase) string {
+	var w infoWriter
+	mode := "standalone"
+	if isClusterMode() {
+		mode = "cluster"
+	}
+	uptime := int64(time.Since(database.stats.startTime) / time.Second)
+	executable, _ := os.Executable()
+	w.write("redis_version", RedisVersion)
+	w.write("redis_git_sha1", "00000000")
+	w.write("redis_git_dirty", 0)
+	w.write("redis_mode", mode)
+	w.write("os", runtime.GOOS+" "+runtime.GOARCH)
+	w.write("arch_bits", strconv.IntSize)
+	w.write("go_version", runtime.Version())
+	w.write("process_id", os.Getpid())
+	w.write("run_id", database.stats.runID)
+	w.write("tcp_port", config.Properties.Port)
+	w.write("server_time_usec", time.Now().UnixNano()/int64(time.Microsecond))
+	w.write("uptime_in_seconds", uptime)
+	w.write("uptime_in_days", uptime/(24*3600))
+	w.write("hz", int(time.Second/activeExpireInterval))
+	w.write("executable", executable)
+	w.write("config_file", config.ConfigFile)
+	return w.buf.String()
+}
+
+// isClusterMode tells whether the server is a node of a cluster, the way the handler decides it
+func isClusterMode() bool {
+	return config.Properties.ClusterEnabled || (config.Properties.Self != "" && len(config.Properties.Peers) > 0)
+}
+
+func clientsInfo(database *StandaloneDatabase) string {
+	var w infoWriter
+	clients := getClientStats()
+	w.write("connected_clients", clients.Connected)
+	w.write("maxclients", clients.MaxClients)
+	w.write("client_recent_max_input_buffer", 0)
+	w.write("client_recent_max_output_buffer", 0)
+	w.write("blocked_clients", 0)
+	w.write("tracking_clients", 0)
+	return w.buf.String()
+}
+
+func memoryInfo(database *StandaloneDatabase) string {
+	var w infoWriter
+	stats := database.stats
+	mem := stats.sampleMemory()
+	stats.mu.Lock()
+	peak := stats.peakMemory
+	stats.mu.Unlock()
+	maxMemory := config.Snapshot().MaxMemory
+
+	w.write("used_memory", mem.HeapAlloc)
+	w.write("used_memory_human", bytesToHuman(mem.HeapAlloc))
+	w.write("used_memory_rss", mem.Sys)
+	w.write("used_memory_rss_human", bytesToHuman(mem.Sys))
+	w.write("used_memory_peak", peak)
+	w.write("used_memory_peak_human", bytesToHuman(peak))
+	w.write("used_memory_peak_perc", fmt.Sprintf("%.2f%%", float64(mem.HeapAlloc)*100/float64(peak)))
+	w.write("maxmemory", maxMemory)
+	w.write("maxmemory_human", bytesToHuman(uint64(maxMemory)))
+	w.write("maxmemory_policy", "noeviction")
+	w.write("mem_fragmentation_ratio", fmt.Sprintf("%.2f", float64(mem.Sys)/float64(mem.HeapAlloc)))
+	w.write("mem_allocator", "go")
+	return w.buf.String()
+}
+
+// bytesToHuman formats a number of bytes the way INFO does, e.g. 1.50M
+func bytesToHuman(n uint64) string {
+	units := []string{"B", "K", "M", "G", "T", "P"}
+	value := float64(n)
+	i := 0
+	for value >= 1024 && i < len(units)-1 {
+		value /= 1024
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", n)
+	}
+	return fmt.Sprintf("%.2f%s", value, units[i])
+}
+
+func statsInfo(database *StandaloneDatabase) string {
+	var w infoWriter
+	stats := database.stats
+	clients := getClientStats()
+	stats.mu.Lock()
+	ops := stats.ops.rate()
+	inputKbps := stats.netInput.rate() / 1024
+	outputKbps := stats.netOutput.rate() / 1024
+	stats.mu.Unlock()
+	channels, patterns := database.hub.Counts()
+
+	w.write("total_connections_received", clients.TotalConnections)
+	w.write("total_commands_processed", stats.commands.Get())
+	w.write("instantaneous_ops_per_sec", int64(ops))
+	w.write("total_net_input_bytes", clients.NetInputBytes)
+	w.write("total_net_output_bytes", clients.NetOutputBytes)
+	w.write("instantaneous_input_kbps", fmt.Sprintf("%.2f", inputKbps))
+	w.write("instantaneous_output_kbps", fmt.Sprintf("%.2f", outputKbps))
+	w.write("rejected_connections", clients.Rejected)
+	w.write("expired_keys", stats.expired.Get())
+	w.write("evicted_keys", 0)
+	w.write("keyspace_hits", stats.hits.Get())
+	w.write("keyspace_misses", stats.misses.Get())
+	w.write("pubsub_channels", channels)
+	w.write("pubsub_patterns", patterns)
+	return w.buf.String()
+}
+
+func cpuInfo(database *StandaloneDatabase) string {
+	var w infoWriter
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return ""
+	}
+	seconds := func(tv syscall.Timeval) string {
+		return fmt.Sprintf("%.6f", float64(tv.Sec)+float64(tv.Usec)/1e6)
+	}
+	w.write("used_cpu_sys", seconds(usage.Stime))
+	w.write("used_cpu_user", seconds(usage.Utime))
+	return w.buf.String()
+}
+
+func clusterInfo(database *StandaloneDatabase) string {
+	var w infoWriter
+	w.write("cluster_enabled", boolToInt(isClusterMode()))
+	return w.buf.String()
+}
+
+// keyspaceInfo lists the dbs holding any key, keys which expired but were not removed yet are counted
+func keyspaceInfo(database *StandaloneDatabase) string {
+	var w infoWriter
+	for _, db := range database.dbSet {
+		keys := db.data.Len()
+		if keys == 0 {
+			continue
+		}
+		w.write("db"+strconv.Itoa(db.index), fmt.Sprintf("keys=%d,expires=%d,avg_ttl=0", keys, db.ttlMap.Len()))
+	}
+	return w.buf.String()
+}
+
+func persistenceInfo(database *StandaloneDatabase) string {
+	var w infoWriter
+	w.write("loading", atomic.LoadInt32(&database.loading))
+
+	database.saveMu.Lock()
+	w.write("rdb_changes_since_last_save", atomic.LoadInt64(&database.dirty))
+	w.write("rdb_bgsave_in_progress", boolToInt(database.bgSaving))
+	w.write("rdb_last_save_time", database.lastSave.Unix())
+	bgSaveStatus := "ok"
+	if database.lastBgSaveErr != nil {
+		bgSaveStatus = "err"
+	}
+	w.write("rdb_last_bgsave_status", bgSaveStatus)
+	bgSaveTime := int64(-1)
+	if !database.lastBgSaveTry.IsZero() {
+		bgSaveTime = int64(database.lastBgSaveDuration / time.Second)
+	}
+	w.write("rdb_last_bgsave_time_sec", bgSaveTime)
+	database.saveMu.Unlock()
+
+	if database.aofHandler == nil {
+		w.write("aof_enabled", 0)
+		return w.buf.String()
+	}
+	handler := database.aofHandler
+	base, current := handler.AofSizes()
+	w.write("aof_enabled", 1)
+	w.write("aof_rewrite_in_progress", boolToInt(handler.IsRewriting()))
+	w.write("aof_current_size", current)
+	w.write("aof_base_size", base)
+	w.write("aof_fsync_policy", config.Snapshot().AppendFsync)
+	w.write("aof_last_fsync_time", handler.LastFsync().Unix())
+	w.write("aof_fsync_lag_ms", handler.FsyncLag().Milliseconds())
+	return w.buf.String()
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
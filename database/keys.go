@@ -1,6 +1,16 @@
 package database
 
 import (
+	"math"
+	"strconv"
+	"time"
+
+	"go-redis/aof"
+	"go-redis/datastruct/dict"
+	"go-redis/datastruct/list"
+	"go-redis/datastruct/set"
+	"go-redis/datastruct/sortedset"
+	"go-redis/interface/database"
 	"go-redis/interface/resp"
 	"go-redis/lib/utils"
 	"go-redis/lib/wildcard"
@@ -8,13 +18,22 @@ import (
 )
 
 func init() {
-	RegisterCommand("del", execDel, -2)
-	RegisterCommand("exists", execExists, -2)
-	RegisterCommand("flushdb", execFlushDB, -1)
-	RegisterCommand("type", execType, 2)
-	RegisterCommand("rename", execRename, 3)
-	RegisterCommand("renamenx", execRenameNX, 3)
-	RegisterCommand("keys", execKeys, 2)
+	RegisterCommand("del", execDel, writeAllKeys, -2)
+	RegisterCommand("exists", execExists, readAllKeys, -2)
+	RegisterCommand("flushdb", execFlushDB, noPrepare, -1)
+	RegisterCommand("type", execType, readFirstKey, 2)
+	RegisterCommand("rename", execRename, writeFirstTwoKeys, 3)
+	RegisterCommand("renamenx", execRenameNX, writeFirstTwoKeys, 3)
+	RegisterCommand("keys", execKeys, noPrepare, 2)
+	RegisterCommand("expire", execExpire, writeFirstKey, 3)
+	RegisterCommand("pexpire", execPExpire, writeFirstKey, 3)
+	RegisterCommand("expireat", execExpireAt, writeFirstKey, 3)
+	RegisterCommand("pexpireat", execPExpireAt, writeFirstKey, 3)
+	RegisterCommand("ttl", execTTL, readFirstKey, 2)
+	RegisterCommand("pttl", execPTTL, readFirstKey, 2)
+	RegisterCommand("expiretime", execExpireTime, readFirstKey, 2)
+	RegisterCommand("pexpiretime", execPExpireTime, readFirstKey, 2)
+	RegisterCommand("persist", execPersist, writeFirstKey, 2)
 }
 
 // execDel DEL k1 k2 k3 ...
@@ -45,7 +64,7 @@ func execExists(db *DB, args [][]byte) resp.Reply {
 
 // execFlushDB FLUSHDB
 func execFlushDB(db *DB, args [][]byte) resp.Reply {
-	db.data.Clear()
+	db.Flush()
 	db.addAof(utils.ToCmdLine2("flushdb", args...))
 	return reply.MakeOKReply()
 }
@@ -60,6 +79,14 @@ func execType(db *DB, args [][]byte) resp.Reply {
 	switch entity.Data.(type) {
 	case []byte:
 		return reply.MakeStatusReply("string")
+	case dict.Dict:
+		return reply.MakeStatusReply("hash")
+	case list.List:
+		return reply.MakeStatusReply("list")
+	case *set.Set:
+		return reply.MakeStatusReply("set")
+	case *sortedset.SortedSet:
+		return reply.MakeStatusReply("zset")
 	}
 	return reply.MakeUnknownErrReplay()
 }
@@ -72,8 +99,7 @@ func execRename(db *DB, args [][]byte) resp.Reply {
 	if !exist {
 		return reply.MakeStatusReply("no such key")
 	}
-	db.Remove(src)
-	db.PutEntity(dst, val)
+	renameEntity(db, src, dst, val)
 	db.addAof(utils.ToCmdLine2("rename", args...))
 	return reply.MakeOKReply()
 }
@@ -90,21 +116,158 @@ func execRenameNX(db *DB, args [][]byte) resp.Reply {
 	if !exist {
 		return reply.MakeStatusReply("no such key")
 	}
-	db.Remove(src)
-	db.PutEntity(dst, val)
+	renameEntity(db, src, dst, val)
 	db.addAof(utils.ToCmdLine2("renamenx", args...))
 	return reply.MakeIntReply(1)
 }
 
+// renameEntity moves the entity and its ttl from src to dst
+func renameEntity(db *DB, src, dst string, val *database.DataEntity) {
+	expireTime, hasTTL := db.ExpireTime(src)
+	db.Remove(src)
+	db.Remove(dst)
+	db.PutEntity(dst, val)
+	if hasTTL {
+		db.Expire(dst, expireTime)
+	}
+}
+
 // execKeys KEYS *
 func execKeys(db *DB, args [][]byte) resp.Reply {
 	pattern := wildcard.CompilePattern(string(args[0]))
 	result := make([][]byte, 0)
 	db.data.Foreach(func(key string, val interface{}) bool {
-		if pattern.IsMatch(key) {
+		if pattern.IsMatch(key) && !db.IsExpired(key) {
 			result = append(result, []byte(key))
 		}
 		return true
 	})
 	return reply.MakeMultiBulkReply(result)
 }
+
+// execExpire EXPIRE k1 seconds
+func execExpire(db *DB, args [][]byte) resp.Reply {
+	return expireAfter(db, args, time.Second, "expire")
+}
+
+// execPExpire PEXPIRE k1 milliseconds
+func execPExpire(db *DB, args [][]byte) resp.Reply {
+	return expireAfter(db, args, time.Millisecond, "pexpire")
+}
+
+// execExpireAt EXPIREAT k1 unix-time-seconds
+func execExpireAt(db *DB, args [][]byte) resp.Reply {
+	return expireAtUnix(db, args, time.Second)
+}
+
+// execPExpireAt PEXPIREAT k1 unix-time-milliseconds
+func execPExpireAt(db *DB, args [][]byte) resp.Reply {
+	return expireAtUnix(db, args, time.Millisecond)
+}
+
+// expireAfter sets a ttl relative to now, unit is the unit of the ttl argument
+func expireAfter(db *DB, args [][]byte, unit time.Duration, cmdName string) resp.Reply {
+	ttl, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if ttl > math.MaxInt64/int64(unit) || ttl < math.MinInt64/int64(unit) {
+		return makeInvalidExpireErrReply(cmdName)
+	}
+	return expireKeyAt(db, string(args[0]), time.Now().Add(time.Duration(ttl)*unit))
+}
+
+// expireAtUnix sets an absolute deadline, unit is the unit of the unix time argument
+func expireAtUnix(db *DB, args [][]byte, unit time.Duration) resp.Reply {
+	timestamp, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	perSecond := int64(time.Second / unit)
+	expireAt := time.Unix(timestamp/perSecond, (timestamp%perSecond)*int64(unit))
+	return expireKeyAt(db, string(args[0]), expireAt)
+}
+
+// expireKeyAt sets the deadline of an existing key, a deadline in the past deletes the key
+func expireKeyAt(db *DB, key string, expireAt time.Time) resp.Reply {
+	_, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(0)
+	}
+
+	if !expireAt.After(time.Now()) && !db.loading.Get() {
+		db.Remove(key)
+		db.addAof(utils.ToCmdLine("del", key))
+		return reply.MakeIntReply(1)
+	}
+
+	db.Expire(key, expireAt)
+	db.addAof(aof.MakeExpireCmd(key, expireAt))
+	return reply.MakeIntReply(1)
+}
+
+func makeInvalidExpireErrReply(cmdName string) resp.Reply {
+	return reply.MakeStandardErrReply("ERR invalid expire time in '" + cmdName + "' command")
+}
+
+// execTTL TTL k1
+func execTTL(db *DB, args [][]byte) resp.Reply {
+	return remainingTTL(db, string(args[0]), time.Second)
+}
+
+// execPTTL PTTL k1
+func execPTTL(db *DB, args [][]byte) resp.Reply {
+	return remainingTTL(db, string(args[0]), time.Millisecond)
+}
+
+// remainingTTL returns -2 if the key does not exist, -1 if the key has no ttl
+func remainingTTL(db *DB, key string, unit time.Duration) resp.Reply {
+	_, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(-2)
+	}
+	expireTime, hasTTL := db.ExpireTime(key)
+	if !hasTTL {
+		return reply.MakeIntReply(-1)
+	}
+	ttl := time.Until(expireTime)
+	// round to the nearest unit like redis does
+	return reply.MakeIntReply(int64((ttl + unit/2) / unit))
+}
+
+// execExpireTime EXPIRETIME k1
+func execExpireTime(db *DB, args [][]byte) resp.Reply {
+	return absoluteExpireTime(db, string(args[0]), time.Second)
+}
+
+// execPExpireTime PEXPIRETIME k1
+func execPExpireTime(db *DB, args [][]byte) resp.Reply {
+	return absoluteExpireTime(db, string(args[0]), time.Millisecond)
+}
+
+// absoluteExpireTime returns the unix time at which the key will expire
+func absoluteExpireTime(db *DB, key string, unit time.Duration) resp.Reply {
+	_, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(-2)
+	}
+	expireTime, hasTTL := db.ExpireTime(key)
+	if !hasTTL {
+		return reply.MakeIntReply(-1)
+	}
+	return reply.MakeIntReply(expireTime.UnixNano() / int64(unit))
+}
+
+// execPersist PERSIST k1
+func execPersist(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	_, exists := db.GetEntity(key)
+	if !exists {
+		return reply.MakeIntReply(0)
+	}
+	removed := db.Persist(key)
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine("persist", key))
+	}
+	return reply.MakeIntReply(int64(removed))
+}
@@ -0,0 +1,137 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLazyExpire(t *testing.T) {
+	database := newMemoryDatabase(t)
+	assertReply(t, execCmd(database, "SET", "k", "v", "PX", "20"), "+OK\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "k"), ":1\r\n")
+	time.Sleep(40 * time.Millisecond)
+	assertReply(t, execCmd(database, "TTL", "k"), ":-2\r\n")
+	assertReply(t, execCmd(database, "GET", "k"), "$-1\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "k"), ":0\r\n")
+}
+
+func TestPersist(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "SET", "k", "v", "EX", "100")
+	assertReply(t, execCmd(database, "PERSIST", "k"), ":1\r\n")
+	assertReply(t, execCmd(database, "TTL", "k"), ":-1\r\n")
+	assertReply(t, execCmd(database, "PERSIST", "k"), ":0\r\n")
+}
+
+func TestDelExpired(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "SET", "expired", "v", "PX", "20")
+	execCmd(database, "SET", "live", "v")
+	time.Sleep(40 * time.Millisecond)
+	assertReply(t, execCmd(database, "DEL", "expired"), ":0\r\n")
+	assertReply(t, execCmd(database, "DEL", "expired", "live"), ":1\r\n")
+}
+
+func TestSetNXExpired(t *testing.T) {
+	database := newMemoryDatabase(t)
+	var aofLines []CmdLine
+	database.dbSet[0].addAof = func(lines ...CmdLine) {
+		aofLines = append(aofLines, lines...)
+	}
+	execCmd(database, "SET", "k", "old", "PX", "20")
+	aofLines = nil
+	assertReply(t, execCmd(database, "SETNX", "k", "v"), ":0\r\n")
+	if len(aofLines) != 0 {
+		t.Errorf("SETNX inserting nothing appended %d lines to aof", len(aofLines))
+	}
+	time.Sleep(40 * time.Millisecond)
+	assertReply(t, execCmd(database, "SETNX", "k", "v"), ":1\r\n")
+	assertReply(t, execCmd(database, "GET", "k"), "$1\r\nv\r\n")
+	assertReply(t, execCmd(database, "TTL", "k"), ":-1\r\n")
+	if len(aofLines) != 1 {
+		t.Errorf("expected SETNX appended to aof once, got %d lines", len(aofLines))
+	}
+}
+
+func TestExpireCommands(t *testing.T) {
+	database := newMemoryDatabase(t)
+	assertReply(t, execCmd(database, "EXPIRE", "missing", "100"), ":0\r\n")
+	assertReply(t, execCmd(database, "TTL", "missing"), ":-2\r\n")
+	assertReply(t, execCmd(database, "PEXPIRETIME", "missing"), ":-2\r\n")
+
+	execCmd(database, "SET", "k", "v")
+	assertReply(t, execCmd(database, "TTL", "k"), ":-1\r\n")
+	assertReply(t, execCmd(database, "EXPIRETIME", "k"), ":-1\r\n")
+	assertReply(t, execCmd(database, "EXPIRE", "k", "x"), "-ERR value is not an integer or out of range\r\n")
+
+	assertReply(t, execCmd(database, "PEXPIRE", "k", "100000"), ":1\r\n")
+	pttl := execCmd(database, "PTTL", "k")
+	if ms, err := strconv.Atoi(strings.TrimSpace(pttl[1:])); err != nil || ms < 99000 || ms > 100000 {
+		t.Errorf("expected pttl about 100000, got %q", pttl)
+	}
+	at := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	assertReply(t, execCmd(database, "EXPIREAT", "k", at), ":1\r\n")
+	assertReply(t, execCmd(database, "EXPIRETIME", "k"), ":"+at+"\r\n")
+	assertReply(t, execCmd(database, "PEXPIREAT", "k", at+"123"), ":1\r\n")
+	assertReply(t, execCmd(database, "PEXPIRETIME", "k"), ":"+at+"123\r\n")
+
+	// a deadline in the past deletes the key
+	assertReply(t, execCmd(database, "EXPIREAT", "k", "1"), ":1\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "k"), ":0\r\n")
+}
+
+func TestActiveExpire(t *testing.T) {
+	useTestConfig(t)
+	database := newTestDatabase(t)
+	for i := 0; i < 100; i++ {
+		execCmd(database, "SET", "k"+strconv.Itoa(i), "v", "PX", "10")
+	}
+	execCmd(database, "SET", "live", "v")
+	// expired keys are removed in background although they are never accessed
+	deadline := time.Now().Add(time.Second)
+	for database.dbSet[0].data.Len() > 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected expired keys removed, %d keys left", database.dbSet[0].data.Len())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertReply(t, execCmd(database, "EXISTS", "live"), ":1\r\n")
+}
+
+func TestExpireAof(t *testing.T) {
+	useTestConfig(t).AppendOnly = true
+	database := newTestDatabase(t)
+	var aofLines []CmdLine
+	addAof := database.dbSet[0].addAof
+	database.dbSet[0].addAof = func(lines ...CmdLine) {
+		aofLines = append(aofLines, lines...)
+		addAof(lines...)
+	}
+	execCmd(database, "SET", "short", "v")
+	execCmd(database, "PEXPIRE", "short", "50")
+	execCmd(database, "SET", "long", "v", "EX", "100")
+	// expirations are logged as absolute deadlines
+	deadlines := 0
+	for _, line := range aofLines {
+		switch name := strings.ToLower(string(line[0])); {
+		case name == "pexpireat":
+			deadlines++
+		case name == "pexpire" || name == "expire" || name == "set" && len(line) > 3:
+			t.Errorf("expected a relative ttl logged as PEXPIREAT, got %q", line)
+		}
+	}
+	if deadlines != 2 {
+		t.Errorf("expected 2 PEXPIREAT logged, got %d", deadlines)
+	}
+	_ = database.Close()
+
+	// replaying the log after the deadline does not resurrect the key
+	time.Sleep(100 * time.Millisecond)
+	database = newTestDatabase(t)
+	assertReply(t, execCmd(database, "EXISTS", "short"), ":0\r\n")
+	if ttl := execCmd(database, "TTL", "long"); ttl != ":100\r\n" && ttl != ":99\r\n" {
+		t.Errorf("expected ttl of long kept, got %q", ttl)
+	}
+}
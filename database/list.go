@@ -0,0 +1,519 @@
+package database
+
+import (
+	"strconv"
+	"strings"
+
+	"go-redis/datastruct/list"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+)
+
+func init() {
+	RegisterCommand("lpush", execLPush, writeFirstKey, -3)
+	RegisterCommand("lpushx", execLPushX, writeFirstKey, -3)
+	RegisterCommand("rpush", execRPush, writeFirstKey, -3)
+	RegisterCommand("rpushx", execRPushX, writeFirstKey, -3)
+	RegisterCommand("lpop", execLPop, writeFirstKey, -2)
+	RegisterCommand("rpop", execRPop, writeFirstKey, -2)
+	RegisterCommand("llen", execLLen, readFirstKey, 2)
+	RegisterCommand("lindex", execLIndex, readFirstKey, 3)
+	RegisterCommand("lset", execLSet, writeFirstKey, 4)
+	RegisterCommand("lrange", execLRange, readFirstKey, 4)
+	RegisterCommand("lrem", execLRem, writeFirstKey, 4)
+	RegisterCommand("ltrim", execLTrim, writeFirstKey, 4)
+	RegisterCommand("linsert", execLInsert, writeFirstKey, 5)
+	RegisterCommand("lpos", execLPos, readFirstKey, -3)
+	RegisterCommand("lmove", execLMove, writeFirstTwoKeys, 5)
+	RegisterCommand("rpoplpush", execRPopLPush, writeFirstTwoKeys, 3)
+}
+
+// getAsList returns the list stored at key, list is nil if the key does not exist
+func (db *DB) getAsList(key string) (list.List, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	l, ok := entity.Data.(list.List)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	return l, nil
+}
+
+// getOrInitList returns the list stored at key, creates an empty one if the key does not exist
+func (db *DB) getOrInitList(key string) (l list.List, inited bool, errReply reply.ErrorReply) {
+	l, errReply = db.getAsList(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	if l == nil {
+		l = list.NewQuickList()
+		db.PutEntity(key, &database.DataEntity{
+			Data: l,
+		})
+		inited = true
+	}
+	return l, inited, nil
+}
+
+// execLPush LPUSH key element [element ...]
+func execLPush(db *DB, args [][]byte) resp.Reply {
+	return pushElements(db, args, true, false, "lpush")
+}
+
+// execLPushX LPUSHX key element [element ...]
+func execLPushX(db *DB, args [][]byte) resp.Reply {
+	return pushElements(db, args, true, true, "lpushx")
+}
+
+// execRPush RPUSH key element [element ...]
+func execRPush(db *DB, args [][]byte) resp.Reply {
+	return pushElements(db, args, false, false, "rpush")
+}
+
+// execRPushX RPUSHX key element [element ...]
+func execRPushX(db *DB, args [][]byte) resp.Reply {
+	return pushElements(db, args, false, true, "rpushx")
+}
+
+// pushElements pushes elements to the head or the tail of the list,
+// onlyExists means the elements are pushed only if the list already exists
+func pushElements(db *DB, args [][]byte, left bool, onlyExists bool, cmdName string) resp.Reply {
+	key := string(args[0])
+	var l list.List
+	var errReply reply.ErrorReply
+	if onlyExists {
+		l, errReply = db.getAsList(key)
+		if errReply != nil {
+			return errReply
+		}
+		if l == nil {
+			return reply.MakeIntReply(0)
+		}
+	} else {
+		l, _, errReply = db.getOrInitList(key)
+		if errReply != nil {
+			return errReply
+		}
+	}
+
+	for _, element := range args[1:] {
+		if left {
+			l.Insert(0, element)
+		} else {
+			l.Add(element)
+		}
+	}
+	db.addAof(utils.ToCmdLine2(cmdName, args...))
+	return reply.MakeIntReply(int64(l.Len()))
+}
+
+// execLPop LPOP key [count]
+func execLPop(db *DB, args [][]byte) resp.Reply {
+	return popElements(db, args, true, "lpop")
+}
+
+// execRPop RPOP key [count]
+func execRPop(db *DB, args [][]byte) resp.Reply {
+	return popElements(db, args, false, "rpop")
+}
+
+// popElements pops elements from the head or the tail of the list,
+// replies a bulk without count and an array with count
+func popElements(db *DB, args [][]byte, left bool, cmdName string) resp.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	key := string(args[0])
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(string(args[1]))
+		if err != nil || n < 0 {
+			return reply.MakeStandardErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		if len(args) == 2 {
+			return reply.MakeNullMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+
+	if count > l.Len() {
+		count = l.Len()
+	}
+	elements := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		if left {
+			elements = append(elements, l.Remove(0).([]byte))
+		} else {
+			elements = append(elements, l.RemoveLast().([]byte))
+		}
+	}
+	if l.Len() == 0 {
+		db.Remove(key)
+	}
+	if count > 0 {
+		db.addAof(utils.ToCmdLine(cmdName, key, strconv.Itoa(count)))
+	}
+
+	if len(args) == 2 {
+		return reply.MakeMultiBulkReply(elements)
+	}
+	return reply.MakeBulkReply(elements[0])
+}
+
+// execLLen LLEN key
+func execLLen(db *DB, args [][]byte) resp.Reply {
+	l, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(l.Len()))
+}
+
+// execLIndex LINDEX key index
+func execLIndex(db *DB, args [][]byte) resp.Reply {
+	index, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	l, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeNullBulkReply()
+	}
+
+	size := l.Len()
+	if index < 0 {
+		index += size
+	}
+	if index < 0 || index >= size {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(l.Get(index).([]byte))
+}
+
+// execLSet LSET key index element
+func execLSet(db *DB, args [][]byte) resp.Reply {
+	index, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	l, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeStandardErrReply("ERR no such key")
+	}
+
+	size := l.Len()
+	if index < 0 {
+		index += size
+	}
+	if index < 0 || index >= size {
+		return reply.MakeStandardErrReply("ERR index out of range")
+	}
+	l.Set(index, args[2])
+	db.addAof(utils.ToCmdLine2("lset", args...))
+	return reply.MakeOKReply()
+}
+
+// execLRange LRANGE key start stop
+func execLRange(db *DB, args [][]byte) resp.Reply {
+	start, err1 := strconv.Atoi(string(args[1]))
+	stop, err2 := strconv.Atoi(string(args[2]))
+	if err1 != nil || err2 != nil {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	l, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+
+	start, stop, ok := normalizeRange(start, stop, l.Len())
+	if !ok {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	slice := l.Range(start, stop)
+	result := make([][]byte, len(slice))
+	for i, raw := range slice {
+		result[i] = raw.([]byte)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// normalizeRange converts the inclusive range [start, stop] which may use negative indexes
+// into the half open range [start, stop) within [0, size), ok is false if the range is empty
+func normalizeRange(start, stop, size int) (int, int, bool) {
+	if start < 0 {
+		start += size
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop < 0 {
+		stop += size
+	}
+	if stop >= size {
+		stop = size - 1
+	}
+	if start >= size || stop < start {
+		return 0, 0, false
+	}
+	return start, stop + 1, true
+}
+
+// execLRem LREM key count element
+func execLRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	count, err := strconv.Atoi(string(args[1]))
+	if err != nil {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	element := args[2]
+	expected := func(a interface{}) bool {
+		return utils.BytesEquals(a.([]byte), element)
+	}
+	var removed int
+	if count == 0 {
+		removed = l.RemoveAllByVal(expected)
+	} else if count > 0 {
+		removed = l.RemoveByVal(expected, count)
+	} else {
+		removed = l.ReverseRemoveByVal(expected, -count)
+	}
+	if l.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine2("lrem", args...))
+	}
+	return reply.MakeIntReply(int64(removed))
+}
+
+// execLTrim LTRIM key start stop
+func execLTrim(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start, err1 := strconv.Atoi(string(args[1]))
+	stop, err2 := strconv.Atoi(string(args[2]))
+	if err1 != nil || err2 != nil {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	l, errReply := db.getAsList(key)
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeOKReply()
+	}
+
+	start, stop, ok := normalizeRange(start, stop, l.Len())
+	if !ok {
+		db.Remove(key)
+	} else {
+		for i := l.Len(); i > stop; i-- {
+			l.RemoveLast()
+		}
+		for i := 0; i < start; i++ {
+			l.Remove(0)
+		}
+	}
+	db.addAof(utils.ToCmdLine2("ltrim", args...))
+	return reply.MakeOKReply()
+}
+
+// execLInsert LINSERT key BEFORE|AFTER pivot element
+func execLInsert(db *DB, args [][]byte) resp.Reply {
+	where := strings.ToUpper(string(args[1]))
+	if where != "BEFORE" && where != "AFTER" {
+		return reply.MakeSyntaxErrReply()
+	}
+	l, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if l == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	pivot := args[2]
+	index := -1
+	l.ForEach(func(i int, v interface{}) bool {
+		if utils.BytesEquals(v.([]byte), pivot) {
+			index = i
+			return false
+		}
+		return true
+	})
+	if index < 0 {
+		return reply.MakeIntReply(-1)
+	}
+	if where == "AFTER" {
+		index++
+	}
+	l.Insert(index, args[3])
+	db.addAof(utils.ToCmdLine2("linsert", args...))
+	return reply.MakeIntReply(int64(l.Len()))
+}
+
+// execLPos LPOS key element [RANK rank] [COUNT num-matches] [MAXLEN len]
+func execLPos(db *DB, args [][]byte) resp.Reply {
+	rank, count, maxLen := 1, -1, 0
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return reply.MakeSyntaxErrReply()
+		}
+		option := strings.ToUpper(string(args[i]))
+		n, err := strconv.Atoi(string(args[i+1]))
+		if err != nil {
+			return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+		}
+		switch option {
+		case "RANK":
+			if n == 0 {
+				return reply.MakeStandardErrReply("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return reply.MakeStandardErrReply("ERR COUNT can't be negative")
+			}
+			count = n
+		case "MAXLEN":
+			if n < 0 {
+				return reply.MakeStandardErrReply("ERR MAXLEN can't be negative")
+			}
+			maxLen = n
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	l, errReply := db.getAsList(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+
+	positions := make([]int, 0)
+	if l != nil {
+		element := args[1]
+		// skip the first |rank|-1 matches, scan backward if rank is negative
+		skip := rank - 1
+		step, index := 1, 0
+		if rank < 0 {
+			skip = -rank - 1
+			step, index = -1, l.Len()-1
+		}
+		for scanned := 0; index >= 0 && index < l.Len(); index += step {
+			if maxLen > 0 && scanned >= maxLen {
+				break
+			}
+			scanned++
+			if !utils.BytesEquals(l.Get(index).([]byte), element) {
+				continue
+			}
+			if skip > 0 {
+				skip--
+				continue
+			}
+			positions = append(positions, index)
+			// without COUNT only the first match is needed, COUNT 0 means all matches
+			if count < 0 || (count > 0 && len(positions) == count) {
+				break
+			}
+		}
+	}
+
+	if count < 0 {
+		if len(positions) == 0 {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeIntReply(int64(positions[0]))
+	}
+	result := make([]resp.Reply, len(positions))
+	for i, pos := range positions {
+		result[i] = reply.MakeIntReply(int64(pos))
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// execLMove LMOVE source destination LEFT|RIGHT LEFT|RIGHT
+func execLMove(db *DB, args [][]byte) resp.Reply {
+	from := strings.ToUpper(string(args[2]))
+	to := strings.ToUpper(string(args[3]))
+	if (from != "LEFT" && from != "RIGHT") || (to != "LEFT" && to != "RIGHT") {
+		return reply.MakeSyntaxErrReply()
+	}
+	return moveElement(db, args, from == "LEFT", to == "LEFT", "lmove")
+}
+
+// execRPopLPush RPOPLPUSH source destination
+func execRPopLPush(db *DB, args [][]byte) resp.Reply {
+	return moveElement(db, args, false, true, "rpoplpush")
+}
+
+// moveElement pops an element from source and pushes it to destination atomically
+func moveElement(db *DB, args [][]byte, fromLeft bool, toLeft bool, cmdName string) resp.Reply {
+	src := string(args[0])
+	dst := string(args[1])
+	srcList, errReply := db.getAsList(src)
+	if errReply != nil {
+		return errReply
+	}
+	if srcList == nil {
+		return reply.MakeNullBulkReply()
+	}
+	// checks type of destination before modifying source
+	dstList, errReply := db.getAsList(dst)
+	if errReply != nil {
+		return errReply
+	}
+
+	var element []byte
+	if fromLeft {
+		element = srcList.Remove(0).([]byte)
+	} else {
+		element = srcList.RemoveLast().([]byte)
+	}
+	if dstList == nil {
+		dstList, _, _ = db.getOrInitList(dst)
+	}
+	if toLeft {
+		dstList.Insert(0, element)
+	} else {
+		dstList.Add(element)
+	}
+	// source and destination may be the same list, so checks emptiness after pushing
+	if srcList.Len() == 0 {
+		db.Remove(src)
+	}
+	db.addAof(utils.ToCmdLine2(cmdName, args...))
+	return reply.MakeBulkReply(element)
+}
@@ -0,0 +1,84 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestListPushPop(t *testing.T) {
+	database := newMemoryDatabase(t)
+	assertReply(t, execCmd(database, "LPUSHX", "l", "a"), ":0\r\n")
+	assertReply(t, execCmd(database, "RPUSH", "l", "c", "d"), ":2\r\n")
+	assertReply(t, execCmd(database, "LPUSH", "l", "b", "a"), ":4\r\n")
+	assertReply(t, execCmd(database, "LRANGE", "l", "0", "-1"), multiBulk("a", "b", "c", "d"))
+	assertReply(t, execCmd(database, "LPOP", "l"), "$1\r\na\r\n")
+	assertReply(t, execCmd(database, "RPOP", "l", "2"), multiBulk("d", "c"))
+	assertReply(t, execCmd(database, "LLEN", "l"), ":1\r\n")
+	assertReply(t, execCmd(database, "LPOP", "l", "-1"), "-ERR value is out of range, must be positive\r\n")
+
+	// the key is removed with its last element
+	assertReply(t, execCmd(database, "LPOP", "l", "5"), multiBulk("b"))
+	assertReply(t, execCmd(database, "EXISTS", "l"), ":0\r\n")
+	assertReply(t, execCmd(database, "LPOP", "l"), "$-1\r\n")
+}
+
+func TestListIndex(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "RPUSH", "l", "a", "b", "c", "d", "e")
+	assertReply(t, execCmd(database, "LINDEX", "l", "-1"), "$1\r\ne\r\n")
+	assertReply(t, execCmd(database, "LINDEX", "l", "5"), "$-1\r\n")
+	assertReply(t, execCmd(database, "LRANGE", "l", "-3", "100"), multiBulk("c", "d", "e"))
+	assertReply(t, execCmd(database, "LRANGE", "l", "3", "1"), "*0\r\n")
+	assertReply(t, execCmd(database, "LSET", "l", "1", "B"), "+OK\r\n")
+	assertReply(t, execCmd(database, "LSET", "l", "9", "x"), "-ERR index out of range\r\n")
+	assertReply(t, execCmd(database, "LSET", "none", "0", "x"), "-ERR no such key\r\n")
+	assertReply(t, execCmd(database, "LTRIM", "l", "1", "-2"), "+OK\r\n")
+	assertReply(t, execCmd(database, "LRANGE", "l", "0", "-1"), multiBulk("B", "c", "d"))
+	assertReply(t, execCmd(database, "LTRIM", "l", "5", "10"), "+OK\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "l"), ":0\r\n")
+}
+
+func TestListInsertRem(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "RPUSH", "l", "a", "x", "b", "x", "c", "x")
+	assertReply(t, execCmd(database, "LINSERT", "l", "BEFORE", "b", "1"), ":7\r\n")
+	assertReply(t, execCmd(database, "LINSERT", "l", "AFTER", "c", "2"), ":8\r\n")
+	assertReply(t, execCmd(database, "LINSERT", "l", "AFTER", "none", "3"), ":-1\r\n")
+	assertReply(t, execCmd(database, "LINSERT", "none", "AFTER", "a", "3"), ":0\r\n")
+	assertReply(t, execCmd(database, "LRANGE", "l", "0", "-1"), multiBulk("a", "x", "1", "b", "x", "c", "2", "x"))
+	assertReply(t, execCmd(database, "LREM", "l", "-2", "x"), ":2\r\n")
+	assertReply(t, execCmd(database, "LRANGE", "l", "0", "-1"), multiBulk("a", "x", "1", "b", "c", "2"))
+	assertReply(t, execCmd(database, "LREM", "l", "0", "x"), ":1\r\n")
+	assertReply(t, execCmd(database, "LRANGE", "l", "0", "-1"), multiBulk("a", "1", "b", "c", "2"))
+}
+
+func TestListPos(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "RPUSH", "l", "a", "b", "c", "b", "b")
+	assertReply(t, execCmd(database, "LPOS", "l", "b"), ":1\r\n")
+	assertReply(t, execCmd(database, "LPOS", "l", "b", "RANK", "-1"), ":4\r\n")
+	assertReply(t, execCmd(database, "LPOS", "l", "b", "RANK", "2", "COUNT", "0"), "*2\r\n:3\r\n:4\r\n")
+	assertReply(t, execCmd(database, "LPOS", "l", "b", "COUNT", "0", "MAXLEN", "2"), "*1\r\n:1\r\n")
+	assertReply(t, execCmd(database, "LPOS", "l", "z"), "$-1\r\n")
+	assertReply(t, execCmd(database, "LPOS", "l", "b", "RANK", "0"),
+		"-ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list\r\n")
+}
+
+func TestListMove(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "RPUSH", "src", "a", "b", "c")
+	assertReply(t, execCmd(database, "LMOVE", "src", "dst", "LEFT", "RIGHT"), "$1\r\na\r\n")
+	assertReply(t, execCmd(database, "LMOVE", "src", "dst", "RIGHT", "LEFT"), "$1\r\nc\r\n")
+	assertReply(t, execCmd(database, "RPOPLPUSH", "src", "dst"), "$1\r\nb\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "src"), ":0\r\n")
+	assertReply(t, execCmd(database, "LRANGE", "dst", "0", "-1"), multiBulk("b", "c", "a"))
+
+	// moving within the same list rotates it
+	assertReply(t, execCmd(database, "LMOVE", "dst", "dst", "LEFT", "RIGHT"), "$1\r\nb\r\n")
+	assertReply(t, execCmd(database, "LRANGE", "dst", "0", "-1"), multiBulk("c", "a", "b"))
+	assertReply(t, execCmd(database, "LMOVE", "none", "dst", "LEFT", "LEFT"), "$-1\r\n")
+	assertReply(t, execCmd(database, "LMOVE", "dst", "x", "UP", "LEFT"), "-Err syntax error\r\n")
+
+	execCmd(database, "SET", "s", "v")
+	assertReply(t, execCmd(database, "LMOVE", "dst", "s", "LEFT", "LEFT"), "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+	assertReply(t, execCmd(database, "LLEN", "dst"), ":3\r\n")
+}
@@ -0,0 +1,267 @@
+package database
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/rdb"
+	"go-redis/resp/reply"
+)
+
+func init() {
+	RegisterCommand("dump", execDump, readFirstKey, 2)
+	RegisterCommand("restore", execRestore, writeFirstKey, -4)
+	// RESTORE-ASKING is sent by MIGRATE, the node importing the slot accepts it without ASKING
+	RegisterCommand("restore-asking", execRestore, writeFirstKey, -4)
+	RegisterCommand("migrate", execMigrate, prepareMigrate, -6)
+}
+
+// execDump DUMP key
+func execDump(db *DB, args [][]byte) resp.Reply {
+	o := db.dumpObject(string(args[0]))
+	if o == nil {
+		return reply.MakeNullBulkReply()
+	}
+	payload, err := rdb.Dump(o)
+	if err != nil {
+		return reply.MakeStandardErrReply("ERR " + err.Error())
+	}
+	return reply.MakeBulkReply(payload)
+}
+
+// execRestore RESTORE key ttl payload [REPLACE] [ABSTTL] [IDLETIME seconds] [FREQ frequency]
+func execRestore(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	ttl, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if ttl < 0 {
+		return reply.MakeStandardErrReply("ERR Invalid TTL value, must be >= 0")
+	}
+	replace, absTTL := false, false
+	for i := 3; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "REPLACE":
+			replace = true
+		case "ABSTTL":
+			absTTL = true
+		case "IDLETIME", "FREQ":
+			// keys are not evicted, the access statistics are accepted and ignored
+			if i+1 >= len(args) {
+				return reply.MakeSyntaxErrReply()
+			}
+			if _, err := strconv.ParseInt(string(args[i+1]), 10, 64); err != nil {
+				return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+			}
+			i++
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	if _, exists := db.GetEntity(key); exists && !replace {
+		return reply.MakeStandardErrReply("BUSYKEY Target key name already exists.")
+	}
+	o, err := rdb.Restore(args[2])
+	if err != nil {
+		return reply.MakeStandardErrReply("ERR " + err.Error())
+	}
+
+	var expireAt time.Time
+	if ttl > 0 {
+		if absTTL {
+			expireAt = time.Unix(0, ttl*int64(time.Millisecond))
+		} else {
+			expireAt = time.Now().Add(time.Duration(ttl) * time.Millisecond)
+		}
+	}
+	db.Remove(key)
+	if ttl > 0 && expireAt.Before(time.Now()) {
+		// restoring an expired key deletes it
+		db.addAof(utils.ToCmdLine("del", key))
+		return reply.MakeOKReply()
+	}
+	db.PutEntity(key, objectToEntity(o))
+	pxat := "0"
+	if ttl > 0 {
+		db.Expire(key, expireAt)
+		pxat = strconv.FormatInt(expireAt.UnixNano()/int64(time.Millisecond), 10)
+	}
+	db.addAof(utils.ToCmdLine2("restore", []byte(key), []byte(pxat), args[2],
+		[]byte("REPLACE"), []byte("ABSTTL")))
+	return reply.MakeOKReply()
+}
+
+// migrateArgs are the arguments of MIGRATE
+type migrateArgs struct {
+	addr     string
+	dbIndex  int
+	timeout  time.Duration
+	copy     bool
+	replace  bool
+	authArgs []string // arguments of AUTH sent to the target, nil if none
+	keys     []string
+}
+
+// parseMigrateArgs parses MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE]
+// [AUTH password] [AUTH2 username password] [KEYS key [key ...]]
+func parseMigrateArgs(args [][]byte) (*migrateArgs, resp.Reply) {
+	port, err := strconv.Atoi(string(args[1]))
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, reply.MakeStandardErrReply("ERR Invalid port")
+	}
+	dbIndex, err := strconv.Atoi(string(args[3]))
+	if err != nil || dbIndex < 0 {
+		return nil, reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	timeout, err := strconv.ParseInt(string(args[4]), 10, 64)
+	if err != nil || timeout < 0 {
+		return nil, reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if timeout == 0 {
+		timeout = 1000
+	}
+	m := &migrateArgs{
+		addr:    net.JoinHostPort(string(args[0]), strconv.Itoa(port)),
+		dbIndex: dbIndex,
+		timeout: time.Duration(timeout) * time.Millisecond,
+	}
+	for i := 5; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "COPY":
+			m.copy = true
+		case "REPLACE":
+			m.replace = true
+		case "AUTH":
+			if i+1 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			m.authArgs = []string{string(args[i+1])}
+			i++
+		case "AUTH2":
+			if i+2 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			m.authArgs = []string{string(args[i+1]), string(args[i+2])}
+			i += 2
+		case "KEYS":
+			if len(args[2]) != 0 {
+				return nil, reply.MakeStandardErrReply("ERR When using MIGRATE KEYS option, the key argument " +
+					"must be set to the empty string")
+			}
+			for _, key := range args[i+1:] {
+				m.keys = append(m.keys, string(key))
+			}
+			i = len(args)
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	if m.keys == nil {
+		m.keys = []string{string(args[2])}
+	}
+	return m, nil
+}
+
+// prepareMigrate locks the keys moved by MIGRATE
+func prepareMigrate(args [][]byte) ([]string, []string) {
+	for i := 5; i < len(args); i++ {
+		if strings.EqualFold(string(args[i]), "KEYS") {
+			_, keys := readAllKeys(args[i+1:])
+			return keys, nil
+		}
+	}
+	return []string{string(args[2])}, nil
+}
+
+// execMigrate MIGRATE host port key|"" destination-db timeout [COPY] [REPLACE] [AUTH password]
+// [AUTH2 username password] [KEYS key [key ...]]
+// the keys are restored on the target then removed locally unless COPY is given,
+// they stay locked meanwhile so no client sees a key on both nodes or on neither
+func execMigrate(db *DB, args [][]byte) resp.Reply {
+	m, errReply := parseMigrateArgs(args)
+	if errReply != nil {
+		return errReply
+	}
+	var keys []string
+	var lines []CmdLine
+	for _, key := range m.keys {
+		o := db.dumpObject(key)
+		if o == nil {
+			continue
+		}
+		payload, err := rdb.Dump(o)
+		if err != nil {
+			return reply.MakeStandardErrReply("ERR " + err.Error())
+		}
+		ttl := "0"
+		if o.ExpireAt != nil {
+			// at least 1ms, 0 means no ttl
+			ttl = strconv.FormatInt(int64(time.Until(*o.ExpireAt)/time.Millisecond)+1, 10)
+		}
+		line := utils.ToCmdLine2("restore-asking", []byte(key), []byte(ttl), payload)
+		if m.replace {
+			line = append(line, []byte("REPLACE"))
+		}
+		keys = append(keys, key)
+		lines = append(lines, line)
+	}
+	if len(keys) == 0 {
+		return reply.MakeStatusReply("NOKEY")
+	}
+
+	if errReply := sendToTarget(m, lines); errReply != nil {
+		return errReply
+	}
+	if !m.copy {
+		db.Removes(keys...)
+		db.addAof(utils.ToCmdLine2("del", toByteArgs(keys)...))
+	}
+	return reply.MakeOKReply()
+}
+
+// sendToTarget sends the RESTORE commands to the target of MIGRATE after authenticating and selecting the db
+func sendToTarget(m *migrateArgs, lines []CmdLine) resp.Reply {
+	conn, err := net.DialTimeout("tcp", m.addr, m.timeout)
+	if err != nil {
+		return reply.MakeStandardErrReply("IOERR error or timeout connecting to the client")
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	command := func(line CmdLine) (string, error) {
+		_ = conn.SetDeadline(time.Now().Add(m.timeout))
+		if _, err := conn.Write(reply.MakeMultiBulkReply(line).ToBytes()); err != nil {
+			return "", err
+		}
+		return readReplyLine(reader)
+	}
+
+	var prefix []CmdLine
+	if m.authArgs != nil {
+		prefix = append(prefix, utils.ToCmdLine(append([]string{"AUTH"}, m.authArgs...)...))
+	}
+	prefix = append(prefix, utils.ToCmdLine("SELECT", strconv.Itoa(m.dbIndex)))
+	for _, line := range append(prefix, lines...) {
+		result, err := command(line)
+		if err != nil {
+			return reply.MakeStandardErrReply("IOERR error or timeout reading to target instance")
+		}
+		if strings.HasPrefix(result, "-") {
+			return reply.MakeStandardErrReply("ERR Target instance replied with error: " + result[1:])
+		}
+	}
+	return nil
+}
+
+func toByteArgs(keys []string) [][]byte {
+	args := make([][]byte, len(keys))
+	for i, key := range keys {
+		args[i] = []byte(key)
+	}
+	return args
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-redis/resp/connection"
+	"go-redis/resp/parser"
+	"go-redis/resp/reply"
+)
+
+func TestDumpRestore(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "SET", "s", "v")
+	execCmd(database, "RPUSH", "l", "a", "b")
+	execCmd(database, "SADD", "set", "1", "2")
+	execCmd(database, "HSET", "h", "f", "v")
+	execCmd(database, "ZADD", "z", "1.5", "m")
+	assertReply(t, execCmd(database, "DUMP", "none"), "$-1\r\n")
+	for _, key := range []string{"s", "l", "set", "h", "z"} {
+		payload := database.Exec(&connection.Connection{}, [][]byte{[]byte("DUMP"), []byte(key)})
+		bulk, ok := payload.(*reply.BulkReply)
+		if !ok {
+			t.Fatalf("expected the payload of %s, got %q", key, payload.ToBytes())
+		}
+		assertReply(t, execCmd(database, "RESTORE", key, "0", string(bulk.Arg)), "-BUSYKEY Target key name already exists.\r\n")
+		assertReply(t, execCmd(database, "RESTORE", key+"2", "0", string(bulk.Arg)), "+OK\r\n")
+		assertReply(t, execCmd(database, "TYPE", key+"2"), execCmd(database, "TYPE", key))
+		assertReply(t, execCmd(database, "DUMP", key+"2"), string(payload.ToBytes()))
+	}
+	assertReply(t, execCmd(database, "LRANGE", "l2", "0", "-1"), multiBulk("a", "b"))
+	assertReply(t, execCmd(database, "ZSCORE", "z2", "m"), "$3\r\n1.5\r\n")
+}
+
+func TestRestoreOptions(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "SET", "s", "v")
+	payload := string(database.Exec(&connection.Connection{}, [][]byte{[]byte("DUMP"), []byte("s")}).(*reply.BulkReply).Arg)
+
+	assertReply(t, execCmd(database, "RESTORE", "s", "100000", payload, "REPLACE", "IDLETIME", "10"), "+OK\r\n")
+	if ttl := execCmd(database, "TTL", "s"); ttl != ":100\r\n" && ttl != ":99\r\n" {
+		t.Errorf("expected ttl of the restored key, got %q", ttl)
+	}
+	past := strconv.FormatInt(time.Now().Add(-time.Hour).UnixNano()/int64(time.Millisecond), 10)
+	assertReply(t, execCmd(database, "RESTORE", "s", past, payload, "REPLACE", "ABSTTL"), "+OK\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "s"), ":0\r\n")
+
+	assertReply(t, execCmd(database, "RESTORE", "s", "-1", payload), "-ERR Invalid TTL value, must be >= 0\r\n")
+	assertReply(t, execCmd(database, "RESTORE", "s", "0", payload, "FREQ"), "-Err syntax error\r\n")
+	broken := payload[:len(payload)-1] + "x"
+	assertReply(t, execCmd(database, "RESTORE", "s", "0", broken), "-ERR DUMP payload version or checksum are wrong\r\n")
+}
+
+// serveDatabase serves the database on a local port, returns the port
+func serveDatabase(t *testing.T, database *StandaloneDatabase) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				client := &connection.Connection{}
+				for p := range parser.ParseStream(conn) {
+					if p.Err != nil {
+						return
+					}
+					if r, ok := p.Data.(*reply.MultiBulkReply); ok {
+						_, _ = conn.Write(database.Exec(client, r.Args).ToBytes())
+					}
+				}
+			}()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(listener.Addr().String())
+	return port
+}
+
+func TestMigrate(t *testing.T) {
+	source := newMemoryDatabase(t)
+	target := newBasicDatabase()
+	port := serveDatabase(t, target)
+	execCmd(source, "SET", "a", "1")
+	execCmd(source, "SET", "b", "2", "EX", "100")
+	execCmd(source, "SET", "c", "3")
+	assertReply(t, execCmd(source, "MIGRATE", "127.0.0.1", port, "", "3", "1000", "KEYS", "a", "b", "none"), "+OK\r\n")
+	assertReply(t, execCmd(source, "EXISTS", "a", "b"), ":0\r\n")
+	assertReply(t, execCmd(source, "MIGRATE", "127.0.0.1", port, "none", "3", "1000"), "+NOKEY\r\n")
+
+	client := &connection.Connection{}
+	client.SelectDB(3)
+	assertReply(t, execOn(target, client, "GET", "a"), "$1\r\n1\r\n")
+	if ttl := execOn(target, client, "TTL", "b"); ttl != ":100\r\n" && ttl != ":99\r\n" {
+		t.Errorf("expected ttl of b moved, got %q", ttl)
+	}
+
+	// the target refuses an existing key unless REPLACE is given
+	execOn(target, client, "SET", "c", "old")
+	ret := execCmd(source, "MIGRATE", "127.0.0.1", port, "c", "3", "1000", "COPY")
+	if !strings.HasPrefix(ret, "-ERR Target instance replied with error: BUSYKEY") {
+		t.Errorf("expected BUSYKEY from the target, got %q", ret)
+	}
+	assertReply(t, execCmd(source, "EXISTS", "c"), ":1\r\n")
+}
@@ -0,0 +1,164 @@
+package database
+
+import (
+	"errors"
+	"strings"
+
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+)
+
+// startMulti MULTI
+func startMulti(c resp.Connection) resp.Reply {
+	if c.InMultiState() {
+		return reply.MakeStandardErrReply("ERR MULTI calls can not be nested")
+	}
+	c.SetMultiState(true)
+	return reply.MakeOKReply()
+}
+
+// discardMulti DISCARD
+func discardMulti(c resp.Connection) resp.Reply {
+	if !c.InMultiState() {
+		return reply.MakeStandardErrReply("ERR DISCARD without MULTI")
+	}
+	c.SetMultiState(false)
+	return reply.MakeOKReply()
+}
+
+// enqueueCmd queues a command of the transaction,
+// an unknown command or a wrong number of arguments aborts the transaction
+func enqueueCmd(c resp.Connection, cmdLine CmdLine) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok {
+		errReply := reply.MakeStandardErrReply("ERR unknown command " + cmdName)
+		c.AddTxError(errors.New(errReply.Error()))
+		return errReply
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		errReply := reply.MakeArgNumErrReply(cmdName)
+		c.AddTxError(errors.New(errReply.Error()))
+		return errReply
+	}
+	c.EnqueueCmd(cmdLine)
+	return reply.MakeStatusReply("QUEUED")
+}
+
+// watch WATCH key [key ...]
+func (db *DB) watch(c resp.Connection, args [][]byte) resp.Reply {
+	if c.InMultiState() {
+		return reply.MakeStandardErrReply("ERR WATCH inside MULTI is not allowed")
+	}
+	watching := c.GetWatching()
+	for _, arg := range args {
+		key := string(arg)
+		watching[key] = db.GetVersion(key)
+	}
+	return reply.MakeOKReply()
+}
+
+// unwatch UNWATCH
+func unwatch(c resp.Connection) resp.Reply {
+	watching := c.GetWatching()
+	for key := range watching {
+		delete(watching, key)
+	}
+	return reply.MakeOKReply()
+}
+
+// isWatchingChanged tells whether any watched key was written after WATCH
+func (db *DB) isWatchingChanged(watching map[string]uint32) bool {
+	for key, version := range watching {
+		if db.GetVersion(key) != version {
+			return true
+		}
+	}
+	return false
+}
+
+// execMulti EXEC
+func (db *DB) execMulti(c resp.Connection) resp.Reply {
+	if !c.InMultiState() {
+		return reply.MakeStandardErrReply("ERR EXEC without MULTI")
+	}
+	defer c.SetMultiState(false)
+	if len(c.GetTxErrors()) > 0 {
+		return reply.MakeStandardErrReply("EXECABORT Transaction discarded because of previous errors.")
+	}
+	return db.ExecMulti(c.GetWatching(), c.GetQueuedCmdLine())
+}
+
+// ExecMulti runs the queued commands atomically: keys of all commands are locked together,
+// so no other command is executed between them. Nothing runs if a watched key was changed.
+// Commands failing at runtime do not stop the others, as redis does no rollback.
+func (db *DB) ExecMulti(watching map[string]uint32, cmdLines [][][]byte) resp.Reply {
+	// prepare
+	writeKeys := make([]string, 0)
+	readKeys := make([]string, 0)
+	exclusive := false
+	for _, cmdLine := range cmdLines {
+		cmdName := strings.ToLower(string(cmdLine[0]))
+		cmd := cmdTable[cmdName]
+		write, read := cmd.prepare(cmdLine[1:])
+		writeKeys = append(writeKeys, write...)
+		readKeys = append(readKeys, read...)
+		exclusive = exclusive || exclusiveCommands[cmdName]
+	}
+	for key := range watching {
+		readKeys = append(readKeys, key)
+	}
+	if exclusive {
+		db.barrier.Lock()
+		defer db.barrier.Unlock()
+	} else {
+		db.barrier.RLock()
+		defer db.barrier.RUnlock()
+	}
+	db.locker.RWLocks(writeKeys, readKeys)
+	defer db.locker.RWUnLocks(writeKeys, readKeys)
+
+	if db.isWatchingChanged(watching) {
+		return reply.MakeNullMultiBulkReply()
+	}
+	db.beforeWrite(writeKeys...)
+
+	// execute, aof of the commands is collected and written as a single MULTI ... EXEC block,
+	// so replaying a truncated aof never applies part of the transaction
+	aofLines := make([]CmdLine, 0)
+	txDB := db.withAof(func(lines ...CmdLine) {
+		aofLines = append(aofLines, lines...)
+	})
+	results := make([]resp.Reply, 0, len(cmdLines))
+	for _, cmdLine := range cmdLines {
+		cmd := cmdTable[strings.ToLower(string(cmdLine[0]))]
+		results = append(results, cmd.executor(txDB, cmdLine[1:]))
+	}
+	db.addVersion(writeKeys...)
+
+	if len(aofLines) > 0 {
+		block := make([]CmdLine, 0, len(aofLines)+2)
+		block = append(block, utils.ToCmdLine("multi"))
+		block = append(block, aofLines...)
+		block = append(block, utils.ToCmdLine("exec"))
+		db.addAof(block...)
+	}
+	return reply.MakeMultiRawReply(results)
+}
+
+// withAof returns a view of db which shares data with db but sends aof to addAof
+func (db *DB) withAof(addAof func(...CmdLine)) *DB {
+	return &DB{
+		index:      db.index,
+		data:       db.data,
+		ttlMap:     db.ttlMap,
+		versionMap: db.versionMap,
+		addAof:     addAof,
+		locker:     db.locker,
+		loading:    db.loading,
+		barrier:    db.barrier,
+		snapshot:   db.snapshot,
+		stats:      db.stats,
+	}
+}
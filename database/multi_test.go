@@ -0,0 +1,121 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"go-redis/resp/connection"
+)
+
+func TestMultiExec(t *testing.T) {
+	database := newMemoryDatabase(t)
+	client := &connection.Connection{}
+	assertReply(t, execOn(database, client, "MULTI"), "+OK\r\n")
+	assertReply(t, execOn(database, client, "SET", "k", "v"), "+QUEUED\r\n")
+	assertReply(t, execOn(database, client, "INCR", "n"), "+QUEUED\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "k"), ":0\r\n")
+	assertReply(t, execOn(database, client, "EXEC"), "*2\r\n+OK\r\n:1\r\n")
+	assertReply(t, execCmd(database, "GET", "k"), "$1\r\nv\r\n")
+}
+
+func TestMultiDiscard(t *testing.T) {
+	database := newMemoryDatabase(t)
+	client := &connection.Connection{}
+	execOn(database, client, "MULTI")
+	execOn(database, client, "SET", "k", "v")
+	assertReply(t, execOn(database, client, "DISCARD"), "+OK\r\n")
+	assertReply(t, execOn(database, client, "EXEC"), "-ERR EXEC without MULTI\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "k"), ":0\r\n")
+}
+
+func TestMultiWatch(t *testing.T) {
+	database := newMemoryDatabase(t)
+	client := &connection.Connection{}
+	execOn(database, client, "WATCH", "k")
+	execCmd(database, "SET", "k", "other")
+	execOn(database, client, "MULTI")
+	execOn(database, client, "SET", "k", "v")
+	assertReply(t, execOn(database, client, "EXEC"), "*-1\r\n")
+	assertReply(t, execCmd(database, "GET", "k"), "$5\r\nother\r\n")
+}
+
+func TestMultiServerCommand(t *testing.T) {
+	database := newMemoryDatabase(t)
+	client := &connection.Connection{}
+	execOn(database, client, "MULTI")
+	execOn(database, client, "SET", "k", "v")
+	for _, cmdLine := range [][]string{{"PUBLISH", "ch", "msg"}, {"SUBSCRIBE", "ch"}, {"INFO"}, {"SAVE"}, {"ROLE"}} {
+		if ret := execOn(database, client, cmdLine...); ret[0] != '-' {
+			t.Errorf("expected %s refused inside MULTI, got %q", cmdLine[0], ret)
+		}
+	}
+	if client.SubsCount() != 0 {
+		t.Error("SUBSCRIBE inside MULTI subscribed")
+	}
+	// every command of the server is refused, whatever its arguments
+	for name := range serverCmdTable {
+		assertReply(t, execOn(database, client, name), "-ERR "+strings.ToUpper(name)+" inside MULTI is not allowed\r\n")
+	}
+	assertReply(t, execOn(database, client, "EXEC"), "-EXECABORT Transaction discarded because of previous errors.\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "k"), ":0\r\n")
+	assertReply(t, execOn(database, client, "SELECT", "1", "2"), "-ERR wrong number of arguments for 'select' command\r\n")
+}
+
+func TestMultiErrors(t *testing.T) {
+	database := newMemoryDatabase(t)
+	client := &connection.Connection{}
+	execOn(database, client, "MULTI")
+	assertReply(t, execOn(database, client, "MULTI"), "-ERR MULTI calls can not be nested\r\n")
+	assertReply(t, execOn(database, client, "WATCH", "k"), "-ERR WATCH inside MULTI is not allowed\r\n")
+	assertReply(t, execOn(database, client, "SET", "k", "v"), "+QUEUED\r\n")
+	assertReply(t, execOn(database, client, "NOSUCHCMD"), "-ERR unknown command nosuchcmd\r\n")
+	assertReply(t, execOn(database, client, "EXEC"), "-EXECABORT Transaction discarded because of previous errors.\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "k"), ":0\r\n")
+	assertReply(t, execOn(database, client, "DISCARD"), "-ERR DISCARD without MULTI\r\n")
+
+	// a command failing at runtime does not stop the others, nothing is rolled back
+	execCmd(database, "RPUSH", "l", "a")
+	execOn(database, client, "MULTI")
+	execOn(database, client, "SET", "k", "v")
+	execOn(database, client, "INCR", "l")
+	execOn(database, client, "INCR", "n")
+	assertReply(t, execOn(database, client, "EXEC"),
+		"*3\r\n+OK\r\n-WRONGTYPE Operation against a key holding the wrong kind of value\r\n:1\r\n")
+	assertReply(t, execCmd(database, "GET", "k"), "$1\r\nv\r\n")
+}
+
+func TestMultiUnwatch(t *testing.T) {
+	database := newMemoryDatabase(t)
+	client := &connection.Connection{}
+	execOn(database, client, "WATCH", "k", "other")
+	execCmd(database, "SET", "other", "v")
+	assertReply(t, execOn(database, client, "UNWATCH"), "+OK\r\n")
+	execOn(database, client, "MULTI")
+	execOn(database, client, "SET", "k", "v")
+	assertReply(t, execOn(database, client, "EXEC"), "*1\r\n+OK\r\n")
+
+	// EXEC forgets the watched keys
+	execOn(database, client, "WATCH", "k")
+	execOn(database, client, "MULTI")
+	execOn(database, client, "SET", "k", "v2")
+	assertReply(t, execOn(database, client, "EXEC"), "*1\r\n+OK\r\n")
+	execCmd(database, "SET", "k", "v3")
+	execOn(database, client, "MULTI")
+	execOn(database, client, "GET", "k")
+	assertReply(t, execOn(database, client, "EXEC"), "*1\r\n$2\r\nv3\r\n")
+}
+
+func TestMultiAof(t *testing.T) {
+	useTestConfig(t).AppendOnly = true
+	database := newTestDatabase(t)
+	client := &connection.Connection{}
+	execOn(database, client, "MULTI")
+	execOn(database, client, "SET", "k", "v")
+	execOn(database, client, "RPUSH", "l", "a", "b")
+	execOn(database, client, "EXEC")
+	_ = database.Close()
+
+	database = newTestDatabase(t)
+	assertReply(t, execCmd(database, "GET", "k"), "$1\r\nv\r\n")
+	assertReply(t, execCmd(database, "LLEN", "l"), ":2\r\n")
+}
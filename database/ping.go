@@ -6,7 +6,7 @@ import (
 )
 
 func init() {
-	RegisterCommand("ping", ping, 1)
+	RegisterCommand("ping", ping, noPrepare, 1)
 }
 
 // ping PING
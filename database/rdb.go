@@ -0,0 +1,366 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go-redis/aof"
+	"go-redis/config"
+	"go-redis/datastruct/dict"
+	"go-redis/datastruct/list"
+	"go-redis/datastruct/set"
+	"go-redis/datastruct/sortedset"
+	"go-redis/interface/resp"
+	"go-redis/lib/logger"
+	"go-redis/rdb"
+	"go-redis/resp/reply"
+
+	databaseface "go-redis/interface/database"
+)
+
+const (
+	// saveCronInterval is the interval between two checks of the save rules
+	saveCronInterval = time.Second
+
+	// saveRetryDelay is the minimum interval before an automatic save is retried after a failure
+	saveRetryDelay = 5 * time.Second
+)
+
+var errSaveInProgress = errors.New("ERR Background save already in progress")
+
+// saveRule triggers a background save once changes writes happened within seconds
+type saveRule struct {
+	seconds int64
+	changes int64
+}
+
+// parseSaveRules parses "<seconds> <changes> [<seconds> <changes> ...]"
+func parseSaveRules(value string) ([]saveRule, error) {
+	fields := strings.Fields(value)
+	if len(fields)%2 != 0 {
+		return nil, fmt.Errorf("invalid save rules %q", value)
+	}
+	rules := make([]saveRule, 0, len(fields)/2)
+	for i := 0; i < len(fields); i += 2 {
+		seconds, err := strconv.ParseInt(fields[i], 10, 64)
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid save rules %q", value)
+		}
+		changes, err := strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil || changes <= 0 {
+			return nil, fmt.Errorf("invalid save rules %q", value)
+		}
+		rules = append(rules, saveRule{seconds: seconds, changes: changes})
+	}
+	return rules, nil
+}
+
+func init() {
+	registerServerCommand("Save", execSave, 1)
+	registerServerCommand("BGSave", execBGSave, 1)
+	registerServerCommand("LastSave", execLastSave, 1)
+}
+
+// execSave SAVE
+func execSave(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if err := database.Save(); err != nil {
+		if err == errSaveInProgress {
+			return reply.MakeStandardErrReply(err.Error())
+		}
+		return reply.MakeStandardErrReply("ERR " + err.Error())
+	}
+	return reply.MakeOKReply()
+}
+
+// execBGSave BGSAVE
+func execBGSave(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if err := database.BGSave(); err != nil {
+		return reply.MakeStandardErrReply(err.Error())
+	}
+	return reply.MakeStatusReply("Background saving started")
+}
+
+// execLastSave LASTSAVE
+func execLastSave(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	database.saveMu.Lock()
+	defer database.saveMu.Unlock()
+	return reply.MakeIntReply(database.lastSave.Unix())
+}
+
+// Save writes the snapshot and returns once it is on disk
+func (database *StandaloneDatabase) Save() error {
+	dirty, err := database.startSave(false)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	err = database.saveRDB()
+	database.finishSave(dirty, start, false, err)
+	return err
+}
+
+// BGSave writes the snapshot in background
+func (database *StandaloneDatabase) BGSave() error {
+	dirty, err := database.startSave(true)
+	if err != nil {
+		return err
+	}
+	go func() {
+		start := time.Now()
+		err := database.saveRDB()
+		database.finishSave(dirty, start, true, err)
+	}()
+	return nil
+}
+
+// startSave marks a snapshot in progress, only one snapshot is written at a time.
+// It returns the number of writes the snapshot will contain.
+func (database *StandaloneDatabase) startSave(background bool) (int64, error) {
+	database.saveMu.Lock()
+	defer database.saveMu.Unlock()
+	if database.saveDone != nil {
+		return 0, errSaveInProgress
+	}
+	database.saveDone = make(chan struct{})
+	database.bgSaving = background
+	if background {
+		database.lastBgSaveTry = time.Now()
+	}
+	return atomic.LoadInt64(&database.dirty), nil
+}
+
+// finishSave records the result of the snapshot started by startSave
+func (database *StandaloneDatabase) finishSave(dirty int64, start time.Time, background bool, err error) {
+	database.saveMu.Lock()
+	defer database.saveMu.Unlock()
+	if background {
+		database.lastBgSaveErr = err
+		database.lastBgSaveDuration = time.Since(start)
+	}
+	if err != nil {
+		logger.Error("save rdb failed: " + err.Error())
+	} else {
+		// writes arriving during the save may be missing from the snapshot, they keep counting
+		atomic.AddInt64(&database.dirty, -dirty)
+		database.lastSave = time.Now()
+		logger.Info("DB saved on disk")
+	}
+	close(database.saveDone)
+	database.saveDone = nil
+	database.bgSaving = false
+}
+
+// saveOnShutdown waits for a running snapshot, then saves the changes written after it
+func (database *StandaloneDatabase) saveOnShutdown() {
+	for {
+		err := database.Save()
+		if err != errSaveInProgress {
+			return
+		}
+		database.saveMu.Lock()
+		done := database.saveDone
+		database.saveMu.Unlock()
+		if done != nil {
+			<-done
+		}
+	}
+}
+
+// saveRDB writes the snapshot into a temporary file then renames it, so the file is always complete
+func (database *StandaloneDatabase) saveRDB() error {
+	filename := config.Properties.DBFilename
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), "temp-*.rdb")
+	if err != nil {
+		return err
+	}
+	err = database.writeSnapshot(database.startSnapshot(database.repl.recordMaster), tmpFile)
+	if err == nil {
+		err = tmpFile.Sync()
+	}
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpFile.Name(), filename)
+	}
+	if err != nil {
+		_ = os.Remove(tmpFile.Name())
+	}
+	return err
+}
+
+// dumpObject copies the value of the key, returns nil if the key does not exist or is expired.
+// The caller holds a lock of the key.
+func (db *DB) dumpObject(key string) *rdb.Object {
+	raw, exists := db.data.Get(key)
+	if !exists {
+		return nil
+	}
+	o := &rdb.Object{
+		DBIndex: db.index,
+		Key:     key,
+	}
+	if expireTime, ok := db.ExpireTime(key); ok {
+		if expireTime.Before(time.Now()) {
+			return nil
+		}
+		o.ExpireAt = &expireTime
+	}
+	entity, _ := raw.(*databaseface.DataEntity)
+	switch val := entity.Data.(type) {
+	case []byte:
+		o.Type = rdb.StringType
+		o.String = val
+	case list.List:
+		o.Type = rdb.ListType
+		o.List = make([][]byte, 0, val.Len())
+		val.ForEach(func(i int, v interface{}) bool {
+			o.List = append(o.List, v.([]byte))
+			return true
+		})
+	case *set.Set:
+		o.Type = rdb.SetType
+		o.Set = make([][]byte, 0, val.Len())
+		val.ForEach(func(member string) bool {
+			o.Set = append(o.Set, []byte(member))
+			return true
+		})
+	case dict.Dict:
+		o.Type = rdb.HashType
+		o.Hash = make(map[string][]byte, val.Len())
+		val.Foreach(func(field string, v interface{}) bool {
+			o.Hash[field] = v.([]byte)
+			return true
+		})
+	case *sortedset.SortedSet:
+		o.Type = rdb.ZSetType
+		o.ZSet = make([]*rdb.ZSetEntry, 0, val.Len())
+		val.ForEachByRank(0, val.Len(), false, func(element *sortedset.Element) bool {
+			o.ZSet = append(o.ZSet, &rdb.ZSetEntry{Member: element.Member, Score: element.Score})
+			return true
+		})
+	default:
+		return nil
+	}
+	return o
+}
+
+// loadRDB loads the snapshot file, a missing file means an empty dataset.
+// If logAof is set, loaded keys are written to aof as commands. It returns the auxiliary fields.
+func (database *StandaloneDatabase) loadRDB(filename string, logAof bool) (map[string]string, error) {
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	now := time.Now()
+	var loadErr error
+	decoder := rdb.NewDecoder(file)
+	err = decoder.Parse(func(o *rdb.Object) bool {
+		if o.DBIndex >= len(database.dbSet) {
+			loadErr = fmt.Errorf("rdb contains db %d but only %d dbs are configured", o.DBIndex, len(database.dbSet))
+			return false
+		}
+		if o.ExpireAt != nil && o.ExpireAt.Before(now) {
+			return true
+		}
+		db := database.dbSet[o.DBIndex]
+		db.beforeWrite(o.Key)
+		entity := objectToEntity(o)
+		db.PutEntity(o.Key, entity)
+		if o.ExpireAt != nil {
+			db.Expire(o.Key, *o.ExpireAt)
+		}
+		if logAof {
+			lines := []CmdLine{aof.EntityToCmd(o.Key, entity)}
+			if o.ExpireAt != nil {
+				lines = append(lines, aof.MakeExpireCmd(o.Key, *o.ExpireAt))
+			}
+			db.addAof(lines...)
+		}
+		return true
+	})
+	if err == nil {
+		err = loadErr
+	}
+	return decoder.Aux(), err
+}
+
+// objectToEntity converts a decoded object into the data structure storing its type
+func objectToEntity(o *rdb.Object) *databaseface.DataEntity {
+	var data interface{}
+	switch o.Type {
+	case rdb.StringType:
+		data = o.String
+	case rdb.ListType:
+		l := list.NewQuickList()
+		for _, value := range o.List {
+			l.Add(value)
+		}
+		data = l
+	case rdb.SetType:
+		s := set.Make()
+		for _, member := range o.Set {
+			s.Add(string(member))
+		}
+		data = s
+	case rdb.HashType:
+		d := dict.MakeSimpleDict()
+		for field, value := range o.Hash {
+			d.Put(field, value)
+		}
+		data = d
+	case rdb.ZSetType:
+		sortedSet := sortedset.Make()
+		for _, entry := range o.ZSet {
+			sortedSet.Add(entry.Member, entry.Score)
+		}
+		data = sortedSet
+	}
+	return &databaseface.DataEntity{Data: data}
+}
+
+// saveCron starts a background save once any save rule is met
+func (database *StandaloneDatabase) saveCron() {
+	ticker := time.NewTicker(saveCronInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			database.checkSaveRules()
+		case <-database.closed:
+			return
+		}
+	}
+}
+
+func (database *StandaloneDatabase) checkSaveRules() {
+	database.saveMu.Lock()
+	inProgress := database.saveDone != nil
+	sinceLastSave := time.Since(database.lastSave)
+	retrying := database.lastBgSaveErr != nil && time.Since(database.lastBgSaveTry) < saveRetryDelay
+	database.saveMu.Unlock()
+	if inProgress || retrying {
+		return
+	}
+	dirty := atomic.LoadInt64(&database.dirty)
+	for _, rule := range database.saveRules {
+		if dirty >= rule.changes && sinceLastSave >= time.Duration(rule.seconds)*time.Second {
+			logger.Info(fmt.Sprintf("%d changes in %d seconds. Saving...", rule.changes, rule.seconds))
+			if err := database.BGSave(); err != nil {
+				logger.Error("background saving failed: " + err.Error())
+			}
+			return
+		}
+	}
+}
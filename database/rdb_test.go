@@ -0,0 +1,105 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go-redis/resp/connection"
+)
+
+func TestParseSaveRules(t *testing.T) {
+	rules, err := parseSaveRules("3600 1 300 100")
+	if err != nil || len(rules) != 2 || rules[1] != (saveRule{seconds: 300, changes: 100}) {
+		t.Errorf("expected 2 rules, got %v, %v", rules, err)
+	}
+	if rules, err := parseSaveRules(""); err != nil || len(rules) != 0 {
+		t.Errorf("expected no rule, got %v, %v", rules, err)
+	}
+	for _, value := range []string{"3600", "0 1", "3600 -1", "x 1"} {
+		if _, err := parseSaveRules(value); err == nil {
+			t.Errorf("expected %q to be invalid", value)
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	useTestConfig(t)
+	database := newTestDatabase(t)
+	client := &connection.Connection{}
+	execOn(database, client, "SET", "s", "v")
+	execOn(database, client, "SET", "ttl", "v", "EX", "100")
+	execOn(database, client, "SELECT", "2")
+	execOn(database, client, "RPUSH", "l", "a", "b")
+	execOn(database, client, "SADD", "set", "1", "x")
+	execOn(database, client, "HSET", "h", "f", "v")
+	execOn(database, client, "ZADD", "z", "1.5", "m")
+	assertReply(t, execOn(database, client, "SAVE"), "+OK\r\n")
+	if lastSave := execCmd(database, "LASTSAVE"); lastSave == ":0\r\n" || lastSave[0] != ':' {
+		t.Errorf("expected the time of the save, got %q", lastSave)
+	}
+	execCmd(database, "SET", "unsaved", "v")
+	_ = database.Close()
+
+	database = newTestDatabase(t)
+	assertReply(t, execCmd(database, "GET", "s"), "$1\r\nv\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "unsaved"), ":0\r\n")
+	if ttl := execCmd(database, "TTL", "ttl"); ttl != ":100\r\n" && ttl != ":99\r\n" {
+		t.Errorf("expected ttl kept by the snapshot, got %q", ttl)
+	}
+	execOn(database, client, "SELECT", "2")
+	assertReply(t, execOn(database, client, "LRANGE", "l", "0", "-1"), multiBulk("a", "b"))
+	assertReply(t, execOn(database, client, "SCARD", "set"), ":2\r\n")
+	assertReply(t, execOn(database, client, "HGET", "h", "f"), "$1\r\nv\r\n")
+	assertReply(t, execOn(database, client, "ZSCORE", "z", "m"), "$3\r\n1.5\r\n")
+}
+
+func TestSaveOnShutdown(t *testing.T) {
+	useTestConfig(t).Save = "3600 1"
+	database := newTestDatabase(t)
+	execCmd(database, "SET", "k", "v")
+	_ = database.Close()
+
+	database = newTestDatabase(t)
+	assertReply(t, execCmd(database, "GET", "k"), "$1\r\nv\r\n")
+}
+
+func TestBGSave(t *testing.T) {
+	useTestConfig(t)
+	database := newTestDatabase(t)
+	for i := 0; i < 100; i++ {
+		execCmd(database, "INCR", "n")
+	}
+	if !strings.Contains(execCmd(database, "INFO", "persistence"), "rdb_changes_since_last_save:100\r\n") {
+		t.Error("expected 100 changes since the last save")
+	}
+	assertReply(t, execCmd(database, "BGSAVE"), "+Background saving started\r\n")
+	// writes go on while saving, they are counted as changes since the save
+	execCmd(database, "SET", "during", "v")
+	waitSaved(t, database)
+	if !strings.Contains(execCmd(database, "INFO", "persistence"), "rdb_changes_since_last_save:1\r\n") {
+		t.Error("expected the write during the save counted")
+	}
+	_ = database.Close()
+
+	database = newTestDatabase(t)
+	assertReply(t, execCmd(database, "GET", "n"), "$3\r\n100\r\n")
+}
+
+// waitSaved waits for the background save to finish
+func waitSaved(t *testing.T, database *StandaloneDatabase) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		database.saveMu.Lock()
+		done := database.saveDone == nil
+		database.saveMu.Unlock()
+		if done {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("background save did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
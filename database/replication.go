@@ -0,0 +1,349 @@
+package database
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+	"go-redis/resp/reply"
+)
+
+const (
+	roleMaster = "master"
+	roleSlave  = "slave"
+
+	// states of the link of a replica to its master
+	linkConnect    = "connect"
+	linkConnecting = "connecting"
+	linkSync       = "sync"
+	linkConnected  = "connected"
+
+	// replicationCronInterval is the interval between two checks of replicas and pings
+	replicationCronInterval = time.Second
+)
+
+// replication holds the replication state of the server,
+// a replica is a master of its own replicas as well when replicas are chained
+type replication struct {
+	mu sync.Mutex // guards the fields below
+
+	role string
+	// replID identifies the history of the dataset, offset is the number of bytes of the replication stream
+	replID string
+	offset int64
+	// replID2 is the id before the last promotion, replicas of the former master
+	// may continue with it up to secondReplOffset
+	replID2          string
+	secondReplOffset int64
+	backlog          *backlog // nil until the first replica syncs
+
+	replicas       map[resp.Connection]*replica
+	listeningPorts map[resp.Connection]int // announced by REPLCONF before PSYNC
+	// streamDB is the db selected in the stream sent to replicas, -1 makes the next command select
+	streamDB int
+	lastPing time.Time
+
+	// replica role
+	masterHost string
+	masterPort int
+	linkState  string
+	lastIO     time.Time
+	link       *masterLink // nil if not replicating
+	// masterConn executes the commands of the master, it is kept across reconnections
+	// as the stream continues with the db the master selected
+	masterConn *connection.Connection
+
+	// streamMu is held while a command of the master is executed and passed on to replicas,
+	// so a snapshot contains either both or neither
+	streamMu sync.Mutex
+}
+
+func makeReplication() *replication {
+	return &replication{
+		role:             roleMaster,
+		replID:           randomReplID(),
+		secondReplOffset: -1,
+		replicas:         make(map[resp.Connection]*replica),
+		listeningPorts:   make(map[resp.Connection]int),
+		streamDB:         -1,
+	}
+}
+
+// randomReplID generates a replication id of 40 hex characters
+func randomReplID() string {
+	buf := make([]byte, 20)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// propagate passes commands written to a db on to replicas, the caller holds the barrier
+func (repl *replication) propagate(dbIndex int, lines []CmdLine) {
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	if repl.role != roleMaster || (repl.backlog == nil && len(repl.replicas) == 0) {
+		return
+	}
+	var buf bytes.Buffer
+	if dbIndex != repl.streamDB {
+		buf.Write(reply.MakeMultiBulkReply(utils.ToCmdLine("SELECT", strconv.Itoa(dbIndex))).ToBytes())
+		repl.streamDB = dbIndex
+	}
+	for _, line := range lines {
+		buf.Write(reply.MakeMultiBulkReply(line).ToBytes())
+	}
+	repl.feed(buf.Bytes())
+}
+
+// feed appends data to the replication stream, the caller holds mu
+func (repl *replication) feed(data []byte) {
+	repl.offset += int64(len(data))
+	if repl.backlog != nil {
+		repl.backlog.write(data)
+	}
+	for _, r := range repl.replicas {
+		if !r.send(data) {
+			repl.dropReplica(r, "output buffer limit reached")
+		}
+	}
+}
+
+// backlog keeps the latest bytes of the replication stream in a ring buffer,
+// so a replica reconnecting soon continues from where it stopped
+type backlog struct {
+	buf     []byte
+	next    int // index of buf the next byte is written to
+	histLen int // number of valid bytes
+}
+
+func newBacklog(size int64) *backlog {
+	if size <= 0 {
+		size = 1
+	}
+	return &backlog{buf: make([]byte, size)}
+}
+
+func (b *backlog) write(data []byte) {
+	if len(data) >= len(b.buf) {
+		copy(b.buf, data[len(data)-len(b.buf):])
+		b.next = 0
+		b.histLen = len(b.buf)
+		return
+	}
+	n := copy(b.buf[b.next:], data)
+	copy(b.buf, data[n:])
+	b.next = (b.next + len(data)) % len(b.buf)
+	b.histLen += len(data)
+	if b.histLen > len(b.buf) {
+		b.histLen = len(b.buf)
+	}
+}
+
+// firstOffset returns the offset of the first byte kept, offsets of the stream start at 1
+func (b *backlog) firstOffset(masterOffset int64) int64 {
+	return masterOffset - int64(b.histLen) + 1
+}
+
+// readFrom copies the bytes from offset to the end of the stream
+func (b *backlog) readFrom(offset int64, masterOffset int64) []byte {
+	n := int(masterOffset - offset + 1)
+	if n <= 0 {
+		return nil
+	}
+	result := make([]byte, n)
+	start := (b.next - n + len(b.buf)) % len(b.buf)
+	copied := copy(result, b.buf[start:])
+	if copied < n {
+		copy(result[copied:], b.buf[:b.next])
+	}
+	return result
+}
+
+func init() {
+	registerServerCommand("Role", execRole, 1)
+	registerServerCommand("ReplicaOf", execReplicaOf, 3)
+	registerServerCommand("SlaveOf", execReplicaOf, 3)
+}
+
+// execRole ROLE
+func execRole(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	repl := database.repl
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	if repl.role == roleSlave {
+		return reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte(roleSlave)),
+			reply.MakeBulkReply([]byte(repl.masterHost)),
+			reply.MakeIntReply(int64(repl.masterPort)),
+			reply.MakeBulkReply([]byte(repl.linkState)),
+			reply.MakeIntReply(repl.offset),
+		})
+	}
+	replicas := make([]resp.Reply, 0, len(repl.replicas))
+	for _, r := range repl.replicas {
+		ip, port, ackOffset, _, _ := r.status()
+		replicas = append(replicas, reply.MakeMultiBulkReply([][]byte{
+			[]byte(ip),
+			[]byte(strconv.Itoa(port)),
+			[]byte(strconv.FormatInt(ackOffset, 10)),
+		}))
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(roleMaster)),
+		reply.MakeIntReply(repl.offset),
+		reply.MakeMultiRawReply(replicas),
+	})
+}
+
+// execReplicaOf REPLICAOF host port | REPLICAOF NO ONE
+func execReplicaOf(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	host := string(args[0])
+	if strings.EqualFold(host, "no") && strings.EqualFold(string(args[1]), "one") {
+		database.promote()
+		return reply.MakeOKReply()
+	}
+	port, err := strconv.Atoi(string(args[1]))
+	if err != nil || port <= 0 || port > 65535 {
+		return reply.MakeStandardErrReply("ERR Invalid master port")
+	}
+	repl := database.repl
+	repl.mu.Lock()
+	same := repl.role == roleSlave && repl.masterHost == host && repl.masterPort == port
+	repl.mu.Unlock()
+	if same {
+		return reply.MakeStatusReply("OK Already connected to specified master")
+	}
+	database.startReplication(host, port)
+	return reply.MakeOKReply()
+}
+
+// startReplication stops replicating the current master if any, and replicates the given master
+func (database *StandaloneDatabase) startReplication(host string, port int) {
+	database.stopReplication()
+	repl := database.repl
+	link := makeMasterLink(host, port)
+	repl.mu.Lock()
+	repl.role = roleSlave
+	repl.masterHost = host
+	repl.masterPort = port
+	repl.linkState = linkConnect
+	repl.link = link
+	repl.mu.Unlock()
+	go database.runMasterLink(link)
+}
+
+// promote turns a replica into a master, the dataset is kept.
+// The former id stays valid up to the current offset, so other replicas of the former master may continue.
+func (database *StandaloneDatabase) promote() {
+	database.stopReplication()
+	repl := database.repl
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	if repl.role == roleMaster {
+		return
+	}
+	repl.role = roleMaster
+	repl.masterHost = ""
+	repl.masterPort = 0
+	repl.masterConn = nil
+	repl.replID2 = repl.replID
+	repl.secondReplOffset = repl.offset + 1
+	repl.replID = randomReplID()
+	repl.streamDB = -1
+	// replicas reconnect to learn the new id, they continue with a partial resync
+	repl.dropReplicas("master promoted")
+}
+
+// isMasterConn tells whether the connection executes commands received from the master
+func (repl *replication) isMasterConn(c resp.Connection) bool {
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	return repl.masterConn != nil && resp.Connection(repl.masterConn) == c
+}
+
+// isReadOnly tells whether clients are refused to write
+func (repl *replication) isReadOnly() bool {
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	return repl.role == roleSlave && config.Snapshot().ReplicaReadOnly
+}
+
+// IsWriteCommand tells whether the command may modify the dataset
+func IsWriteCommand(cmdLine [][]byte) bool {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok || !validateArity(cmd.arity, cmdLine) {
+		return false
+	}
+	if exclusiveCommands[cmdName] {
+		return true
+	}
+	writeKeys, _ := cmd.prepare(cmdLine[1:])
+	return len(writeKeys) > 0
+}
+
+// replicationInfo generates the replication section of INFO
+func replicationInfo(database *StandaloneDatabase) string {
+	repl := database.repl
+	var w infoWriter
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	w.write("role", repl.role)
+	if repl.role == roleSlave {
+		w.write("master_host", repl.masterHost)
+		w.write("master_port", repl.masterPort)
+		linkStatus := "down"
+		if repl.linkState == linkConnected {
+			linkStatus = "up"
+		}
+		w.write("master_link_status", linkStatus)
+		lastIO := int64(-1)
+		if !repl.lastIO.IsZero() {
+			lastIO = int64(time.Since(repl.lastIO) / time.Second)
+		}
+		w.write("master_last_io_seconds_ago", lastIO)
+		w.write("master_sync_in_progress", boolToInt(repl.linkState == linkSync))
+		w.write("slave_read_repl_offset", repl.offset)
+		w.write("slave_repl_offset", repl.offset)
+		w.write("slave_priority", 100)
+		w.write("slave_read_only", boolToInt(config.Snapshot().ReplicaReadOnly))
+		w.write("replica_announced", 1)
+	}
+	w.write("connected_slaves", len(repl.replicas))
+	i := 0
+	for _, r := range repl.replicas {
+		ip, port, ackOffset, state, lag := r.status()
+		w.write(fmt.Sprintf("slave%d", i), fmt.Sprintf("ip=%s,port=%d,state=%s,offset=%d,lag=%d",
+			ip, port, state, ackOffset, lag))
+		i++
+	}
+	w.write("master_failover_state", "no-failover")
+	w.write("master_replid", repl.replID)
+	replID2 := repl.replID2
+	if replID2 == "" {
+		replID2 = strings.Repeat("0", 40)
+	}
+	w.write("master_replid2", replID2)
+	w.write("master_repl_offset", repl.offset)
+	w.write("second_repl_offset", repl.secondReplOffset)
+	if repl.backlog == nil {
+		w.write("repl_backlog_active", 0)
+		w.write("repl_backlog_size", config.Properties.ReplBacklogSize)
+		w.write("repl_backlog_first_byte_offset", 0)
+		w.write("repl_backlog_histlen", 0)
+	} else {
+		w.write("repl_backlog_active", 1)
+		w.write("repl_backlog_size", len(repl.backlog.buf))
+		w.write("repl_backlog_first_byte_offset", repl.backlog.firstOffset(repl.offset))
+		w.write("repl_backlog_histlen", repl.backlog.histLen)
+	}
+	return w.buf.String()
+}
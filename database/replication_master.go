@@ -0,0 +1,384 @@
+package database
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-redis/config"
+	"go-redis/interface/resp"
+	"go-redis/lib/logger"
+	"go-redis/resp/reply"
+)
+
+const (
+	// states of a replica seen by its master
+	replicaWaitBgSave = "wait_bgsave"
+	replicaSendBulk   = "send_bulk"
+	replicaOnline     = "online"
+
+	// replicaOutputLimit is the number of bytes of the stream buffered for a replica before it is dropped
+	replicaOutputLimit = 256 << 20
+
+	// rdbChunkSize is the size of the chunks the snapshot is sent to a replica in
+	rdbChunkSize = 64 << 10
+)
+
+// replica is a connection which replicates this server,
+// the stream is buffered while the snapshot is transferred and written by a goroutine of its own
+type replica struct {
+	conn resp.Connection
+	ip   string
+	port int // listening port announced by the replica
+
+	mu          sync.Mutex // guards the fields below
+	state       string
+	pending     [][]byte
+	pendingSize int
+	signal      chan struct{}
+	closed      bool
+	ackOffset   int64
+	ackTime     time.Time
+}
+
+func newReplica(c resp.Connection, port int) *replica {
+	ip := ""
+	if addr, ok := c.(interface{ RemoteAddr() net.Addr }); ok {
+		if tcpAddr, ok := addr.RemoteAddr().(*net.TCPAddr); ok {
+			ip = tcpAddr.IP.String()
+		}
+	}
+	return &replica{
+		conn:    c,
+		ip:      ip,
+		port:    port,
+		state:   replicaWaitBgSave,
+		signal:  make(chan struct{}, 1),
+		ackTime: time.Now(),
+	}
+}
+
+// send buffers data for the replica, returns false if the output limit is reached
+func (r *replica) send(data []byte) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return true
+	}
+	if r.pendingSize+len(data) > replicaOutputLimit {
+		return false
+	}
+	r.pending = append(r.pending, data)
+	r.pendingSize += len(data)
+	select {
+	case r.signal <- struct{}{}:
+	default:
+	}
+	return true
+}
+
+func (r *replica) setState(state string) {
+	r.mu.Lock()
+	r.state = state
+	r.mu.Unlock()
+}
+
+// status returns the fields reported by ROLE and INFO
+func (r *replica) status() (ip string, port int, ackOffset int64, state string, lag int64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ip, r.port, r.ackOffset, r.state, int64(time.Since(r.ackTime) / time.Second)
+}
+
+// startWriting goes online and writes the buffered stream until the replica is closed
+func (r *replica) startWriting() {
+	r.setState(replicaOnline)
+	go func() {
+		for range r.signal {
+			r.mu.Lock()
+			if r.closed {
+				r.mu.Unlock()
+				return
+			}
+			pending := r.pending
+			r.pending = nil
+			r.pendingSize = 0
+			r.mu.Unlock()
+
+			for _, data := range pending {
+				if err := r.conn.Write(data); err != nil {
+					r.close()
+					return
+				}
+			}
+		}
+	}()
+}
+
+// close stops writing and closes the connection, the handler then forgets the replica
+func (r *replica) close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	r.pending = nil
+	close(r.signal)
+	if closer, ok := r.conn.(interface{ Close() error }); ok {
+		// closing waits for the running write, never block the stream on it
+		go func() {
+			_ = closer.Close()
+		}()
+	}
+}
+
+// dropReplica disconnects the replica, the caller holds mu
+func (repl *replication) dropReplica(r *replica, reason string) {
+	if repl.replicas[r.conn] != r {
+		return
+	}
+	delete(repl.replicas, r.conn)
+	ip, port, _, _, _ := r.status()
+	logger.Info("dropping replica " + ip + ":" + strconv.Itoa(port) + ": " + reason)
+	r.close()
+}
+
+// dropReplicas disconnects all replicas, the caller holds mu
+func (repl *replication) dropReplicas(reason string) {
+	for _, r := range repl.replicas {
+		repl.dropReplica(r, reason)
+	}
+}
+
+// removeConn forgets the connection once it is closed
+func (repl *replication) removeConn(c resp.Connection) {
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	delete(repl.listeningPorts, c)
+	if r, ok := repl.replicas[c]; ok {
+		repl.dropReplica(r, "connection closed")
+	}
+}
+
+func init() {
+	registerServerCommand("PSync", execPSync, 3)
+	registerServerCommand("ReplConf", execReplConf, -3)
+}
+
+// execReplConf REPLCONF option value [option value ...]
+func execReplConf(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+	repl := database.repl
+	for i := 0; i < len(args); i += 2 {
+		option := strings.ToLower(string(args[i]))
+		value := string(args[i+1])
+		switch option {
+		case "listening-port":
+			port, err := strconv.Atoi(value)
+			if err != nil {
+				return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+			}
+			repl.mu.Lock()
+			repl.listeningPorts[c] = port
+			repl.mu.Unlock()
+		case "capa", "ip-address":
+		case "ack":
+			offset, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return reply.MakeNoReply()
+			}
+			repl.mu.Lock()
+			if r, ok := repl.replicas[c]; ok {
+				r.mu.Lock()
+				r.ackOffset = offset
+				r.ackTime = time.Now()
+				r.mu.Unlock()
+			}
+			repl.mu.Unlock()
+			// ACK is never replied
+			return reply.MakeNoReply()
+		case "getack":
+			// only the master asks for an ack, the replica answers it on the replication link
+			return reply.MakeNoReply()
+		default:
+			return reply.MakeStandardErrReply("ERR Unrecognized REPLCONF option: " + option)
+		}
+	}
+	return reply.MakeOKReply()
+}
+
+// execPSync PSYNC replicationid offset
+func execPSync(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	repl := database.repl
+	repl.mu.Lock()
+	_, isReplica := repl.replicas[c]
+	linkDown := repl.role == roleSlave && repl.linkState != linkConnected
+	repl.mu.Unlock()
+	if isReplica {
+		return reply.MakeNoReply()
+	}
+	if linkDown {
+		return reply.MakeStandardErrReply("NOMASTERLINK Can't SYNC while not connected with my master")
+	}
+	offset, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err == nil && database.tryPartialResync(c, string(args[0]), offset) {
+		return reply.MakeNoReply()
+	}
+	database.fullResync(c)
+	return reply.MakeNoReply()
+}
+
+// tryPartialResync continues the stream from offset if the backlog still holds it
+func (database *StandaloneDatabase) tryPartialResync(c resp.Connection, replID string, offset int64) bool {
+	repl := database.repl
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	if repl.backlog == nil {
+		return false
+	}
+	if replID != repl.replID && (replID != repl.replID2 || offset > repl.secondReplOffset) {
+		return false
+	}
+	if offset < repl.backlog.firstOffset(repl.offset) || offset > repl.offset+1 {
+		return false
+	}
+
+	r := newReplica(c, repl.listeningPorts[c])
+	r.send([]byte("+CONTINUE " + repl.replID + "\r\n"))
+	if data := repl.backlog.readFrom(offset, repl.offset); len(data) > 0 {
+		r.send(data)
+	}
+	repl.replicas[c] = r
+	r.startWriting()
+	logger.Info("partial resynchronization accepted, sending " +
+		strconv.FormatInt(repl.offset-offset+1, 10) + " bytes of backlog")
+	return true
+}
+
+// fullResync sends a snapshot to the replica then streams the commands written after the snapshot started
+func (database *StandaloneDatabase) fullResync(c resp.Connection) {
+	repl := database.repl
+	var r *replica
+	var replID string
+	var offset int64
+	s := database.startSnapshot(func(s *snapshot) {
+		repl.mu.Lock()
+		defer repl.mu.Unlock()
+		if repl.backlog == nil {
+			repl.backlog = newBacklog(config.Properties.ReplBacklogSize)
+		}
+		r = newReplica(c, repl.listeningPorts[c])
+		repl.replicas[c] = r
+		replID, offset = repl.replID, repl.offset
+		s.replID, s.replOffset = replID, offset
+		if repl.role == roleMaster {
+			// the next command selects its db, so the db of the replica does not matter
+			repl.streamDB = -1
+			s.streamDB = 0
+		} else {
+			// commands of the master are passed on, they keep using the db the master selected
+			s.streamDB = repl.masterConn.GetDBIndex()
+		}
+	})
+	logger.Info("full resynchronization requested, starting snapshot for replica")
+
+	err := c.Write([]byte("+FULLRESYNC " + replID + " " + strconv.FormatInt(offset, 10) + "\r\n"))
+	if err == nil {
+		r.setState(replicaSendBulk)
+		err = database.sendSnapshot(s, c)
+	} else {
+		database.stopSnapshot(s)
+	}
+	if err != nil {
+		logger.Error("full resynchronization failed: " + err.Error())
+		repl.mu.Lock()
+		repl.dropReplica(r, "full resynchronization failed")
+		repl.mu.Unlock()
+		return
+	}
+	logger.Info("snapshot transferred to replica")
+	r.startWriting()
+}
+
+// sendSnapshot writes the snapshot into a temporary file, then sends it as a bulk string
+func (database *StandaloneDatabase) sendSnapshot(s *snapshot, c resp.Connection) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(config.Properties.DBFilename), "temp-repl-*.rdb")
+	if err != nil {
+		database.stopSnapshot(s)
+		return err
+	}
+	defer func() {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+	}()
+	if err := database.writeSnapshot(s, tmpFile); err != nil {
+		return err
+	}
+	size, err := tmpFile.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := tmpFile.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := c.Write([]byte("$" + strconv.FormatInt(size, 10) + "\r\n")); err != nil {
+		return err
+	}
+	buf := make([]byte, rdbChunkSize)
+	for {
+		n, err := tmpFile.Read(buf)
+		if n > 0 {
+			if err := c.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// replicationCron pings replicas so they notice a dead master,
+// and drops replicas which did not acknowledge for a while
+func (database *StandaloneDatabase) replicationCron() {
+	ticker := time.NewTicker(replicationCronInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			database.repl.checkReplicas()
+		case <-database.closed:
+			return
+		}
+	}
+}
+
+func (repl *replication) checkReplicas() {
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	timeout := time.Duration(config.Snapshot().ReplTimeout) * time.Second
+	for _, r := range repl.replicas {
+		r.mu.Lock()
+		expired := r.state == replicaOnline && time.Since(r.ackTime) > timeout
+		r.mu.Unlock()
+		if expired {
+			repl.dropReplica(r, "timeout")
+		}
+	}
+	period := time.Duration(config.Snapshot().ReplPingReplicaPeriod) * time.Second
+	if repl.role == roleMaster && len(repl.replicas) > 0 && time.Since(repl.lastPing) >= period {
+		repl.lastPing = time.Now()
+		repl.feed(reply.MakeMultiBulkReply([][]byte{[]byte("PING")}).ToBytes())
+	}
+}
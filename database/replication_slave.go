@@ -0,0 +1,434 @@
+package database
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go-redis/config"
+	"go-redis/lib/logger"
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+	"go-redis/resp/parser"
+	"go-redis/resp/reply"
+)
+
+const (
+	// reconnectDelay is the delay before connecting to the master again after the link broke
+	reconnectDelay = time.Second
+
+	// ackInterval is the interval between two acks sent to the master
+	ackInterval = time.Second
+)
+
+var errLinkStopped = errors.New("replication stopped")
+
+// masterLink is the connection of a replica to its master
+type masterLink struct {
+	host string
+	port int
+
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{} // closed once the link goroutine returns
+
+	mu   sync.Mutex // guards conn
+	conn net.Conn
+
+	writeMu sync.Mutex // serializes writes to conn
+}
+
+func makeMasterLink(host string, port int) *masterLink {
+	return &masterLink{
+		host: host,
+		port: port,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// close stops the link and interrupts any blocking read
+func (link *masterLink) close() {
+	link.stopOnce.Do(func() {
+		close(link.stop)
+		link.mu.Lock()
+		if link.conn != nil {
+			_ = link.conn.Close()
+		}
+		link.mu.Unlock()
+	})
+}
+
+func (link *masterLink) stopped() bool {
+	select {
+	case <-link.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// setConn records the connection so close interrupts it, returns false if the link was stopped
+func (link *masterLink) setConn(conn net.Conn) bool {
+	link.mu.Lock()
+	defer link.mu.Unlock()
+	if link.stopped() {
+		return false
+	}
+	link.conn = conn
+	return true
+}
+
+func (link *masterLink) send(args ...string) error {
+	link.writeMu.Lock()
+	defer link.writeMu.Unlock()
+	_, err := link.conn.Write(reply.MakeMultiBulkReply(utils.ToCmdLine(args...)).ToBytes())
+	return err
+}
+
+// stopReplication disconnects from the master and waits for the link to stop
+func (database *StandaloneDatabase) stopReplication() {
+	repl := database.repl
+	repl.mu.Lock()
+	link := repl.link
+	repl.link = nil
+	repl.mu.Unlock()
+	if link != nil {
+		link.close()
+		<-link.done
+	}
+}
+
+func (repl *replication) setLinkState(state string) {
+	repl.mu.Lock()
+	repl.linkState = state
+	repl.mu.Unlock()
+}
+
+// runMasterLink keeps replicating the master until the link is stopped
+func (database *StandaloneDatabase) runMasterLink(link *masterLink) {
+	defer close(link.done)
+	addr := net.JoinHostPort(link.host, strconv.Itoa(link.port))
+	for {
+		logger.Info("connecting to master " + addr)
+		err := database.syncWithMaster(link, addr)
+		if link.stopped() {
+			return
+		}
+		logger.Error("replication link to " + addr + " broken: " + err.Error())
+		database.repl.setLinkState(linkConnect)
+		select {
+		case <-link.stop:
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// syncWithMaster does the handshake, resynchronizes and applies the stream until the connection breaks
+func (database *StandaloneDatabase) syncWithMaster(link *masterLink, addr string) error {
+	repl := database.repl
+	timeout := time.Duration(config.Snapshot().ReplTimeout) * time.Second
+	repl.setLinkState(linkConnecting)
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return err
+	}
+	if !link.setConn(conn) {
+		_ = conn.Close()
+		return errLinkStopped
+	}
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	command := func(args ...string) (string, error) {
+		if err := link.send(args...); err != nil {
+			return "", err
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		return readReplyLine(reader)
+	}
+
+	// handshake
+	line, err := command("PING")
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "-NOAUTH") {
+		return errors.New("error reply to PING from master: " + line)
+	}
+	if masterAuth := config.Snapshot().MasterAuth; masterAuth != "" {
+		line, err = command("AUTH", masterAuth)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(line, "-") {
+			return errors.New("unable to AUTH to master: " + line)
+		}
+	}
+	if _, err := command("REPLCONF", "listening-port", strconv.Itoa(config.Properties.Port)); err != nil {
+		return err
+	}
+	if _, err := command("REPLCONF", "capa", "psync2"); err != nil {
+		return err
+	}
+
+	repl.mu.Lock()
+	replID, offset := repl.replID, repl.offset
+	repl.mu.Unlock()
+	line, err = command("PSYNC", replID, strconv.FormatInt(offset+1, 10))
+	if err != nil {
+		return err
+	}
+	switch {
+	case strings.HasPrefix(line, "+FULLRESYNC"):
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return errors.New("bad FULLRESYNC reply: " + line)
+		}
+		masterOffset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return errors.New("bad FULLRESYNC reply: " + line)
+		}
+		logger.Info("full resync from master: " + fields[1] + ":" + fields[2])
+		repl.setLinkState(linkSync)
+		if err := database.receiveSnapshot(reader, conn, fields[1], masterOffset); err != nil {
+			return err
+		}
+	case strings.HasPrefix(line, "+CONTINUE"):
+		fields := strings.Fields(line)
+		repl.mu.Lock()
+		if len(fields) == 2 && fields[1] != repl.replID {
+			// the master was promoted, our own replicas follow the new id as well
+			repl.replID2 = repl.replID
+			repl.secondReplOffset = repl.offset + 1
+			repl.replID = fields[1]
+			repl.dropReplicas("master replication id changed")
+		}
+		repl.mu.Unlock()
+		logger.Info("partial resynchronization succeeded")
+	default:
+		return errors.New("unexpected reply to PSYNC from master: " + line)
+	}
+
+	repl.mu.Lock()
+	repl.linkState = linkConnected
+	repl.lastIO = time.Now()
+	if repl.masterConn == nil {
+		// continuing the stream of a former master of ours
+		repl.masterConn = &connection.Connection{}
+	}
+	masterConn := repl.masterConn
+	repl.mu.Unlock()
+	logger.Info("master <-> replica sync finished, streaming commands")
+
+	stopAck := make(chan struct{})
+	defer close(stopAck)
+	go database.sendAcks(link, stopAck)
+	return database.applyStream(link, reader, conn, masterConn, timeout)
+}
+
+// readReplyLine reads a single line reply, empty lines sent by the master to keep the connection alive are skipped
+func readReplyLine(reader *bufio.Reader) (string, error) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line != "" {
+			return line, nil
+		}
+	}
+}
+
+// receiveSnapshot reads the snapshot of the master into a temporary file, then replaces the dataset with it
+func (database *StandaloneDatabase) receiveSnapshot(reader *bufio.Reader, conn net.Conn, replID string, offset int64) error {
+	timeout := time.Duration(config.Snapshot().ReplTimeout) * time.Second
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	line, err := readReplyLine(reader)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(line, "$") {
+		return errors.New("bad snapshot header from master: " + line)
+	}
+	size, err := strconv.ParseInt(line[1:], 10, 64)
+	if err != nil || size < 0 {
+		return errors.New("bad snapshot header from master: " + line)
+	}
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(config.Properties.DBFilename), "temp-repl-*.rdb")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+	}()
+	// the deadline is extended per chunk, a large snapshot may take longer than timeout
+	for received := int64(0); received < size; {
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		n, err := io.CopyN(tmpFile, reader, minInt64(size-received, rdbChunkSize))
+		received += n
+		if err != nil {
+			return err
+		}
+	}
+	logger.Info(fmt.Sprintf("received %d bytes of snapshot from master", size))
+	return database.loadSnapshot(tmpFile.Name(), replID, offset)
+}
+
+func minInt64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// loadSnapshot replaces the dataset with the snapshot received from the master while no command runs
+func (database *StandaloneDatabase) loadSnapshot(filename string, replID string, offset int64) error {
+	repl := database.repl
+	atomic.StoreInt32(&database.loading, 1)
+	defer atomic.StoreInt32(&database.loading, 0)
+	repl.streamMu.Lock()
+	defer repl.streamMu.Unlock()
+	database.barrier.Lock()
+	defer database.barrier.Unlock()
+
+	for _, db := range database.dbSet {
+		db.Flush()
+		db.addAof(utils.ToCmdLine("flushdb"))
+	}
+	aux, err := database.loadRDB(filename, true)
+	if err != nil {
+		return err
+	}
+	masterConn := &connection.Connection{}
+	if streamDB, err := strconv.Atoi(aux["repl-stream-db"]); err == nil && streamDB >= 0 && streamDB < len(database.dbSet) {
+		masterConn.SelectDB(streamDB)
+	}
+
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	repl.replID = replID
+	repl.offset = offset
+	repl.replID2 = ""
+	repl.secondReplOffset = -1
+	repl.backlog = newBacklog(config.Properties.ReplBacklogSize)
+	repl.masterConn = masterConn
+	// our own replicas hold the former dataset, they have to resync
+	repl.dropReplicas("full resynchronization with master")
+	logger.Info("master snapshot loaded")
+	return nil
+}
+
+// sendAcks reports the offset applied to the master periodically
+func (database *StandaloneDatabase) sendAcks(link *masterLink, stop chan struct{}) {
+	ticker := time.NewTicker(ackInterval)
+	defer ticker.Stop()
+	for {
+		if err := database.sendAck(link); err != nil {
+			return
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (database *StandaloneDatabase) sendAck(link *masterLink) error {
+	database.repl.mu.Lock()
+	offset := database.repl.offset
+	database.repl.mu.Unlock()
+	return link.send("REPLCONF", "ACK", strconv.FormatInt(offset, 10))
+}
+
+// applyStream executes the commands of the master and passes them on to our own replicas
+func (database *StandaloneDatabase) applyStream(link *masterLink, reader *bufio.Reader, conn net.Conn,
+	masterConn *connection.Connection, timeout time.Duration) error {
+	repl := database.repl
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	ch := parser.ParseStream(reader)
+	defer func() {
+		// unblock the parser
+		_ = conn.Close()
+		for range ch {
+		}
+	}()
+	for payload := range ch {
+		if payload.Err != nil {
+			return payload.Err
+		}
+		_ = conn.SetReadDeadline(time.Now().Add(timeout))
+		cmd, ok := payload.Data.(*reply.MultiBulkReply)
+		if !ok || len(cmd.Args) == 0 {
+			continue
+		}
+		data := cmd.ToBytes()
+
+		repl.streamMu.Lock()
+		if strings.EqualFold(string(cmd.Args[0]), "replconf") && len(cmd.Args) > 1 &&
+			strings.EqualFold(string(cmd.Args[1]), "getack") {
+			if err := database.sendAck(link); err != nil {
+				repl.streamMu.Unlock()
+				return err
+			}
+		} else {
+			database.Exec(masterConn, cmd.Args)
+		}
+		repl.feedFromMaster(data)
+		repl.streamMu.Unlock()
+	}
+	return io.EOF
+}
+
+// feedFromMaster passes the stream of the master on unchanged, so offsets match along a chain of replicas
+func (repl *replication) feedFromMaster(data []byte) {
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	repl.lastIO = time.Now()
+	repl.feed(data)
+}
+
+// recordMaster saves the replication state of a replica into the snapshot,
+// so the replica continues the stream of its master with a partial resync after a restart
+func (repl *replication) recordMaster(s *snapshot) {
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	if repl.role != roleSlave || repl.masterConn == nil {
+		return
+	}
+	s.replID = repl.replID
+	s.replOffset = repl.offset
+	s.streamDB = repl.masterConn.GetDBIndex()
+}
+
+// restoreMaster restores the replication state saved by recordMaster
+func (repl *replication) restoreMaster(aux map[string]string) {
+	replID := aux["repl-id"]
+	offset, err := strconv.ParseInt(aux["repl-offset"], 10, 64)
+	if replID == "" || err != nil {
+		return
+	}
+	masterConn := &connection.Connection{}
+	if streamDB, err := strconv.Atoi(aux["repl-stream-db"]); err == nil && streamDB >= 0 && streamDB < config.Properties.Databases {
+		masterConn.SelectDB(streamDB)
+	}
+	repl.mu.Lock()
+	defer repl.mu.Unlock()
+	repl.replID = replID
+	repl.offset = offset
+	repl.masterConn = masterConn
+	logger.Info("replication id and offset restored from snapshot: " + replID + ":" + aux["repl-offset"])
+}
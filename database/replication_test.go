@@ -0,0 +1,45 @@
+package database
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestBacklog(t *testing.T) {
+	const size = 16
+	b := newBacklog(size)
+	var stream []byte
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		// chunks smaller than, equal to and larger than the buffer
+		chunk := make([]byte, r.Intn(2*size+1))
+		r.Read(chunk)
+		b.write(chunk)
+		stream = append(stream, chunk...)
+		masterOffset := int64(len(stream))
+
+		histLen := len(stream)
+		if histLen > size {
+			histLen = size
+		}
+		if b.histLen != histLen {
+			t.Fatalf("write %d: expected histLen %d, got %d", i, histLen, b.histLen)
+		}
+		first := b.firstOffset(masterOffset)
+		if first != masterOffset-int64(histLen)+1 {
+			t.Fatalf("write %d: unexpected first offset %d", i, first)
+		}
+		for offset := first; offset <= masterOffset+1; offset++ {
+			expected := stream[offset-1:]
+			if actual := b.readFrom(offset, masterOffset); !bytes.Equal(actual, expected) {
+				t.Fatalf("write %d: readFrom(%d) = %v, expected %v", i, offset, actual, expected)
+			}
+		}
+	}
+}
+
+func TestRoleOfMaster(t *testing.T) {
+	database := newMemoryDatabase(t)
+	assertReply(t, execCmd(database, "ROLE"), "*3\r\n$6\r\nmaster\r\n:0\r\n*0\r\n")
+}
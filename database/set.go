@@ -0,0 +1,426 @@
+package database
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"go-redis/datastruct/set"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/lib/wildcard"
+	"go-redis/resp/reply"
+)
+
+func init() {
+	RegisterCommand("sadd", execSAdd, writeFirstKey, -3)
+	RegisterCommand("srem", execSRem, writeFirstKey, -3)
+	RegisterCommand("sismember", execSIsMember, readFirstKey, 3)
+	RegisterCommand("smismember", execSMIsMember, readFirstKey, -3)
+	RegisterCommand("scard", execSCard, readFirstKey, 2)
+	RegisterCommand("smembers", execSMembers, readFirstKey, 2)
+	RegisterCommand("sinter", execSInter, readAllKeys, -2)
+	RegisterCommand("sunion", execSUnion, readAllKeys, -2)
+	RegisterCommand("sdiff", execSDiff, readAllKeys, -2)
+	RegisterCommand("sinterstore", execSInterStore, writeFirstReadOthers, -3)
+	RegisterCommand("sunionstore", execSUnionStore, writeFirstReadOthers, -3)
+	RegisterCommand("sdiffstore", execSDiffStore, writeFirstReadOthers, -3)
+	RegisterCommand("smove", execSMove, writeFirstTwoKeys, 4)
+	RegisterCommand("srandmember", execSRandMember, readFirstKey, -2)
+	RegisterCommand("spop", execSPop, writeFirstKey, -2)
+	RegisterCommand("sscan", execSScan, readFirstKey, -3)
+}
+
+// getAsSet returns the set stored at key, set is nil if the key does not exist
+func (db *DB) getAsSet(key string) (*set.Set, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	s, ok := entity.Data.(*set.Set)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	return s, nil
+}
+
+// getOrInitSet returns the set stored at key, creates an empty one if the key does not exist
+func (db *DB) getOrInitSet(key string) (s *set.Set, inited bool, errReply reply.ErrorReply) {
+	s, errReply = db.getAsSet(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	if s == nil {
+		s = set.Make()
+		db.PutEntity(key, &database.DataEntity{
+			Data: s,
+		})
+		inited = true
+	}
+	return s, inited, nil
+}
+
+// execSAdd SADD key member [member ...]
+func execSAdd(db *DB, args [][]byte) resp.Reply {
+	s, _, errReply := db.getOrInitSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+
+	added := 0
+	for _, member := range args[1:] {
+		added += s.Add(string(member))
+	}
+	db.addAof(utils.ToCmdLine2("sadd", args...))
+	return reply.MakeIntReply(int64(added))
+}
+
+// execSRem SREM key member [member ...]
+func execSRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	removed := 0
+	for _, member := range args[1:] {
+		removed += s.Remove(string(member))
+	}
+	if s.Len() == 0 {
+		db.Remove(key)
+	}
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine2("srem", args...))
+	}
+	return reply.MakeIntReply(int64(removed))
+}
+
+// execSIsMember SISMEMBER key member
+func execSIsMember(db *DB, args [][]byte) resp.Reply {
+	s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s != nil && s.Has(string(args[1])) {
+		return reply.MakeIntReply(1)
+	}
+	return reply.MakeIntReply(0)
+}
+
+// execSMIsMember SMISMEMBER key member [member ...]
+func execSMIsMember(db *DB, args [][]byte) resp.Reply {
+	s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+
+	result := make([]resp.Reply, len(args)-1)
+	for i, member := range args[1:] {
+		if s != nil && s.Has(string(member)) {
+			result[i] = reply.MakeIntReply(1)
+		} else {
+			result[i] = reply.MakeIntReply(0)
+		}
+	}
+	return reply.MakeMultiRawReply(result)
+}
+
+// execSCard SCARD key
+func execSCard(db *DB, args [][]byte) resp.Reply {
+	s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(int64(s.Len()))
+}
+
+// execSMembers SMEMBERS key
+func execSMembers(db *DB, args [][]byte) resp.Reply {
+	s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	return makeSetReply(s)
+}
+
+// makeSetReply replies all members of the set
+func makeSetReply(s *set.Set) resp.Reply {
+	members := make([][]byte, 0, s.Len())
+	s.ForEach(func(member string) bool {
+		members = append(members, []byte(member))
+		return true
+	})
+	return reply.MakeMultiBulkReply(members)
+}
+
+const (
+	setInter = iota
+	setUnion
+	setDiff
+)
+
+// computeSets computes the intersection, union or difference of the sets stored at keys,
+// a key which does not exist is treated as an empty set
+func computeSets(db *DB, keys [][]byte, op int) (*set.Set, reply.ErrorReply) {
+	var result *set.Set
+	for i, key := range keys {
+		s, errReply := db.getAsSet(string(key))
+		if errReply != nil {
+			return nil, errReply
+		}
+		if s == nil {
+			s = set.Make()
+		}
+		if i == 0 {
+			result = s.Union(set.Make()) // copy, so the stored set is never modified
+			continue
+		}
+		switch op {
+		case setInter:
+			result = result.Intersect(s)
+		case setUnion:
+			result = result.Union(s)
+		case setDiff:
+			result = result.Diff(s)
+		}
+	}
+	return result, nil
+}
+
+// execSInter SINTER key [key ...]
+func execSInter(db *DB, args [][]byte) resp.Reply {
+	return computeSetsReply(db, args, setInter)
+}
+
+// execSUnion SUNION key [key ...]
+func execSUnion(db *DB, args [][]byte) resp.Reply {
+	return computeSetsReply(db, args, setUnion)
+}
+
+// execSDiff SDIFF key [key ...]
+func execSDiff(db *DB, args [][]byte) resp.Reply {
+	return computeSetsReply(db, args, setDiff)
+}
+
+func computeSetsReply(db *DB, keys [][]byte, op int) resp.Reply {
+	result, errReply := computeSets(db, keys, op)
+	if errReply != nil {
+		return errReply
+	}
+	return makeSetReply(result)
+}
+
+// execSInterStore SINTERSTORE destination key [key ...]
+func execSInterStore(db *DB, args [][]byte) resp.Reply {
+	return storeSets(db, args, setInter, "sinterstore")
+}
+
+// execSUnionStore SUNIONSTORE destination key [key ...]
+func execSUnionStore(db *DB, args [][]byte) resp.Reply {
+	return storeSets(db, args, setUnion, "sunionstore")
+}
+
+// execSDiffStore SDIFFSTORE destination key [key ...]
+func execSDiffStore(db *DB, args [][]byte) resp.Reply {
+	return storeSets(db, args, setDiff, "sdiffstore")
+}
+
+// storeSets stores the result of computeSets at destination, an empty result removes destination
+func storeSets(db *DB, args [][]byte, op int, cmdName string) resp.Reply {
+	dest := string(args[0])
+	result, errReply := computeSets(db, args[1:], op)
+	if errReply != nil {
+		return errReply
+	}
+
+	db.Remove(dest)
+	if result.Len() > 0 {
+		db.PutEntity(dest, &database.DataEntity{
+			Data: result,
+		})
+	}
+	db.addAof(utils.ToCmdLine2(cmdName, args...))
+	return reply.MakeIntReply(int64(result.Len()))
+}
+
+// execSMove SMOVE source destination member
+func execSMove(db *DB, args [][]byte) resp.Reply {
+	src := string(args[0])
+	dst := string(args[1])
+	member := string(args[2])
+	srcSet, errReply := db.getAsSet(src)
+	if errReply != nil {
+		return errReply
+	}
+	dstSet, errReply := db.getAsSet(dst)
+	if errReply != nil {
+		return errReply
+	}
+	if srcSet == nil || !srcSet.Has(member) {
+		return reply.MakeIntReply(0)
+	}
+	if src == dst {
+		return reply.MakeIntReply(1)
+	}
+
+	srcSet.Remove(member)
+	if srcSet.Len() == 0 {
+		db.Remove(src)
+	}
+	if dstSet == nil {
+		dstSet, _, _ = db.getOrInitSet(dst)
+	}
+	dstSet.Add(member)
+	db.addAof(utils.ToCmdLine2("smove", args...))
+	return reply.MakeIntReply(1)
+}
+
+// execSRandMember SRANDMEMBER key [count]
+func execSRandMember(db *DB, args [][]byte) resp.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+
+	if len(args) == 1 {
+		if s == nil {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply([]byte(s.RandomMembers(1)[0]))
+	}
+
+	count, errReply := parseRandomCount(args[1])
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil || count == 0 {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+
+	// a positive count returns distinct members, a negative count allows repeated members
+	var members []string
+	if count > 0 {
+		members = s.RandomDistinctMembers(int(count))
+	} else {
+		members = s.RandomMembers(int(-count))
+	}
+	result := make([][]byte, len(members))
+	for i, member := range members {
+		result[i] = []byte(member)
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execSPop SPOP key [count]
+func execSPop(db *DB, args [][]byte) resp.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	key := string(args[0])
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(string(args[1]))
+		if err != nil || n < 0 {
+			return reply.MakeStandardErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	s, errReply := db.getAsSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		if len(args) == 2 {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+
+	members := s.RandomDistinctMembers(count)
+	removed := make([][]byte, len(members))
+	for i, member := range members {
+		s.Remove(member)
+		removed[i] = []byte(member)
+	}
+	if s.Len() == 0 {
+		db.Remove(key)
+	}
+	if len(removed) > 0 {
+		// writes the popped members, so replaying does not pop other members at random
+		db.addAof(utils.ToCmdLine2("srem", append([][]byte{args[0]}, removed...)...))
+	}
+
+	if len(args) == 2 {
+		return reply.MakeMultiBulkReply(removed)
+	}
+	return reply.MakeBulkReply(removed[0])
+}
+
+// execSScan SSCAN key cursor [MATCH pattern] [COUNT count]
+// the cursor is an offset into the sorted members, so it stays valid while the set is unchanged
+func execSScan(db *DB, args [][]byte) resp.Reply {
+	cursor, err := strconv.Atoi(string(args[1]))
+	if err != nil || cursor < 0 {
+		return reply.MakeStandardErrReply("ERR invalid cursor")
+	}
+	var pattern *wildcard.Pattern
+	count := defaultScanCount
+	for i := 2; i < len(args); i += 2 {
+		if i+1 >= len(args) {
+			return reply.MakeSyntaxErrReply()
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			pattern = wildcard.CompilePattern(string(args[i+1]))
+		case "COUNT":
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return reply.MakeSyntaxErrReply()
+			}
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	s, errReply := db.getAsSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if s == nil {
+		return makeScanReply(0, nil)
+	}
+
+	members := s.ToSlice()
+	sort.Strings(members)
+	end := cursor + count
+	next := end
+	if end >= len(members) {
+		end = len(members)
+		next = 0
+	}
+	result := make([][]byte, 0)
+	for i := cursor; i < end; i++ {
+		if pattern == nil || pattern.IsMatch(members[i]) {
+			result = append(result, []byte(members[i]))
+		}
+	}
+	return makeScanReply(next, result)
+}
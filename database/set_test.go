@@ -0,0 +1,84 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestSetMembers(t *testing.T) {
+	database := newMemoryDatabase(t)
+	assertReply(t, execCmd(database, "SADD", "s", "3", "1", "2", "1"), ":3\r\n")
+	// an intset keeps its members ordered
+	assertReply(t, execCmd(database, "SMEMBERS", "s"), multiBulk("1", "2", "3"))
+	assertReply(t, execCmd(database, "SISMEMBER", "s", "2"), ":1\r\n")
+	assertReply(t, execCmd(database, "SMISMEMBER", "s", "2", "02", "4"), "*3\r\n:1\r\n:0\r\n:0\r\n")
+	assertReply(t, execCmd(database, "SREM", "s", "2", "4"), ":1\r\n")
+	assertReply(t, execCmd(database, "SCARD", "s"), ":2\r\n")
+	assertReply(t, execCmd(database, "SMOVE", "s", "t", "1"), ":1\r\n")
+	assertReply(t, execCmd(database, "SMOVE", "s", "t", "1"), ":0\r\n")
+	assertReply(t, execCmd(database, "SMEMBERS", "t"), multiBulk("1"))
+
+	// the key is removed with its last member
+	assertReply(t, execCmd(database, "SREM", "s", "3"), ":1\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "s"), ":0\r\n")
+	assertReply(t, execCmd(database, "SMEMBERS", "s"), "*0\r\n")
+}
+
+func TestSetAlgebra(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "SADD", "a", "1", "2", "3", "4")
+	execCmd(database, "SADD", "b", "3", "4", "5")
+	execCmd(database, "SADD", "c", "4")
+	assertReply(t, execCmd(database, "SINTER", "a", "b", "c"), multiBulk("4"))
+	assertReply(t, execCmd(database, "SINTER", "a", "none"), "*0\r\n")
+	assertReply(t, execCmd(database, "SDIFF", "a", "b"), multiBulk("1", "2"))
+	assertReply(t, execCmd(database, "SUNIONSTORE", "u", "a", "b"), ":5\r\n")
+	assertReply(t, execCmd(database, "SMEMBERS", "u"), multiBulk("1", "2", "3", "4", "5"))
+	assertReply(t, execCmd(database, "SDIFFSTORE", "d", "b", "a"), ":1\r\n")
+	assertReply(t, execCmd(database, "SMEMBERS", "d"), multiBulk("5"))
+
+	// storing an empty result removes the destination
+	assertReply(t, execCmd(database, "SINTERSTORE", "d", "a", "none"), ":0\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "d"), ":0\r\n")
+
+	execCmd(database, "SET", "str", "v")
+	assertReply(t, execCmd(database, "SUNION", "a", "str"), "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+}
+
+func TestSetRandom(t *testing.T) {
+	database := newMemoryDatabase(t)
+	assertReply(t, execCmd(database, "SRANDMEMBER", "s"), "$-1\r\n")
+	assertReply(t, execCmd(database, "SPOP", "s"), "$-1\r\n")
+	execCmd(database, "SADD", "s", "1", "2", "3")
+	if reply := execCmd(database, "SRANDMEMBER", "s", "5"); reply[:4] != "*3\r\n" {
+		t.Errorf("expected each member once, got %q", reply)
+	}
+	if reply := execCmd(database, "SRANDMEMBER", "s", "-5"); reply[:4] != "*5\r\n" {
+		t.Errorf("expected 5 members, got %q", reply)
+	}
+	// huge negative counts are refused before allocating the reply, the lowest one can not be negated
+	for _, count := range []string{"-100000000000", "-9223372036854775808"} {
+		assertReply(t, execCmd(database, "SRANDMEMBER", "s", count), "-ERR value is out of range\r\n")
+	}
+	if reply := execCmd(database, "SPOP", "s", "2"); reply[:4] != "*2\r\n" {
+		t.Errorf("expected 2 members, got %q", reply)
+	}
+	assertReply(t, execCmd(database, "SCARD", "s"), ":1\r\n")
+	assertReply(t, execCmd(database, "SPOP", "s", "-1"), "-ERR value is out of range, must be positive\r\n")
+}
+
+func TestSetPopAof(t *testing.T) {
+	useTestConfig(t).AppendOnly = true
+	database := newTestDatabase(t)
+	execCmd(database, "SADD", "s", "a", "b", "c", "d")
+	popped := execCmd(database, "SPOP", "s")
+	members := execCmd(database, "SMEMBERS", "s")
+	_ = database.Close()
+
+	// replaying removes the members popped, not other members at random
+	database = newTestDatabase(t)
+	assertReply(t, execCmd(database, "SCARD", "s"), ":3\r\n")
+	assertReply(t, execCmd(database, "SISMEMBER", "s", popped[4:5]), ":0\r\n")
+	if reply := execCmd(database, "SMEMBERS", "s"); len(reply) != len(members) {
+		t.Errorf("expected members %q, got %q", members, reply)
+	}
+}
@@ -0,0 +1,184 @@
+package database
+
+import (
+	"io"
+	"strconv"
+	"sync"
+
+	"go-redis/rdb"
+)
+
+// exclusiveCommands touch every key of a db, they run while no other command runs,
+// so a running snapshot can copy all keys safely
+var exclusiveCommands = map[string]bool{
+	"flushdb": true,
+}
+
+// snapshot records the dataset as it was when the snapshot started while clients keep writing.
+// Before a key is written for the first time during the snapshot its value is copied,
+// and the copy is saved instead of the newer value, like the copy on write of a forked process per key.
+type snapshot struct {
+	mu        sync.Mutex
+	visited   []map[string]struct{} // per db, keys saved or copied already
+	preserved [][]*rdb.Object       // per db, copies of keys written before they were saved
+	finished  bool
+
+	// replication state the snapshot matches, written as auxiliary fields
+	replID     string
+	replOffset int64
+	streamDB   int // db selected in the replication stream
+}
+
+func newSnapshot(dbCount int) *snapshot {
+	s := &snapshot{
+		visited:   make([]map[string]struct{}, dbCount),
+		preserved: make([][]*rdb.Object, dbCount),
+	}
+	for i := range s.visited {
+		s.visited[i] = make(map[string]struct{})
+	}
+	return s
+}
+
+// markVisited returns true if the key is neither saved nor copied yet
+func (s *snapshot) markVisited(dbIndex int, key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return false
+	}
+	if _, ok := s.visited[dbIndex][key]; ok {
+		return false
+	}
+	s.visited[dbIndex][key] = struct{}{}
+	return true
+}
+
+// preserve copies the key before it is written, the caller holds the write lock of the key.
+// A key created after the snapshot started is marked only, so it is never saved.
+func (s *snapshot) preserve(db *DB, key string) {
+	if !s.markVisited(db.index, key) {
+		return
+	}
+	if o := db.dumpObject(key); o != nil {
+		s.mu.Lock()
+		s.preserved[db.index] = append(s.preserved[db.index], o)
+		s.mu.Unlock()
+	}
+}
+
+// visit returns the key to save, nil if it is copied already or does not exist
+func (s *snapshot) visit(db *DB, key string) *rdb.Object {
+	db.locker.RLock(key)
+	defer db.locker.RUnLock(key)
+	if !s.markVisited(db.index, key) {
+		return nil
+	}
+	return db.dumpObject(key)
+}
+
+func (s *snapshot) takePreserved(dbIndex int) []*rdb.Object {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	objects := s.preserved[dbIndex]
+	s.preserved[dbIndex] = nil
+	return objects
+}
+
+// beforeWrite lets the running snapshot copy the keys before they are modified,
+// the caller holds the barrier and the write locks of the keys
+func (db *DB) beforeWrite(keys ...string) {
+	if db.snapshot == nil {
+		return
+	}
+	for _, key := range keys {
+		db.snapshot.preserve(db, key)
+	}
+}
+
+// startSnapshot starts copy on write of all dbs, only one snapshot runs at a time.
+// onStart is called while no command runs, e.g. to record the replication offset.
+func (database *StandaloneDatabase) startSnapshot(onStart func(s *snapshot)) *snapshot {
+	database.snapshotMu.Lock() // released by stopSnapshot
+	database.repl.streamMu.Lock()
+	defer database.repl.streamMu.Unlock()
+	database.barrier.Lock()
+	defer database.barrier.Unlock()
+
+	s := newSnapshot(len(database.dbSet))
+	if onStart != nil {
+		onStart(s)
+	}
+	for _, db := range database.dbSet {
+		db.snapshot = s
+	}
+	return s
+}
+
+func (database *StandaloneDatabase) stopSnapshot(s *snapshot) {
+	database.barrier.Lock()
+	for _, db := range database.dbSet {
+		db.snapshot = nil
+	}
+	database.barrier.Unlock()
+
+	s.mu.Lock()
+	s.finished = true
+	s.visited = nil
+	s.preserved = nil
+	s.mu.Unlock()
+	database.snapshotMu.Unlock()
+}
+
+// writeSnapshot encodes the snapshot and stops it
+func (database *StandaloneDatabase) writeSnapshot(s *snapshot, w io.Writer) error {
+	defer database.stopSnapshot(s)
+
+	encoder := rdb.NewEncoder(w)
+	if err := encoder.WriteHeader(); err != nil {
+		return err
+	}
+	if s.replID != "" {
+		aux := [][2]string{
+			{"repl-stream-db", strconv.Itoa(s.streamDB)},
+			{"repl-id", s.replID},
+			{"repl-offset", strconv.FormatInt(s.replOffset, 10)},
+		}
+		for _, field := range aux {
+			if err := encoder.WriteAux(field[0], field[1]); err != nil {
+				return err
+			}
+		}
+	}
+	for _, db := range database.dbSet {
+		headerWritten := false
+		write := func(o *rdb.Object) error {
+			if !headerWritten {
+				headerWritten = true
+				err := encoder.WriteDBHeader(db.index, uint64(db.data.Len()), uint64(db.ttlMap.Len()))
+				if err != nil {
+					return err
+				}
+			}
+			return encoder.WriteObject(o)
+		}
+
+		var err error
+		db.data.Foreach(func(key string, _ interface{}) bool {
+			if o := s.visit(db, key); o != nil {
+				err = write(o)
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+		// every key existing when the snapshot started is visited or copied by now
+		for _, o := range s.takePreserved(db.index) {
+			if err := write(o); err != nil {
+				return err
+			}
+		}
+	}
+	return encoder.WriteEnd()
+}
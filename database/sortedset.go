@@ -0,0 +1,976 @@
+package database
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"go-redis/datastruct/set"
+	"go-redis/datastruct/sortedset"
+	"go-redis/interface/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/lib/wildcard"
+	"go-redis/resp/reply"
+)
+
+func init() {
+	RegisterCommand("zadd", execZAdd, writeFirstKey, -4)
+	RegisterCommand("zincrby", execZIncrBy, writeFirstKey, 4)
+	RegisterCommand("zscore", execZScore, readFirstKey, 3)
+	RegisterCommand("zmscore", execZMScore, readFirstKey, -3)
+	RegisterCommand("zcard", execZCard, readFirstKey, 2)
+	RegisterCommand("zcount", execZCount, readFirstKey, 4)
+	RegisterCommand("zlexcount", execZLexCount, readFirstKey, 4)
+	RegisterCommand("zrank", execZRank, readFirstKey, -3)
+	RegisterCommand("zrevrank", execZRevRank, readFirstKey, -3)
+	RegisterCommand("zrange", execZRange, readFirstKey, -4)
+	RegisterCommand("zrevrange", execZRevRange, readFirstKey, -4)
+	RegisterCommand("zrangebyscore", execZRangeByScore, readFirstKey, -4)
+	RegisterCommand("zrevrangebyscore", execZRevRangeByScore, readFirstKey, -4)
+	RegisterCommand("zrangebylex", execZRangeByLex, readFirstKey, -4)
+	RegisterCommand("zrevrangebylex", execZRevRangeByLex, readFirstKey, -4)
+	RegisterCommand("zrem", execZRem, writeFirstKey, -3)
+	RegisterCommand("zremrangebyrank", execZRemRangeByRank, writeFirstKey, 4)
+	RegisterCommand("zremrangebyscore", execZRemRangeByScore, writeFirstKey, 4)
+	RegisterCommand("zremrangebylex", execZRemRangeByLex, writeFirstKey, 4)
+	RegisterCommand("zpopmin", execZPopMin, writeFirstKey, -2)
+	RegisterCommand("zpopmax", execZPopMax, writeFirstKey, -2)
+	RegisterCommand("zunionstore", execZUnionStore, prepareZStore, -4)
+	RegisterCommand("zinterstore", execZInterStore, prepareZStore, -4)
+	RegisterCommand("zunion", execZUnion, prepareZCombine, -3)
+	RegisterCommand("zinter", execZInter, prepareZCombine, -3)
+	RegisterCommand("zscan", execZScan, readFirstKey, -3)
+}
+
+// getAsSortedSet returns the sorted set stored at key, sortedSet is nil if the key does not exist
+func (db *DB) getAsSortedSet(key string) (*sortedset.SortedSet, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	sortedSet, ok := entity.Data.(*sortedset.SortedSet)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	return sortedSet, nil
+}
+
+// getOrInitSortedSet returns the sorted set stored at key, creates an empty one if the key does not exist
+func (db *DB) getOrInitSortedSet(key string) (sortedSet *sortedset.SortedSet, inited bool, errReply reply.ErrorReply) {
+	sortedSet, errReply = db.getAsSortedSet(key)
+	if errReply != nil {
+		return nil, false, errReply
+	}
+	if sortedSet == nil {
+		sortedSet = sortedset.Make()
+		db.PutEntity(key, &database.DataEntity{
+			Data: sortedSet,
+		})
+		inited = true
+	}
+	return sortedSet, inited, nil
+}
+
+// removeIfEmptySortedSet removes key if the sorted set stored at it has no member left
+func (db *DB) removeIfEmptySortedSet(key string, sortedSet *sortedset.SortedSet) {
+	if sortedSet.Len() == 0 {
+		db.Remove(key)
+	}
+}
+
+// parseScore parses a score argument, "inf", "+inf" and "-inf" are accepted while NaN is not
+func parseScore(arg []byte) (float64, bool) {
+	score, err := strconv.ParseFloat(string(arg), 64)
+	if err != nil || math.IsNaN(score) {
+		return 0, false
+	}
+	return score, true
+}
+
+// formatScore formats score the way redis does: integral scores have no decimal point
+func formatScore(score float64) []byte {
+	if math.IsInf(score, 1) {
+		return []byte("inf")
+	}
+	if math.IsInf(score, -1) {
+		return []byte("-inf")
+	}
+	if score == math.Trunc(score) && math.Abs(score) < 1e17 {
+		return []byte(strconv.FormatFloat(score, 'f', -1, 64))
+	}
+	return []byte(strconv.FormatFloat(score, 'g', -1, 64))
+}
+
+func makeInvalidFloatErrReply() reply.ErrorReply {
+	return reply.MakeStandardErrReply("ERR value is not a valid float")
+}
+
+// execZAdd ZADD key [NX|XX] [GT|LT] [CH] [INCR] score member [score member ...]
+func execZAdd(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	nx, xx, gt, lt, ch, incr := false, false, false, false, false, false
+	i := 1
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		if option == "NX" {
+			nx = true
+		} else if option == "XX" {
+			xx = true
+		} else if option == "GT" {
+			gt = true
+		} else if option == "LT" {
+			lt = true
+		} else if option == "CH" {
+			ch = true
+		} else if option == "INCR" {
+			incr = true
+		} else {
+			break
+		}
+	}
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+	if nx && xx {
+		return reply.MakeStandardErrReply("ERR XX and NX options at the same time are not compatible")
+	}
+	if (gt && lt) || (gt && nx) || (lt && nx) {
+		return reply.MakeStandardErrReply("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if incr && len(pairs) > 2 {
+		return reply.MakeStandardErrReply("ERR INCR option supports a single increment-element pair")
+	}
+
+	// validate all scores before modifying anything
+	elements := make([]*sortedset.Element, len(pairs)/2)
+	for j := range elements {
+		score, ok := parseScore(pairs[2*j])
+		if !ok {
+			return makeInvalidFloatErrReply()
+		}
+		elements[j] = &sortedset.Element{
+			Member: string(pairs[2*j+1]),
+			Score:  score,
+		}
+	}
+
+	sortedSet, _, errReply := db.getOrInitSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+
+	added, changed := 0, 0
+	aofArgs := [][]byte{args[0]}
+	var incrResult []byte
+	for _, element := range elements {
+		score := element.Score
+		current, exists := sortedSet.Get(element.Member)
+		if (nx && exists) || (xx && !exists) {
+			continue
+		}
+		if incr && exists {
+			score += current.Score
+			if math.IsNaN(score) {
+				db.removeIfEmptySortedSet(key, sortedSet)
+				return reply.MakeStandardErrReply("ERR resulting score is not a number (NaN)")
+			}
+		}
+		if exists && ((gt && score <= current.Score) || (lt && score >= current.Score)) {
+			continue
+		}
+		if exists && score == current.Score {
+			incrResult = formatScore(score)
+			continue
+		}
+		if sortedSet.Add(element.Member, score) {
+			added++
+		} else {
+			changed++
+		}
+		incrResult = formatScore(score)
+		aofArgs = append(aofArgs, formatScore(score), []byte(element.Member))
+	}
+	db.removeIfEmptySortedSet(key, sortedSet)
+	if len(aofArgs) > 1 {
+		db.addAof(utils.ToCmdLine2("zadd", aofArgs...))
+	}
+
+	if incr {
+		if incrResult == nil {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply(incrResult)
+	}
+	if ch {
+		return reply.MakeIntReply(int64(added + changed))
+	}
+	return reply.MakeIntReply(int64(added))
+}
+
+// execZIncrBy ZINCRBY key increment member
+func execZIncrBy(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	member := string(args[2])
+	delta, ok := parseScore(args[1])
+	if !ok {
+		return makeInvalidFloatErrReply()
+	}
+
+	sortedSet, _, errReply := db.getOrInitSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	score := delta
+	if element, exists := sortedSet.Get(member); exists {
+		score += element.Score
+	}
+	if math.IsNaN(score) {
+		db.removeIfEmptySortedSet(key, sortedSet)
+		return reply.MakeStandardErrReply("ERR resulting score is not a number (NaN)")
+	}
+	sortedSet.Add(member, score)
+	// log the result instead of the increment, so replaying is idempotent
+	db.addAof(utils.ToCmdLine2("zadd", args[0], formatScore(score), args[2]))
+	return reply.MakeBulkReply(formatScore(score))
+}
+
+// execZScore ZSCORE key member
+func execZScore(db *DB, args [][]byte) resp.Reply {
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeNullBulkReply()
+	}
+	element, exists := sortedSet.Get(string(args[1]))
+	if !exists {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeBulkReply(formatScore(element.Score))
+}
+
+// execZMScore ZMSCORE key member [member ...]
+func execZMScore(db *DB, args [][]byte) resp.Reply {
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	result := make([][]byte, len(args)-1)
+	if sortedSet == nil {
+		return reply.MakeMultiBulkReply(result)
+	}
+	for i, member := range args[1:] {
+		if element, exists := sortedSet.Get(string(member)); exists {
+			result[i] = formatScore(element.Score)
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execZCard ZCARD key
+func execZCard(db *DB, args [][]byte) resp.Reply {
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(sortedSet.Len())
+}
+
+// execZCount ZCOUNT key min max
+func execZCount(db *DB, args [][]byte) resp.Reply {
+	return countInRange(db, args, sortedset.ParseScoreBorder)
+}
+
+// execZLexCount ZLEXCOUNT key min max
+func execZLexCount(db *DB, args [][]byte) resp.Reply {
+	return countInRange(db, args, sortedset.ParseLexBorder)
+}
+
+func countInRange(db *DB, args [][]byte, parseBorder func(string) (sortedset.Border, error)) resp.Reply {
+	min, err := parseBorder(string(args[1]))
+	if err != nil {
+		return reply.MakeStandardErrReply(err.Error())
+	}
+	max, err := parseBorder(string(args[2]))
+	if err != nil {
+		return reply.MakeStandardErrReply(err.Error())
+	}
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+	return reply.MakeIntReply(sortedSet.RangeCount(min, max))
+}
+
+// execZRank ZRANK key member [WITHSCORE]
+func execZRank(db *DB, args [][]byte) resp.Reply {
+	return getRank(db, args, false)
+}
+
+// execZRevRank ZREVRANK key member [WITHSCORE]
+func execZRevRank(db *DB, args [][]byte) resp.Reply {
+	return getRank(db, args, true)
+}
+
+func getRank(db *DB, args [][]byte, desc bool) resp.Reply {
+	withScore := false
+	if len(args) == 3 && strings.ToUpper(string(args[2])) == "WITHSCORE" {
+		withScore = true
+	} else if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	var element *sortedset.Element
+	exists := false
+	if sortedSet != nil {
+		element, exists = sortedSet.Get(string(args[1]))
+	}
+	if !exists {
+		if withScore {
+			return reply.MakeNullMultiBulkReply()
+		}
+		return reply.MakeNullBulkReply()
+	}
+
+	rank := sortedSet.GetRank(element.Member, desc)
+	if withScore {
+		return reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeIntReply(rank),
+			reply.MakeBulkReply(formatScore(element.Score)),
+		})
+	}
+	return reply.MakeIntReply(rank)
+}
+
+// rangeSpec describes a ZRANGE query, by rank unless byScore or byLex is set
+type rangeSpec struct {
+	byScore    bool
+	byLex      bool
+	rev        bool
+	withScores bool
+	hasLimit   bool
+	offset     int64
+	count      int64
+}
+
+// parseLimit parses the offset and count of LIMIT option at args[i+1] and args[i+2]
+func (spec *rangeSpec) parseLimit(args [][]byte, i int) reply.ErrorReply {
+	if i+2 >= len(args) {
+		return reply.MakeSyntaxErrReply()
+	}
+	offset, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	count, err := strconv.ParseInt(string(args[i+2]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	spec.hasLimit = true
+	spec.offset = offset
+	spec.count = count
+	return nil
+}
+
+// execZRange ZRANGE key start stop [BYSCORE|BYLEX] [REV] [LIMIT offset count] [WITHSCORES]
+func execZRange(db *DB, args [][]byte) resp.Reply {
+	spec := &rangeSpec{}
+	for i := 3; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch option {
+		case "BYSCORE":
+			spec.byScore = true
+		case "BYLEX":
+			spec.byLex = true
+		case "REV":
+			spec.rev = true
+		case "WITHSCORES":
+			spec.withScores = true
+		case "LIMIT":
+			if errReply := spec.parseLimit(args, i); errReply != nil {
+				return errReply
+			}
+			i += 2
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	if spec.byScore && spec.byLex {
+		return reply.MakeSyntaxErrReply()
+	}
+	if spec.hasLimit && !spec.byScore && !spec.byLex {
+		return reply.MakeStandardErrReply("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.withScores && spec.byLex {
+		return reply.MakeStandardErrReply("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return rangeSortedSet(db, args[0], args[1], args[2], spec)
+}
+
+// execZRevRange ZREVRANGE key start stop [WITHSCORES]
+func execZRevRange(db *DB, args [][]byte) resp.Reply {
+	spec := &rangeSpec{rev: true}
+	if len(args) == 4 && strings.ToUpper(string(args[3])) == "WITHSCORES" {
+		spec.withScores = true
+	} else if len(args) > 3 {
+		return reply.MakeSyntaxErrReply()
+	}
+	return rangeSortedSet(db, args[0], args[1], args[2], spec)
+}
+
+// execZRangeByScore ZRANGEBYSCORE key min max [WITHSCORES] [LIMIT offset count]
+func execZRangeByScore(db *DB, args [][]byte) resp.Reply {
+	return rangeByBorder(db, args, &rangeSpec{byScore: true})
+}
+
+// execZRevRangeByScore ZREVRANGEBYSCORE key max min [WITHSCORES] [LIMIT offset count]
+func execZRevRangeByScore(db *DB, args [][]byte) resp.Reply {
+	return rangeByBorder(db, args, &rangeSpec{byScore: true, rev: true})
+}
+
+// execZRangeByLex ZRANGEBYLEX key min max [LIMIT offset count]
+func execZRangeByLex(db *DB, args [][]byte) resp.Reply {
+	return rangeByBorder(db, args, &rangeSpec{byLex: true})
+}
+
+// execZRevRangeByLex ZREVRANGEBYLEX key max min [LIMIT offset count]
+func execZRevRangeByLex(db *DB, args [][]byte) resp.Reply {
+	return rangeByBorder(db, args, &rangeSpec{byLex: true, rev: true})
+}
+
+// rangeByBorder parses options of the legacy ZRANGEBYSCORE and ZRANGEBYLEX family
+func rangeByBorder(db *DB, args [][]byte, spec *rangeSpec) resp.Reply {
+	for i := 3; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "WITHSCORES" && spec.byScore:
+			spec.withScores = true
+		case option == "LIMIT":
+			if errReply := spec.parseLimit(args, i); errReply != nil {
+				return errReply
+			}
+			i += 2
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+	return rangeSortedSet(db, args[0], args[1], args[2], spec)
+}
+
+// rangeSortedSet replies the members within [start, stop] described by spec,
+// start and stop are swapped by the caller for REV queries by score or lex as redis does
+func rangeSortedSet(db *DB, key []byte, start []byte, stop []byte, spec *rangeSpec) resp.Reply {
+	if !spec.byScore && !spec.byLex {
+		startRank, err := strconv.ParseInt(string(start), 10, 64)
+		if err != nil {
+			return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+		}
+		stopRank, err := strconv.ParseInt(string(stop), 10, 64)
+		if err != nil {
+			return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+		}
+		sortedSet, errReply := db.getAsSortedSet(string(key))
+		if errReply != nil {
+			return errReply
+		}
+		if sortedSet == nil {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+		from, to, ok := normalizeRange(int(startRank), int(stopRank), int(sortedSet.Len()))
+		if !ok {
+			return reply.MakeEmptyMultiBulkReply()
+		}
+		return makeElementsReply(sortedSet.RangeByRank(int64(from), int64(to), spec.rev), spec.withScores)
+	}
+
+	parseBorder := sortedset.ParseScoreBorder
+	if spec.byLex {
+		parseBorder = sortedset.ParseLexBorder
+	}
+	// REV queries take max before min
+	minArg, maxArg := start, stop
+	if spec.rev {
+		minArg, maxArg = stop, start
+	}
+	min, err := parseBorder(string(minArg))
+	if err != nil {
+		return reply.MakeStandardErrReply(err.Error())
+	}
+	max, err := parseBorder(string(maxArg))
+	if err != nil {
+		return reply.MakeStandardErrReply(err.Error())
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(string(key))
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	limit := int64(-1)
+	var offset int64
+	if spec.hasLimit {
+		offset, limit = spec.offset, spec.count
+	}
+	return makeElementsReply(sortedSet.Range(min, max, offset, limit, spec.rev), spec.withScores)
+}
+
+// makeElementsReply replies members, followed by their scores if withScores is set
+func makeElementsReply(elements []*sortedset.Element, withScores bool) resp.Reply {
+	size := len(elements)
+	if withScores {
+		size *= 2
+	}
+	result := make([][]byte, 0, size)
+	for _, element := range elements {
+		result = append(result, []byte(element.Member))
+		if withScores {
+			result = append(result, formatScore(element.Score))
+		}
+	}
+	return reply.MakeMultiBulkReply(result)
+}
+
+// execZRem ZREM key member [member ...]
+func execZRem(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+
+	removed := 0
+	for _, member := range args[1:] {
+		if sortedSet.Remove(string(member)) {
+			removed++
+		}
+	}
+	db.removeIfEmptySortedSet(key, sortedSet)
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine2("zrem", args...))
+	}
+	return reply.MakeIntReply(int64(removed))
+}
+
+// execZRemRangeByRank ZREMRANGEBYRANK key start stop
+func execZRemRangeByRank(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	start, err := strconv.ParseInt(string(args[1]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	stop, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+	from, to, ok := normalizeRange(int(start), int(stop), int(sortedSet.Len()))
+	if !ok {
+		return reply.MakeIntReply(0)
+	}
+	removed := sortedSet.RemoveByRank(int64(from), int64(to))
+	db.removeIfEmptySortedSet(key, sortedSet)
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine2("zremrangebyrank", args...))
+	}
+	return reply.MakeIntReply(removed)
+}
+
+// execZRemRangeByScore ZREMRANGEBYSCORE key min max
+func execZRemRangeByScore(db *DB, args [][]byte) resp.Reply {
+	return removeInRange(db, args, sortedset.ParseScoreBorder, "zremrangebyscore")
+}
+
+// execZRemRangeByLex ZREMRANGEBYLEX key min max
+func execZRemRangeByLex(db *DB, args [][]byte) resp.Reply {
+	return removeInRange(db, args, sortedset.ParseLexBorder, "zremrangebylex")
+}
+
+func removeInRange(db *DB, args [][]byte, parseBorder func(string) (sortedset.Border, error), cmdName string) resp.Reply {
+	key := string(args[0])
+	min, err := parseBorder(string(args[1]))
+	if err != nil {
+		return reply.MakeStandardErrReply(err.Error())
+	}
+	max, err := parseBorder(string(args[2]))
+	if err != nil {
+		return reply.MakeStandardErrReply(err.Error())
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil {
+		return reply.MakeIntReply(0)
+	}
+	removed := sortedSet.RemoveRange(min, max)
+	db.removeIfEmptySortedSet(key, sortedSet)
+	if removed > 0 {
+		db.addAof(utils.ToCmdLine2(cmdName, args...))
+	}
+	return reply.MakeIntReply(removed)
+}
+
+// execZPopMin ZPOPMIN key [count]
+func execZPopMin(db *DB, args [][]byte) resp.Reply {
+	return popSortedSet(db, args, false)
+}
+
+// execZPopMax ZPOPMAX key [count]
+func execZPopMax(db *DB, args [][]byte) resp.Reply {
+	return popSortedSet(db, args, true)
+}
+
+func popSortedSet(db *DB, args [][]byte, max bool) resp.Reply {
+	if len(args) > 2 {
+		return reply.MakeSyntaxErrReply()
+	}
+	key := string(args[0])
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+		}
+		if n < 0 {
+			return reply.MakeStandardErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(key)
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil || count == 0 {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	var popped []*sortedset.Element
+	if max {
+		popped = sortedSet.PopMax(count)
+	} else {
+		popped = sortedSet.PopMin(count)
+	}
+	db.removeIfEmptySortedSet(key, sortedSet)
+
+	// log the popped members, so replaying does not depend on the order of members
+	aofArgs := make([][]byte, 0, len(popped)+1)
+	aofArgs = append(aofArgs, args[0])
+	for _, element := range popped {
+		aofArgs = append(aofArgs, []byte(element.Member))
+	}
+	if len(popped) > 0 {
+		db.addAof(utils.ToCmdLine2("zrem", aofArgs...))
+	}
+	return makeElementsReply(popped, true)
+}
+
+const (
+	aggregateSum = iota
+	aggregateMin
+	aggregateMax
+)
+
+// combineSpec describes the sources, weights and aggregate function of ZUNION and ZINTER family
+type combineSpec struct {
+	keys       [][]byte
+	weights    []float64
+	aggregate  int
+	withScores bool
+}
+
+// parseCombineSpec parses numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES],
+// WITHSCORES is only accepted if allowWithScores is set
+func parseCombineSpec(args [][]byte, cmdName string, allowWithScores bool) (*combineSpec, reply.ErrorReply) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil {
+		return nil, reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if numKeys < 1 {
+		return nil, reply.MakeStandardErrReply("ERR at least 1 input key is needed for '" + cmdName + "' command")
+	}
+	if numKeys > len(args)-1 {
+		return nil, reply.MakeSyntaxErrReply()
+	}
+
+	spec := &combineSpec{
+		keys:      args[1 : 1+numKeys],
+		weights:   make([]float64, numKeys),
+		aggregate: aggregateSum,
+	}
+	for i := range spec.weights {
+		spec.weights[i] = 1
+	}
+	for i := 1 + numKeys; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "WEIGHTS" && i+numKeys < len(args):
+			for j := 0; j < numKeys; j++ {
+				weight, ok := parseScore(args[i+1+j])
+				if !ok {
+					return nil, reply.MakeStandardErrReply("ERR weight value is not a float")
+				}
+				spec.weights[j] = weight
+			}
+			i += numKeys
+		case option == "AGGREGATE" && i+1 < len(args):
+			switch strings.ToUpper(string(args[i+1])) {
+			case "SUM":
+				spec.aggregate = aggregateSum
+			case "MIN":
+				spec.aggregate = aggregateMin
+			case "MAX":
+				spec.aggregate = aggregateMax
+			default:
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			i++
+		case option == "WITHSCORES" && allowWithScores:
+			spec.withScores = true
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	return spec, nil
+}
+
+// getAsScoredMembers returns members of the sorted set or set stored at key, members of a set have score 1
+func (db *DB) getAsScoredMembers(key string) (map[string]float64, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	members := make(map[string]float64)
+	switch data := entity.Data.(type) {
+	case *sortedset.SortedSet:
+		data.ForEachByRank(0, data.Len(), false, func(element *sortedset.Element) bool {
+			members[element.Member] = element.Score
+			return true
+		})
+	case *set.Set:
+		data.ForEach(func(member string) bool {
+			members[member] = 1
+			return true
+		})
+	default:
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	return members, nil
+}
+
+// aggregateScores combines two scores, NaN caused by adding opposite infinities is treated as 0 as redis does
+func aggregateScores(aggregate int, a float64, b float64) float64 {
+	switch aggregate {
+	case aggregateMin:
+		return math.Min(a, b)
+	case aggregateMax:
+		return math.Max(a, b)
+	}
+	sum := a + b
+	if math.IsNaN(sum) {
+		return 0
+	}
+	return sum
+}
+
+// weightScore multiplies score by weight, 0 * inf is treated as 0
+func weightScore(score float64, weight float64) float64 {
+	result := score * weight
+	if math.IsNaN(result) {
+		return 0
+	}
+	return result
+}
+
+// combineSortedSets computes the union or intersection described by spec
+func combineSortedSets(db *DB, spec *combineSpec, inter bool) (*sortedset.SortedSet, reply.ErrorReply) {
+	var result map[string]float64
+	for i, key := range spec.keys {
+		members, errReply := db.getAsScoredMembers(string(key))
+		if errReply != nil {
+			return nil, errReply
+		}
+		if i == 0 {
+			result = make(map[string]float64, len(members))
+			for member, score := range members {
+				result[member] = weightScore(score, spec.weights[i])
+			}
+			continue
+		}
+		if inter {
+			for member, score := range result {
+				other, ok := members[member]
+				if !ok {
+					delete(result, member)
+					continue
+				}
+				result[member] = aggregateScores(spec.aggregate, score, weightScore(other, spec.weights[i]))
+			}
+			continue
+		}
+		for member, other := range members {
+			weighted := weightScore(other, spec.weights[i])
+			if score, ok := result[member]; ok {
+				result[member] = aggregateScores(spec.aggregate, score, weighted)
+			} else {
+				result[member] = weighted
+			}
+		}
+	}
+
+	sortedSet := sortedset.Make()
+	for member, score := range result {
+		sortedSet.Add(member, score)
+	}
+	return sortedSet, nil
+}
+
+// prepareZCombine locks the source keys of ZUNION and ZINTER: numkeys key [key ...] ...
+func prepareZCombine(args [][]byte) ([]string, []string) {
+	numKeys, err := strconv.Atoi(string(args[0]))
+	if err != nil || numKeys < 1 || numKeys > len(args)-1 {
+		return nil, nil // the executor replies the error
+	}
+	return readAllKeys(args[1 : 1+numKeys])
+}
+
+// prepareZStore locks the destination and source keys of ZUNIONSTORE and ZINTERSTORE: destination numkeys key [key ...] ...
+func prepareZStore(args [][]byte) ([]string, []string) {
+	_, readKeys := prepareZCombine(args[1:])
+	return []string{string(args[0])}, readKeys
+}
+
+// execZUnionStore ZUNIONSTORE destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+func execZUnionStore(db *DB, args [][]byte) resp.Reply {
+	return storeSortedSets(db, args, false, "zunionstore")
+}
+
+// execZInterStore ZINTERSTORE destination numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX]
+func execZInterStore(db *DB, args [][]byte) resp.Reply {
+	return storeSortedSets(db, args, true, "zinterstore")
+}
+
+// storeSortedSets stores the result of combineSortedSets at destination, an empty result removes destination
+func storeSortedSets(db *DB, args [][]byte, inter bool, cmdName string) resp.Reply {
+	dest := string(args[0])
+	spec, errReply := parseCombineSpec(args[1:], cmdName, false)
+	if errReply != nil {
+		return errReply
+	}
+	result, errReply := combineSortedSets(db, spec, inter)
+	if errReply != nil {
+		return errReply
+	}
+
+	db.Remove(dest)
+	if result.Len() > 0 {
+		db.PutEntity(dest, &database.DataEntity{
+			Data: result,
+		})
+	}
+	db.addAof(utils.ToCmdLine2(cmdName, args...))
+	return reply.MakeIntReply(result.Len())
+}
+
+// execZUnion ZUNION numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func execZUnion(db *DB, args [][]byte) resp.Reply {
+	return combineSortedSetsReply(db, args, false, "zunion")
+}
+
+// execZInter ZINTER numkeys key [key ...] [WEIGHTS weight ...] [AGGREGATE SUM|MIN|MAX] [WITHSCORES]
+func execZInter(db *DB, args [][]byte) resp.Reply {
+	return combineSortedSetsReply(db, args, true, "zinter")
+}
+
+func combineSortedSetsReply(db *DB, args [][]byte, inter bool, cmdName string) resp.Reply {
+	spec, errReply := parseCombineSpec(args, cmdName, true)
+	if errReply != nil {
+		return errReply
+	}
+	result, errReply := combineSortedSets(db, spec, inter)
+	if errReply != nil {
+		return errReply
+	}
+	if result.Len() == 0 {
+		return reply.MakeEmptyMultiBulkReply()
+	}
+	return makeElementsReply(result.RangeByRank(0, result.Len(), false), spec.withScores)
+}
+
+// execZScan ZSCAN key cursor [MATCH pattern] [COUNT count]
+func execZScan(db *DB, args [][]byte) resp.Reply {
+	cursor, err := strconv.Atoi(string(args[1]))
+	if err != nil || cursor < 0 {
+		return reply.MakeStandardErrReply("ERR invalid cursor")
+	}
+	var pattern *wildcard.Pattern
+	count := defaultScanCount
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "MATCH" && i+1 < len(args):
+			pattern = wildcard.CompilePattern(string(args[i+1]))
+			i++
+		case option == "COUNT" && i+1 < len(args):
+			count, err = strconv.Atoi(string(args[i+1]))
+			if err != nil {
+				return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+			}
+			if count < 1 {
+				return reply.MakeSyntaxErrReply()
+			}
+			i++
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	sortedSet, errReply := db.getAsSortedSet(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+	if sortedSet == nil || cursor >= int(sortedSet.Len()) {
+		return makeScanReply(0, nil)
+	}
+
+	// the cursor is the rank of the next member to visit
+	end := cursor + count
+	next := end
+	if end >= int(sortedSet.Len()) {
+		end = int(sortedSet.Len())
+		next = 0
+	}
+	result := make([][]byte, 0)
+	sortedSet.ForEachByRank(int64(cursor), int64(end), false, func(element *sortedset.Element) bool {
+		if pattern == nil || pattern.IsMatch(element.Member) {
+			result = append(result, []byte(element.Member), formatScore(element.Score))
+		}
+		return true
+	})
+	return makeScanReply(next, result)
+}
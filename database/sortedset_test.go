@@ -0,0 +1,82 @@
+package database
+
+import (
+	"testing"
+)
+
+func TestZAddOptions(t *testing.T) {
+	database := newMemoryDatabase(t)
+	assertReply(t, execCmd(database, "ZADD", "z", "1", "a", "2", "b"), ":2\r\n")
+	assertReply(t, execCmd(database, "ZADD", "z", "NX", "5", "a", "3", "c"), ":1\r\n")
+	assertReply(t, execCmd(database, "ZADD", "z", "XX", "CH", "4", "b", "4", "d"), ":1\r\n")
+	assertReply(t, execCmd(database, "ZADD", "z", "GT", "CH", "0", "a", "9", "c"), ":1\r\n")
+	assertReply(t, execCmd(database, "ZADD", "z", "LT", "CH", "0", "a", "10", "c"), ":1\r\n")
+	assertReply(t, execCmd(database, "ZRANGE", "z", "0", "-1", "WITHSCORES"), multiBulk("a", "0", "b", "4", "c", "9"))
+	assertReply(t, execCmd(database, "ZADD", "z", "INCR", "1.5", "a"), "$3\r\n1.5\r\n")
+	assertReply(t, execCmd(database, "ZADD", "z", "NX", "INCR", "1", "a"), "$-1\r\n")
+	assertReply(t, execCmd(database, "ZINCRBY", "z", "-2", "b"), "$1\r\n2\r\n")
+	assertReply(t, execCmd(database, "ZSCORE", "z", "b"), "$1\r\n2\r\n")
+	assertReply(t, execCmd(database, "ZMSCORE", "z", "a", "x"), "*2\r\n$3\r\n1.5\r\n$-1\r\n")
+
+	assertReply(t, execCmd(database, "ZADD", "z", "NX", "XX", "1", "a"), "-ERR XX and NX options at the same time are not compatible\r\n")
+	assertReply(t, execCmd(database, "ZADD", "z", "GT", "LT", "1", "a"), "-ERR GT, LT, and/or NX options at the same time are not compatible\r\n")
+	assertReply(t, execCmd(database, "ZADD", "z", "1", "a", "x", "b"), "-ERR value is not a valid float\r\n")
+	assertReply(t, execCmd(database, "ZADD", "z", "1", "a", "2"), "-Err syntax error\r\n")
+
+	// a ZADD adding nothing does not leave an empty key
+	assertReply(t, execCmd(database, "ZADD", "empty", "XX", "1", "a"), ":0\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "empty"), ":0\r\n")
+}
+
+func TestZRange(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e")
+	assertReply(t, execCmd(database, "ZCARD", "z"), ":5\r\n")
+	assertReply(t, execCmd(database, "ZRANK", "z", "c"), ":2\r\n")
+	assertReply(t, execCmd(database, "ZREVRANK", "z", "c", "WITHSCORE"), "*2\r\n:2\r\n$1\r\n3\r\n")
+	assertReply(t, execCmd(database, "ZRANK", "z", "x"), "$-1\r\n")
+	assertReply(t, execCmd(database, "ZRANGE", "z", "-2", "-1"), multiBulk("d", "e"))
+	assertReply(t, execCmd(database, "ZREVRANGE", "z", "0", "1"), multiBulk("e", "d"))
+	assertReply(t, execCmd(database, "ZRANGEBYSCORE", "z", "(1", "4", "LIMIT", "1", "2"), multiBulk("c", "d"))
+	assertReply(t, execCmd(database, "ZREVRANGEBYSCORE", "z", "+inf", "(3", "WITHSCORES"), multiBulk("e", "5", "d", "4"))
+	assertReply(t, execCmd(database, "ZRANGE", "z", "(2", "+inf", "BYSCORE", "REV", "LIMIT", "0", "2"), "*0\r\n")
+	assertReply(t, execCmd(database, "ZRANGE", "z", "+inf", "(2", "BYSCORE", "REV", "LIMIT", "0", "2"), multiBulk("e", "d"))
+	assertReply(t, execCmd(database, "ZCOUNT", "z", "2", "(4"), ":2\r\n")
+	assertReply(t, execCmd(database, "ZRANGE", "z", "0", "1", "LIMIT", "0", "1"),
+		"-ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX\r\n")
+	assertReply(t, execCmd(database, "ZRANGEBYSCORE", "z", "x", "1"), "-ERR min or max is not a float\r\n")
+
+	execCmd(database, "ZADD", "lex", "0", "a", "0", "b", "0", "c", "0", "d")
+	assertReply(t, execCmd(database, "ZRANGEBYLEX", "lex", "(a", "[c"), multiBulk("b", "c"))
+	assertReply(t, execCmd(database, "ZREVRANGEBYLEX", "lex", "+", "-", "LIMIT", "0", "1"), multiBulk("d"))
+	assertReply(t, execCmd(database, "ZLEXCOUNT", "lex", "-", "(c"), ":2\r\n")
+}
+
+func TestZRemove(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e", "6", "f")
+	assertReply(t, execCmd(database, "ZREM", "z", "a", "x"), ":1\r\n")
+	assertReply(t, execCmd(database, "ZREMRANGEBYRANK", "z", "0", "0"), ":1\r\n")
+	assertReply(t, execCmd(database, "ZREMRANGEBYSCORE", "z", "(3", "4"), ":1\r\n")
+	assertReply(t, execCmd(database, "ZPOPMIN", "z"), multiBulk("c", "3"))
+	assertReply(t, execCmd(database, "ZPOPMAX", "z", "5"), multiBulk("f", "6", "e", "5"))
+	assertReply(t, execCmd(database, "EXISTS", "z"), ":0\r\n")
+	assertReply(t, execCmd(database, "ZPOPMIN", "z"), "*0\r\n")
+}
+
+func TestZStore(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "ZADD", "a", "1", "x", "2", "y")
+	execCmd(database, "ZADD", "b", "3", "y", "4", "z")
+	assertReply(t, execCmd(database, "ZUNIONSTORE", "u", "2", "a", "b", "WEIGHTS", "2", "1"), ":3\r\n")
+	assertReply(t, execCmd(database, "ZRANGE", "u", "0", "-1", "WITHSCORES"), multiBulk("x", "2", "z", "4", "y", "7"))
+	assertReply(t, execCmd(database, "ZINTERSTORE", "i", "2", "a", "b", "AGGREGATE", "MAX"), ":1\r\n")
+	assertReply(t, execCmd(database, "ZRANGE", "i", "0", "-1", "WITHSCORES"), multiBulk("y", "3"))
+	assertReply(t, execCmd(database, "ZINTER", "2", "a", "b", "AGGREGATE", "MIN", "WITHSCORES"), multiBulk("y", "2"))
+	assertReply(t, execCmd(database, "ZUNION", "1", "a"), multiBulk("x", "y"))
+	assertReply(t, execCmd(database, "ZUNIONSTORE", "u", "0", "a"), "-ERR at least 1 input key is needed for 'zunionstore' command\r\n")
+
+	// storing an empty result removes the destination
+	assertReply(t, execCmd(database, "ZINTERSTORE", "u", "2", "a", "none"), ":0\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "u"), ":0\r\n")
+}
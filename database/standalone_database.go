@@ -1,26 +1,154 @@
 package database
 
 import (
+	"errors"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"go-redis/aof"
 	"go-redis/config"
 	"go-redis/interface/resp"
 	"go-redis/lib/logger"
+	"go-redis/pubsub"
 	"go-redis/resp/reply"
+
+	databaseface "go-redis/interface/database"
 )
 
+// activeExpireInterval is the interval between two active expire cycles
+const activeExpireInterval = 100 * time.Millisecond
+
 // StandaloneDatabase represent a redis
 type StandaloneDatabase struct {
 	dbSet      []*DB
 	aofHandler *aof.Handler
+	hub        *pubsub.Hub   // publish/subscribe relations
+	closed     chan struct{} // stops background jobs
+	closeOnce  sync.Once
+	jobs       sync.WaitGroup // background jobs, Close waits for them to stop
+
+	// dirty counts the writes since the last successful save
+	dirty     int64
+	saveRules []saveRule
+
+	// saveMu guards the snapshot state below
+	saveMu             sync.Mutex
+	saveDone           chan struct{} // closed once the running save finishes, nil if not saving
+	bgSaving           bool
+	lastSave           time.Time
+	lastBgSaveTry      time.Time
+	lastBgSaveErr      error
+	lastBgSaveDuration time.Duration
+
+	// barrier is shared by the dbs, see DB.barrier. snapshotMu is held while a snapshot runs.
+	barrier    sync.RWMutex
+	snapshotMu sync.Mutex
+	repl       *replication
+	// loading is 1 while the dataset is being loaded, clients are refused meanwhile
+	loading int32
+	stats   *serverStats
 }
 
 // NewStandaloneDatabase initials a redis
 func NewStandaloneDatabase() *StandaloneDatabase {
-	// create dbs
-	database := &StandaloneDatabase{}
+	database := newBasicDatabase()
+
+	// initial aof, or load the snapshot if aof is off
+	if config.Snapshot().AppendOnly {
+		database.setLoading(true)
+		aofHandler, err := aof.NewAofHandler(database, makeTmpDB)
+		database.setLoading(false)
+		if err != nil {
+			panic(err)
+		}
+		database.aofHandler = aofHandler
+	} else {
+		aux, err := database.loadRDB(config.Properties.DBFilename, false)
+		if err != nil {
+			panic(err)
+		}
+		if config.Properties.ReplicaOf != "" {
+			database.repl.restoreMaster(aux)
+		}
+	}
+	for _, db := range database.dbSet {
+		sdb := db // fix closure problem
+		sdb.addAof = func(lines ...CmdLine) {
+			atomic.AddInt64(&database.dirty, int64(len(lines)))
+			database.repl.propagate(sdb.index, lines)
+			if database.aofHandler == nil {
+				return
+			}
+			aofLines := make([]aof.CmdLine, len(lines))
+			for i, line := range lines {
+				aofLines[i] = aof.CmdLine(line)
+			}
+			database.aofHandler.AddAof(sdb.index, aofLines...)
+		}
+	}
+
+	// stats count the commands of clients only, not the ones loaded
+	database.stats = stats
+	for _, db := range database.dbSet {
+		db.stats = stats
+	}
+	config.OnChange("appendonly", database.applyAppendOnly)
+	config.OnChange("maxmemory", database.applyMaxMemory)
+
+	saveRules, err := parseSaveRules(config.Properties.Save)
+	if err != nil {
+		panic(err)
+	}
+	database.saveRules = saveRules
+	database.lastSave = time.Now()
+	if len(saveRules) > 0 {
+		database.startJob(database.saveCron)
+	}
+
+	if config.Properties.ReplicaOf != "" {
+		fields := strings.Fields(config.Properties.ReplicaOf)
+		if len(fields) != 2 {
+			panic("invalid replicaOf " + config.Properties.ReplicaOf + ", expected <host> <port>")
+		}
+		port, err := strconv.Atoi(fields[1])
+		if err != nil || port <= 0 || port > 65535 {
+			panic("invalid master port in replicaOf " + config.Properties.ReplicaOf)
+		}
+		database.startReplication(fields[0], port)
+	}
+	database.startJob(database.replicationCron)
+
+	database.startJob(database.activeExpire)
+	database.startJob(database.statsCron)
+	return database
+}
+
+// startJob runs the job in background until the database is closed
+func (database *StandaloneDatabase) startJob(job func()) {
+	database.jobs.Add(1)
+	go func() {
+		defer database.jobs.Done()
+		job()
+	}()
+}
+
+// makeTmpDB makes an empty database to replay aof file while rewriting it
+func makeTmpDB() databaseface.DBEngine {
+	tmpDB := newBasicDatabase()
+	tmpDB.setLoading(true) // keys in the snapshot never expire while replaying
+	return tmpDB
+}
+
+// newBasicDatabase creates the dbs without aof and background jobs
+func newBasicDatabase() *StandaloneDatabase {
+	database := &StandaloneDatabase{
+		hub:    pubsub.MakeHub(),
+		closed: make(chan struct{}),
+		repl:   makeReplication(),
+	}
 	if config.Properties.Databases == 0 {
 		config.Properties.Databases = 16
 	}
@@ -29,24 +157,9 @@ func NewStandaloneDatabase() *StandaloneDatabase {
 	for i := range database.dbSet {
 		db := makeDB()
 		db.index = i
+		db.barrier = &database.barrier
 		database.dbSet[i] = db
 	}
-
-	// initial aof
-	if config.Properties.AppendOnly {
-		aofHandler, err := aof.NewAofHandler(database)
-		if err != nil {
-			panic(err)
-		}
-		database.aofHandler = aofHandler
-		for _, db := range database.dbSet {
-			sdb := db // fix closure problem
-			sdb.addAof = func(line CmdLine) {
-				database.aofHandler.AddAof(sdb.index, aof.CmdLine(line))
-			}
-		}
-
-	}
 	return database
 }
 
@@ -59,31 +172,213 @@ func (database *StandaloneDatabase) Exec(client resp.Connection, args [][]byte)
 	}()
 
 	cmdName := strings.ToLower(string(args[0]))
-	if cmdName == "select" {
-		if len(args) != 2 {
-			return reply.MakeArgNumErrReply("select")
+	if atomic.LoadInt32(&database.loading) == 1 && !loadingCommands[cmdName] {
+		return reply.MakeStandardErrReply("LOADING Redis is loading the dataset in memory")
+	}
+	if client.SubsCount() > 0 && !subscriberCommands[cmdName] {
+		return reply.MakeStandardErrReply("ERR Can't execute '" + cmdName +
+			"': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING / QUIT are allowed in this context")
+	}
+	cmd, isServerCmd := serverCmdTable[cmdName]
+	if client.InMultiState() && isServerCmd {
+		err := errors.New("ERR " + strings.ToUpper(cmdName) + " inside MULTI is not allowed")
+		client.AddTxError(err)
+		return reply.MakeStandardErrReply(err.Error())
+	}
+	// dbs replaying aof file or rewriting it have no stats
+	if database.stats != nil {
+		database.stats.commands.Add(1)
+	}
+	if cmdName == "ping" && client.SubsCount() > 0 {
+		return execSubscriberPing(args[1:])
+	}
+	if isServerCmd {
+		if !validateArity(cmd.arity, args) {
+			return reply.MakeArgNumErrReply(cmdName)
 		}
+		return cmd.executor(database, client, args[1:])
+	}
 
-		return execSelect(client, database, args[1:])
+	if database.repl.isReadOnly() && !database.repl.isMasterConn(client) && IsWriteCommand(args) {
+		if client.InMultiState() {
+			client.AddTxError(errReadOnly)
+		}
+		return reply.MakeStandardErrReply(errReadOnly.Error())
+	}
+	if database.overMaxMemory() && !database.repl.isMasterConn(client) && IsWriteCommand(args) {
+		if client.InMultiState() {
+			client.AddTxError(errOOM)
+		}
+		return reply.MakeStandardErrReply(errOOM.Error())
 	}
 
 	db := database.dbSet[client.GetDBIndex()]
 	return db.Exec(client, args)
 }
 
+// Close stops background jobs and flushes persistence, a snapshot is saved if any save rule is set
 func (database *StandaloneDatabase) Close() error {
-	logger.Info("database shutting down")
+	database.closeOnce.Do(func() {
+		logger.Info("database shutting down")
+		close(database.closed)
+		database.jobs.Wait()
+		database.stopReplication()
+		if database.aofHandler != nil {
+			database.aofHandler.Close()
+		}
+		if len(database.saveRules) > 0 {
+			database.saveOnShutdown()
+		}
+	})
 	return nil
 }
 
+// ForEach visits the keys of the db which are not expired
+func (database *StandaloneDatabase) ForEach(dbIndex int, cb func(key string, data *databaseface.DataEntity, expiration *time.Time) bool) {
+	database.dbSet[dbIndex].ForEach(cb)
+}
+
 func (database *StandaloneDatabase) AfterClientClose(client resp.Connection) error {
 	logger.Info("client shutting down")
+	database.hub.UnsubscribeAll(client)
+	database.repl.removeConn(client)
 	return nil
 }
 
+// errReadOnly is replied to clients writing a read only replica
+var errReadOnly = errors.New("READONLY You can't write against a read only replica.")
+
+// loadingCommands are the commands accepted while the dataset is being loaded
+var loadingCommands = map[string]bool{
+	"info":      true,
+	"role":      true,
+	"replicaof": true,
+	"slaveof":   true,
+	"ping":      true,
+}
+
+// subscriberCommands are the commands accepted while the connection subscribes any channel or pattern,
+// QUIT is handled by the handler before reaching the database
+var subscriberCommands = map[string]bool{
+	"subscribe":    true,
+	"unsubscribe":  true,
+	"psubscribe":   true,
+	"punsubscribe": true,
+	"ping":         true,
+}
+
+// serverCmdTable holds the commands run by the server instead of a db, EXEC could not run them
+// so they are refused inside MULTI and abort the transaction
+var serverCmdTable = make(map[string]*serverCommand)
+
+// serverCommand is a command of the server, arity is checked as the one of command
+type serverCommand struct {
+	executor serverExecFunc
+	arity    int
+}
+
+// serverExecFunc executes a server command, args exclude the command name
+type serverExecFunc func(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply
+
+// registerServerCommand adds a command to serverCmdTable
+func registerServerCommand(name string, executor serverExecFunc, arity int) {
+	serverCmdTable[strings.ToLower(name)] = &serverCommand{
+		executor: executor,
+		arity:    arity,
+	}
+}
+
+func init() {
+	registerServerCommand("Subscribe", execSubscribe, -2)
+	registerServerCommand("Unsubscribe", execUnsubscribe, -1)
+	registerServerCommand("PSubscribe", execPSubscribe, -2)
+	registerServerCommand("PUnsubscribe", execPUnsubscribe, -1)
+	registerServerCommand("Publish", execPublish, 3)
+	registerServerCommand("PubSub", execPubSub, -2)
+	registerServerCommand("BGRewriteAOF", execBGRewriteAOF, 1)
+	registerServerCommand("Select", execSelect, 2)
+}
+
+// execSubscribe SUBSCRIBE channel [channel ...]
+func execSubscribe(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	return database.hub.Subscribe(c, args)
+}
+
+// execUnsubscribe UNSUBSCRIBE [channel ...]
+func execUnsubscribe(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	return database.hub.UnSubscribe(c, args)
+}
+
+// execPSubscribe PSUBSCRIBE pattern [pattern ...]
+func execPSubscribe(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	return database.hub.PSubscribe(c, args)
+}
+
+// execPUnsubscribe PUNSUBSCRIBE [pattern ...]
+func execPUnsubscribe(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	return database.hub.PUnSubscribe(c, args)
+}
+
+// execPublish PUBLISH channel message
+func execPublish(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	return database.hub.Publish(args)
+}
+
+// execPubSub PUBSUB subcommand [argument ...]
+func execPubSub(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	return database.hub.PubSub(args)
+}
+
+// execSubscriberPing replies PING of a subscriber as a message: ["pong", message]
+func execSubscriberPing(args [][]byte) resp.Reply {
+	if len(args) > 1 {
+		return reply.MakeArgNumErrReply("ping")
+	}
+	message := []byte("")
+	if len(args) == 1 {
+		message = args[0]
+	}
+	return reply.MakeMultiBulkReply([][]byte{[]byte("pong"), message})
+}
+
+// setLoading marks whether all dbs are replaying persisted commands
+func (database *StandaloneDatabase) setLoading(loading bool) {
+	for _, db := range database.dbSet {
+		db.loading.Set(loading)
+	}
+}
+
+// activeExpire removes expired keys in background,
+// so keys which are never accessed again do not stay in memory forever
+func (database *StandaloneDatabase) activeExpire() {
+	ticker := time.NewTicker(activeExpireInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			for _, db := range database.dbSet {
+				db.activeExpire()
+			}
+		case <-database.closed:
+			return
+		}
+	}
+}
+
+// execBGRewriteAOF BGREWRITEAOF
+func execBGRewriteAOF(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
+	if database.aofHandler == nil {
+		return reply.MakeStandardErrReply("ERR Background append only file rewriting is not possible while appendonly is off")
+	}
+	if err := database.aofHandler.BGRewrite(); err != nil {
+		return reply.MakeStandardErrReply(err.Error())
+	}
+	return reply.MakeStatusReply("Background append only file rewriting started")
+}
+
 // execSelect selects a db
 // e.g. select 1
-func execSelect(c resp.Connection, database *StandaloneDatabase, args [][]byte) resp.Reply {
+func execSelect(database *StandaloneDatabase, c resp.Connection, args [][]byte) resp.Reply {
 	index := string(args[0])
 	i, err := strconv.Atoi(index)
 	if err != nil {
@@ -0,0 +1,158 @@
+package database
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"go-redis/config"
+	"go-redis/lib/sync/atomic"
+)
+
+const (
+	// statsSampleInterval is the interval between two samples of the instantaneous metrics
+	statsSampleInterval = 100 * time.Millisecond
+	// statsSamples is the number of samples the instantaneous metrics are averaged over
+	statsSamples = 16
+)
+
+// ClientStats are the counters of the clients, kept by the handler serving them and reported by INFO
+type ClientStats struct {
+	Connected        int
+	MaxClients       int
+	TotalConnections int64
+	Rejected         int64
+	NetInputBytes    int64
+	NetOutputBytes   int64
+}
+
+var (
+	clientStatsMu       sync.RWMutex
+	clientStatsProvider = func() ClientStats { return ClientStats{} }
+)
+
+// SetClientStatsProvider sets how INFO gets the counters of the clients
+func SetClientStatsProvider(provider func() ClientStats) {
+	clientStatsMu.Lock()
+	clientStatsProvider = provider
+	clientStatsMu.Unlock()
+}
+
+func getClientStats() ClientStats {
+	clientStatsMu.RLock()
+	provider := clientStatsProvider
+	clientStatsMu.RUnlock()
+	return provider()
+}
+
+// stats are shared by the databases serving clients in the process, so CONFIG RESETSTAT resets them all
+var stats = makeServerStats()
+
+// serverStats are the counters of INFO stats, shared by the dbs of a server
+type serverStats struct {
+	startTime time.Time
+	runID     string
+
+	commands atomic.Int64
+	hits     atomic.Int64
+	misses   atomic.Int64
+	expired  atomic.Int64
+
+	// mu guards the instantaneous metrics and the peak memory
+	mu         sync.Mutex
+	ops        instantaneousMetric
+	netInput   instantaneousMetric
+	netOutput  instantaneousMetric
+	peakMemory uint64
+
+	// usedMemory is the heap in use sampled by statsCron, accessed atomically
+	usedMemory atomic.Int64
+}
+
+func makeServerStats() *serverStats {
+	return &serverStats{
+		startTime: time.Now(),
+		runID:     randomReplID(),
+	}
+}
+
+// instantaneousMetric is the rate of a counter averaged over the last samples
+type instantaneousMetric struct {
+	lastTime  time.Time
+	lastValue int64
+	samples   [statsSamples]float64
+	index     int
+}
+
+// track samples the counter, the rate since the last sample is recorded
+func (m *instantaneousMetric) track(value int64, now time.Time) {
+	if !m.lastTime.IsZero() {
+		elapsed := now.Sub(m.lastTime).Seconds()
+		if elapsed > 0 {
+			m.samples[m.index] = float64(value-m.lastValue) / elapsed
+			m.index = (m.index + 1) % statsSamples
+		}
+	}
+	m.lastTime = now
+	m.lastValue = value
+}
+
+// rate returns the average rate per second of the samples
+func (m *instantaneousMetric) rate() float64 {
+	sum := 0.0
+	for _, sample := range m.samples {
+		sum += sample
+	}
+	return sum / statsSamples
+}
+
+// statsCron samples the instantaneous metrics until the database is closed
+func (database *StandaloneDatabase) statsCron() {
+	ticker := time.NewTicker(statsSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-database.closed:
+			return
+		}
+		stats := database.stats
+		clients := getClientStats()
+		now := time.Now()
+		stats.mu.Lock()
+		stats.ops.track(stats.commands.Get(), now)
+		stats.netInput.track(clients.NetInputBytes, now)
+		stats.netOutput.track(clients.NetOutputBytes, now)
+		stats.mu.Unlock()
+		if config.Snapshot().MaxMemory > 0 {
+			stats.sampleMemory()
+		}
+	}
+}
+
+// sampleMemory records the heap in use and the peak of it
+func (stats *serverStats) sampleMemory() runtime.MemStats {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	stats.usedMemory.Set(int64(mem.HeapAlloc))
+	stats.mu.Lock()
+	if mem.HeapAlloc > stats.peakMemory {
+		stats.peakMemory = mem.HeapAlloc
+	}
+	stats.mu.Unlock()
+	return mem
+}
+
+// ResetStats resets the counters of INFO stats, see CONFIG RESETSTAT
+func ResetStats() {
+	stats.commands.Set(0)
+	stats.hits.Set(0)
+	stats.misses.Set(0)
+	stats.expired.Set(0)
+	stats.mu.Lock()
+	stats.ops = instantaneousMetric{}
+	stats.netInput = instantaneousMetric{}
+	stats.netOutput = instantaneousMetric{}
+	stats.peakMemory = uint64(stats.usedMemory.Get())
+	stats.mu.Unlock()
+}
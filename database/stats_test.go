@@ -0,0 +1,49 @@
+package database
+
+import (
+	"strings"
+	"testing"
+
+	"go-redis/resp/connection"
+)
+
+func TestKeyspaceStats(t *testing.T) {
+	useTestConfig(t)
+	database := newTestDatabase(t)
+	execCmd(database, "SET", "k", "v")
+	hits, misses := stats.hits.Get(), stats.misses.Get()
+	execCmd(database, "GET", "k")
+	execCmd(database, "GET", "missing")
+
+	client := &connection.Connection{}
+	execOn(database, client, "MULTI")
+	execOn(database, client, "GET", "k")
+	execOn(database, client, "GET", "missing")
+	execOn(database, client, "EXEC")
+
+	if delta := stats.hits.Get() - hits; delta != 2 {
+		t.Errorf("expected 2 keyspace hits, got %d", delta)
+	}
+	if delta := stats.misses.Get() - misses; delta != 2 {
+		t.Errorf("expected 2 keyspace misses, got %d", delta)
+	}
+}
+
+func TestInfoSections(t *testing.T) {
+	useTestConfig(t)
+	database := newTestDatabase(t)
+	execCmd(database, "SET", "k", "v")
+	info := execCmd(database, "INFO")
+	for _, section := range []string{"# Server", "# Clients", "# Memory", "# Persistence", "# Stats", "# Replication", "# CPU", "# Keyspace"} {
+		if !strings.Contains(info, section) {
+			t.Errorf("INFO misses section %s", section)
+		}
+	}
+	if !strings.Contains(info, "db0:keys=1,expires=0") {
+		t.Error("INFO keyspace misses db0")
+	}
+	statsInfo := execCmd(database, "INFO", "stats")
+	if strings.Contains(statsInfo, "# Server") || !strings.Contains(statsInfo, "keyspace_hits:") {
+		t.Errorf("unexpected INFO stats: %q", statsInfo)
+	}
+}
@@ -1,6 +1,12 @@
 package database
 
 import (
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-redis/aof"
 	"go-redis/interface/database"
 	"go-redis/interface/resp"
 	"go-redis/lib/utils"
@@ -8,36 +14,207 @@ import (
 )
 
 func init() {
-	RegisterCommand("get", execGet, 2)
-	RegisterCommand("set", execSet, 3)
-	RegisterCommand("setnx", execSetNX, 3)
-	RegisterCommand("getset", execGetSet, 3)
-	RegisterCommand("strlen", execStrLen, 2)
+	RegisterCommand("get", execGet, readFirstKey, 2)
+	RegisterCommand("set", execSet, writeFirstKey, -3)
+	RegisterCommand("setnx", execSetNX, writeFirstKey, 3)
+	RegisterCommand("getset", execGetSet, writeFirstKey, 3)
+	RegisterCommand("strlen", execStrLen, readFirstKey, 2)
+	RegisterCommand("incr", execIncr, writeFirstKey, 2)
+	RegisterCommand("incrby", execIncrBy, writeFirstKey, 3)
+	RegisterCommand("decr", execDecr, writeFirstKey, 2)
+	RegisterCommand("decrby", execDecrBy, writeFirstKey, 3)
+	RegisterCommand("incrbyfloat", execIncrByFloat, writeFirstKey, 3)
+	RegisterCommand("mset", execMSet, prepareMSet, -3)
+	RegisterCommand("mget", execMGet, readAllKeys, -2)
+}
+
+// getAsString returns the string stored at key, bytes is nil if the key does not exist
+func (db *DB) getAsString(key string) ([]byte, reply.ErrorReply) {
+	entity, exists := db.GetEntity(key)
+	if !exists {
+		return nil, nil
+	}
+	bytes, ok := entity.Data.([]byte)
+	if !ok {
+		return nil, reply.MakeWrongTypeErrReply()
+	}
+	return bytes, nil
 }
 
 // execGet GET k1
 func execGet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
-	entity, exist := db.GetEntity(key)
-	if !exist {
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	if bytes == nil {
 		return reply.MakeNullBulkReply()
 	}
-	return reply.MakeBulkReply(entity.Data.([]byte))
+	return reply.MakeBulkReply(bytes)
+}
+
+const (
+	upsertPolicy = iota // default, sets the key whether it exists or not
+	insertPolicy        // NX, only sets the key if it does not exist
+	updatePolicy        // XX, only sets the key if it already exists
+)
+
+// setOptions holds the options of SET command
+type setOptions struct {
+	policy   int
+	get      bool      // GET, replies the old value
+	keepTTL  bool      // KEEPTTL, retains the ttl of the old value
+	expireAt time.Time // zero means no ttl
+}
+
+// parseSetOptions parses options following SET k v
+func parseSetOptions(args [][]byte) (*setOptions, resp.Reply) {
+	opts := &setOptions{policy: upsertPolicy}
+	hasTTL := false
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch option {
+		case "NX", "XX":
+			if opts.policy != upsertPolicy {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.policy = insertPolicy
+			if option == "XX" {
+				opts.policy = updatePolicy
+			}
+		case "GET":
+			opts.get = true
+		case "KEEPTTL":
+			if hasTTL {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			opts.keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasTTL || opts.keepTTL || i+1 >= len(args) {
+				return nil, reply.MakeSyntaxErrReply()
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return nil, reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+			}
+			unit := time.Second
+			if option == "PX" || option == "PXAT" {
+				unit = time.Millisecond
+			}
+			relative := option == "EX" || option == "PX"
+			if n <= 0 || (relative && n > math.MaxInt64/int64(unit)) {
+				return nil, reply.MakeStandardErrReply("ERR invalid expire time in 'set' command")
+			}
+			if relative {
+				opts.expireAt = time.Now().Add(time.Duration(n) * unit)
+			} else {
+				perSecond := int64(time.Second / unit)
+				opts.expireAt = time.Unix(n/perSecond, (n%perSecond)*int64(unit))
+			}
+			hasTTL = true
+			i++
+		default:
+			return nil, reply.MakeSyntaxErrReply()
+		}
+	}
+	return opts, nil
 }
 
-// execSet SET k v
+// execSet SET k v [NX|XX] [GET] [EX seconds|PX milliseconds|EXAT unix-time-seconds|PXAT unix-time-milliseconds|KEEPTTL]
 func execSet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	val := args[1]
+	opts, errReply := parseSetOptions(args[2:])
+	if errReply != nil {
+		return errReply
+	}
+
+	var oldVal []byte
+	if opts.get {
+		oldVal, errReply = db.getAsString(key)
+		if errReply != nil {
+			return errReply
+		}
+	}
+
 	entity := &database.DataEntity{
 		Data: val,
 	}
+	// an expired key which is not removed yet is absent for NX and XX
+	db.IsExpired(key)
+	var result int
+	switch opts.policy {
+	case upsertPolicy:
+		db.PutEntity(key, entity)
+		result = 1
+	case insertPolicy:
+		result = db.PutIfAbsent(key, entity)
+	case updatePolicy:
+		result = db.PutIfExists(key, entity)
+	}
 
-	db.PutEntity(key, entity)
-	db.addAof(utils.ToCmdLine2("set", args...))
+	if result > 0 {
+		if opts.keepTTL {
+			db.addAof(utils.ToCmdLine2("set", args[0], args[1], []byte("KEEPTTL")))
+		} else {
+			db.addAof(utils.ToCmdLine2("set", args[0], args[1]))
+			if !opts.expireAt.IsZero() {
+				db.Expire(key, opts.expireAt)
+				db.addAof(aof.MakeExpireCmd(key, opts.expireAt))
+			} else {
+				db.Persist(key)
+			}
+		}
+	}
+
+	if opts.get {
+		if oldVal == nil {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply(oldVal)
+	}
+	if result == 0 {
+		return reply.MakeNullBulkReply()
+	}
 	return reply.MakeOKReply()
 }
 
+// prepareMSet locks the keys of MSET k1 v1 k2 v2 ...
+func prepareMSet(args [][]byte) ([]string, []string) {
+	keys := make([]string, 0, len(args)/2)
+	for i := 0; i < len(args); i += 2 {
+		keys = append(keys, string(args[i]))
+	}
+	return keys, nil
+}
+
+// execMSet MSET k1 v1 [k2 v2 ...]
+func execMSet(db *DB, args [][]byte) resp.Reply {
+	if len(args)%2 != 0 {
+		return reply.MakeArgNumErrReply("mset")
+	}
+	for i := 0; i < len(args); i += 2 {
+		key := string(args[i])
+		db.PutEntity(key, &database.DataEntity{Data: args[i+1]})
+		db.Persist(key)
+	}
+	db.addAof(utils.ToCmdLine2("mset", args...))
+	return reply.MakeOKReply()
+}
+
+// execMGet MGET k1 [k2 ...], keys which do not hold a string are nil
+func execMGet(db *DB, args [][]byte) resp.Reply {
+	values := make([][]byte, len(args))
+	for i, arg := range args {
+		bytes, errReply := db.getAsString(string(arg))
+		if errReply == nil {
+			values[i] = bytes
+		}
+	}
+	return reply.MakeMultiBulkReply(values)
+}
+
 // execSetNX SETNX k1 v1
 func execSetNX(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
@@ -46,8 +223,12 @@ func execSetNX(db *DB, args [][]byte) resp.Reply {
 		Data: val,
 	}
 
+	// an expired key which is not removed yet is absent
+	db.IsExpired(key)
 	inserted := db.PutIfAbsent(key, entity)
-	db.addAof(utils.ToCmdLine2("setnx", args...))
+	if inserted > 0 {
+		db.addAof(utils.ToCmdLine2("setnx", args...))
+	}
 	return reply.MakeIntReply(int64(inserted))
 }
 
@@ -56,25 +237,143 @@ func execGetSet(db *DB, args [][]byte) resp.Reply {
 	key := string(args[0])
 	val := args[1]
 
-	entity, exists := db.GetEntity(key)
+	old, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
 
 	db.PutEntity(key, &database.DataEntity{
 		Data: val,
 	})
+	db.Persist(key)
+	db.addAof(utils.ToCmdLine2("getset", args...))
 
-	if exists {
-		db.addAof(utils.ToCmdLine2("getset", args...))
-		return reply.MakeBulkReply(entity.Data.([]byte))
+	if old != nil {
+		return reply.MakeBulkReply(old)
 	}
 	return reply.MakeNullBulkReply()
 }
 
 // execStrLen STRLEN
 func execStrLen(db *DB, args [][]byte) resp.Reply {
-	entity, exists := db.GetEntity(string(args[0]))
-	if !exists {
-		return reply.MakeNullBulkReply()
+	bytes, errReply := db.getAsString(string(args[0]))
+	if errReply != nil {
+		return errReply
+	}
+
+	return reply.MakeIntReply(int64(len(bytes)))
+}
+
+// parseInteger parses a signed 64 bit integer the way redis does,
+// leading '+', leading zeros and spaces are not allowed
+func parseInteger(bytes []byte) (int64, bool) {
+	n, err := strconv.ParseInt(string(bytes), 10, 64)
+	if err != nil || strconv.FormatInt(n, 10) != string(bytes) {
+		return 0, false
+	}
+	return n, true
+}
+
+// execIncr INCR key
+func execIncr(db *DB, args [][]byte) resp.Reply {
+	return incrBy(db, args, 1)
+}
+
+// execDecr DECR key
+func execDecr(db *DB, args [][]byte) resp.Reply {
+	return incrBy(db, args, -1)
+}
+
+// execIncrBy INCRBY key increment
+func execIncrBy(db *DB, args [][]byte) resp.Reply {
+	delta, ok := parseInteger(args[1])
+	if !ok {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	return incrBy(db, args, delta)
+}
+
+// execDecrBy DECRBY key decrement
+func execDecrBy(db *DB, args [][]byte) resp.Reply {
+	delta, ok := parseInteger(args[1])
+	if !ok {
+		return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+	}
+	if delta == math.MinInt64 {
+		return reply.MakeStandardErrReply("ERR decrement would overflow")
 	}
+	return incrBy(db, args, -delta)
+}
 
-	return reply.MakeIntReply(int64(len(entity.Data.([]byte))))
+// incrBy adds delta to the integer stored at args[0], a key which does not exist is treated as 0.
+// The caller holds the lock of the key, so the read-modify-write is atomic
+func incrBy(db *DB, args [][]byte, delta int64) resp.Reply {
+	key := string(args[0])
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	var current int64
+	if bytes != nil {
+		var ok bool
+		current, ok = parseInteger(bytes)
+		if !ok {
+			return reply.MakeStandardErrReply("ERR value is not an integer or out of range")
+		}
+	}
+	if (delta > 0 && current > math.MaxInt64-delta) || (delta < 0 && current < math.MinInt64-delta) {
+		return reply.MakeStandardErrReply("ERR increment or decrement would overflow")
+	}
+
+	result := current + delta
+	// the ttl of key is retained
+	db.PutEntity(key, &database.DataEntity{
+		Data: []byte(strconv.FormatInt(result, 10)),
+	})
+	db.addAof(utils.ToCmdLine("incrby", key, strconv.FormatInt(delta, 10)))
+	return reply.MakeIntReply(result)
+}
+
+// execIncrByFloat INCRBYFLOAT key increment
+func execIncrByFloat(db *DB, args [][]byte) resp.Reply {
+	key := string(args[0])
+	delta, err := strconv.ParseFloat(string(args[1]), 64)
+	if err != nil || math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return reply.MakeStandardErrReply("ERR value is not a valid float")
+	}
+
+	bytes, errReply := db.getAsString(key)
+	if errReply != nil {
+		return errReply
+	}
+	var current float64
+	if bytes != nil {
+		current, err = strconv.ParseFloat(string(bytes), 64)
+		if err != nil || math.IsNaN(current) || math.IsInf(current, 0) {
+			return reply.MakeStandardErrReply("ERR value is not a valid float")
+		}
+	}
+	result := current + delta
+	if math.IsNaN(result) || math.IsInf(result, 0) {
+		return reply.MakeStandardErrReply("ERR increment would produce NaN or Infinity")
+	}
+
+	resultBytes := formatFloat(result)
+	db.PutEntity(key, &database.DataEntity{
+		Data: resultBytes,
+	})
+	// log the result instead of the increment, so replaying does not accumulate float rounding errors
+	db.addAof(utils.ToCmdLine2("set", args[0], resultBytes, []byte("KEEPTTL")))
+	return reply.MakeBulkReply(resultBytes)
+}
+
+// formatFloat formats the result of INCRBYFLOAT and HINCRBYFLOAT like the %.17g of redis with the shortest digits reading back
+// the same value: decimals unless the exponent is below -4 or at least 17, e.g. 10.5, 1e+300, 1e-05
+func formatFloat(f float64) []byte {
+	s := strconv.FormatFloat(f, 'e', -1, 64)
+	exp, _ := strconv.Atoi(s[strings.IndexByte(s, 'e')+1:])
+	if exp < -4 || exp >= 17 {
+		return []byte(s)
+	}
+	return []byte(strconv.FormatFloat(f, 'f', -1, 64))
 }
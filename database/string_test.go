@@ -0,0 +1,172 @@
+package database
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSetOptions(t *testing.T) {
+	database := newMemoryDatabase(t)
+	assertReply(t, execCmd(database, "SET", "k", "v1", "XX"), "$-1\r\n")
+	assertReply(t, execCmd(database, "SET", "k", "v1", "NX"), "+OK\r\n")
+	assertReply(t, execCmd(database, "SET", "k", "v2", "NX"), "$-1\r\n")
+	assertReply(t, execCmd(database, "SET", "k", "v2", "XX", "GET"), "$2\r\nv1\r\n")
+	assertReply(t, execCmd(database, "SET", "k", "v3", "EX", "100"), "+OK\r\n")
+	assertReply(t, execCmd(database, "SET", "k", "v4", "KEEPTTL"), "+OK\r\n")
+	if ttl := execCmd(database, "TTL", "k"); ttl != ":100\r\n" && ttl != ":99\r\n" {
+		t.Errorf("expected ttl kept by KEEPTTL, got %q", ttl)
+	}
+	assertReply(t, execCmd(database, "SET", "k", "v5"), "+OK\r\n")
+	assertReply(t, execCmd(database, "TTL", "k"), ":-1\r\n")
+	assertReply(t, execCmd(database, "SET", "k", "v", "NX", "XX"), "-Err syntax error\r\n")
+	assertReply(t, execCmd(database, "SET", "k", "v", "EX", "0"), "-ERR invalid expire time in 'set' command\r\n")
+}
+
+func TestSetExpireOptions(t *testing.T) {
+	database := newMemoryDatabase(t)
+	at := time.Now().Add(time.Hour).Unix()
+	assertReply(t, execCmd(database, "SET", "k", "v", "exat", strconv.FormatInt(at, 10)), "+OK\r\n")
+	assertReply(t, execCmd(database, "EXPIRETIME", "k"), ":"+strconv.FormatInt(at, 10)+"\r\n")
+	assertReply(t, execCmd(database, "SET", "k", "v", "PXAT", strconv.FormatInt(at*1000+5, 10)), "+OK\r\n")
+	assertReply(t, execCmd(database, "PEXPIRETIME", "k"), ":"+strconv.FormatInt(at*1000+5, 10)+"\r\n")
+	assertReply(t, execCmd(database, "SET", "k", "v", "PX", "20"), "+OK\r\n")
+	time.Sleep(40 * time.Millisecond)
+	assertReply(t, execCmd(database, "EXISTS", "k"), ":0\r\n")
+
+	for _, options := range [][]string{{"EX"}, {"EX", "10", "PX", "10"}, {"KEEPTTL", "EX", "10"}, {"EX", "10", "KEEPTTL"},
+		{"XX", "NX"}, {"FOO"}} {
+		assertReply(t, execCmd(database, append([]string{"SET", "k", "v"}, options...)...), "-Err syntax error\r\n")
+	}
+	assertReply(t, execCmd(database, "SET", "k", "v", "EX", "x"), "-ERR value is not an integer or out of range\r\n")
+	assertReply(t, execCmd(database, "SET", "k", "v", "PXAT", "-1"), "-ERR invalid expire time in 'set' command\r\n")
+	assertReply(t, execCmd(database, "SET", "k"), "-ERR wrong number of arguments for 'set' command\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "k"), ":0\r\n")
+}
+
+func TestSetGet(t *testing.T) {
+	database := newMemoryDatabase(t)
+	// GET replies the former value, nil if there was none, whether the value is set or not
+	assertReply(t, execCmd(database, "SET", "k", "v1", "GET"), "$-1\r\n")
+	assertReply(t, execCmd(database, "SET", "k", "v2", "NX", "GET"), "$2\r\nv1\r\n")
+	assertReply(t, execCmd(database, "GET", "k"), "$2\r\nv1\r\n")
+	assertReply(t, execCmd(database, "SET", "k", "v3", "GET", "EX", "100"), "$2\r\nv1\r\n")
+	assertReply(t, execCmd(database, "GET", "k"), "$2\r\nv3\r\n")
+
+	// a key of another type is not overwritten
+	execCmd(database, "RPUSH", "l", "a")
+	assertReply(t, execCmd(database, "SET", "l", "v", "GET"), "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+	assertReply(t, execCmd(database, "TYPE", "l"), "+list\r\n")
+	assertReply(t, execCmd(database, "SET", "l", "v"), "+OK\r\n")
+}
+
+func TestSetOptionsAof(t *testing.T) {
+	useTestConfig(t).AppendOnly = true
+	database := newTestDatabase(t)
+	execCmd(database, "SET", "short", "v", "PX", "50")
+	execCmd(database, "SET", "long", "v", "EX", "100", "GET")
+	execCmd(database, "SET", "long", "v2", "KEEPTTL")
+	execCmd(database, "SET", "nx", "v1")
+	execCmd(database, "SET", "nx", "v2", "NX")
+	execCmd(database, "SET", "xx", "v", "XX")
+	_ = database.Close()
+
+	// replaying the log gives the values and deadlines the keys had
+	time.Sleep(100 * time.Millisecond)
+	database = newTestDatabase(t)
+	assertReply(t, execCmd(database, "EXISTS", "short", "xx"), ":0\r\n")
+	assertReply(t, execCmd(database, "GET", "long"), "$2\r\nv2\r\n")
+	if ttl := execCmd(database, "TTL", "long"); ttl != ":100\r\n" && ttl != ":99\r\n" {
+		t.Errorf("expected ttl of long kept, got %q", ttl)
+	}
+	assertReply(t, execCmd(database, "GET", "nx"), "$2\r\nv1\r\n")
+}
+
+func TestSetNXXXExpired(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "SET", "nx", "old", "PX", "20")
+	execCmd(database, "SET", "xx", "old", "PX", "20")
+	time.Sleep(40 * time.Millisecond)
+	assertReply(t, execCmd(database, "SET", "nx", "v", "NX"), "+OK\r\n")
+	assertReply(t, execCmd(database, "TTL", "nx"), ":-1\r\n")
+	assertReply(t, execCmd(database, "SET", "xx", "v", "XX"), "$-1\r\n")
+	assertReply(t, execCmd(database, "EXISTS", "xx"), ":0\r\n")
+}
+
+func TestCounters(t *testing.T) {
+	database := newMemoryDatabase(t)
+	assertReply(t, execCmd(database, "INCR", "n"), ":1\r\n")
+	assertReply(t, execCmd(database, "INCRBY", "n", "10"), ":11\r\n")
+	assertReply(t, execCmd(database, "DECR", "n"), ":10\r\n")
+	assertReply(t, execCmd(database, "DECRBY", "n", "-5"), ":15\r\n")
+	assertReply(t, execCmd(database, "INCRBY", "n", "1.5"), "-ERR value is not an integer or out of range\r\n")
+	assertReply(t, execCmd(database, "DECRBY", "n", "-9223372036854775808"), "-ERR decrement would overflow\r\n")
+
+	// the value must be the canonical form of an integer
+	execCmd(database, "SET", "s", " 1")
+	assertReply(t, execCmd(database, "INCR", "s"), "-ERR value is not an integer or out of range\r\n")
+	execCmd(database, "SET", "max", "9223372036854775807")
+	assertReply(t, execCmd(database, "INCR", "max"), "-ERR increment or decrement would overflow\r\n")
+	execCmd(database, "SET", "min", "-9223372036854775808")
+	assertReply(t, execCmd(database, "DECR", "min"), "-ERR increment or decrement would overflow\r\n")
+
+	assertReply(t, execCmd(database, "INCRBYFLOAT", "f", "10.5"), "$4\r\n10.5\r\n")
+	assertReply(t, execCmd(database, "INCRBYFLOAT", "f", "-0.25"), "$5\r\n10.25\r\n")
+	assertReply(t, execCmd(database, "INCRBYFLOAT", "f", "x"), "-ERR value is not a valid float\r\n")
+	assertReply(t, execCmd(database, "INCRBYFLOAT", "f", "inf"), "-ERR value is not a valid float\r\n")
+
+	// large and small values are formatted with an exponent like %.17g, the others with the digits needed only
+	for _, c := range []struct{ from, incr, expected string }{
+		{"0", "1e300", "1e+300"}, {"0", "-2.5e20", "-2.5e+20"}, {"0", "1e-5", "1e-05"},
+		{"0", "0.00012", "0.00012"}, {"0", "1000000", "1000000"}, {"0", "1e16", "10000000000000000"},
+		{"0", "1e17", "1e+17"}, {"0.2", "0.1", "0.30000000000000004"}, {"0", "-1.23456789e-20", "-1.23456789e-20"},
+	} {
+		execCmd(database, "SET", "g", c.from)
+		assertReply(t, execCmd(database, "INCRBYFLOAT", "g", c.incr), "$"+strconv.Itoa(len(c.expected))+"\r\n"+c.expected+"\r\n")
+	}
+
+	execCmd(database, "RPUSH", "l", "a")
+	assertReply(t, execCmd(database, "INCR", "l"), "-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
+}
+
+func TestCountersKeepTTL(t *testing.T) {
+	database := newMemoryDatabase(t)
+	execCmd(database, "SET", "n", "1", "EX", "100")
+	execCmd(database, "INCR", "n")
+	execCmd(database, "INCRBYFLOAT", "n", "0.5")
+	if ttl := execCmd(database, "TTL", "n"); ttl != ":100\r\n" && ttl != ":99\r\n" {
+		t.Errorf("expected ttl kept by counters, got %q", ttl)
+	}
+}
+
+func TestConcurrentIncr(t *testing.T) {
+	database := newMemoryDatabase(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				execCmd(database, "INCR", "n")
+			}
+		}()
+	}
+	wg.Wait()
+	assertReply(t, execCmd(database, "GET", "n"), "$4\r\n1000\r\n")
+}
+
+func TestCountersAof(t *testing.T) {
+	useTestConfig(t).AppendOnly = true
+	database := newTestDatabase(t)
+	execCmd(database, "INCRBY", "n", "5")
+	execCmd(database, "DECR", "n")
+	execCmd(database, "INCRBYFLOAT", "f", "0.1")
+	execCmd(database, "INCRBYFLOAT", "f", "0.2")
+	_ = database.Close()
+
+	// replaying gives the values the counters had before the restart
+	database = newTestDatabase(t)
+	assertReply(t, execCmd(database, "GET", "n"), "$1\r\n4\r\n")
+	assertReply(t, execCmd(database, "GET", "f"), "$19\r\n0.30000000000000004\r\n")
+}
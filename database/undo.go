@@ -0,0 +1,75 @@
+package database
+
+import (
+	"strings"
+
+	"go-redis/aof"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+
+	databaseface "go-redis/interface/database"
+)
+
+// The methods below let the cluster run a command as part of a transaction spanning nodes:
+// the keys are locked when the transaction is prepared and stay locked until it is committed or rolled back.
+
+// RWLocks locks the keys of the db until RWUnLocks, the barrier is held shared meanwhile
+// so a snapshot contains either all or none of the transaction
+func (database *StandaloneDatabase) RWLocks(dbIndex int, writeKeys []string, readKeys []string) {
+	db := database.dbSet[dbIndex]
+	db.barrier.RLock()
+	db.locker.RWLocks(writeKeys, readKeys)
+}
+
+// RWUnLocks releases the keys locked by RWLocks
+func (database *StandaloneDatabase) RWUnLocks(dbIndex int, writeKeys []string, readKeys []string) {
+	db := database.dbSet[dbIndex]
+	db.locker.RWUnLocks(writeKeys, readKeys)
+	db.barrier.RUnlock()
+}
+
+// ExecWithLock executes a command whose keys are locked by RWLocks
+func (database *StandaloneDatabase) ExecWithLock(c resp.Connection, cmdLine [][]byte) resp.Reply {
+	db := database.dbSet[c.GetDBIndex()]
+	return db.execWithLock(cmdLine)
+}
+
+func (db *DB) execWithLock(cmdLine CmdLine) resp.Reply {
+	cmdName := strings.ToLower(string(cmdLine[0]))
+	cmd, ok := cmdTable[cmdName]
+	if !ok || exclusiveCommands[cmdName] {
+		return reply.MakeStandardErrReply("ERR unknown command " + cmdName)
+	}
+	if !validateArity(cmd.arity, cmdLine) {
+		return reply.MakeArgNumErrReply(cmdName)
+	}
+	writeKeys, _ := cmd.prepare(cmdLine[1:])
+	defer db.addVersion(writeKeys...)
+	db.beforeWrite(writeKeys...)
+	return cmd.executor(db, cmdLine[1:])
+}
+
+// GetUndoLogs returns the commands restoring the keys written by the command to their current values,
+// the caller holds the locks of the keys
+func (database *StandaloneDatabase) GetUndoLogs(dbIndex int, cmdLine [][]byte) []databaseface.CmdLine {
+	cmd, ok := cmdTable[strings.ToLower(string(cmdLine[0]))]
+	if !ok || !validateArity(cmd.arity, cmdLine) {
+		return nil
+	}
+	db := database.dbSet[dbIndex]
+	writeKeys, _ := cmd.prepare(cmdLine[1:])
+	var undoLogs []databaseface.CmdLine
+	for _, key := range writeKeys {
+		undoLogs = append(undoLogs, utils.ToCmdLine("del", key))
+		entity, exists := db.GetEntity(key)
+		if !exists {
+			continue
+		}
+		undoLogs = append(undoLogs, aof.EntityToCmd(key, entity))
+		if expireTime, ok := db.ExpireTime(key); ok {
+			undoLogs = append(undoLogs, aof.MakeExpireCmd(key, expireTime))
+		}
+	}
+	return undoLogs
+}
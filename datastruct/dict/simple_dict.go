@@ -0,0 +1,106 @@
+package dict
+
+import "math/rand"
+
+// SimpleDict wraps a map, it is not thread safe
+// it is used to store values of a single key, like fields of a hash, which are guarded by the key
+type SimpleDict struct {
+	m map[string]interface{}
+}
+
+// MakeSimpleDict makes a new SimpleDict
+func MakeSimpleDict() *SimpleDict {
+	return &SimpleDict{
+		m: make(map[string]interface{}),
+	}
+}
+
+func (dict *SimpleDict) Get(key string) (val interface{}, exists bool) {
+	val, exists = dict.m[key]
+	return
+}
+
+func (dict *SimpleDict) Len() int {
+	return len(dict.m)
+}
+
+func (dict *SimpleDict) Put(key string, val interface{}) (result int) {
+	_, existed := dict.m[key]
+	dict.m[key] = val
+	if existed {
+		return 0
+	}
+	return 1
+}
+
+func (dict *SimpleDict) PutIfAbsent(key string, val interface{}) (result int) {
+	if _, existed := dict.m[key]; existed {
+		return 0
+	}
+	dict.m[key] = val
+	return 1
+}
+
+func (dict *SimpleDict) PutIfExists(key string, val interface{}) (result int) {
+	if _, existed := dict.m[key]; !existed {
+		return 0
+	}
+	dict.m[key] = val
+	return 1
+}
+
+func (dict *SimpleDict) Remove(key string) (result int) {
+	if _, existed := dict.m[key]; !existed {
+		return 0
+	}
+	delete(dict.m, key)
+	return 1
+}
+
+func (dict *SimpleDict) Foreach(consumer Consumer) {
+	for k, v := range dict.m {
+		if !consumer(k, v) {
+			break
+		}
+	}
+}
+
+func (dict *SimpleDict) Keys() []string {
+	keys := make([]string, 0, len(dict.m))
+	for k := range dict.m {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// RandomKeys returns keys at random, the same key may be returned more than once
+func (dict *SimpleDict) RandomKeys(limit int) []string {
+	if limit <= 0 || len(dict.m) == 0 {
+		return nil
+	}
+	keys := dict.Keys()
+	result := make([]string, limit)
+	for i := range result {
+		result[i] = keys[rand.Intn(len(keys))]
+	}
+	return result
+}
+
+// RandomDistinctKeys returns at most limit distinct keys at random
+func (dict *SimpleDict) RandomDistinctKeys(limit int) []string {
+	if limit <= 0 {
+		return nil
+	}
+	keys := dict.Keys()
+	rand.Shuffle(len(keys), func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+	if limit < len(keys) {
+		keys = keys[:limit]
+	}
+	return keys
+}
+
+func (dict *SimpleDict) Clear() {
+	*dict = *MakeSimpleDict()
+}
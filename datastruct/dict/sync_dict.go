@@ -106,7 +106,7 @@ func (dict *SyncDict) RandomDistinctKeys(limit int) []string {
 		}
 		return true
 	})
-	return result
+	return result[:i]
 }
 
 func (dict *SyncDict) Clear() {
@@ -0,0 +1,152 @@
+package list
+
+import (
+	"math/rand"
+	"testing"
+)
+
+// assertList compares the list with the expected elements through Len, Get, ForEach and Range
+func assertList(t *testing.T, ql *QuickList, expected []int) {
+	t.Helper()
+	if ql.Len() != len(expected) {
+		t.Fatalf("expected len %d, got %d", len(expected), ql.Len())
+	}
+	ql.ForEach(func(i int, v interface{}) bool {
+		if v.(int) != expected[i] {
+			t.Fatalf("expected %d at %d, got %d", expected[i], i, v)
+		}
+		return true
+	})
+	if len(expected) == 0 {
+		return
+	}
+	i := rand.Intn(len(expected))
+	if v := ql.Get(i).(int); v != expected[i] {
+		t.Fatalf("expected %d at %d, got %d", expected[i], i, v)
+	}
+	start := rand.Intn(len(expected))
+	stop := start + rand.Intn(len(expected)-start+1)
+	for j, v := range ql.Range(start, stop) {
+		if v.(int) != expected[start+j] {
+			t.Fatalf("expected %d at %d, got %d", expected[start+j], start+j, v)
+		}
+	}
+}
+
+func TestQuickListAddRemove(t *testing.T) {
+	ql := NewQuickList()
+	var expected []int
+	for i := 0; i < 3*pageSize; i++ {
+		ql.Add(i)
+		expected = append(expected, i)
+	}
+	assertList(t, ql, expected)
+	for i := 0; i < pageSize+10; i++ {
+		if v := ql.RemoveLast().(int); v != expected[len(expected)-1] {
+			t.Fatalf("expected last %d, got %d", expected[len(expected)-1], v)
+		}
+		expected = expected[:len(expected)-1]
+	}
+	assertList(t, ql, expected)
+	for len(expected) > 0 {
+		ql.Remove(0)
+		expected = expected[1:]
+	}
+	assertList(t, ql, expected)
+	if ql.RemoveLast() != nil {
+		t.Error("expected nil from an empty list")
+	}
+}
+
+// TestQuickListRandomOps applies random operations spanning several pages to the list and to a slice
+func TestQuickListRandomOps(t *testing.T) {
+	rand.Seed(1)
+	ql := NewQuickList()
+	var expected []int
+	// full pages are split by inserts
+	for i := 0; i < 3*pageSize; i++ {
+		v := rand.Intn(100)
+		ql.Add(v)
+		expected = append(expected, v)
+	}
+	for round := 0; round < 20000; round++ {
+		size := len(expected)
+		switch op := rand.Intn(10); {
+		case op < 5 || size == 0:
+			i := rand.Intn(size + 1)
+			v := rand.Intn(100)
+			ql.Insert(i, v)
+			expected = append(expected[:i], append([]int{v}, expected[i:]...)...)
+		case op < 6:
+			i := rand.Intn(size)
+			if v := ql.Remove(i).(int); v != expected[i] {
+				t.Fatalf("expected to remove %d at %d, got %d", expected[i], i, v)
+			}
+			expected = append(expected[:i], expected[i+1:]...)
+		case op < 8:
+			i := rand.Intn(size)
+			v := rand.Intn(100)
+			ql.Set(i, v)
+			expected[i] = v
+		default:
+			v, count := rand.Intn(100), 1+rand.Intn(3)
+			equals := func(a interface{}) bool { return a.(int) == v }
+			var removed int
+			if op == 8 {
+				removed = ql.RemoveByVal(equals, count)
+				expected = removeInts(expected, v, count, false)
+			} else {
+				removed = ql.ReverseRemoveByVal(equals, count)
+				expected = removeInts(expected, v, count, true)
+			}
+			if removed != size-len(expected) {
+				t.Fatalf("expected %d removed, got %d", size-len(expected), removed)
+			}
+		}
+		if round%500 == 0 {
+			assertList(t, ql, expected)
+		}
+	}
+	assertList(t, ql, expected)
+
+	v := expected[0]
+	want := 0
+	for _, e := range expected {
+		if e == v {
+			want++
+		}
+	}
+	if removed := ql.RemoveAllByVal(func(a interface{}) bool { return a.(int) == v }); removed != want {
+		t.Fatalf("expected %d removed, got %d", want, removed)
+	}
+	if ql.Contains(func(a interface{}) bool { return a.(int) == v }) {
+		t.Fatalf("expected no %d left", v)
+	}
+}
+
+// removeInts removes at most count elements equal to v from the head, or from the tail if reverse is set
+func removeInts(s []int, v int, count int, reverse bool) []int {
+	result := make([]int, 0, len(s))
+	removed := 0
+	if !reverse {
+		for _, e := range s {
+			if e == v && removed < count {
+				removed++
+				continue
+			}
+			result = append(result, e)
+		}
+		return result
+	}
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == v && removed < count {
+			removed++
+			continue
+		}
+		result = append(result, s[i])
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
@@ -0,0 +1,49 @@
+package set
+
+import "sort"
+
+// intSet is a sorted slice of integers, it is compact and keeps members ordered
+type intSet struct {
+	members []int64
+}
+
+func makeIntSet() *intSet {
+	return &intSet{}
+}
+
+// search returns the index of val, or the index to insert val if it does not exist
+func (s *intSet) search(val int64) (int, bool) {
+	i := sort.Search(len(s.members), func(i int) bool {
+		return s.members[i] >= val
+	})
+	return i, i < len(s.members) && s.members[i] == val
+}
+
+func (s *intSet) add(val int64) int {
+	i, exists := s.search(val)
+	if exists {
+		return 0
+	}
+	s.members = append(s.members, 0)
+	copy(s.members[i+1:], s.members[i:])
+	s.members[i] = val
+	return 1
+}
+
+func (s *intSet) remove(val int64) int {
+	i, exists := s.search(val)
+	if !exists {
+		return 0
+	}
+	s.members = append(s.members[:i], s.members[i+1:]...)
+	return 1
+}
+
+func (s *intSet) has(val int64) bool {
+	_, exists := s.search(val)
+	return exists
+}
+
+func (s *intSet) len() int {
+	return len(s.members)
+}
@@ -0,0 +1,195 @@
+package set
+
+import (
+	"math/rand"
+	"strconv"
+
+	"go-redis/datastruct/dict"
+)
+
+// maxIntSetEntries is the max size of a set encoded as intset, like set-max-intset-entries of redis
+const maxIntSetEntries = 512
+
+// Set is a set of strings, it is not thread safe.
+// a set holding only integers is encoded as a compact intset,
+// it is upgraded to a hash set once a non integer member is added or it grows too large
+type Set struct {
+	ints *intSet   // not nil while the set is encoded as intset
+	dict dict.Dict // member -> struct{}{}, used after upgrading
+}
+
+// Make creates a new set with the given members
+func Make(members ...string) *Set {
+	set := &Set{
+		ints: makeIntSet(),
+	}
+	for _, member := range members {
+		set.Add(member)
+	}
+	return set
+}
+
+// toInt returns the integer represented by member,
+// ok is false unless member is the canonical form of the integer, e.g. "01" is not an integer member
+func toInt(member string) (int64, bool) {
+	val, err := strconv.ParseInt(member, 10, 64)
+	if err != nil || strconv.FormatInt(val, 10) != member {
+		return 0, false
+	}
+	return val, true
+}
+
+// upgrade converts the intset encoding to the hash set encoding
+func (set *Set) upgrade() {
+	set.dict = dict.MakeSimpleDict()
+	for _, val := range set.ints.members {
+		set.dict.Put(strconv.FormatInt(val, 10), struct{}{})
+	}
+	set.ints = nil
+}
+
+// IsIntSet returns whether the set is encoded as intset
+func (set *Set) IsIntSet() bool {
+	return set.ints != nil
+}
+
+// Add adds member into set, returns 1 if member is new
+func (set *Set) Add(member string) int {
+	if set.ints != nil {
+		if val, ok := toInt(member); ok {
+			if set.ints.has(val) {
+				return 0
+			}
+			if set.ints.len() < maxIntSetEntries {
+				return set.ints.add(val)
+			}
+		}
+		set.upgrade()
+	}
+	return set.dict.Put(member, struct{}{})
+}
+
+// Remove removes member from set, returns 1 if member existed
+func (set *Set) Remove(member string) int {
+	if set.ints != nil {
+		val, ok := toInt(member)
+		if !ok {
+			return 0
+		}
+		return set.ints.remove(val)
+	}
+	return set.dict.Remove(member)
+}
+
+// Has returns whether member is in set
+func (set *Set) Has(member string) bool {
+	if set.ints != nil {
+		val, ok := toInt(member)
+		return ok && set.ints.has(val)
+	}
+	_, exists := set.dict.Get(member)
+	return exists
+}
+
+// Len returns the number of members
+func (set *Set) Len() int {
+	if set.ints != nil {
+		return set.ints.len()
+	}
+	return set.dict.Len()
+}
+
+// ForEach visits each member in the set, stops if consumer returns false
+func (set *Set) ForEach(consumer func(member string) bool) {
+	if set.ints != nil {
+		for _, val := range set.ints.members {
+			if !consumer(strconv.FormatInt(val, 10)) {
+				return
+			}
+		}
+		return
+	}
+	set.dict.Foreach(func(key string, val interface{}) bool {
+		return consumer(key)
+	})
+}
+
+// ToSlice returns all members
+func (set *Set) ToSlice() []string {
+	members := make([]string, 0, set.Len())
+	set.ForEach(func(member string) bool {
+		members = append(members, member)
+		return true
+	})
+	return members
+}
+
+// Intersect returns members which are in both set and another
+func (set *Set) Intersect(another *Set) *Set {
+	result := Make()
+	small, large := set, another
+	if small.Len() > large.Len() {
+		small, large = large, small
+	}
+	small.ForEach(func(member string) bool {
+		if large.Has(member) {
+			result.Add(member)
+		}
+		return true
+	})
+	return result
+}
+
+// Union returns members which are in set or another
+func (set *Set) Union(another *Set) *Set {
+	result := Make()
+	set.ForEach(func(member string) bool {
+		result.Add(member)
+		return true
+	})
+	another.ForEach(func(member string) bool {
+		result.Add(member)
+		return true
+	})
+	return result
+}
+
+// Diff returns members which are in set but not in another
+func (set *Set) Diff(another *Set) *Set {
+	result := Make()
+	set.ForEach(func(member string) bool {
+		if !another.Has(member) {
+			result.Add(member)
+		}
+		return true
+	})
+	return result
+}
+
+// RandomMembers returns members at random, the same member may be returned more than once
+func (set *Set) RandomMembers(limit int) []string {
+	if limit <= 0 || set.Len() == 0 {
+		return nil
+	}
+	members := set.ToSlice()
+	result := make([]string, limit)
+	for i := range result {
+		result[i] = members[rand.Intn(len(members))]
+	}
+	return result
+}
+
+// RandomDistinctMembers returns at most limit distinct members at random
+func (set *Set) RandomDistinctMembers(limit int) []string {
+	if limit <= 0 {
+		return nil
+	}
+	members := set.ToSlice()
+	rand.Shuffle(len(members), func(i, j int) {
+		members[i], members[j] = members[j], members[i]
+	})
+	if limit < len(members) {
+		members = members[:limit]
+	}
+	return members
+}
@@ -0,0 +1,96 @@
+package set
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func TestIntSetEncoding(t *testing.T) {
+	set := Make("3", "1", "2", "1")
+	if !set.IsIntSet() || set.Len() != 3 {
+		t.Fatalf("expected an intset of 3 members, got intset %v of %d", set.IsIntSet(), set.Len())
+	}
+	if members := set.ToSlice(); members[0] != "1" || members[1] != "2" || members[2] != "3" {
+		t.Errorf("expected ordered members, got %v", members)
+	}
+	// "01" is not the canonical form of 1
+	if set.Has("01") || set.Remove("01") != 0 {
+		t.Error("expected 01 not to be a member")
+	}
+	if set.Remove("2") != 1 || set.Has("2") || set.Len() != 2 {
+		t.Error("expected 2 removed")
+	}
+
+	set.Add("01")
+	if set.IsIntSet() {
+		t.Fatal("expected the set upgraded by a non integer member")
+	}
+	for _, member := range []string{"1", "3", "01"} {
+		if !set.Has(member) {
+			t.Errorf("expected %s kept by the upgrade", member)
+		}
+	}
+}
+
+func TestIntSetUpgradeBySize(t *testing.T) {
+	set := Make()
+	for i := 0; i < maxIntSetEntries; i++ {
+		set.Add(strconv.Itoa(i))
+	}
+	if !set.IsIntSet() {
+		t.Fatalf("expected an intset of %d members", maxIntSetEntries)
+	}
+	// adding an existing member does not upgrade
+	if set.Add("0") != 0 || !set.IsIntSet() {
+		t.Fatal("expected the intset unchanged")
+	}
+	if set.Add("-1") != 1 || set.IsIntSet() {
+		t.Fatal("expected the set upgraded once it grows too large")
+	}
+	if set.Len() != maxIntSetEntries+1 || !set.Has("-1") || !set.Has("511") {
+		t.Errorf("expected all members kept, got %d", set.Len())
+	}
+}
+
+func TestSetOperations(t *testing.T) {
+	a := Make("1", "2", "3", "x")
+	b := Make("2", "3", "4")
+	assertMembers(t, a.Intersect(b), "2", "3")
+	assertMembers(t, a.Union(b), "1", "2", "3", "4", "x")
+	assertMembers(t, a.Diff(b), "1", "x")
+	assertMembers(t, b.Diff(a), "4")
+	if !a.Intersect(b).IsIntSet() {
+		t.Error("expected the intersection of integers to be an intset")
+	}
+}
+
+func TestRandomMembers(t *testing.T) {
+	set := Make("a", "b", "c")
+	members := set.RandomDistinctMembers(5)
+	sort.Strings(members)
+	if len(members) != 3 || members[0] != "a" || members[1] != "b" || members[2] != "c" {
+		t.Errorf("expected each member once, got %v", members)
+	}
+	if members := set.RandomMembers(5); len(members) != 5 {
+		t.Errorf("expected 5 members, got %v", members)
+	}
+	if members := Make().RandomMembers(5); len(members) != 0 {
+		t.Errorf("expected no member of an empty set, got %v", members)
+	}
+}
+
+func assertMembers(t *testing.T, set *Set, expected ...string) {
+	t.Helper()
+	members := set.ToSlice()
+	sort.Strings(members)
+	sort.Strings(expected)
+	if len(members) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, members)
+	}
+	for i := range members {
+		if members[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, members)
+		}
+	}
+}
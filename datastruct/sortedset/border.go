@@ -0,0 +1,181 @@
+package sortedset
+
+import (
+	"errors"
+	"math"
+	"strconv"
+)
+
+/*
+ * Border is the boundary of a range of elements, a range is [min, max].
+ * ScoreBorder compares scores, e.g. "(1.5", "-inf", "+inf".
+ * LexBorder compares members of elements with the same score, e.g. "[a", "(b", "-", "+".
+ */
+
+const (
+	negativeInf int8 = -1
+	positiveInf int8 = 1
+)
+
+// Border is the boundary of a range
+type Border interface {
+	// greater returns whether element is below the border when the border is used as min
+	greater(element *Element) bool
+	// less returns whether element is above the border when the border is used as max
+	less(element *Element) bool
+	getInf() int8
+	getExclude() bool
+}
+
+// ScoreBorder represents range of a float value, including: <, <=, >, >=, +inf, -inf
+type ScoreBorder struct {
+	Inf     int8
+	Value   float64
+	Exclude bool
+}
+
+func (border *ScoreBorder) greater(element *Element) bool {
+	if border.Inf == negativeInf {
+		return false
+	} else if border.Inf == positiveInf {
+		return true
+	}
+	if border.Exclude {
+		return border.Value >= element.Score
+	}
+	return border.Value > element.Score
+}
+
+func (border *ScoreBorder) less(element *Element) bool {
+	if border.Inf == negativeInf {
+		return true
+	} else if border.Inf == positiveInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value <= element.Score
+	}
+	return border.Value < element.Score
+}
+
+func (border *ScoreBorder) getInf() int8 {
+	return border.Inf
+}
+
+func (border *ScoreBorder) getExclude() bool {
+	return border.Exclude
+}
+
+var scorePositiveInfBorder = &ScoreBorder{
+	Inf: positiveInf,
+}
+
+var scoreNegativeInfBorder = &ScoreBorder{
+	Inf: negativeInf,
+}
+
+// ErrInvalidScoreBorder is returned while parsing an invalid score border
+var ErrInvalidScoreBorder = errors.New("ERR min or max is not a float")
+
+// ParseScoreBorder creates ScoreBorder from redis arguments
+func ParseScoreBorder(s string) (Border, error) {
+	if s == "inf" || s == "+inf" {
+		return scorePositiveInfBorder, nil
+	}
+	if s == "-inf" {
+		return scoreNegativeInfBorder, nil
+	}
+	exclude := false
+	if len(s) > 0 && s[0] == '(' {
+		exclude = true
+		s = s[1:]
+	}
+	value, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(value) {
+		return nil, ErrInvalidScoreBorder
+	}
+	return &ScoreBorder{
+		Value:   value,
+		Exclude: exclude,
+	}, nil
+}
+
+// LexBorder represents range of a string value, including: <, <=, >, >=, +, -
+type LexBorder struct {
+	Inf     int8
+	Value   string
+	Exclude bool
+}
+
+func (border *LexBorder) greater(element *Element) bool {
+	if border.Inf == negativeInf {
+		return false
+	} else if border.Inf == positiveInf {
+		return true
+	}
+	if border.Exclude {
+		return border.Value >= element.Member
+	}
+	return border.Value > element.Member
+}
+
+func (border *LexBorder) less(element *Element) bool {
+	if border.Inf == negativeInf {
+		return true
+	} else if border.Inf == positiveInf {
+		return false
+	}
+	if border.Exclude {
+		return border.Value <= element.Member
+	}
+	return border.Value < element.Member
+}
+
+func (border *LexBorder) getInf() int8 {
+	return border.Inf
+}
+
+func (border *LexBorder) getExclude() bool {
+	return border.Exclude
+}
+
+// ErrInvalidLexBorder is returned while parsing an invalid lex border
+var ErrInvalidLexBorder = errors.New("ERR min or max not valid string range item")
+
+// ParseLexBorder creates LexBorder from redis arguments
+func ParseLexBorder(s string) (Border, error) {
+	if s == "+" {
+		return &LexBorder{Inf: positiveInf}, nil
+	}
+	if s == "-" {
+		return &LexBorder{Inf: negativeInf}, nil
+	}
+	if len(s) == 0 || (s[0] != '(' && s[0] != '[') {
+		return nil, ErrInvalidLexBorder
+	}
+	return &LexBorder{
+		Value:   s[1:],
+		Exclude: s[0] == '(',
+	}, nil
+}
+
+// isEmptyRange returns whether no element could be within [min, max]
+func isEmptyRange(min Border, max Border) bool {
+	if min.getInf() == positiveInf || max.getInf() == negativeInf {
+		return true
+	}
+	if min.getInf() == negativeInf || max.getInf() == positiveInf {
+		return false
+	}
+	switch minBorder := min.(type) {
+	case *ScoreBorder:
+		maxBorder := max.(*ScoreBorder)
+		return minBorder.Value > maxBorder.Value ||
+			(minBorder.Value == maxBorder.Value && (minBorder.Exclude || maxBorder.Exclude))
+	case *LexBorder:
+		maxBorder := max.(*LexBorder)
+		return minBorder.Value > maxBorder.Value ||
+			(minBorder.Value == maxBorder.Value && (minBorder.Exclude || maxBorder.Exclude))
+	}
+	return false
+}
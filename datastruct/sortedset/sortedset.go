@@ -0,0 +1,232 @@
+package sortedset
+
+import "strconv"
+
+// SortedSet is a set of members ordered by score, it is not thread safe.
+// dict finds the score of a member in O(1), skiplist keeps elements ordered
+type SortedSet struct {
+	dict     map[string]*Element
+	skiplist *skiplist
+}
+
+// Make makes a new SortedSet
+func Make() *SortedSet {
+	return &SortedSet{
+		dict:     make(map[string]*Element),
+		skiplist: makeSkiplist(),
+	}
+}
+
+// Add puts member into set, returns whether member is new
+func (sortedSet *SortedSet) Add(member string, score float64) bool {
+	element, ok := sortedSet.dict[member]
+	sortedSet.dict[member] = &Element{
+		Member: member,
+		Score:  score,
+	}
+	if ok {
+		if score != element.Score {
+			sortedSet.skiplist.remove(member, element.Score)
+			sortedSet.skiplist.insert(member, score)
+		}
+		return false
+	}
+	sortedSet.skiplist.insert(member, score)
+	return true
+}
+
+// Len returns number of members in set
+func (sortedSet *SortedSet) Len() int64 {
+	return int64(len(sortedSet.dict))
+}
+
+// Get returns the given member
+func (sortedSet *SortedSet) Get(member string) (element *Element, ok bool) {
+	element, ok = sortedSet.dict[member]
+	if !ok {
+		return nil, false
+	}
+	return element, true
+}
+
+// Remove removes the given member from set
+func (sortedSet *SortedSet) Remove(member string) bool {
+	v, ok := sortedSet.dict[member]
+	if ok {
+		sortedSet.skiplist.remove(member, v.Score)
+		delete(sortedSet.dict, member)
+		return true
+	}
+	return false
+}
+
+// GetRank returns the 0-based rank of the given member, sort by ascending order, rank starts from 0
+func (sortedSet *SortedSet) GetRank(member string, desc bool) (rank int64) {
+	element, ok := sortedSet.dict[member]
+	if !ok {
+		return -1
+	}
+	r := sortedSet.skiplist.getRank(member, element.Score)
+	if desc {
+		r = sortedSet.skiplist.length - r
+	} else {
+		r--
+	}
+	return r
+}
+
+// ForEachByRank visits each member which rank within [start, stop), sort by ascending order, rank starts from 0
+func (sortedSet *SortedSet) ForEachByRank(start int64, stop int64, desc bool, consumer func(element *Element) bool) {
+	size := sortedSet.Len()
+	if start < 0 || start > size {
+		panic("illegal start " + strconv.FormatInt(start, 10))
+	}
+	if stop < start || stop > size {
+		panic("illegal end " + strconv.FormatInt(stop, 10))
+	}
+
+	// find start node
+	var n *node
+	if desc {
+		n = sortedSet.skiplist.tail
+		if start > 0 {
+			n = sortedSet.skiplist.getByRank(size - start)
+		}
+	} else {
+		n = sortedSet.skiplist.header.level[0].forward
+		if start > 0 {
+			n = sortedSet.skiplist.getByRank(start + 1)
+		}
+	}
+
+	sliceSize := int(stop - start)
+	for i := 0; i < sliceSize; i++ {
+		if !consumer(&n.Element) {
+			break
+		}
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+	}
+}
+
+// RangeByRank returns members which rank within [start, stop), sort by ascending order, rank starts from 0
+func (sortedSet *SortedSet) RangeByRank(start int64, stop int64, desc bool) []*Element {
+	sliceSize := int(stop - start)
+	slice := make([]*Element, sliceSize)
+	i := 0
+	sortedSet.ForEachByRank(start, stop, desc, func(element *Element) bool {
+		slice[i] = element
+		i++
+		return true
+	})
+	return slice
+}
+
+// RangeCount returns the number of members which score or member within the given border
+func (sortedSet *SortedSet) RangeCount(min Border, max Border) int64 {
+	first := sortedSet.skiplist.getFirstInRange(min, max)
+	if first == nil {
+		return 0
+	}
+	last := sortedSet.skiplist.getLastInRange(min, max)
+	return sortedSet.skiplist.getRank(last.Member, last.Score) - sortedSet.skiplist.getRank(first.Member, first.Score) + 1
+}
+
+// ForEach visits members which score or member within the given border, limit < 0 means no limit
+func (sortedSet *SortedSet) ForEach(min Border, max Border, offset int64, limit int64, desc bool, consumer func(element *Element) bool) {
+	// find start node
+	var n *node
+	if desc {
+		n = sortedSet.skiplist.getLastInRange(min, max)
+	} else {
+		n = sortedSet.skiplist.getFirstInRange(min, max)
+	}
+
+	for n != nil && offset > 0 {
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+		offset--
+	}
+
+	// A negative limit returns all elements from the offset
+	for i := 0; (i < int(limit) || limit < 0) && n != nil; i++ {
+		if min.greater(&n.Element) || max.less(&n.Element) {
+			break // break through score border
+		}
+		if !consumer(&n.Element) {
+			break
+		}
+		if desc {
+			n = n.backward
+		} else {
+			n = n.level[0].forward
+		}
+	}
+}
+
+// Range returns members which score or member within the given border
+// param limit: < 0 means no limit
+func (sortedSet *SortedSet) Range(min Border, max Border, offset int64, limit int64, desc bool) []*Element {
+	if limit == 0 || offset < 0 {
+		return make([]*Element, 0)
+	}
+	slice := make([]*Element, 0)
+	sortedSet.ForEach(min, max, offset, limit, desc, func(element *Element) bool {
+		slice = append(slice, element)
+		return true
+	})
+	return slice
+}
+
+// RemoveRange removes members which score or member within the given border
+func (sortedSet *SortedSet) RemoveRange(min Border, max Border) int64 {
+	removed := sortedSet.skiplist.removeRange(min, max, 0)
+	for _, element := range removed {
+		delete(sortedSet.dict, element.Member)
+	}
+	return int64(len(removed))
+}
+
+// PopMin removes and returns at most count members with the lowest scores
+func (sortedSet *SortedSet) PopMin(count int) []*Element {
+	first := sortedSet.skiplist.header.level[0].forward
+	if first == nil {
+		return nil
+	}
+	border := &ScoreBorder{
+		Value:   first.Score,
+		Exclude: false,
+	}
+	removed := sortedSet.skiplist.removeRange(border, scorePositiveInfBorder, count)
+	for _, element := range removed {
+		delete(sortedSet.dict, element.Member)
+	}
+	return removed
+}
+
+// PopMax removes and returns at most count members with the highest scores
+func (sortedSet *SortedSet) PopMax(count int) []*Element {
+	removed := make([]*Element, 0)
+	for n := sortedSet.skiplist.tail; n != nil && len(removed) < count; n = sortedSet.skiplist.tail {
+		element := n.Element
+		sortedSet.Remove(element.Member)
+		removed = append(removed, &element)
+	}
+	return removed
+}
+
+// RemoveByRank removes member ranking within [start, stop)
+// sort by ascending order and rank starts from 0
+func (sortedSet *SortedSet) RemoveByRank(start int64, stop int64) int64 {
+	removed := sortedSet.skiplist.removeRangeByRank(start+1, stop+1)
+	for _, element := range removed {
+		delete(sortedSet.dict, element.Member)
+	}
+	return int64(len(removed))
+}
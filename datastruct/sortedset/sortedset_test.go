@@ -0,0 +1,153 @@
+package sortedset
+
+import (
+	"math/rand"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// sortedElements returns the members of the map ordered by score, then by member
+func sortedElements(scores map[string]float64) []Element {
+	elements := make([]Element, 0, len(scores))
+	for member, score := range scores {
+		elements = append(elements, Element{Member: member, Score: score})
+	}
+	sort.Slice(elements, func(i, j int) bool {
+		return lessThan(elements[i].Score, elements[i].Member, elements[j].Score, elements[j].Member)
+	})
+	return elements
+}
+
+func assertElements(t *testing.T, actual []*Element, expected []Element) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d elements, got %d", len(expected), len(actual))
+	}
+	for i := range actual {
+		if *actual[i] != expected[i] {
+			t.Fatalf("expected %v at %d, got %v", expected[i], i, *actual[i])
+		}
+	}
+}
+
+func reversed(elements []Element) []Element {
+	result := make([]Element, len(elements))
+	for i, element := range elements {
+		result[len(elements)-1-i] = element
+	}
+	return result
+}
+
+// TestSkiplistRandomOps compares the ranks and ranges of the sorted set with a sorted slice
+func TestSkiplistRandomOps(t *testing.T) {
+	rand.Seed(1)
+	sortedSet := Make()
+	scores := make(map[string]float64)
+	for round := 0; round < 5000; round++ {
+		member := "m" + strconv.Itoa(rand.Intn(300))
+		if rand.Intn(4) == 0 {
+			_, exists := scores[member]
+			if sortedSet.Remove(member) != exists {
+				t.Fatalf("expected Remove(%s) to return %v", member, exists)
+			}
+			delete(scores, member)
+			continue
+		}
+		score := float64(rand.Intn(50))
+		_, exists := scores[member]
+		if sortedSet.Add(member, score) == exists {
+			t.Fatalf("expected Add(%s) to return %v", member, !exists)
+		}
+		scores[member] = score
+	}
+
+	expected := sortedElements(scores)
+	size := int64(len(expected))
+	if sortedSet.Len() != size {
+		t.Fatalf("expected len %d, got %d", size, sortedSet.Len())
+	}
+	for i, element := range expected {
+		if rank := sortedSet.GetRank(element.Member, false); rank != int64(i) {
+			t.Fatalf("expected rank %d of %s, got %d", i, element.Member, rank)
+		}
+		if rank := sortedSet.GetRank(element.Member, true); rank != size-1-int64(i) {
+			t.Fatalf("expected reverse rank %d of %s, got %d", size-1-int64(i), element.Member, rank)
+		}
+	}
+	if sortedSet.GetRank("none", false) != -1 {
+		t.Error("expected rank -1 of a missing member")
+	}
+	assertElements(t, sortedSet.RangeByRank(10, 20, false), expected[10:20])
+	assertElements(t, sortedSet.RangeByRank(0, size, true), reversed(expected))
+
+	// scores in [10, 20)
+	min, _ := ParseScoreBorder("10")
+	max, _ := ParseScoreBorder("(20")
+	var inRange []Element
+	for _, element := range expected {
+		if element.Score >= 10 && element.Score < 20 {
+			inRange = append(inRange, element)
+		}
+	}
+	if count := sortedSet.RangeCount(min, max); count != int64(len(inRange)) {
+		t.Fatalf("expected %d in range, got %d", len(inRange), count)
+	}
+	assertElements(t, sortedSet.Range(min, max, 0, -1, false), inRange)
+	assertElements(t, sortedSet.Range(min, max, 2, 3, false), inRange[2:5])
+	assertElements(t, sortedSet.Range(min, max, 0, -1, true), reversed(inRange))
+
+	if removed := sortedSet.RemoveRange(min, max); removed != int64(len(inRange)) {
+		t.Fatalf("expected %d removed, got %d", len(inRange), removed)
+	}
+	for _, element := range inRange {
+		delete(scores, element.Member)
+	}
+	expected = sortedElements(scores)
+	assertElements(t, sortedSet.RangeByRank(0, sortedSet.Len(), false), expected)
+
+	assertElements(t, sortedSet.PopMin(3), expected[:3])
+	assertElements(t, sortedSet.PopMax(2), reversed(expected[len(expected)-2:]))
+	expected = expected[3 : len(expected)-2]
+	if removed := sortedSet.RemoveByRank(5, 15); removed != 10 {
+		t.Fatalf("expected 10 removed by rank, got %d", removed)
+	}
+	expected = append(expected[:5:5], expected[15:]...)
+	assertElements(t, sortedSet.RangeByRank(0, sortedSet.Len(), false), expected)
+	for _, element := range expected {
+		if e, ok := sortedSet.Get(element.Member); !ok || *e != element {
+			t.Fatalf("expected %v kept", element)
+		}
+	}
+}
+
+func TestLexRange(t *testing.T) {
+	sortedSet := Make()
+	for _, member := range []string{"a", "b", "c", "d", "e"} {
+		sortedSet.Add(member, 0)
+	}
+	min, _ := ParseLexBorder("(b")
+	max, _ := ParseLexBorder("[d")
+	assertElements(t, sortedSet.Range(min, max, 0, -1, false), []Element{{"c", 0}, {"d", 0}})
+	min, _ = ParseLexBorder("-")
+	max, _ = ParseLexBorder("(c")
+	if count := sortedSet.RangeCount(min, max); count != 2 {
+		t.Errorf("expected 2 members before c, got %d", count)
+	}
+	if _, err := ParseLexBorder("b"); err == nil {
+		t.Error("expected a lex border without [ or ( to be invalid")
+	}
+}
+
+func TestParseScoreBorder(t *testing.T) {
+	for _, s := range []string{"1.5", "(1.5", "-inf", "+inf", "inf"} {
+		if _, err := ParseScoreBorder(s); err != nil {
+			t.Errorf("expected %s to be valid, got %v", s, err)
+		}
+	}
+	for _, s := range []string{"", "(", "x", "nan"} {
+		if _, err := ParseScoreBorder(s); err != ErrInvalidScoreBorder {
+			t.Errorf("expected %q to be invalid", s)
+		}
+	}
+}
@@ -2,7 +2,11 @@
 // @description redis core service
 package database
 
-import "go-redis/interface/resp"
+import (
+	"time"
+
+	"go-redis/interface/resp"
+)
 
 type CmdLine = [][]byte
 
@@ -12,6 +16,21 @@ type Database interface {
 	AfterClientClose(client resp.Connection) error
 }
 
+// DBEngine is a Database whose data can be visited directly, e.g. while rewriting aof
+type DBEngine interface {
+	Database
+	// ForEach visits the keys of the db which are not expired, expiration is nil if the key has no ttl
+	ForEach(dbIndex int, cb func(key string, data *DataEntity, expiration *time.Time) bool)
+	// RWLocks locks the keys of the db until RWUnLocks, so a transaction spanning nodes can execute
+	// its command by ExecWithLock once every node is prepared
+	RWLocks(dbIndex int, writeKeys []string, readKeys []string)
+	RWUnLocks(dbIndex int, writeKeys []string, readKeys []string)
+	// ExecWithLock executes a command whose keys are locked by RWLocks
+	ExecWithLock(client resp.Connection, cmdLine [][]byte) resp.Reply
+	// GetUndoLogs returns the commands restoring the keys written by the command to their current values
+	GetUndoLogs(dbIndex int, cmdLine [][]byte) []CmdLine
+}
+
 // DataEntity represents redis data structure
 type DataEntity struct {
 	Data interface{} // string, hash, list, set, sorted set
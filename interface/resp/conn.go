@@ -5,4 +5,30 @@ type Connection interface {
 	Write([]byte) error // writes data to client
 	GetDBIndex() int    // redis has multi databases
 	SelectDB(int)       // select redis database
+
+	// used for transaction
+	InMultiState() bool
+	SetMultiState(bool) // leaving multi state discards queued commands, errors and watched keys
+	GetQueuedCmdLine() [][][]byte
+	EnqueueCmd([][]byte)
+	AddTxError(err error)
+	GetTxErrors() []error
+	GetWatching() map[string]uint32 // key -> version of the key when it was watched
+
+	// used for publish/subscribe
+	Subscribe(channel string)
+	UnSubscribe(channel string)
+	PSubscribe(pattern string)
+	PUnSubscribe(pattern string)
+	SubsCount() int // number of channels and patterns subscribed
+	GetChannels() []string
+	GetPatterns() []string
+
+	// used for redis cluster slots, ASKING allows the next command to access a slot being imported
+	SetAsking(bool)
+	IsAsking() bool
+
+	// used for authentication
+	SetUser(string)
+	GetUser() string
 }
@@ -3,22 +3,36 @@ package consistenthash
 import (
 	"hash/crc32"
 	"sort"
+	"strconv"
+	"sync"
 )
 
 // HashFunc defines function to generate hash code
 type HashFunc func(data []byte) uint32
 
-// NodeMap stores nodes and you can pick node from NodeMap
+// NodeMap stores nodes and you can pick node from NodeMap.
+// Each node is placed on the ring replicas*weight times, so keys are spread evenly
+// and a node of weight 2 serves about twice as many keys as a node of weight 1.
 type NodeMap struct {
-	hashFunc    HashFunc
+	hashFunc HashFunc
+	replicas int // points of a node of weight 1
+
+	mu          sync.RWMutex // guards the fields below
+	weights     map[string]int
 	nodeHashes  []int // sorted
 	nodeHashMap map[int]string
 }
 
-// NewNodeMap creates a new NodeMap
-func NewNodeMap(fn HashFunc) *NodeMap {
+// NewNodeMap creates a new NodeMap placing replicas points per unit of weight on the ring,
+// a single point per node if replicas is less than 1
+func NewNodeMap(replicas int, fn HashFunc) *NodeMap {
+	if replicas < 1 {
+		replicas = 1
+	}
 	m := &NodeMap{
 		hashFunc:    fn,
+		replicas:    replicas,
+		weights:     make(map[string]int),
 		nodeHashMap: make(map[int]string),
 	}
 	if m.hashFunc == nil {
@@ -29,25 +43,79 @@ func NewNodeMap(fn HashFunc) *NodeMap {
 
 // IsEmpty returns if there is no node in NodeMap
 func (m *NodeMap) IsEmpty() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
 	return len(m.nodeHashes) == 0
 }
 
-// AddNode add the given nodes into consistent hash circle
+// AddNode add the given nodes into consistent hash circle with weight 1
 func (m *NodeMap) AddNode(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	for _, key := range keys {
 		if key == "" {
 			continue
 		}
-		hash := int(m.hashFunc([]byte(key)))
-		m.nodeHashes = append(m.nodeHashes, hash)
-		m.nodeHashMap[hash] = key
+		m.weights[key] = 1
+	}
+	m.build()
+}
+
+// AddWeightedNode adds the node or changes its weight, a node of weight 0 is known but serves no key
+func (m *NodeMap) AddWeightedNode(key string, weight int) {
+	if key == "" {
+		return
+	}
+	if weight < 0 {
+		weight = 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.weights[key] = weight
+	m.build()
+}
+
+// RemoveNode removes the given nodes, their keys move to the next points on the ring
+func (m *NodeMap) RemoveNode(keys ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range keys {
+		delete(m.weights, key)
+	}
+	m.build()
+}
+
+// build places the points of all nodes on the ring, the caller holds mu.
+// The first point of a node is the hash of its name and a point claimed by two nodes goes to the smaller name,
+// so every server computes the same ring whatever order the nodes were added in.
+func (m *NodeMap) build() {
+	m.nodeHashes = m.nodeHashes[:0]
+	m.nodeHashMap = make(map[int]string)
+	for key, weight := range m.weights {
+		for i := 0; i < m.replicas*weight; i++ {
+			point := key
+			if i > 0 {
+				point = key + "#" + strconv.Itoa(i)
+			}
+			hash := int(m.hashFunc([]byte(point)))
+			if owner, ok := m.nodeHashMap[hash]; ok {
+				if key < owner {
+					m.nodeHashMap[hash] = key
+				}
+				continue
+			}
+			m.nodeHashes = append(m.nodeHashes, hash)
+			m.nodeHashMap[hash] = key
+		}
 	}
 	sort.Ints(m.nodeHashes)
 }
 
 // PickNode gets the closest item in the hash to the provided key.
 func (m *NodeMap) PickNode(key string) string {
-	if m.IsEmpty() {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if len(m.nodeHashes) == 0 {
 		return ""
 	}
 
@@ -65,3 +133,40 @@ func (m *NodeMap) PickNode(key string) string {
 
 	return m.nodeHashMap[m.nodeHashes[idx]]
 }
+
+// Nodes returns the nodes with their weights
+func (m *NodeMap) Nodes() map[string]int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	nodes := make(map[string]int, len(m.weights))
+	for key, weight := range m.weights {
+		nodes[key] = weight
+	}
+	return nodes
+}
+
+// Distribution reports the share of the hash space served by each node, from 0 to 1,
+// keys hashed uniformly are spread across nodes in the same proportions
+func (m *NodeMap) Distribution() map[string]float64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	shares := make(map[string]float64, len(m.weights))
+	for key := range m.weights {
+		shares[key] = 0
+	}
+	n := len(m.nodeHashes)
+	if n == 0 {
+		return shares
+	}
+	const space = float64(1 << 32)
+	for i, hash := range m.nodeHashes {
+		// a point serves the hashes after the previous point up to itself, the first one wraps around
+		prev := m.nodeHashes[(i+n-1)%n]
+		arc := float64(hash - prev)
+		if i == 0 {
+			arc += space
+		}
+		shares[m.nodeHashMap[hash]] += arc / space
+	}
+	return shares
+}
@@ -0,0 +1,97 @@
+package consistenthash
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestPickNode(t *testing.T) {
+	m := NewNodeMap(0, nil)
+	if !m.IsEmpty() || m.PickNode("foo") != "" {
+		t.Fatal("expected no node picked from an empty map")
+	}
+	m.AddNode("a", "", "b", "c")
+	if len(m.Nodes()) != 3 {
+		t.Fatalf("expected 3 nodes, got %v", m.Nodes())
+	}
+	picked := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		picked[key] = m.PickNode(key)
+	}
+	m.RemoveNode("b")
+	for key, node := range picked {
+		moved := m.PickNode(key)
+		if node != "b" && moved != node {
+			t.Fatalf("expected %s to stay on %s, moved to %s", key, node, moved)
+		}
+		if moved == "b" {
+			t.Fatalf("expected %s moved off the removed node", key)
+		}
+	}
+}
+
+// TestSameRing checks the ring does not depend on the order nodes are added in
+func TestSameRing(t *testing.T) {
+	m1 := NewNodeMap(50, nil)
+	m1.AddNode("a", "b")
+	m1.AddWeightedNode("c", 3)
+	m2 := NewNodeMap(50, nil)
+	m2.AddWeightedNode("c", 3)
+	m2.AddNode("b", "a")
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if m1.PickNode(key) != m2.PickNode(key) {
+			t.Fatalf("expected the same node for %s", key)
+		}
+	}
+}
+
+func TestWeights(t *testing.T) {
+	m := NewNodeMap(100, nil)
+	m.AddNode("a", "b")
+	m.AddWeightedNode("c", 2)
+	m.AddWeightedNode("d", -1)
+	if weights := m.Nodes(); weights["c"] != 2 || weights["d"] != 0 {
+		t.Fatalf("unexpected weights %v", weights)
+	}
+
+	shares := m.Distribution()
+	total := 0.0
+	for _, share := range shares {
+		total += share
+	}
+	if math.Abs(total-1) > 1e-9 {
+		t.Errorf("expected shares adding up to 1, got %f", total)
+	}
+	if shares["d"] != 0 {
+		t.Errorf("expected a node of weight 0 to serve nothing, got %f", shares["d"])
+	}
+	// crc32 of similar names is not uniform, a share stays within 15 percent of its weight
+	for node, expected := range map[string]float64{"a": 0.25, "b": 0.25, "c": 0.5} {
+		if math.Abs(shares[node]-expected) > 0.15 {
+			t.Errorf("expected share of %s about %.2f, got %.3f", node, expected, shares[node])
+		}
+	}
+
+	counts := make(map[string]int)
+	for i := 0; i < 10000; i++ {
+		counts[m.PickNode("key:"+strconv.Itoa(i))]++
+	}
+	if counts["d"] != 0 || counts["c"] < counts["a"] || counts["c"] < counts["b"] {
+		t.Errorf("unexpected spread of keys %v", counts)
+	}
+}
+
+func TestCollision(t *testing.T) {
+	// every point lands on the same hash, which goes to the smallest name
+	m := NewNodeMap(3, func(data []byte) uint32 { return 42 })
+	m.AddNode("b", "a")
+	if node := m.PickNode("foo"); node != "a" {
+		t.Errorf("expected a, got %s", node)
+	}
+	if shares := m.Distribution(); shares["a"] != 1 || shares["b"] != 0 {
+		t.Errorf("unexpected distribution %v", shares)
+	}
+}
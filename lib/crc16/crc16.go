@@ -0,0 +1,27 @@
+package crc16
+
+// table of crc16 CCITT (XMODEM), polynomial 0x1021, the checksum redis cluster maps keys to slots with
+var table [256]uint16
+
+func init() {
+	for i := range table {
+		crc := uint16(i) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+}
+
+// Checksum returns the crc16 of data
+func Checksum(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc = crc<<8 ^ table[byte(crc>>8)^b]
+	}
+	return crc
+}
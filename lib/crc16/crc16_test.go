@@ -0,0 +1,15 @@
+package crc16
+
+import "testing"
+
+func TestChecksum(t *testing.T) {
+	for data, expected := range map[string]uint16{
+		"":          0,
+		"123456789": 0x31C3, // the check value of crc16 XMODEM
+		"foo":       0xAF96,
+	} {
+		if actual := Checksum([]byte(data)); actual != expected {
+			t.Errorf("expected crc16 of %q to be %#x, got %#x", data, expected, actual)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
 	"time"
 )
@@ -28,6 +29,8 @@ var (
 	mu                 = &sync.Mutex{}
 	logPrefix          = ""
 	levelFlags         = []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL"}
+	// minLevel is the lowest level logged, guarded by mu
+	minLevel = DEBUG
 )
 
 type logLevel int
@@ -65,6 +68,28 @@ func Setup(settings *Settings) {
 	logger = log.New(mw, defaultPrefix, flags)
 }
 
+// parseLevel checks the name of a level: debug, info, warn or error
+func parseLevel(name string) (logLevel, error) {
+	for i, flag := range levelFlags[:FATAL] {
+		if strings.EqualFold(name, flag) {
+			return logLevel(i), nil
+		}
+	}
+	return DEBUG, fmt.Errorf("unknown log level %s, expected debug, info, warn or error", name)
+}
+
+// SetLevel logs the messages of the level and above only, fatal messages are always logged
+func SetLevel(name string) error {
+	level, err := parseLevel(name)
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	minLevel = level
+	mu.Unlock()
+	return nil
+}
+
 // setPrefix sets log prefix according to log level
 func setPrefix(level logLevel) {
 	_, f, line, ok := runtime.Caller(defaultCallerDepth)
@@ -79,6 +104,9 @@ func setPrefix(level logLevel) {
 func Debug(v ...interface{}) {
 	mu.Lock()
 	defer mu.Unlock()
+	if DEBUG < minLevel {
+		return
+	}
 	setPrefix(DEBUG)
 	logger.Println(v...)
 }
@@ -86,6 +114,9 @@ func Debug(v ...interface{}) {
 func Info(v ...interface{}) {
 	mu.Lock()
 	defer mu.Unlock()
+	if INFO < minLevel {
+		return
+	}
 	setPrefix(INFO)
 	logger.Println(v...)
 }
@@ -93,6 +124,9 @@ func Info(v ...interface{}) {
 func Error(v ...interface{}) {
 	mu.Lock()
 	defer mu.Unlock()
+	if ERROR < minLevel {
+		return
+	}
 	setPrefix(ERROR)
 	logger.Println(v...)
 }
@@ -107,6 +141,9 @@ func Fatal(v ...interface{}) {
 func Warn(v ...interface{}) {
 	mu.Lock()
 	defer mu.Unlock()
+	if WARN < minLevel {
+		return
+	}
 	setPrefix(WARN)
 	logger.Println(v...)
 }
@@ -18,3 +18,34 @@ func (b *Boolean) Set(v bool) {
 		atomic.StoreUint32((*uint32)(b), 0)
 	}
 }
+
+// Int32 is an int32 value, all actions of it are atomic
+type Int32 int32
+
+// Add adds delta atomically and returns the new value
+func (i *Int32) Add(delta int32) int32 {
+	return atomic.AddInt32((*int32)(i), delta)
+}
+
+// Get reads the value atomically
+func (i *Int32) Get() int32 {
+	return atomic.LoadInt32((*int32)(i))
+}
+
+// Int64 is an int64 value, all actions of it are atomic
+type Int64 int64
+
+// Add adds delta atomically and returns the new value
+func (i *Int64) Add(delta int64) int64 {
+	return atomic.AddInt64((*int64)(i), delta)
+}
+
+// Get reads the value atomically
+func (i *Int64) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+// Set writes the value atomically
+func (i *Int64) Set(v int64) {
+	atomic.StoreInt64((*int64)(i), v)
+}
@@ -0,0 +1,135 @@
+package lock
+
+import (
+	"sort"
+	"sync"
+)
+
+const (
+	prime32 = uint32(16777619)
+)
+
+// Locks provides rw locks for keys, keys are spread over a fixed number of mutexes
+// so memory does not grow with the number of keys
+type Locks struct {
+	table []*sync.RWMutex
+}
+
+// Make creates a new lock map, tableSize is rounded up to a power of two
+func Make(tableSize int) *Locks {
+	size := 1
+	for size < tableSize {
+		size <<= 1
+	}
+	table := make([]*sync.RWMutex, size)
+	for i := 0; i < size; i++ {
+		table[i] = &sync.RWMutex{}
+	}
+	return &Locks{
+		table: table,
+	}
+}
+
+func fnv32(key string) uint32 {
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash *= prime32
+		hash ^= uint32(key[i])
+	}
+	return hash
+}
+
+func (locks *Locks) spread(hashCode uint32) uint32 {
+	tableSize := uint32(len(locks.table))
+	return (tableSize - 1) & hashCode
+}
+
+// Lock obtains exclusive lock for writing
+func (locks *Locks) Lock(key string) {
+	index := locks.spread(fnv32(key))
+	locks.table[index].Lock()
+}
+
+// RLock obtains shared lock for reading
+func (locks *Locks) RLock(key string) {
+	index := locks.spread(fnv32(key))
+	locks.table[index].RLock()
+}
+
+// UnLock releases exclusive lock
+func (locks *Locks) UnLock(key string) {
+	index := locks.spread(fnv32(key))
+	locks.table[index].Unlock()
+}
+
+// RUnLock releases shared lock
+func (locks *Locks) RUnLock(key string) {
+	index := locks.spread(fnv32(key))
+	locks.table[index].RUnlock()
+}
+
+// toLockIndices returns the distinct mutex indices of keys in ascending order,
+// always locking in the same order avoids deadlock between commands sharing keys
+func (locks *Locks) toLockIndices(keys []string, reverse bool) []uint32 {
+	indexMap := make(map[uint32]struct{})
+	for _, key := range keys {
+		index := locks.spread(fnv32(key))
+		indexMap[index] = struct{}{}
+	}
+	indices := make([]uint32, 0, len(indexMap))
+	for index := range indexMap {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool {
+		if !reverse {
+			return indices[i] < indices[j]
+		}
+		return indices[i] > indices[j]
+	})
+	return indices
+}
+
+// RWLocks locks write keys exclusively and read keys shared,
+// a key in both writeKeys and readKeys is locked exclusively
+func (locks *Locks) RWLocks(writeKeys []string, readKeys []string) {
+	keys := make([]string, 0, len(writeKeys)+len(readKeys))
+	keys = append(keys, writeKeys...)
+	keys = append(keys, readKeys...)
+	indices := locks.toLockIndices(keys, false)
+	writeIndexSet := make(map[uint32]struct{})
+	for _, wKey := range writeKeys {
+		idx := locks.spread(fnv32(wKey))
+		writeIndexSet[idx] = struct{}{}
+	}
+	for _, index := range indices {
+		_, w := writeIndexSet[index]
+		mu := locks.table[index]
+		if w {
+			mu.Lock()
+		} else {
+			mu.RLock()
+		}
+	}
+}
+
+// RWUnLocks releases the locks obtained by RWLocks
+func (locks *Locks) RWUnLocks(writeKeys []string, readKeys []string) {
+	keys := make([]string, 0, len(writeKeys)+len(readKeys))
+	keys = append(keys, writeKeys...)
+	keys = append(keys, readKeys...)
+	indices := locks.toLockIndices(keys, true)
+	writeIndexSet := make(map[uint32]struct{})
+	for _, wKey := range writeKeys {
+		idx := locks.spread(fnv32(wKey))
+		writeIndexSet[idx] = struct{}{}
+	}
+	for _, index := range indices {
+		_, w := writeIndexSet[index]
+		mu := locks.table[index]
+		if w {
+			mu.Unlock()
+		} else {
+			mu.RUnlock()
+		}
+	}
+}
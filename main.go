@@ -2,6 +2,9 @@ package main
 
 import (
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"go-redis/config"
 	"go-redis/lib/file"
@@ -10,9 +13,38 @@ import (
 	"go-redis/tcp"
 )
 
-const configFile string = "etc/config.yaml"
+// defaultConfigFile is loaded if no config file is given and it exists
+const defaultConfigFile string = "etc/config.yaml"
+
+const usage = `Usage: go-redis [/path/to/redis.conf | /path/to/config.yaml] [--<setting> <value> ...]
+
+Examples:
+  go-redis                                  (loads etc/config.yaml if it exists)
+  go-redis /etc/redis/redis.conf
+  go-redis --port 6380 --appendonly yes
+  go-redis redis.conf --save 3600 1 --save 300 100
+
+Settings are also overridden by REDIS_<SETTING> environment variables, e.g. REDIS_MAXMEMORY=64mb,
+the command line overrides the environment which overrides the config file.
+`
 
 func main() {
+	args := os.Args[1:]
+	if len(args) > 0 && (args[0] == "-h" || args[0] == "--help") {
+		fmt.Print(usage)
+		return
+	}
+	configFile := ""
+	if len(args) > 0 && !strings.HasPrefix(args[0], "--") {
+		configFile, args = args[0], args[1:]
+	} else if !file.CheckNotExist(defaultConfigFile) {
+		configFile = defaultConfigFile
+	}
+	if err := config.Load(configFile, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
 	logger.Setup(&logger.Settings{
 		Path:       "logs",
 		Name:       "tcp-server",
@@ -20,12 +52,11 @@ func main() {
 		TimeFormat: "2006-01-02",
 	})
 
-	if !file.CheckNotExist(configFile) {
-		config.SetupConfig(configFile, ".")
-	}
-
 	err := tcp.ListenAndServeWithSignal(
-		&tcp.Config{Address: fmt.Sprintf("%s:%d", config.Properties.Bind, config.Properties.Port)},
+		&tcp.Config{
+			Address:   fmt.Sprintf("%s:%d", config.Properties.Bind, config.Properties.Port),
+			KeepAlive: time.Duration(config.Snapshot().TcpKeepalive) * time.Second,
+		},
 		handler.MakeRespHandler())
 
 	if err != nil {
@@ -0,0 +1,50 @@
+package pubsub
+
+import (
+	"sync"
+
+	"go-redis/datastruct/dict"
+	"go-redis/interface/resp"
+	"go-redis/lib/sync/lock"
+	"go-redis/lib/wildcard"
+)
+
+// lockerSize is the number of mutexes channels are spread over
+const lockerSize = 16
+
+// subscribers is the set of connections subscribing a channel or a pattern
+type subscribers map[resp.Connection]struct{}
+
+// patternSubscribers holds the connections subscribing a pattern and its compiled form
+type patternSubscribers struct {
+	pattern     *wildcard.Pattern
+	subscribers subscribers
+}
+
+// Hub stores all subscribe relations
+type Hub struct {
+	// channel -> subscribers
+	subs dict.Dict
+	// lock channel while modifying its subscribers
+	subsLocker *lock.Locks
+
+	// pattern -> *patternSubscribers, every pattern is matched against published channels
+	patterns   map[string]*patternSubscribers
+	patternsMu sync.RWMutex
+}
+
+// MakeHub creates new hub
+func MakeHub() *Hub {
+	return &Hub{
+		subs:       dict.MakeSyncDict(),
+		subsLocker: lock.Make(lockerSize),
+		patterns:   make(map[string]*patternSubscribers),
+	}
+}
+
+// Counts returns the number of channels and patterns with subscribers
+func (hub *Hub) Counts() (channels int, patterns int) {
+	hub.patternsMu.RLock()
+	defer hub.patternsMu.RUnlock()
+	return hub.subs.Len(), len(hub.patterns)
+}
@@ -0,0 +1,279 @@
+package pubsub
+
+import (
+	"sort"
+	"strings"
+
+	"go-redis/interface/resp"
+	"go-redis/lib/wildcard"
+	"go-redis/resp/reply"
+)
+
+var (
+	_subscribe    = "subscribe"
+	_unsubscribe  = "unsubscribe"
+	_psubscribe   = "psubscribe"
+	_punsubscribe = "punsubscribe"
+	messageBytes  = []byte("message")
+	pmessageBytes = []byte("pmessage")
+)
+
+// makeMsg makes the confirmation of (un)subscribing, e.g. ["subscribe", channel, count]
+func makeMsg(t string, channel string, code int64) []byte {
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(t)),
+		reply.MakeBulkReply([]byte(channel)),
+		reply.MakeIntReply(code),
+	}).ToBytes()
+}
+
+// makeEmptyMsg makes the confirmation of unsubscribing while nothing is subscribed, e.g. ["unsubscribe", nil, 0]
+func makeEmptyMsg(t string) []byte {
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte(t)),
+		reply.MakeNullBulkReply(),
+		reply.MakeIntReply(0),
+	}).ToBytes()
+}
+
+// subscribe0 adds the subscriber of channel, returns whether it is new
+func (hub *Hub) subscribe0(channel string, client resp.Connection) bool {
+	client.Subscribe(channel)
+
+	raw, ok := hub.subs.Get(channel)
+	var subs subscribers
+	if ok {
+		subs, _ = raw.(subscribers)
+	} else {
+		subs = make(subscribers)
+		hub.subs.Put(channel, subs)
+	}
+	if _, exists := subs[client]; exists {
+		return false
+	}
+	subs[client] = struct{}{}
+	return true
+}
+
+// unsubscribe0 removes the subscriber of channel, returns whether it was subscribing
+func (hub *Hub) unsubscribe0(channel string, client resp.Connection) bool {
+	client.UnSubscribe(channel)
+
+	raw, ok := hub.subs.Get(channel)
+	if !ok {
+		return false
+	}
+	subs, _ := raw.(subscribers)
+	if _, exists := subs[client]; !exists {
+		return false
+	}
+	delete(subs, client)
+	if len(subs) == 0 {
+		hub.subs.Remove(channel)
+	}
+	return true
+}
+
+// Subscribe puts the client into the subscriber lists of the channels
+func (hub *Hub) Subscribe(c resp.Connection, args [][]byte) resp.Reply {
+	channels := make([]string, len(args))
+	for i, b := range args {
+		channels[i] = string(b)
+	}
+
+	hub.subsLocker.RWLocks(channels, nil)
+	defer hub.subsLocker.RWUnLocks(channels, nil)
+
+	for _, channel := range channels {
+		hub.subscribe0(channel, c)
+		_ = c.Write(makeMsg(_subscribe, channel, int64(c.SubsCount())))
+	}
+	return reply.MakeNoReply()
+}
+
+// UnSubscribe removes the client from the subscriber lists of the channels,
+// all channels subscribed by the client are unsubscribed if no channel is given
+func (hub *Hub) UnSubscribe(c resp.Connection, args [][]byte) resp.Reply {
+	var channels []string
+	if len(args) > 0 {
+		channels = make([]string, len(args))
+		for i, b := range args {
+			channels[i] = string(b)
+		}
+	} else {
+		channels = c.GetChannels()
+	}
+
+	hub.subsLocker.RWLocks(channels, nil)
+	defer hub.subsLocker.RWUnLocks(channels, nil)
+
+	if len(channels) == 0 {
+		_ = c.Write(makeEmptyMsg(_unsubscribe))
+		return reply.MakeNoReply()
+	}
+	for _, channel := range channels {
+		hub.unsubscribe0(channel, c)
+		_ = c.Write(makeMsg(_unsubscribe, channel, int64(c.SubsCount())))
+	}
+	return reply.MakeNoReply()
+}
+
+// PSubscribe puts the client into the subscriber lists of the patterns
+func (hub *Hub) PSubscribe(c resp.Connection, args [][]byte) resp.Reply {
+	hub.patternsMu.Lock()
+	defer hub.patternsMu.Unlock()
+
+	for _, arg := range args {
+		pattern := string(arg)
+		c.PSubscribe(pattern)
+		subs, ok := hub.patterns[pattern]
+		if !ok {
+			subs = &patternSubscribers{
+				pattern:     wildcard.CompilePattern(pattern),
+				subscribers: make(subscribers),
+			}
+			hub.patterns[pattern] = subs
+		}
+		subs.subscribers[c] = struct{}{}
+		_ = c.Write(makeMsg(_psubscribe, pattern, int64(c.SubsCount())))
+	}
+	return reply.MakeNoReply()
+}
+
+// PUnSubscribe removes the client from the subscriber lists of the patterns,
+// all patterns subscribed by the client are unsubscribed if no pattern is given
+func (hub *Hub) PUnSubscribe(c resp.Connection, args [][]byte) resp.Reply {
+	var patterns []string
+	if len(args) > 0 {
+		patterns = make([]string, len(args))
+		for i, b := range args {
+			patterns[i] = string(b)
+		}
+	} else {
+		patterns = c.GetPatterns()
+	}
+
+	hub.patternsMu.Lock()
+	defer hub.patternsMu.Unlock()
+
+	if len(patterns) == 0 {
+		_ = c.Write(makeEmptyMsg(_punsubscribe))
+		return reply.MakeNoReply()
+	}
+	for _, pattern := range patterns {
+		hub.punsubscribe0(pattern, c)
+		_ = c.Write(makeMsg(_punsubscribe, pattern, int64(c.SubsCount())))
+	}
+	return reply.MakeNoReply()
+}
+
+// punsubscribe0 removes the subscriber of pattern, the caller holds patternsMu
+func (hub *Hub) punsubscribe0(pattern string, client resp.Connection) {
+	client.PUnSubscribe(pattern)
+	subs, ok := hub.patterns[pattern]
+	if !ok {
+		return
+	}
+	delete(subs.subscribers, client)
+	if len(subs.subscribers) == 0 {
+		delete(hub.patterns, pattern)
+	}
+}
+
+// UnsubscribeAll removes the client from all subscriber lists, it is called when the client is closed
+func (hub *Hub) UnsubscribeAll(c resp.Connection) {
+	channels := c.GetChannels()
+	hub.subsLocker.RWLocks(channels, nil)
+	for _, channel := range channels {
+		hub.unsubscribe0(channel, c)
+	}
+	hub.subsLocker.RWUnLocks(channels, nil)
+
+	hub.patternsMu.Lock()
+	for _, pattern := range c.GetPatterns() {
+		hub.punsubscribe0(pattern, c)
+	}
+	hub.patternsMu.Unlock()
+}
+
+// Publish sends message to the subscribers of channel and of the patterns matching channel,
+// returns the number of receivers
+func (hub *Hub) Publish(args [][]byte) resp.Reply {
+	if len(args) != 2 {
+		return reply.MakeArgNumErrReply("publish")
+	}
+	channel := string(args[0])
+	message := args[1]
+
+	var receivers int64
+	hub.subsLocker.RLock(channel)
+	if raw, ok := hub.subs.Get(channel); ok {
+		subs, _ := raw.(subscribers)
+		msg := reply.MakeMultiBulkReply([][]byte{messageBytes, args[0], message}).ToBytes()
+		for client := range subs {
+			_ = client.Write(msg)
+			receivers++
+		}
+	}
+	hub.subsLocker.RUnLock(channel)
+
+	hub.patternsMu.RLock()
+	for pattern, subs := range hub.patterns {
+		if !subs.pattern.IsMatch(channel) {
+			continue
+		}
+		msg := reply.MakeMultiBulkReply([][]byte{pmessageBytes, []byte(pattern), args[0], message}).ToBytes()
+		for client := range subs.subscribers {
+			_ = client.Write(msg)
+			receivers++
+		}
+	}
+	hub.patternsMu.RUnlock()
+
+	return reply.MakeIntReply(receivers)
+}
+
+// PubSub PUBSUB CHANNELS [pattern] | NUMSUB [channel ...] | NUMPAT
+func (hub *Hub) PubSub(args [][]byte) resp.Reply {
+	if len(args) == 0 {
+		return reply.MakeArgNumErrReply("pubsub")
+	}
+	subCmd := strings.ToLower(string(args[0]))
+	switch {
+	case subCmd == "channels" && len(args) <= 2:
+		var pattern *wildcard.Pattern
+		if len(args) == 2 {
+			pattern = wildcard.CompilePattern(string(args[1]))
+		}
+		channels := make([]string, 0)
+		for _, channel := range hub.subs.Keys() {
+			if pattern == nil || pattern.IsMatch(channel) {
+				channels = append(channels, channel)
+			}
+		}
+		sort.Strings(channels)
+		result := make([][]byte, len(channels))
+		for i, channel := range channels {
+			result[i] = []byte(channel)
+		}
+		return reply.MakeMultiBulkReply(result)
+	case subCmd == "numsub":
+		result := make([]resp.Reply, 0, 2*(len(args)-1))
+		for _, arg := range args[1:] {
+			channel := string(arg)
+			var count int64
+			hub.subsLocker.RLock(channel)
+			if raw, ok := hub.subs.Get(channel); ok {
+				count = int64(len(raw.(subscribers)))
+			}
+			hub.subsLocker.RUnLock(channel)
+			result = append(result, reply.MakeBulkReply(arg), reply.MakeIntReply(count))
+		}
+		return reply.MakeMultiRawReply(result)
+	case subCmd == "numpat" && len(args) == 1:
+		hub.patternsMu.RLock()
+		defer hub.patternsMu.RUnlock()
+		return reply.MakeIntReply(int64(len(hub.patterns)))
+	}
+	return reply.MakeStandardErrReply("ERR unknown subcommand '" + string(args[0]) + "'. Try PUBSUB HELP.")
+}
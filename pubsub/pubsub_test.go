@@ -0,0 +1,110 @@
+package pubsub
+
+import (
+	"strings"
+	"testing"
+
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+)
+
+// fakeConn records the messages written to the client
+type fakeConn struct {
+	*connection.Connection
+	written strings.Builder
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{Connection: &connection.Connection{}}
+}
+
+func (c *fakeConn) Write(b []byte) error {
+	c.written.Write(b)
+	return nil
+}
+
+// flush returns the messages written since the last flush
+func (c *fakeConn) flush() string {
+	s := c.written.String()
+	c.written.Reset()
+	return s
+}
+
+func assertMsg(t *testing.T, actual string, expected string) {
+	t.Helper()
+	if actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
+
+func TestPublish(t *testing.T) {
+	hub := MakeHub()
+	c1, c2 := newFakeConn(), newFakeConn()
+	hub.Subscribe(c1, utils.ToCmdLine("news", "sport"))
+	assertMsg(t, c1.flush(), "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n*3\r\n$9\r\nsubscribe\r\n$5\r\nsport\r\n:2\r\n")
+	hub.PSubscribe(c2, utils.ToCmdLine("n*"))
+	assertMsg(t, c2.flush(), "*3\r\n$10\r\npsubscribe\r\n$2\r\nn*\r\n:1\r\n")
+
+	assertMsg(t, string(hub.Publish(utils.ToCmdLine("news", "hi")).ToBytes()), ":2\r\n")
+	assertMsg(t, c1.flush(), "*3\r\n$7\r\nmessage\r\n$4\r\nnews\r\n$2\r\nhi\r\n")
+	assertMsg(t, c2.flush(), "*4\r\n$8\r\npmessage\r\n$2\r\nn*\r\n$4\r\nnews\r\n$2\r\nhi\r\n")
+	assertMsg(t, string(hub.Publish(utils.ToCmdLine("sport", "goal")).ToBytes()), ":1\r\n")
+	assertMsg(t, string(hub.Publish(utils.ToCmdLine("weather", "rain")).ToBytes()), ":0\r\n")
+	c1.flush()
+	assertMsg(t, c2.flush(), "")
+}
+
+func TestUnsubscribe(t *testing.T) {
+	hub := MakeHub()
+	c := newFakeConn()
+	hub.Subscribe(c, utils.ToCmdLine("a", "b"))
+	hub.PSubscribe(c, utils.ToCmdLine("p*"))
+	c.flush()
+
+	hub.UnSubscribe(c, utils.ToCmdLine("a"))
+	assertMsg(t, c.flush(), "*3\r\n$11\r\nunsubscribe\r\n$1\r\na\r\n:2\r\n")
+	// no channel unsubscribes all channels, patterns are kept
+	hub.UnSubscribe(c, nil)
+	assertMsg(t, c.flush(), "*3\r\n$11\r\nunsubscribe\r\n$1\r\nb\r\n:1\r\n")
+	hub.UnSubscribe(c, nil)
+	assertMsg(t, c.flush(), "*3\r\n$11\r\nunsubscribe\r\n$-1\r\n:0\r\n")
+	if !c.IsSubscriber() {
+		t.Error("expected the client to subscribe the pattern")
+	}
+	hub.PUnSubscribe(c, nil)
+	assertMsg(t, c.flush(), "*3\r\n$12\r\npunsubscribe\r\n$2\r\np*\r\n:0\r\n")
+	if c.IsSubscriber() {
+		t.Error("expected the client to subscribe nothing")
+	}
+	if channels, patterns := hub.Counts(); channels != 0 || patterns != 0 {
+		t.Errorf("expected no channel nor pattern left, got %d and %d", channels, patterns)
+	}
+}
+
+func TestUnsubscribeAll(t *testing.T) {
+	hub := MakeHub()
+	c := newFakeConn()
+	hub.Subscribe(c, utils.ToCmdLine("a", "b"))
+	hub.PSubscribe(c, utils.ToCmdLine("*"))
+	hub.UnsubscribeAll(c)
+	assertMsg(t, string(hub.Publish(utils.ToCmdLine("a", "msg")).ToBytes()), ":0\r\n")
+	if channels, patterns := hub.Counts(); channels != 0 || patterns != 0 {
+		t.Errorf("expected no channel nor pattern left, got %d and %d", channels, patterns)
+	}
+}
+
+func TestPubSubCommand(t *testing.T) {
+	hub := MakeHub()
+	c1, c2 := newFakeConn(), newFakeConn()
+	hub.Subscribe(c1, utils.ToCmdLine("news", "sport"))
+	hub.Subscribe(c2, utils.ToCmdLine("news"))
+	hub.PSubscribe(c2, utils.ToCmdLine("n*", "s*"))
+	pubsub := func(args ...string) string {
+		return string(hub.PubSub(utils.ToCmdLine(args...)).ToBytes())
+	}
+	assertMsg(t, pubsub("CHANNELS"), "*2\r\n$4\r\nnews\r\n$5\r\nsport\r\n")
+	assertMsg(t, pubsub("channels", "s*"), "*1\r\n$5\r\nsport\r\n")
+	assertMsg(t, pubsub("NUMSUB", "news", "none"), "*4\r\n$4\r\nnews\r\n:2\r\n$4\r\nnone\r\n:0\r\n")
+	assertMsg(t, pubsub("NUMPAT"), ":2\r\n")
+	assertMsg(t, pubsub("NOPE"), "-ERR unknown subcommand 'NOPE'. Try PUBSUB HELP.\r\n")
+}
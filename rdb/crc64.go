@@ -0,0 +1,12 @@
+package rdb
+
+import "hash/crc64"
+
+// Redis uses CRC-64-Jones, reflected, with zero initial value and no final xor.
+// hash/crc64 inverts the crc before and after each update, so the inversions are undone here
+var jonesTable = crc64.MakeTable(0x95ac9329ac4bc9b5) // reversed form of 0xad93d23594c935a9
+
+// crc64Update returns the checksum of data following crc, as redis computes it
+func crc64Update(crc uint64, data []byte) uint64 {
+	return ^crc64.Update(^crc, jonesTable, data)
+}
@@ -0,0 +1,515 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Object is a key decoded from a rdb file, the field matching Type holds the value
+type Object struct {
+	DBIndex  int
+	Key      string
+	ExpireAt *time.Time // nil if the key has no ttl
+	Type     ObjectType
+
+	String []byte
+	List   [][]byte
+	Set    [][]byte
+	Hash   map[string][]byte
+	ZSet   []*ZSetEntry
+}
+
+// Decoder reads a rdb file, besides the plain encodings it understands the compact encodings
+// (ziplist, listpack, intset, quicklist) found in files written by redis
+type Decoder struct {
+	reader  *crcReader
+	version int
+	aux     map[string]string
+	buf     [8]byte
+}
+
+// crcReader computes the checksum of the bytes read through it
+type crcReader struct {
+	reader io.Reader
+	crc    uint64
+}
+
+func (r *crcReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.crc = crc64Update(r.crc, p[:n])
+	return n, err
+}
+
+// NewDecoder creates a decoder reading from r
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{
+		reader: &crcReader{reader: bufio.NewReader(r)},
+		aux:    make(map[string]string),
+	}
+}
+
+// Aux returns the auxiliary fields read so far, e.g. "redis-ver"
+func (dec *Decoder) Aux() map[string]string {
+	return dec.aux
+}
+
+func (dec *Decoder) readFull(p []byte) error {
+	_, err := io.ReadFull(dec.reader, p)
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+func (dec *Decoder) readByte() (byte, error) {
+	if err := dec.readFull(dec.buf[:1]); err != nil {
+		return 0, err
+	}
+	return dec.buf[0], nil
+}
+
+// readLength reads a length, encoded is true if the value is the kind of a special encoded string
+func (dec *Decoder) readLength() (length uint64, encoded bool, err error) {
+	first, err := dec.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch first >> 6 {
+	case len6Bit:
+		return uint64(first & 0x3F), false, nil
+	case len14Bit:
+		second, err := dec.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		return uint64(first&0x3F)<<8 | uint64(second), false, nil
+	case lenEncV:
+		return uint64(first & 0x3F), true, nil
+	}
+	switch first {
+	case len32Bit:
+		if err := dec.readFull(dec.buf[:4]); err != nil {
+			return 0, false, err
+		}
+		return uint64(binary.BigEndian.Uint32(dec.buf[:4])), false, nil
+	case len64Bit:
+		if err := dec.readFull(dec.buf[:8]); err != nil {
+			return 0, false, err
+		}
+		return binary.BigEndian.Uint64(dec.buf[:8]), false, nil
+	}
+	return 0, false, fmt.Errorf("unknown length encoding %#x", first)
+}
+
+func (dec *Decoder) readCount() (int, error) {
+	length, encoded, err := dec.readLength()
+	if err != nil {
+		return 0, err
+	}
+	if encoded || length > math.MaxInt32 {
+		return 0, errors.New("invalid length")
+	}
+	return int(length), nil
+}
+
+func (dec *Decoder) readString() ([]byte, error) {
+	length, encoded, err := dec.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if !encoded {
+		if length > math.MaxInt32 {
+			return nil, errors.New("invalid string length")
+		}
+		s := make([]byte, length)
+		return s, dec.readFull(s)
+	}
+	switch length {
+	case encodeInt8:
+		if err := dec.readFull(dec.buf[:1]); err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int8(dec.buf[0])))), nil
+	case encodeInt16:
+		if err := dec.readFull(dec.buf[:2]); err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int16(binary.LittleEndian.Uint16(dec.buf[:2]))))), nil
+	case encodeInt32:
+		if err := dec.readFull(dec.buf[:4]); err != nil {
+			return nil, err
+		}
+		return []byte(strconv.Itoa(int(int32(binary.LittleEndian.Uint32(dec.buf[:4]))))), nil
+	case encodeLZF:
+		compressedLen, err := dec.readCount()
+		if err != nil {
+			return nil, err
+		}
+		rawLen, err := dec.readCount()
+		if err != nil {
+			return nil, err
+		}
+		compressed := make([]byte, compressedLen)
+		if err := dec.readFull(compressed); err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, rawLen)
+	}
+	return nil, fmt.Errorf("unknown string encoding %d", length)
+}
+
+// readScore reads a score of the legacy zset type, written as a string prefixed by its length
+func (dec *Decoder) readScore() (float64, error) {
+	length, err := dec.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch length {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	s := make([]byte, length)
+	if err := dec.readFull(s); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(s), 64)
+}
+
+func (dec *Decoder) readBinaryScore() (float64, error) {
+	if err := dec.readFull(dec.buf[:8]); err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(dec.buf[:8])), nil
+}
+
+func (dec *Decoder) readHeader() error {
+	header := make([]byte, len(magic)+4)
+	if err := dec.readFull(header); err != nil {
+		return err
+	}
+	if string(header[:len(magic)]) != magic {
+		return errors.New("not a rdb file")
+	}
+	v, err := strconv.Atoi(string(header[len(magic):]))
+	if err != nil || v < 1 || v > maxVersion {
+		return fmt.Errorf("unsupported rdb version %s", header[len(magic):])
+	}
+	dec.version = v
+	return nil
+}
+
+// Parse reads the whole file and calls cb with each object, parsing stops if cb returns false
+func (dec *Decoder) Parse(cb func(o *Object) bool) error {
+	if err := dec.readHeader(); err != nil {
+		return err
+	}
+	dbIndex := 0
+	var expireAt *time.Time
+	for {
+		opcode, err := dec.readByte()
+		if err != nil {
+			return err
+		}
+		switch opcode {
+		case opcodeAux:
+			key, err := dec.readString()
+			if err != nil {
+				return err
+			}
+			value, err := dec.readString()
+			if err != nil {
+				return err
+			}
+			dec.aux[string(key)] = string(value)
+		case opcodeSelectDB:
+			if dbIndex, err = dec.readCount(); err != nil {
+				return err
+			}
+		case opcodeResizeDB:
+			if _, err := dec.readCount(); err != nil {
+				return err
+			}
+			if _, err := dec.readCount(); err != nil {
+				return err
+			}
+		case opcodeSlotInfo:
+			for i := 0; i < 3; i++ {
+				if _, err := dec.readCount(); err != nil {
+					return err
+				}
+			}
+		case opcodeExpireTimeMs:
+			if err := dec.readFull(dec.buf[:8]); err != nil {
+				return err
+			}
+			t := time.Unix(0, int64(binary.LittleEndian.Uint64(dec.buf[:8]))*int64(time.Millisecond))
+			expireAt = &t
+		case opcodeExpireTime:
+			if err := dec.readFull(dec.buf[:4]); err != nil {
+				return err
+			}
+			t := time.Unix(int64(binary.LittleEndian.Uint32(dec.buf[:4])), 0)
+			expireAt = &t
+		case opcodeIdle:
+			if _, _, err := dec.readLength(); err != nil {
+				return err
+			}
+		case opcodeFreq:
+			if _, err := dec.readByte(); err != nil {
+				return err
+			}
+		case opcodeModuleAux, opcodeFunction, opcodeFunction2:
+			return fmt.Errorf("unsupported rdb opcode %#x", opcode)
+		case opcodeEOF:
+			return dec.checkSum()
+		default:
+			key, err := dec.readString()
+			if err != nil {
+				return err
+			}
+			o := &Object{
+				DBIndex:  dbIndex,
+				Key:      string(key),
+				ExpireAt: expireAt,
+			}
+			if err := dec.readObject(o, opcode); err != nil {
+				return fmt.Errorf("read key %s: %v", key, err)
+			}
+			expireAt = nil
+			if !cb(o) {
+				return nil
+			}
+		}
+	}
+}
+
+// checkSum compares the checksum at the end of file, files written with checksum disabled store 0
+func (dec *Decoder) checkSum() error {
+	if dec.version < 5 {
+		return nil
+	}
+	expected := dec.reader.crc
+	if err := dec.readFull(dec.buf[:8]); err != nil {
+		return err
+	}
+	actual := binary.LittleEndian.Uint64(dec.buf[:8])
+	if actual != 0 && actual != expected {
+		return ErrChecksum
+	}
+	return nil
+}
+
+func (dec *Decoder) readObject(o *Object, valueType byte) error {
+	var err error
+	switch valueType {
+	case typeString:
+		o.Type = StringType
+		o.String, err = dec.readString()
+	case typeList:
+		o.Type = ListType
+		o.List, err = dec.readStrings()
+	case typeSet:
+		o.Type = SetType
+		o.Set, err = dec.readStrings()
+	case typeZSet, typeZSet2:
+		o.Type = ZSetType
+		o.ZSet, err = dec.readZSet(valueType == typeZSet2)
+	case typeHash:
+		o.Type = HashType
+		o.Hash, err = dec.readHash()
+	case typeListZipList:
+		o.Type = ListType
+		o.List, err = dec.readPacked(parseZipList)
+	case typeListQuickList:
+		o.Type = ListType
+		o.List, err = dec.readQuickList()
+	case typeListQuickList2:
+		o.Type = ListType
+		o.List, err = dec.readQuickList2()
+	case typeSetIntSet:
+		o.Type = SetType
+		o.Set, err = dec.readPacked(parseIntSet)
+	case typeSetListPack:
+		o.Type = SetType
+		o.Set, err = dec.readPacked(parseListPack)
+	case typeHashZipList, typeHashListPack:
+		o.Type = HashType
+		o.Hash, err = dec.readPackedHash(valueType == typeHashListPack)
+	case typeZSetZipList, typeZSetListPack:
+		o.Type = ZSetType
+		o.ZSet, err = dec.readPackedZSet(valueType == typeZSetListPack)
+	default:
+		return fmt.Errorf("unsupported value type %d", valueType)
+	}
+	return err
+}
+
+func (dec *Decoder) readStrings() ([][]byte, error) {
+	size, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, 0, size)
+	for i := 0; i < size; i++ {
+		value, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+func (dec *Decoder) readHash() (map[string][]byte, error) {
+	size, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	hash := make(map[string][]byte, size)
+	for i := 0; i < size; i++ {
+		field, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		value, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		hash[string(field)] = value
+	}
+	return hash, nil
+}
+
+func (dec *Decoder) readZSet(binaryScore bool) ([]*ZSetEntry, error) {
+	size, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*ZSetEntry, 0, size)
+	for i := 0; i < size; i++ {
+		member, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if binaryScore {
+			score, err = dec.readBinaryScore()
+		} else {
+			score, err = dec.readScore()
+		}
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &ZSetEntry{Member: string(member), Score: score})
+	}
+	return entries, nil
+}
+
+// readPacked reads a string blob and parses the elements packed in it
+func (dec *Decoder) readPacked(parse func([]byte) ([][]byte, error)) ([][]byte, error) {
+	blob, err := dec.readString()
+	if err != nil {
+		return nil, err
+	}
+	return parse(blob)
+}
+
+func (dec *Decoder) readQuickList() ([][]byte, error) {
+	size, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, 0)
+	for i := 0; i < size; i++ {
+		node, err := dec.readPacked(parseZipList)
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, node...)
+	}
+	return values, nil
+}
+
+func (dec *Decoder) readQuickList2() ([][]byte, error) {
+	size, err := dec.readCount()
+	if err != nil {
+		return nil, err
+	}
+	values := make([][]byte, 0)
+	for i := 0; i < size; i++ {
+		container, err := dec.readCount()
+		if err != nil {
+			return nil, err
+		}
+		blob, err := dec.readString()
+		if err != nil {
+			return nil, err
+		}
+		switch container {
+		case quickListNodePlain:
+			values = append(values, blob)
+		case quickListNodePacked:
+			node, err := parseListPack(blob)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, node...)
+		default:
+			return nil, fmt.Errorf("unknown quicklist container %d", container)
+		}
+	}
+	return values, nil
+}
+
+func (dec *Decoder) readPackedPairs(listPack bool) ([][]byte, error) {
+	parse := parseZipList
+	if listPack {
+		parse = parseListPack
+	}
+	values, err := dec.readPacked(parse)
+	if err != nil {
+		return nil, err
+	}
+	if len(values)%2 != 0 {
+		return nil, errors.New("odd number of packed elements")
+	}
+	return values, nil
+}
+
+func (dec *Decoder) readPackedHash(listPack bool) (map[string][]byte, error) {
+	values, err := dec.readPackedPairs(listPack)
+	if err != nil {
+		return nil, err
+	}
+	hash := make(map[string][]byte, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		hash[string(values[i])] = values[i+1]
+	}
+	return hash, nil
+}
+
+func (dec *Decoder) readPackedZSet(listPack bool) ([]*ZSetEntry, error) {
+	values, err := dec.readPackedPairs(listPack)
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]*ZSetEntry, 0, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		score, err := strconv.ParseFloat(string(values[i+1]), 64)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &ZSetEntry{Member: string(values[i]), Score: score})
+	}
+	return entries, nil
+}
@@ -0,0 +1,68 @@
+package rdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// dumpFooterSize is the size of the rdb version and the checksum closing a DUMP payload
+const dumpFooterSize = 10
+
+// ErrDumpPayload is returned when a DUMP payload is malformed or comes from a newer rdb version
+var ErrDumpPayload = errors.New("DUMP payload version or checksum are wrong")
+
+// Dump serializes the value of the object the way DUMP does:
+// the value type and the value, followed by the rdb version and a checksum of the bytes before it
+func Dump(o *Object) ([]byte, error) {
+	valueType, ok := valueTypes[o.Type]
+	if !ok {
+		return nil, errors.New("unknown object type " + string(o.Type))
+	}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.writeByte(valueType); err != nil {
+		return nil, err
+	}
+	if err := enc.writeValue(o); err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint16(enc.buf[:2], version)
+	if err := enc.write(enc.buf[:2]); err != nil {
+		return nil, err
+	}
+	binary.LittleEndian.PutUint64(enc.buf[:8], enc.crc)
+	if _, err := enc.writer.Write(enc.buf[:8]); err != nil {
+		return nil, err
+	}
+	if err := enc.writer.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Restore decodes a payload created by Dump, the key and expiration of the object are left empty
+func Restore(payload []byte) (*Object, error) {
+	if len(payload) < dumpFooterSize {
+		return nil, ErrDumpPayload
+	}
+	body := payload[:len(payload)-8]
+	if binary.LittleEndian.Uint16(body[len(body)-2:]) > maxVersion {
+		return nil, ErrDumpPayload
+	}
+	if crc := binary.LittleEndian.Uint64(payload[len(body):]); crc != 0 && crc != crc64Update(0, body) {
+		// a zero checksum means it was disabled by the sender
+		return nil, ErrDumpPayload
+	}
+	dec := NewDecoder(bytes.NewReader(body[:len(body)-2]))
+	dec.version = int(binary.LittleEndian.Uint16(body[len(body)-2:]))
+	valueType, err := dec.readByte()
+	if err != nil {
+		return nil, ErrDumpPayload
+	}
+	o := &Object{}
+	if err := dec.readObject(o, valueType); err != nil {
+		return nil, ErrDumpPayload
+	}
+	return o, nil
+}
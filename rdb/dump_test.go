@@ -0,0 +1,51 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestDumpRestore(t *testing.T) {
+	for _, o := range testObjects() {
+		payload, err := Dump(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		restored, err := Restore(payload)
+		if err != nil {
+			t.Fatalf("restore %s: %v", o.Key, err)
+		}
+		// the payload holds the value only
+		restored.Key, restored.DBIndex, restored.ExpireAt = o.Key, o.DBIndex, o.ExpireAt
+		assertObjects(t, []*Object{restored}, []*Object{o})
+	}
+}
+
+func TestRestoreInvalid(t *testing.T) {
+	payload, err := Dump(&Object{Type: StringType, String: []byte("hello")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutChecksum := append([]byte(nil), payload...)
+	binary.LittleEndian.PutUint64(withoutChecksum[len(payload)-8:], 0)
+	if _, err := Restore(withoutChecksum); err != nil {
+		t.Errorf("expected a zero checksum accepted, got %v", err)
+	}
+
+	corrupted := append([]byte(nil), payload...)
+	corrupted[2] ^= 0xff
+	newer := append([]byte(nil), payload...)
+	binary.LittleEndian.PutUint16(newer[len(payload)-10:], maxVersion+1)
+	binary.LittleEndian.PutUint64(newer[len(payload)-8:], 0)
+	truncated := append([]byte(nil), withoutChecksum[1:]...)
+	for name, p := range map[string][]byte{
+		"corrupted": corrupted,
+		"newer":     newer,
+		"short":     payload[:dumpFooterSize-1],
+		"truncated": truncated,
+	} {
+		if _, err := Restore(p); err != ErrDumpPayload {
+			t.Errorf("%s: expected ErrDumpPayload, got %v", name, err)
+		}
+	}
+}
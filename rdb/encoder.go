@@ -0,0 +1,265 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+)
+
+// Encoder writes a rdb file, objects are written in the plain encodings every redis version loads
+type Encoder struct {
+	writer *bufio.Writer
+	crc    uint64
+	buf    [9]byte
+}
+
+// NewEncoder creates an encoder writing to w
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{
+		writer: bufio.NewWriter(w),
+	}
+}
+
+func (enc *Encoder) write(p []byte) error {
+	enc.crc = crc64Update(enc.crc, p)
+	_, err := enc.writer.Write(p)
+	return err
+}
+
+func (enc *Encoder) writeByte(b byte) error {
+	enc.buf[0] = b
+	return enc.write(enc.buf[:1])
+}
+
+// writeLength writes n in the length encoding
+func (enc *Encoder) writeLength(n uint64) error {
+	var p []byte
+	switch {
+	case n < 1<<6:
+		enc.buf[0] = byte(n)
+		p = enc.buf[:1]
+	case n < 1<<14:
+		enc.buf[0] = byte(n>>8) | len14Bit<<6
+		enc.buf[1] = byte(n)
+		p = enc.buf[:2]
+	case n <= math.MaxUint32:
+		enc.buf[0] = len32Bit
+		binary.BigEndian.PutUint32(enc.buf[1:], uint32(n))
+		p = enc.buf[:5]
+	default:
+		enc.buf[0] = len64Bit
+		binary.BigEndian.PutUint64(enc.buf[1:], n)
+		p = enc.buf[:9]
+	}
+	return enc.write(p)
+}
+
+// writeString writes a string, strings holding a small integer are stored as the integer
+func (enc *Encoder) writeString(s []byte) error {
+	if len(s) <= 11 {
+		if n, err := strconv.ParseInt(string(s), 10, 32); err == nil && strconv.FormatInt(n, 10) == string(s) {
+			return enc.writeInt(n)
+		}
+	}
+	if err := enc.writeLength(uint64(len(s))); err != nil {
+		return err
+	}
+	return enc.write(s)
+}
+
+func (enc *Encoder) writeInt(n int64) error {
+	var p []byte
+	switch {
+	case n >= math.MinInt8 && n <= math.MaxInt8:
+		enc.buf[0] = lenEncV<<6 | encodeInt8
+		enc.buf[1] = byte(int8(n))
+		p = enc.buf[:2]
+	case n >= math.MinInt16 && n <= math.MaxInt16:
+		enc.buf[0] = lenEncV<<6 | encodeInt16
+		binary.LittleEndian.PutUint16(enc.buf[1:], uint16(int16(n)))
+		p = enc.buf[:3]
+	default:
+		enc.buf[0] = lenEncV<<6 | encodeInt32
+		binary.LittleEndian.PutUint32(enc.buf[1:], uint32(int32(n)))
+		p = enc.buf[:5]
+	}
+	return enc.write(p)
+}
+
+// WriteHeader writes the magic string, version and the auxiliary fields describing the file
+func (enc *Encoder) WriteHeader() error {
+	if err := enc.write([]byte(fmt.Sprintf("%s%04d", magic, version))); err != nil {
+		return err
+	}
+	aux := [][2]string{
+		{"redis-ver", "7.0.0"},
+		{"redis-bits", strconv.Itoa(strconv.IntSize)},
+		{"ctime", strconv.FormatInt(time.Now().Unix(), 10)},
+		{"aof-base", "0"},
+	}
+	for _, field := range aux {
+		if err := enc.WriteAux(field[0], field[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteAux writes an auxiliary field
+func (enc *Encoder) WriteAux(key string, value string) error {
+	if err := enc.writeByte(opcodeAux); err != nil {
+		return err
+	}
+	if err := enc.writeString([]byte(key)); err != nil {
+		return err
+	}
+	return enc.writeString([]byte(value))
+}
+
+// WriteDBHeader starts the keys of a db, the sizes are hints for the loader
+func (enc *Encoder) WriteDBHeader(dbIndex int, keyCount uint64, ttlCount uint64) error {
+	if err := enc.writeByte(opcodeSelectDB); err != nil {
+		return err
+	}
+	if err := enc.writeLength(uint64(dbIndex)); err != nil {
+		return err
+	}
+	if err := enc.writeByte(opcodeResizeDB); err != nil {
+		return err
+	}
+	if err := enc.writeLength(keyCount); err != nil {
+		return err
+	}
+	return enc.writeLength(ttlCount)
+}
+
+// writeObjectHeader writes the expiration, value type and key of an object
+func (enc *Encoder) writeObjectHeader(key string, valueType byte, expireAt *time.Time) error {
+	if expireAt != nil {
+		if err := enc.writeByte(opcodeExpireTimeMs); err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(enc.buf[:8], uint64(expireAt.UnixNano()/int64(time.Millisecond)))
+		if err := enc.write(enc.buf[:8]); err != nil {
+			return err
+		}
+	}
+	if err := enc.writeByte(valueType); err != nil {
+		return err
+	}
+	return enc.writeString([]byte(key))
+}
+
+// WriteStringObject writes a string
+func (enc *Encoder) WriteStringObject(key string, value []byte, expireAt *time.Time) error {
+	return enc.WriteObject(&Object{Key: key, ExpireAt: expireAt, Type: StringType, String: value})
+}
+
+// WriteListObject writes a list
+func (enc *Encoder) WriteListObject(key string, values [][]byte, expireAt *time.Time) error {
+	return enc.WriteObject(&Object{Key: key, ExpireAt: expireAt, Type: ListType, List: values})
+}
+
+// WriteSetObject writes a set
+func (enc *Encoder) WriteSetObject(key string, members [][]byte, expireAt *time.Time) error {
+	return enc.WriteObject(&Object{Key: key, ExpireAt: expireAt, Type: SetType, Set: members})
+}
+
+// WriteHashObject writes a hash
+func (enc *Encoder) WriteHashObject(key string, fields map[string][]byte, expireAt *time.Time) error {
+	return enc.WriteObject(&Object{Key: key, ExpireAt: expireAt, Type: HashType, Hash: fields})
+}
+
+// WriteZSetObject writes a sorted set with binary scores
+func (enc *Encoder) WriteZSetObject(key string, entries []*ZSetEntry, expireAt *time.Time) error {
+	return enc.WriteObject(&Object{Key: key, ExpireAt: expireAt, Type: ZSetType, ZSet: entries})
+}
+
+// valueTypes are the value types objects are written with
+var valueTypes = map[ObjectType]byte{
+	StringType: typeString,
+	ListType:   typeList,
+	SetType:    typeSet,
+	HashType:   typeHash,
+	ZSetType:   typeZSet2,
+}
+
+// writeValue writes the value of the object without its key
+func (enc *Encoder) writeValue(o *Object) error {
+	switch o.Type {
+	case StringType:
+		return enc.writeString(o.String)
+	case ListType:
+		return enc.writeStrings(o.List)
+	case SetType:
+		return enc.writeStrings(o.Set)
+	case HashType:
+		if err := enc.writeLength(uint64(len(o.Hash))); err != nil {
+			return err
+		}
+		for field, value := range o.Hash {
+			if err := enc.writeString([]byte(field)); err != nil {
+				return err
+			}
+			if err := enc.writeString(value); err != nil {
+				return err
+			}
+		}
+		return nil
+	case ZSetType:
+		if err := enc.writeLength(uint64(len(o.ZSet))); err != nil {
+			return err
+		}
+		for _, entry := range o.ZSet {
+			if err := enc.writeString([]byte(entry.Member)); err != nil {
+				return err
+			}
+			binary.LittleEndian.PutUint64(enc.buf[:8], math.Float64bits(entry.Score))
+			if err := enc.write(enc.buf[:8]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown object type %s", o.Type)
+}
+
+func (enc *Encoder) writeStrings(values [][]byte) error {
+	if err := enc.writeLength(uint64(len(values))); err != nil {
+		return err
+	}
+	for _, value := range values {
+		if err := enc.writeString(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteEnd writes the end of file mark and the checksum, then flushes the buffer
+func (enc *Encoder) WriteEnd() error {
+	if err := enc.writeByte(opcodeEOF); err != nil {
+		return err
+	}
+	binary.LittleEndian.PutUint64(enc.buf[:8], enc.crc)
+	if _, err := enc.writer.Write(enc.buf[:8]); err != nil {
+		return err
+	}
+	return enc.writer.Flush()
+}
+
+// WriteObject writes an object by its type
+func (enc *Encoder) WriteObject(o *Object) error {
+	valueType, ok := valueTypes[o.Type]
+	if !ok {
+		return fmt.Errorf("unknown object type %s", o.Type)
+	}
+	if err := enc.writeObjectHeader(o.Key, valueType, o.ExpireAt); err != nil {
+		return err
+	}
+	return enc.writeValue(o)
+}
@@ -0,0 +1,263 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+var errPacked = errors.New("malformed packed encoding")
+
+// lzfDecompress expands data compressed by lzf into rawLen bytes
+func lzfDecompress(in []byte, rawLen int) ([]byte, error) {
+	out := make([]byte, 0, rawLen)
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 {
+			// literal run of ctrl+1 bytes
+			end := i + ctrl + 1
+			if end > len(in) {
+				return nil, errPacked
+			}
+			out = append(out, in[i:end]...)
+			i = end
+			continue
+		}
+		// back reference
+		length := ctrl >> 5
+		if length == 7 {
+			if i >= len(in) {
+				return nil, errPacked
+			}
+			length += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errPacked
+		}
+		ref := len(out) - (ctrl&0x1F)<<8 - int(in[i]) - 1
+		i++
+		if ref < 0 {
+			return nil, errPacked
+		}
+		for j := 0; j < length+2; j++ {
+			out = append(out, out[ref+j]) // the reference may overlap the bytes being written
+		}
+	}
+	if len(out) != rawLen {
+		return nil, errPacked
+	}
+	return out, nil
+}
+
+// parseIntSet parses an intset: encoding and length as 32 bit integers, then the members
+func parseIntSet(blob []byte) ([][]byte, error) {
+	if len(blob) < 8 {
+		return nil, errPacked
+	}
+	width := int(binary.LittleEndian.Uint32(blob))
+	size := int(binary.LittleEndian.Uint32(blob[4:]))
+	if (width != 2 && width != 4 && width != 8) || len(blob) != 8+width*size {
+		return nil, errPacked
+	}
+	members := make([][]byte, 0, size)
+	for i := 0; i < size; i++ {
+		p := blob[8+i*width:]
+		var n int64
+		switch width {
+		case 2:
+			n = int64(int16(binary.LittleEndian.Uint16(p)))
+		case 4:
+			n = int64(int32(binary.LittleEndian.Uint32(p)))
+		case 8:
+			n = int64(binary.LittleEndian.Uint64(p))
+		}
+		members = append(members, []byte(strconv.FormatInt(n, 10)))
+	}
+	return members, nil
+}
+
+// parseZipList parses a ziplist: a 10 bytes header, entries, and 0xFF.
+// An entry is the length of the previous entry, an encoding and the content.
+func parseZipList(blob []byte) ([][]byte, error) {
+	if len(blob) < 11 {
+		return nil, errPacked
+	}
+	values := make([][]byte, 0, binary.LittleEndian.Uint16(blob[8:]))
+	i := 10
+	for {
+		if i >= len(blob) {
+			return nil, errPacked
+		}
+		if blob[i] == 0xFF {
+			return values, nil
+		}
+		// skip previous entry length
+		if blob[i] < 254 {
+			i++
+		} else {
+			i += 5
+		}
+		if i >= len(blob) {
+			return nil, errPacked
+		}
+		value, n, err := parseZipListEntry(blob[i:])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		i += n
+	}
+}
+
+// parseZipListEntry parses the encoding and content of an entry, returns the bytes consumed
+func parseZipListEntry(p []byte) ([]byte, int, error) {
+	header := p[0]
+	var length, offset int
+	switch header >> 6 {
+	case 0:
+		length, offset = int(header&0x3F), 1
+	case 1:
+		if len(p) < 2 {
+			return nil, 0, errPacked
+		}
+		length, offset = int(header&0x3F)<<8|int(p[1]), 2
+	case 2:
+		if len(p) < 5 {
+			return nil, 0, errPacked
+		}
+		length, offset = int(binary.BigEndian.Uint32(p[1:])), 5
+	default:
+		var size int
+		switch header {
+		case 0xC0:
+			size = 2
+		case 0xD0:
+			size = 4
+		case 0xE0:
+			size = 8
+		case 0xF0:
+			size = 3
+		case 0xFE:
+			size = 1
+		default:
+			if header >= 0xF1 && header <= 0xFD {
+				return []byte(strconv.Itoa(int(header&0x0F) - 1)), 1, nil
+			}
+			return nil, 0, fmt.Errorf("unknown ziplist encoding %#x", header)
+		}
+		if len(p) < 1+size {
+			return nil, 0, errPacked
+		}
+		return []byte(strconv.FormatInt(littleEndianInt(p[1:1+size]), 10)), 1 + size, nil
+	}
+	if offset+length > len(p) {
+		return nil, 0, errPacked
+	}
+	return p[offset : offset+length], offset + length, nil
+}
+
+// parseListPack parses a listpack: a 6 bytes header, entries, and 0xFF.
+// An entry is an encoding, the content, and the entry length backwards.
+func parseListPack(blob []byte) ([][]byte, error) {
+	if len(blob) < 7 {
+		return nil, errPacked
+	}
+	values := make([][]byte, 0, binary.LittleEndian.Uint16(blob[4:]))
+	i := 6
+	for {
+		if i >= len(blob) {
+			return nil, errPacked
+		}
+		if blob[i] == 0xFF {
+			return values, nil
+		}
+		value, n, err := parseListPackEntry(blob[i:])
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		i += n + backLenSize(n)
+	}
+}
+
+// parseListPackEntry parses the encoding and content of an entry, returns the bytes consumed
+func parseListPackEntry(p []byte) ([]byte, int, error) {
+	header := p[0]
+	str := func(offset, length int) ([]byte, int, error) {
+		if offset+length > len(p) {
+			return nil, 0, errPacked
+		}
+		return p[offset : offset+length], offset + length, nil
+	}
+	integer := func(size int) ([]byte, int, error) {
+		if len(p) < 1+size {
+			return nil, 0, errPacked
+		}
+		return []byte(strconv.FormatInt(littleEndianInt(p[1:1+size]), 10)), 1 + size, nil
+	}
+	switch {
+	case header&0x80 == 0: // 7 bit unsigned integer
+		return []byte(strconv.Itoa(int(header))), 1, nil
+	case header&0xC0 == 0x80: // 6 bit string length
+		return str(1, int(header&0x3F))
+	case header&0xE0 == 0xC0: // 13 bit signed integer
+		if len(p) < 2 {
+			return nil, 0, errPacked
+		}
+		v := int64(header&0x1F)<<8 | int64(p[1])
+		if v >= 1<<12 {
+			v -= 1 << 13
+		}
+		return []byte(strconv.FormatInt(v, 10)), 2, nil
+	case header&0xF0 == 0xE0: // 12 bit string length
+		if len(p) < 2 {
+			return nil, 0, errPacked
+		}
+		return str(2, int(header&0x0F)<<8|int(p[1]))
+	}
+	switch header {
+	case 0xF0: // 32 bit string length
+		if len(p) < 5 {
+			return nil, 0, errPacked
+		}
+		return str(5, int(binary.LittleEndian.Uint32(p[1:])))
+	case 0xF1:
+		return integer(2)
+	case 0xF2:
+		return integer(3)
+	case 0xF3:
+		return integer(4)
+	case 0xF4:
+		return integer(8)
+	}
+	return nil, 0, fmt.Errorf("unknown listpack encoding %#x", header)
+}
+
+// backLenSize returns the size of the backward length of an entry of n bytes
+func backLenSize(n int) int {
+	switch {
+	case n <= 127:
+		return 1
+	case n < 16383:
+		return 2
+	case n < 2097151:
+		return 3
+	case n < 268435455:
+		return 4
+	default:
+		return 5
+	}
+}
+
+// littleEndianInt decodes a signed little endian integer of len(p) bytes
+func littleEndianInt(p []byte) int64 {
+	var v uint64
+	for i := len(p) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(p[i])
+	}
+	shift := uint(64 - 8*len(p))
+	return int64(v<<shift) >> shift
+}
@@ -0,0 +1,86 @@
+// Package rdb reads and writes snapshots in the redis rdb file format
+package rdb
+
+import "errors"
+
+// version is the rdb version written in the header,
+// files of versions up to maxVersion can be read
+const (
+	version    = 9
+	maxVersion = 12
+	magic      = "REDIS"
+)
+
+// opcodes
+const (
+	opcodeSlotInfo     = 0xF4
+	opcodeFunction2    = 0xF5
+	opcodeFunction     = 0xF6
+	opcodeModuleAux    = 0xF7
+	opcodeIdle         = 0xF8
+	opcodeFreq         = 0xF9
+	opcodeAux          = 0xFA
+	opcodeResizeDB     = 0xFB
+	opcodeExpireTimeMs = 0xFC
+	opcodeExpireTime   = 0xFD
+	opcodeSelectDB     = 0xFE
+	opcodeEOF          = 0xFF
+)
+
+// value types
+const (
+	typeString          = 0
+	typeList            = 1
+	typeSet             = 2
+	typeZSet            = 3
+	typeHash            = 4
+	typeZSet2           = 5
+	typeListZipList     = 10
+	typeSetIntSet       = 11
+	typeZSetZipList     = 12
+	typeHashZipList     = 13
+	typeListQuickList   = 14
+	typeHashListPack    = 16
+	typeZSetListPack    = 17
+	typeListQuickList2  = 18
+	typeSetListPack     = 20
+	quickListNodePlain  = 1
+	quickListNodePacked = 2
+)
+
+// length encodings, the two highest bits of the first byte
+const (
+	len6Bit  = 0
+	len14Bit = 1
+	len32Bit = 0x80
+	len64Bit = 0x81
+	lenEncV  = 3
+)
+
+// special encodings of strings
+const (
+	encodeInt8  = 0
+	encodeInt16 = 1
+	encodeInt32 = 2
+	encodeLZF   = 3
+)
+
+// ObjectType is the type of a decoded value
+type ObjectType string
+
+const (
+	StringType ObjectType = "string"
+	ListType   ObjectType = "list"
+	SetType    ObjectType = "set"
+	HashType   ObjectType = "hash"
+	ZSetType   ObjectType = "zset"
+)
+
+// ZSetEntry is a member of a sorted set with its score
+type ZSetEntry struct {
+	Member string
+	Score  float64
+}
+
+// ErrChecksum is returned when the checksum at the end of the file does not match its content
+var ErrChecksum = errors.New("rdb checksum mismatch")
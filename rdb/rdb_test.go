@@ -0,0 +1,173 @@
+package rdb
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func testObjects() []*Object {
+	expireAt := time.Unix(4102444800, 123*int64(time.Millisecond))
+	return []*Object{
+		{Key: "str", Type: StringType, String: []byte("hello")},
+		{Key: "int", Type: StringType, String: []byte("-12345"), ExpireAt: &expireAt},
+		{Key: "padded", Type: StringType, String: []byte("007")},
+		{Key: "list", Type: ListType, List: [][]byte{[]byte("a"), []byte("1"), []byte("")}},
+		{Key: "set", Type: SetType, Set: [][]byte{[]byte("70000"), []byte("x")}},
+		{Key: "hash", Type: HashType, Hash: map[string][]byte{"f": []byte("v"), "n": []byte("2")}},
+		{DBIndex: 5, Key: "zset", Type: ZSetType, ZSet: []*ZSetEntry{
+			{Member: "a", Score: -1.5}, {Member: "b", Score: 0.1}, {Member: "c", Score: math.Inf(1)},
+		}},
+	}
+}
+
+func encodeObjects(t *testing.T, objects []*Object) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	dbIndex := -1
+	for _, o := range objects {
+		if o.DBIndex != dbIndex {
+			dbIndex = o.DBIndex
+			if err := enc.WriteDBHeader(dbIndex, 0, 0); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := enc.WriteObject(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := enc.WriteEnd(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func decodeObjects(data []byte) ([]*Object, *Decoder, error) {
+	var objects []*Object
+	dec := NewDecoder(bytes.NewReader(data))
+	err := dec.Parse(func(o *Object) bool {
+		objects = append(objects, o)
+		return true
+	})
+	return objects, dec, err
+}
+
+func assertObjects(t *testing.T, actual []*Object, expected []*Object) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %d objects, got %d", len(expected), len(actual))
+	}
+	for i, o := range actual {
+		e := expected[i]
+		if o.ExpireAt != nil && e.ExpireAt != nil && o.ExpireAt.Equal(*e.ExpireAt) {
+			o.ExpireAt = e.ExpireAt
+		}
+		if o.Type == SetType {
+			sort.Slice(o.Set, func(i, j int) bool { return bytes.Compare(o.Set[i], o.Set[j]) < 0 })
+		}
+		if !reflect.DeepEqual(o, e) {
+			t.Errorf("expected %+v, got %+v", e, o)
+		}
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	objects := testObjects()
+	decoded, dec, err := decodeObjects(encodeObjects(t, objects))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertObjects(t, decoded, objects)
+	if dec.Aux()["redis-ver"] == "" {
+		t.Error("expected the aux fields of the header")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	// the check value of CRC-64-Jones
+	if crc := crc64Update(0, []byte("123456789")); crc != 0xe9c6d914c4b8d9ca {
+		t.Errorf("expected crc64 0xe9c6d914c4b8d9ca, got %#x", crc)
+	}
+	// DUMP of SET mykey 10 in the documentation of redis: an integer encoded string, rdb version 9 and the crc
+	o, err := Restore([]byte("\x00\xc0\n\t\x00\xbem\x06\x89Z(\x00\n"))
+	if err != nil || o.Type != StringType || string(o.String) != "10" {
+		t.Errorf("expected the string 10 restored, got %+v, %v", o, err)
+	}
+
+	data := encodeObjects(t, testObjects())
+	i := bytes.Index(data, []byte("hello"))
+	data[i] = 'j'
+	if _, _, err := decodeObjects(data); err != ErrChecksum {
+		t.Errorf("expected checksum mismatch, got %v", err)
+	}
+	if _, _, err := decodeObjects(data[:len(data)-20]); err == nil {
+		t.Error("expected a truncated file to fail")
+	}
+}
+
+func TestParseIntSet(t *testing.T) {
+	// 16 bit encoding, 3 members
+	blob := []byte{2, 0, 0, 0, 3, 0, 0, 0, 0xFE, 0xFF, 1, 0, 0x10, 0x27}
+	assertValues(t, mustParse(t, parseIntSet, blob), "-2", "1", "10000")
+	if _, err := parseIntSet(blob[:12]); err == nil {
+		t.Error("expected a truncated intset to fail")
+	}
+}
+
+func TestParseZipList(t *testing.T) {
+	blob := []byte{0, 0, 0, 0, 0, 0, 0, 0, 4, 0,
+		0, 0x02, 'a', 'b', // 6 bit string
+		4, 0xF3, // 4 bit immediate integer 2
+		2, 0xC0, 0x18, 0xFC, // 16 bit integer -1000
+		4, 0xFE, 0x80, // 8 bit integer -128
+		0xFF}
+	assertValues(t, mustParse(t, parseZipList, blob), "ab", "2", "-1000", "-128")
+}
+
+func TestParseListPack(t *testing.T) {
+	blob := []byte{0, 0, 0, 0, 3, 0,
+		0x82, 'h', 'i', 3, // 6 bit string
+		0x05, 1, // 7 bit integer
+		0xDF, 0xFF, 2, // 13 bit integer -1
+		0xFF}
+	assertValues(t, mustParse(t, parseListPack, blob), "hi", "5", "-1")
+}
+
+func TestLzfDecompress(t *testing.T) {
+	// a literal run of abc, then a back reference copying 6 bytes from 3 bytes back
+	out, err := lzfDecompress([]byte{0x02, 'a', 'b', 'c', 0x80, 0x02}, 9)
+	if err != nil || string(out) != "abcabcabc" {
+		t.Errorf("expected abcabcabc, got %q, %v", out, err)
+	}
+	if _, err := lzfDecompress([]byte{0x02, 'a', 'b', 'c', 0x80, 0x02}, 8); err == nil {
+		t.Error("expected a wrong length to fail")
+	}
+}
+
+func mustParse(t *testing.T, parse func([]byte) ([][]byte, error), blob []byte) [][]byte {
+	t.Helper()
+	values, err := parse(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func assertValues(t *testing.T, actual [][]byte, expected ...string) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Fatalf("expected %q, got %q", expected, actual)
+	}
+	for i := range actual {
+		if string(actual[i]) != expected[i] {
+			t.Fatalf("expected %q, got %q", expected, actual)
+		}
+	}
+}
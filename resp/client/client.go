@@ -3,14 +3,17 @@
 package client
 
 import (
+	"errors"
 	"net"
 	"runtime/debug"
+	"strings"
 	"sync"
 	"time"
 
 	"go-redis/interface/resp"
 	"go-redis/lib/logger"
 	"go-redis/lib/sync/wait"
+	"go-redis/lib/utils"
 	"go-redis/resp/parser"
 	"go-redis/resp/reply"
 )
@@ -22,6 +25,8 @@ type Client struct {
 	waitingReqs chan *request // waiting response
 	ticker      *time.Ticker
 	addr        string
+	// credentials returns the user and password every connection authenticates with, nil for none
+	credentials func() (username string, password string)
 
 	working *sync.WaitGroup // its counter presents unfinished requests(pending and waiting)
 }
@@ -43,17 +48,73 @@ const (
 
 // MakeClient creates a new client
 func MakeClient(addr string) (*Client, error) {
-	conn, err := net.Dial("tcp", addr)
-	if err != nil {
-		return nil, err
-	}
-	return &Client{
+	return MakeAuthClient(addr, nil)
+}
+
+// MakeAuthClient creates a new client authenticating its connection, and the ones replacing it after errors,
+// with the current credentials. An empty password sends no AUTH, an empty user name authenticates the default user.
+func MakeAuthClient(addr string, credentials func() (username string, password string)) (*Client, error) {
+	client := &Client{
 		addr:        addr,
-		conn:        conn,
+		credentials: credentials,
 		pendingReqs: make(chan *request, chanSize),
 		waitingReqs: make(chan *request, chanSize),
 		working:     &sync.WaitGroup{},
-	}, nil
+	}
+	conn, err := client.dial()
+	if err != nil {
+		return nil, err
+	}
+	client.conn = conn
+	return client, nil
+}
+
+// dial connects to the server and authenticates the connection before it carries any request
+func (client *Client) dial() (net.Conn, error) {
+	conn, err := net.Dial("tcp", client.addr)
+	if err != nil {
+		return nil, err
+	}
+	if client.credentials == nil {
+		return conn, nil
+	}
+	username, password := client.credentials()
+	if password == "" {
+		return conn, nil
+	}
+	args := utils.ToCmdLine("AUTH", password)
+	if username != "" {
+		args = utils.ToCmdLine("AUTH", username, password)
+	}
+	if err := handshake(conn, args); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// handshake sends a command replied by a single line, e.g. AUTH, before the pipeline starts reading the connection
+func handshake(conn net.Conn, args [][]byte) error {
+	_ = conn.SetDeadline(time.Now().Add(maxWait))
+	defer func() {
+		_ = conn.SetDeadline(time.Time{})
+	}()
+	if _, err := conn.Write(reply.MakeMultiBulkReply(args).ToBytes()); err != nil {
+		return err
+	}
+	// read byte by byte so nothing after the line is consumed
+	var line []byte
+	b := make([]byte, 1)
+	for len(line) == 0 || line[len(line)-1] != '\n' {
+		if _, err := conn.Read(b); err != nil {
+			return err
+		}
+		line = append(line, b[0])
+	}
+	if line[0] == '-' {
+		return errors.New(strings.TrimSpace(string(line[1:])))
+	}
+	return nil
 }
 
 // Start starts a client in asynchronous goroutines
@@ -97,7 +158,7 @@ func (client *Client) handleConnectionError(err error) error {
 		}
 	}
 
-	conn, err1 := net.Dial("tcp", client.addr)
+	conn, err1 := client.dial()
 	if err1 != nil {
 		logger.Error(err1)
 		return err1
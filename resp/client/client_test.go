@@ -0,0 +1,119 @@
+package client
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"go-redis/lib/utils"
+	"go-redis/resp/parser"
+	"go-redis/resp/reply"
+)
+
+// fakeServer records the commands it receives, AUTH is accepted with the password secret only
+type fakeServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	commands []string
+}
+
+func startFakeServer(t *testing.T) *fakeServer {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeServer{listener: listener}
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for p := range parser.ParseStream(conn) {
+		if p.Err != nil {
+			return
+		}
+		r, ok := p.Data.(*reply.MultiBulkReply)
+		if !ok {
+			continue
+		}
+		args := make([]string, len(r.Args))
+		for i, arg := range r.Args {
+			args[i] = string(arg)
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, strings.Join(args, " "))
+		s.mu.Unlock()
+		var result []byte
+		if strings.EqualFold(args[0], "auth") && args[len(args)-1] != "secret" {
+			result = reply.MakeStandardErrReply("WRONGPASS invalid username-password pair").ToBytes()
+		} else {
+			result = reply.MakeOKReply().ToBytes()
+		}
+		_, _ = conn.Write(result)
+	}
+}
+
+func (s *fakeServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func TestAuthClient(t *testing.T) {
+	s := startFakeServer(t)
+	client, err := MakeAuthClient(s.listener.Addr().String(), func() (string, string) {
+		return "relay", "secret"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Start()
+	defer client.Close()
+	for i := 0; i < 2; i++ {
+		if r := client.Send(utils.ToCmdLine("SET", "k", "v")); string(r.ToBytes()) != "+OK\r\n" {
+			t.Fatalf("unexpected reply %q", r.ToBytes())
+		}
+	}
+	// the connection authenticates once before its first command
+	if received := strings.Join(s.received(), ","); received != "AUTH relay secret,SET k v,SET k v" {
+		t.Errorf("unexpected commands %s", received)
+	}
+}
+
+func TestAuthClientRefused(t *testing.T) {
+	s := startFakeServer(t)
+	_, err := MakeAuthClient(s.listener.Addr().String(), func() (string, string) {
+		return "", "wrong"
+	})
+	if err == nil || err.Error() != "WRONGPASS invalid username-password pair" {
+		t.Errorf("expected the refused password reported, got %v", err)
+	}
+
+	// no AUTH without password
+	client, err := MakeAuthClient(s.listener.Addr().String(), func() (string, string) {
+		return "", ""
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.Start()
+	defer client.Close()
+	client.Send(utils.ToCmdLine("PING"))
+	if received := strings.Join(s.received(), ","); received != "AUTH wrong,PING" {
+		t.Errorf("unexpected commands %s", received)
+	}
+}
@@ -3,6 +3,7 @@ package connection
 import (
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"go-redis/lib/sync/wait"
@@ -14,12 +15,84 @@ type Connection struct {
 	waitingReply wait.Wait  // waiting until reply finished
 	mu           sync.Mutex // lock while handler sending response
 	selectedDB   int        // selected redis db
+
+	// transaction state
+	multiState bool
+	queue      [][][]byte
+	watching   map[string]uint32
+	txErrors   []error
+
+	// subscribed channels and patterns, accessed by the connection's own goroutine only
+	subs     map[string]struct{}
+	patterns map[string]struct{}
+	// subscriber is 1 while any channel or pattern is subscribed, read by other goroutines atomically
+	subscriber int32
+
+	// asking is set by ASKING and cleared by the next command
+	asking bool
+
+	// unix nano time of the last command, accessed atomically as idle clients are reaped by another goroutine
+	lastActive int64
+
+	// client metadata shown by CLIENT LIST, guarded by metaMu as other clients read it
+	metaMu sync.Mutex
+	info   Info
+
+	// replyMode is set by CLIENT REPLY
+	replyMode int
+	// closeAfterReply is set when the client kills itself by CLIENT KILL
+	closeAfterReply bool
 }
 
+// Info is the client metadata shown by CLIENT LIST,
+// the state of the connection is recorded when the client finishes a command
+type Info struct {
+	ID        uint64
+	Addr      string
+	LocalAddr string
+	Name      string
+	// User the client authenticated as by AUTH or HELLO, empty if none
+	User      string
+	CreatedAt time.Time
+	Idle      time.Duration
+	DB        int
+	Sub       int
+	PSub      int
+	// Multi is the number of queued commands, -1 outside a transaction
+	Multi    int
+	MultiMem int
+	ArgvMem  int
+	// LastCmd is the last or current command, e.g. client|list
+	LastCmd string
+	// Replica is set once the client sent PSYNC or SYNC
+	Replica bool
+	NoEvict bool
+}
+
+// reply modes set by CLIENT REPLY
+const (
+	ReplyOn = iota
+	ReplyOff
+	// ReplySkip skips the reply of the next command
+	ReplySkip
+)
+
+// nextID is the id of the last client, ids are never reused
+var nextID uint64
+
 // NewConn creates a new connection
 func NewConn(conn net.Conn) *Connection {
+	now := time.Now()
 	return &Connection{
-		conn: conn,
+		conn:       conn,
+		lastActive: now.UnixNano(),
+		info: Info{
+			ID:        atomic.AddUint64(&nextID, 1),
+			Addr:      conn.RemoteAddr().String(),
+			LocalAddr: conn.LocalAddr().String(),
+			CreatedAt: now,
+			Multi:     -1,
+		},
 	}
 }
 
@@ -56,3 +129,247 @@ func (c *Connection) Close() error {
 	_ = c.conn.Close()
 	return nil
 }
+
+// InMultiState tells whether the connection is within a transaction
+func (c *Connection) InMultiState() bool {
+	return c.multiState
+}
+
+// SetMultiState sets whether the connection is within a transaction,
+// leaving the transaction discards queued commands, errors and watched keys
+func (c *Connection) SetMultiState(state bool) {
+	if !state {
+		c.watching = nil
+		c.queue = nil
+		c.txErrors = nil
+	}
+	c.multiState = state
+}
+
+// GetQueuedCmdLine returns the commands queued in the transaction
+func (c *Connection) GetQueuedCmdLine() [][][]byte {
+	return c.queue
+}
+
+// EnqueueCmd queues a command of the transaction
+func (c *Connection) EnqueueCmd(cmdLine [][]byte) {
+	c.queue = append(c.queue, cmdLine)
+}
+
+// AddTxError records an error met while queuing commands, EXEC is aborted if there is any
+func (c *Connection) AddTxError(err error) {
+	c.txErrors = append(c.txErrors, err)
+}
+
+// GetTxErrors returns the errors met while queuing commands
+func (c *Connection) GetTxErrors() []error {
+	return c.txErrors
+}
+
+// GetWatching returns the watched keys and their versions
+func (c *Connection) GetWatching() map[string]uint32 {
+	if c.watching == nil {
+		c.watching = make(map[string]uint32)
+	}
+	return c.watching
+}
+
+// Subscribe records a subscribed channel
+func (c *Connection) Subscribe(channel string) {
+	if c.subs == nil {
+		c.subs = make(map[string]struct{})
+	}
+	c.subs[channel] = struct{}{}
+	c.updateSubscriber()
+}
+
+// UnSubscribe removes a subscribed channel
+func (c *Connection) UnSubscribe(channel string) {
+	delete(c.subs, channel)
+	c.updateSubscriber()
+}
+
+// PSubscribe records a subscribed pattern
+func (c *Connection) PSubscribe(pattern string) {
+	if c.patterns == nil {
+		c.patterns = make(map[string]struct{})
+	}
+	c.patterns[pattern] = struct{}{}
+	c.updateSubscriber()
+}
+
+// PUnSubscribe removes a subscribed pattern
+func (c *Connection) PUnSubscribe(pattern string) {
+	delete(c.patterns, pattern)
+	c.updateSubscriber()
+}
+
+func (c *Connection) updateSubscriber() {
+	var subscriber int32
+	if c.SubsCount() > 0 {
+		subscriber = 1
+	}
+	atomic.StoreInt32(&c.subscriber, subscriber)
+}
+
+// IsSubscriber tells whether the client subscribes any channel or pattern, safe to call from any goroutine
+func (c *Connection) IsSubscriber() bool {
+	return atomic.LoadInt32(&c.subscriber) == 1
+}
+
+// SubsCount returns the number of subscribed channels and patterns
+func (c *Connection) SubsCount() int {
+	return len(c.subs) + len(c.patterns)
+}
+
+// GetChannels returns all subscribed channels
+func (c *Connection) GetChannels() []string {
+	channels := make([]string, 0, len(c.subs))
+	for channel := range c.subs {
+		channels = append(channels, channel)
+	}
+	return channels
+}
+
+// GetPatterns returns all subscribed patterns
+func (c *Connection) GetPatterns() []string {
+	patterns := make([]string, 0, len(c.patterns))
+	for pattern := range c.patterns {
+		patterns = append(patterns, pattern)
+	}
+	return patterns
+}
+
+// SetAsking sets whether the next command may access a slot being imported
+func (c *Connection) SetAsking(asking bool) {
+	c.asking = asking
+}
+
+// IsAsking tells whether ASKING was sent before the current command
+func (c *Connection) IsAsking() bool {
+	return c.asking
+}
+
+// SetUser records the user the client authenticated as
+func (c *Connection) SetUser(user string) {
+	c.metaMu.Lock()
+	c.info.User = user
+	c.metaMu.Unlock()
+}
+
+// GetUser returns the user the client authenticated as, empty if none
+func (c *Connection) GetUser() string {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+	return c.info.User
+}
+
+// MarkActive records the client sent a command
+func (c *Connection) MarkActive() {
+	atomic.StoreInt64(&c.lastActive, time.Now().UnixNano())
+}
+
+// IdleTime returns the time since the client sent the last command
+func (c *Connection) IdleTime() time.Duration {
+	return time.Since(time.Unix(0, atomic.LoadInt64(&c.lastActive)))
+}
+
+// ID returns the unique id of the client, 0 for connections created by the server itself
+func (c *Connection) ID() uint64 {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+	return c.info.ID
+}
+
+// SetName sets the name of CLIENT SETNAME, empty removes the name
+func (c *Connection) SetName(name string) {
+	c.metaMu.Lock()
+	c.info.Name = name
+	c.metaMu.Unlock()
+}
+
+// GetName returns the name of CLIENT SETNAME, empty if none
+func (c *Connection) GetName() string {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+	return c.info.Name
+}
+
+// SetNoEvict sets whether the client is excluded from client eviction, see CLIENT NO-EVICT
+func (c *Connection) SetNoEvict(noEvict bool) {
+	c.metaMu.Lock()
+	c.info.NoEvict = noEvict
+	c.metaMu.Unlock()
+}
+
+// StartCommand records the command the client is running, cmd is the name shown by CLIENT LIST
+func (c *Connection) StartCommand(cmd string, cmdLine [][]byte) {
+	argvMem := 0
+	for _, arg := range cmdLine {
+		argvMem += len(arg)
+	}
+	c.metaMu.Lock()
+	c.info.LastCmd = cmd
+	c.info.ArgvMem = argvMem
+	if cmd == "psync" || cmd == "sync" {
+		c.info.Replica = true
+	}
+	c.metaMu.Unlock()
+}
+
+// FinishCommand records the state of the connection after a command for other clients to read
+func (c *Connection) FinishCommand() {
+	multi, multiMem := -1, 0
+	if c.multiState {
+		multi = len(c.queue)
+		for _, cmdLine := range c.queue {
+			for _, arg := range cmdLine {
+				multiMem += len(arg)
+			}
+		}
+	}
+	c.metaMu.Lock()
+	c.info.DB = c.selectedDB
+	c.info.Sub = len(c.subs)
+	c.info.PSub = len(c.patterns)
+	c.info.Multi = multi
+	c.info.MultiMem = multiMem
+	c.info.ArgvMem = 0
+	c.metaMu.Unlock()
+}
+
+// IsReplica tells whether the client is a replica, which sent PSYNC or SYNC
+func (c *Connection) IsReplica() bool {
+	c.metaMu.Lock()
+	defer c.metaMu.Unlock()
+	return c.info.Replica
+}
+
+// Info returns the metadata of the client, safe to call from any goroutine
+func (c *Connection) Info() Info {
+	c.metaMu.Lock()
+	info := c.info
+	c.metaMu.Unlock()
+	info.Idle = c.IdleTime()
+	return info
+}
+
+// SetReplyMode sets the mode of CLIENT REPLY
+func (c *Connection) SetReplyMode(mode int) {
+	c.replyMode = mode
+}
+
+// GetReplyMode returns the mode of CLIENT REPLY
+func (c *Connection) GetReplyMode() int {
+	return c.replyMode
+}
+
+// SetCloseAfterReply closes the connection once the reply of the current command is sent
+func (c *Connection) SetCloseAfterReply() {
+	c.closeAfterReply = true
+}
+
+// IsCloseAfterReply tells whether the connection should be closed once the reply is sent
+func (c *Connection) IsCloseAfterReply() bool {
+	return c.closeAfterReply
+}
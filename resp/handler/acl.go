@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-redis/acl"
+	"go-redis/database"
+	"go-redis/interface/resp"
+	"go-redis/resp/connection"
+	"go-redis/resp/reply"
+)
+
+var (
+	errNoPermKey     = reply.MakeStandardErrReply("NOPERM this user has no permissions to access one of the keys used as arguments")
+	errNoPermChannel = reply.MakeStandardErrReply("NOPERM this user has no permissions to access one of the channels used as arguments")
+)
+
+// subcommandCommands are the commands whose first argument names a subcommand, e.g. ACL SETUSER,
+// rules may allow or deny a subcommand only, e.g. +acl|whoami
+var subcommandCommands = map[string]bool{
+	"acl":     true,
+	"client":  true,
+	"cluster": true,
+	"config":  true,
+	"pubsub":  true,
+}
+
+// notInMultiCommands are run by the handler rather than queued by the database,
+// so they are refused inside MULTI and abort the transaction
+var notInMultiCommands = map[string]bool{
+	"acl":    true,
+	"client": true,
+	"config": true,
+}
+
+// exec runs the command if the user of the client is allowed to
+func (r *RespHandler) exec(c *connection.Connection, args [][]byte) resp.Reply {
+	user := currentUser(c)
+	if user == nil {
+		return errNoAuth
+	}
+	if errReply := checkPermission(c, user, args); errReply != nil {
+		if c.InMultiState() {
+			c.AddTxError(errReply)
+		}
+		return errReply
+	}
+	cmdName := strings.ToLower(string(args[0]))
+	if c.InMultiState() && notInMultiCommands[cmdName] {
+		err := errors.New("ERR " + strings.ToUpper(cmdName) + " inside MULTI is not allowed")
+		c.AddTxError(err)
+		return reply.MakeStandardErrReply(err.Error())
+	}
+	switch cmdName {
+	case "acl":
+		return execACL(c, user, args)
+	case "client":
+		return r.execClient(c, args)
+	case "config":
+		return r.execConfig(args)
+	}
+	return r.db.Exec(c, args)
+}
+
+// checkPermission checks the command, its keys and channels against the rules of the user,
+// denials are recorded by ACL LOG
+func checkPermission(c *connection.Connection, user *acl.User, args [][]byte) reply.ErrorReply {
+	cmdName := strings.ToLower(string(args[0]))
+	subCmd := ""
+	if len(args) > 1 {
+		subCmd = strings.ToLower(string(args[1]))
+	}
+	if !user.CanRun(cmdName, subCmd) {
+		object := commandName(args)
+		acl.LogDenied(acl.ReasonCommand, aclContext(c), object, user.Name, clientInfo(c))
+		return reply.MakeStandardErrReply("NOPERM this user has no permissions to run the '" + object + "' command")
+	}
+
+	if writeKeys, readKeys, ok := database.GetKeys(args); ok {
+		if key, ok := user.CanAccessKeys(writeKeys, readKeys); !ok {
+			acl.LogDenied(acl.ReasonKey, aclContext(c), key, user.Name, clientInfo(c))
+			return errNoPermKey
+		}
+	}
+
+	var channels [][]byte
+	isPattern := false
+	switch cmdName {
+	case "publish":
+		if len(args) > 1 {
+			channels = args[1:2]
+		}
+	case "subscribe":
+		channels = args[1:]
+	case "psubscribe":
+		channels = args[1:]
+		isPattern = true
+	}
+	for _, channel := range channels {
+		if !user.CanAccessChannel(string(channel), isPattern) {
+			acl.LogDenied(acl.ReasonChannel, aclContext(c), string(channel), user.Name, clientInfo(c))
+			return errNoPermChannel
+		}
+	}
+	return nil
+}
+
+// aclContext tells where a denied command was run for ACL LOG
+func aclContext(c *connection.Connection) string {
+	if c.InMultiState() {
+		return "multi"
+	}
+	return "toplevel"
+}
+
+// clientInfo describes the client for ACL LOG the way CLIENT INFO does
+func clientInfo(c *connection.Connection) string {
+	info := c.Info()
+	return formatClient(&info)
+}
+
+// execACL ACL subcommand [args ...]
+func execACL(c *connection.Connection, user *acl.User, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("acl")
+	}
+	subCmd := strings.ToLower(string(args[1]))
+	argNumErr := reply.MakeStandardErrReply("ERR wrong number of arguments for 'acl|" + subCmd + "' command")
+	switch subCmd {
+	case "setuser":
+		if len(args) < 3 {
+			return argNumErr
+		}
+		rules := make([]string, len(args)-3)
+		for i, arg := range args[3:] {
+			rules[i] = string(arg)
+		}
+		if err := acl.SetUser(string(args[2]), rules); err != nil {
+			return reply.MakeStandardErrReply("ERR " + err.Error())
+		}
+		return reply.MakeOKReply()
+	case "getuser":
+		if len(args) != 3 {
+			return argNumErr
+		}
+		return aclGetUser(string(args[2]))
+	case "deluser":
+		if len(args) < 3 {
+			return argNumErr
+		}
+		names := make([]string, len(args)-2)
+		for i, arg := range args[2:] {
+			names[i] = string(arg)
+		}
+		deleted, err := acl.DelUsers(names)
+		if err != nil {
+			return reply.MakeStandardErrReply("ERR " + err.Error())
+		}
+		return reply.MakeIntReply(int64(deleted))
+	case "list", "users":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		var lines [][]byte
+		for _, u := range acl.Users() {
+			if subCmd == "list" {
+				lines = append(lines, []byte(u.Describe()))
+			} else {
+				lines = append(lines, []byte(u.Name))
+			}
+		}
+		return reply.MakeMultiBulkReply(lines)
+	case "whoami":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		return reply.MakeBulkReply([]byte(user.Name))
+	case "cat":
+		if len(args) > 3 {
+			return argNumErr
+		}
+		if len(args) == 2 {
+			return reply.MakeMultiBulkReply(toByteArgs(acl.Categories()))
+		}
+		commands := acl.CommandsOf(strings.ToLower(string(args[2])))
+		if commands == nil {
+			return reply.MakeStandardErrReply("ERR Unknown category '" + string(args[2]) + "'")
+		}
+		return reply.MakeMultiBulkReply(toByteArgs(commands))
+	case "log":
+		if len(args) > 3 {
+			return argNumErr
+		}
+		return aclLog(args[2:])
+	case "load", "save":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		var err error
+		if subCmd == "load" {
+			err = acl.Load()
+		} else {
+			err = acl.Save()
+		}
+		if err != nil {
+			return reply.MakeStandardErrReply("ERR " + err.Error())
+		}
+		return reply.MakeOKReply()
+	case "genpass":
+		if len(args) > 3 {
+			return argNumErr
+		}
+		bits := 256
+		if len(args) == 3 {
+			n, err := strconv.Atoi(string(args[2]))
+			if err != nil || n <= 0 || n > 4096 {
+				return reply.MakeStandardErrReply("ERR ACL GENPASS argument must be the number of bits for " +
+					"the output password, a positive number up to 4096")
+			}
+			bits = n
+		}
+		buf := make([]byte, (bits+7)/8)
+		if _, err := rand.Read(buf); err != nil {
+			return reply.MakeStandardErrReply("ERR " + err.Error())
+		}
+		// 4 bits per hex digit
+		return reply.MakeBulkReply([]byte(hex.EncodeToString(buf)[:(bits+3)/4]))
+	}
+	return reply.MakeStandardErrReply("ERR unknown subcommand '" + subCmd + "'. Try ACL HELP.")
+}
+
+// aclGetUser ACL GETUSER username
+func aclGetUser(name string) resp.Reply {
+	u := acl.GetUser(name)
+	if u == nil {
+		return reply.MakeNullBulkReply()
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("flags")),
+		reply.MakeMultiBulkReply(toByteArgs(u.Flags())),
+		reply.MakeBulkReply([]byte("passwords")),
+		reply.MakeMultiBulkReply(toByteArgs(u.PasswordHashes())),
+		reply.MakeBulkReply([]byte("commands")),
+		reply.MakeBulkReply([]byte(u.CommandRules())),
+		reply.MakeBulkReply([]byte("keys")),
+		reply.MakeBulkReply([]byte(u.KeyRules())),
+		reply.MakeBulkReply([]byte("channels")),
+		reply.MakeBulkReply([]byte(u.ChannelRules())),
+		reply.MakeBulkReply([]byte("selectors")),
+		reply.MakeEmptyMultiBulkReply(),
+	})
+}
+
+// aclLog ACL LOG [count | RESET]
+func aclLog(args [][]byte) resp.Reply {
+	count := 10
+	if len(args) == 1 {
+		if strings.EqualFold(string(args[0]), "reset") {
+			acl.ResetLogs()
+			return reply.MakeOKReply()
+		}
+		n, err := strconv.Atoi(string(args[0]))
+		if err != nil || n < 0 {
+			return reply.MakeStandardErrReply("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+	now := time.Now()
+	entries := acl.Logs(count)
+	replies := make([]resp.Reply, len(entries))
+	for i, entry := range entries {
+		age := now.Sub(entry.CreatedAt).Seconds()
+		replies[i] = reply.MakeMultiRawReply([]resp.Reply{
+			reply.MakeBulkReply([]byte("count")),
+			reply.MakeIntReply(int64(entry.Count)),
+			reply.MakeBulkReply([]byte("reason")),
+			reply.MakeBulkReply([]byte(entry.Reason)),
+			reply.MakeBulkReply([]byte("context")),
+			reply.MakeBulkReply([]byte(entry.Context)),
+			reply.MakeBulkReply([]byte("object")),
+			reply.MakeBulkReply([]byte(entry.Object)),
+			reply.MakeBulkReply([]byte("username")),
+			reply.MakeBulkReply([]byte(entry.Username)),
+			reply.MakeBulkReply([]byte("age-seconds")),
+			reply.MakeBulkReply([]byte(strconv.FormatFloat(age, 'f', 3, 64))),
+			reply.MakeBulkReply([]byte("client-info")),
+			reply.MakeBulkReply([]byte(entry.ClientInfo)),
+			reply.MakeBulkReply([]byte("entry-id")),
+			reply.MakeIntReply(entry.EntryID),
+			reply.MakeBulkReply([]byte("timestamp-created")),
+			reply.MakeIntReply(entry.CreatedAt.UnixNano() / int64(time.Millisecond)),
+			reply.MakeBulkReply([]byte("timestamp-last-updated")),
+			reply.MakeIntReply(entry.LastUpdated.UnixNano() / int64(time.Millisecond)),
+		})
+	}
+	return reply.MakeMultiRawReply(replies)
+}
+
+func toByteArgs(values []string) [][]byte {
+	args := make([][]byte, len(values))
+	for i, v := range values {
+		args[i] = []byte(v)
+	}
+	return args
+}
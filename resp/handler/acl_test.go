@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestACLPermissions(t *testing.T) {
+	h := newTestHandler(t, nil)
+	admin := connect(t, h)
+	assertReply(t, admin.send(t, "ACL", "SETUSER", "alice", "on", ">pw", "~cache:*", "%R~shared:*", "&news",
+		"+@read", "+set", "+publish", "+subscribe", "+multi", "+exec", "+acl|whoami"), "+OK\r\n")
+	assertReply(t, admin.send(t, "ACL", "LOG", "RESET"), "+OK\r\n")
+
+	c := connect(t, h)
+	assertReply(t, c.send(t, "AUTH", "alice", "pw"), "+OK\r\n")
+	assertReply(t, c.send(t, "ACL", "WHOAMI"), "$5\r\nalice\r\n")
+	assertReply(t, c.send(t, "SET", "cache:1", "v"), "+OK\r\n")
+	assertReply(t, c.send(t, "GET", "shared:1"), "$-1\r\n")
+	assertReply(t, c.send(t, "SET", "shared:1", "v"),
+		"-NOPERM this user has no permissions to access one of the keys used as arguments\r\n")
+	assertReply(t, c.send(t, "DEL", "cache:1"), "-NOPERM this user has no permissions to run the 'del' command\r\n")
+	assertReply(t, c.send(t, "ACL", "USERS"), "-NOPERM this user has no permissions to run the 'acl|users' command\r\n")
+	assertReply(t, c.send(t, "PUBLISH", "sports", "m"),
+		"-NOPERM this user has no permissions to access one of the channels used as arguments\r\n")
+	assertReply(t, c.send(t, "PUBLISH", "news", "m"), ":0\r\n")
+
+	// a denied command inside MULTI aborts EXEC
+	assertReply(t, c.send(t, "MULTI"), "+OK\r\n")
+	assertReply(t, c.send(t, "SET", "cache:2", "v"), "+QUEUED\r\n")
+	assertReply(t, c.send(t, "SET", "other", "v"),
+		"-NOPERM this user has no permissions to access one of the keys used as arguments\r\n")
+	assertReply(t, c.send(t, "EXEC"), "-EXECABORT Transaction discarded because of previous errors.\r\n")
+	assertReply(t, admin.send(t, "EXISTS", "cache:2"), ":0\r\n")
+
+	log := admin.send(t, "ACL", "LOG")
+	for _, denial := range []string{"$7\r\ncontext\r\n$5\r\nmulti\r\n$6\r\nobject\r\n$5\r\nother\r\n", "$6\r\nobject\r\n$9\r\nacl|users\r\n", "$6\r\nobject\r\n$6\r\nsports\r\n"} {
+		if !strings.Contains(log, denial) {
+			t.Errorf("expected %q in ACL LOG, got %q", denial, log)
+		}
+	}
+
+	// a deleted user can not run commands any more
+	assertReply(t, admin.send(t, "ACL", "DELUSER", "alice", "nobody"), ":1\r\n")
+	assertReply(t, c.send(t, "GET", "cache:1"), "-NOAUTH Authentication required.\r\n")
+	assertReply(t, c.send(t, "AUTH", "alice", "pw"), "-WRONGPASS invalid username-password pair or user is disabled.\r\n")
+}
+
+func TestACLCommands(t *testing.T) {
+	h := newTestHandler(t, nil)
+	c := connect(t, h)
+	assertReply(t, c.send(t, "ACL", "SETUSER", "bob", "on", "bogus"),
+		"-ERR Error in ACL SETUSER modifier 'bogus': Syntax error\r\n")
+	assertReply(t, c.send(t, "ACL", "GETUSER", "bob"), "$-1\r\n")
+	assertReply(t, c.send(t, "ACL", "SETUSER", "bob", "on", "nopass", "~*", "+get"), "+OK\r\n")
+	assertReply(t, c.send(t, "ACL", "USERS"), "*2\r\n$3\r\nbob\r\n$7\r\ndefault\r\n")
+	assertReply(t, c.send(t, "ACL", "LIST"), "*2\r\n$40\r\nuser bob on nopass ~* resetchannels +get\r\n"+
+		"$34\r\nuser default on nopass ~* &* +@all\r\n")
+	assertReply(t, c.send(t, "ACL", "DELUSER", "default"), "-ERR The 'default' user cannot be removed\r\n")
+	assertReply(t, c.send(t, "ACL", "WHOAMI", "x"), "-ERR wrong number of arguments for 'acl|whoami' command\r\n")
+
+	// ACL is not queued by MULTI, it aborts the transaction instead of running at once
+	assertReply(t, c.send(t, "MULTI"), "+OK\r\n")
+	assertReply(t, c.send(t, "ACL", "DELUSER", "bob"), "-ERR ACL inside MULTI is not allowed\r\n")
+	assertReply(t, c.send(t, "EXEC"), "-EXECABORT Transaction discarded because of previous errors.\r\n")
+	assertReply(t, c.send(t, "ACL", "USERS"), "*2\r\n$3\r\nbob\r\n$7\r\ndefault\r\n")
+	assertReply(t, c.send(t, "ACL", "CAT", "nosuch"), "-ERR Unknown category 'nosuch'\r\n")
+	if ret := c.send(t, "ACL", "CAT", "read"); !strings.Contains(ret, "$3\r\nget\r\n") {
+		t.Errorf("expected get in the read category, got %q", ret)
+	}
+	if ret := c.send(t, "ACL", "GENPASS", "10"); !strings.HasPrefix(ret, "$3\r\n") {
+		t.Errorf("expected 3 hex digits for 10 bits, got %q", ret)
+	}
+	if ret := c.send(t, "ACL", "SAVE"); !strings.HasPrefix(ret, "-ERR This Redis instance is not configured to use an ACL file") {
+		t.Errorf("expected saving refused without aclFile, got %q", ret)
+	}
+	assertReply(t, c.send(t, "ACL", "FOO"), "-ERR unknown subcommand 'foo'. Try ACL HELP.\r\n")
+}
@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+
+	"go-redis/acl"
+	"go-redis/cluster"
+	"go-redis/database"
+	"go-redis/interface/resp"
+	"go-redis/lib/utils"
+	"go-redis/resp/connection"
+	"go-redis/resp/reply"
+)
+
+// Clients must authenticate before running any command other than AUTH, HELLO and QUIT unless the default user
+// needs no password, the user is kept by the connection so every client authenticates on its own.
+
+var (
+	errNoAuth    = reply.MakeStandardErrReply("NOAUTH Authentication required.")
+	errWrongPass = reply.MakeStandardErrReply("WRONGPASS invalid username-password pair or user is disabled.")
+)
+
+// currentUser returns the user the client runs commands as, nil if the client must authenticate first.
+// A client which did not authenticate is the default user if it is enabled and needs no password.
+func currentUser(c resp.Connection) *acl.User {
+	if name := c.GetUser(); name != "" {
+		// nil if the user was deleted meanwhile
+		return acl.GetUser(name)
+	}
+	if u := acl.GetUser(acl.DefaultUser); u != nil && u.Enabled && u.NoPass {
+		return u
+	}
+	return nil
+}
+
+// authenticate checks the password of the user, failures are recorded by ACL LOG
+func authenticate(c *connection.Connection, username string, password string) reply.ErrorReply {
+	if !acl.Authenticate(username, password) {
+		acl.LogDenied(acl.ReasonAuth, aclContext(c), "AUTH", username, clientInfo(c))
+		return errWrongPass
+	}
+	c.SetUser(username)
+	return nil
+}
+
+// execAuth AUTH [username] password
+func execAuth(c *connection.Connection, args [][]byte) resp.Reply {
+	switch len(args) {
+	case 2:
+		if u := acl.GetUser(acl.DefaultUser); u != nil && u.NoPass {
+			return reply.MakeStandardErrReply("ERR AUTH <password> called without any password configured " +
+				"for the default user. Are you sure your configuration is correct?")
+		}
+		if errReply := authenticate(c, acl.DefaultUser, string(args[1])); errReply != nil {
+			return errReply
+		}
+	case 3:
+		if errReply := authenticate(c, string(args[1]), string(args[2])); errReply != nil {
+			return errReply
+		}
+	default:
+		return reply.MakeArgNumErrReply("auth")
+	}
+	return reply.MakeOKReply()
+}
+
+// execHello HELLO [protover [AUTH username password] [SETNAME clientname]], only RESP2 is supported
+func (r *RespHandler) execHello(c *connection.Connection, args [][]byte) resp.Reply {
+	if len(args) > 1 {
+		protover, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			return reply.MakeStandardErrReply("ERR Protocol version is not an integer or out of range")
+		}
+		if protover != 2 {
+			return reply.MakeStandardErrReply("NOPROTO unsupported protocol version")
+		}
+	}
+	var username, password, clientName string
+	auth, setName := false, false
+	for i := 2; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i]))
+		switch {
+		case option == "AUTH" && i+2 < len(args):
+			auth = true
+			username, password = string(args[i+1]), string(args[i+2])
+			i += 2
+		case option == "SETNAME" && i+1 < len(args):
+			setName = true
+			clientName = string(args[i+1])
+			i++
+		default:
+			return reply.MakeStandardErrReply("ERR Syntax error in HELLO option '" + string(args[i]) + "'")
+		}
+	}
+	if auth {
+		if errReply := authenticate(c, username, password); errReply != nil {
+			return errReply
+		}
+	}
+	if currentUser(c) == nil {
+		return reply.MakeStandardErrReply("NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client " +
+			"and select the RESP protocol version at the same time")
+	}
+	// the name is set only if HELLO succeeds
+	if setName {
+		if !validClientName(clientName) {
+			return errClientName
+		}
+		c.SetName(clientName)
+	}
+
+	mode := "standalone"
+	if _, ok := r.db.(*cluster.Database); ok {
+		mode = "cluster"
+	}
+	role := "master"
+	// a connection of its own, the client may be in a transaction
+	if roleReply, ok := r.db.Exec(&connection.Connection{}, utils.ToCmdLine("role")).(*reply.MultiRawReply); ok &&
+		len(roleReply.Replies) > 0 {
+		if bulk, ok := roleReply.Replies[0].(*reply.BulkReply); ok && string(bulk.Arg) == "slave" {
+			role = "replica"
+		}
+	}
+	return reply.MakeMultiRawReply([]resp.Reply{
+		reply.MakeBulkReply([]byte("server")),
+		reply.MakeBulkReply([]byte("redis")),
+		reply.MakeBulkReply([]byte("version")),
+		reply.MakeBulkReply([]byte(database.RedisVersion)),
+		reply.MakeBulkReply([]byte("proto")),
+		reply.MakeIntReply(2),
+		reply.MakeBulkReply([]byte("id")),
+		reply.MakeIntReply(int64(c.ID())),
+		reply.MakeBulkReply([]byte("mode")),
+		reply.MakeBulkReply([]byte(mode)),
+		reply.MakeBulkReply([]byte("role")),
+		reply.MakeBulkReply([]byte(role)),
+		reply.MakeBulkReply([]byte("modules")),
+		reply.MakeEmptyMultiBulkReply(),
+	})
+}
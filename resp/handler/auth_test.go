@@ -0,0 +1,68 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+
+	"go-redis/config"
+)
+
+func TestRequirePass(t *testing.T) {
+	h := newTestHandler(t, func(props *config.ServerProperties) {
+		props.RequirePass = "secret"
+	})
+	c := connect(t, h)
+	assertReply(t, c.send(t, "SET", "k", "v"), "-NOAUTH Authentication required.\r\n")
+	assertReply(t, c.send(t, "AUTH", "wrong"), "-WRONGPASS invalid username-password pair or user is disabled.\r\n")
+	assertReply(t, c.send(t, "AUTH"), "-ERR wrong number of arguments for 'auth' command\r\n")
+	assertReply(t, c.send(t, "AUTH", "secret"), "+OK\r\n")
+	assertReply(t, c.send(t, "SET", "k", "v"), "+OK\r\n")
+
+	// each client authenticates on its own
+	other := connect(t, h)
+	assertReply(t, other.send(t, "GET", "k"), "-NOAUTH Authentication required.\r\n")
+	assertReply(t, other.send(t, "AUTH", "default", "secret"), "+OK\r\n")
+	assertReply(t, other.send(t, "GET", "k"), "$1\r\nv\r\n")
+	assertReply(t, connect(t, h).send(t, "QUIT"), "+OK\r\n")
+}
+
+func TestAuthWithoutPassword(t *testing.T) {
+	h := newTestHandler(t, nil)
+	c := connect(t, h)
+	if ret := c.send(t, "AUTH", "any"); !strings.HasPrefix(ret, "-ERR AUTH <password> called without any password") {
+		t.Errorf("expected AUTH refused without password, got %q", ret)
+	}
+	assertReply(t, c.send(t, "PING"), "+PONG\r\n")
+
+	// clients connected before CONFIG SET requirepass stay authenticated, new ones must authenticate
+	assertReply(t, c.send(t, "CONFIG", "SET", "requirepass", "secret"), "+OK\r\n")
+	assertReply(t, c.send(t, "PING"), "+PONG\r\n")
+	other := connect(t, h)
+	assertReply(t, other.send(t, "PING"), "-NOAUTH Authentication required.\r\n")
+	assertReply(t, other.send(t, "AUTH", "secret"), "+OK\r\n")
+	assertReply(t, c.send(t, "CONFIG", "SET", "requirepass", ""), "+OK\r\n")
+	assertReply(t, connect(t, h).send(t, "PING"), "+PONG\r\n")
+}
+
+func TestHello(t *testing.T) {
+	h := newTestHandler(t, func(props *config.ServerProperties) {
+		props.RequirePass = "secret"
+	})
+	c := connect(t, h)
+	assertReply(t, c.send(t, "HELLO", "3"), "-NOPROTO unsupported protocol version\r\n")
+	assertReply(t, c.send(t, "HELLO", "two"), "-ERR Protocol version is not an integer or out of range\r\n")
+	assertReply(t, c.send(t, "HELLO", "2", "FOO"), "-ERR Syntax error in HELLO option 'FOO'\r\n")
+	if ret := c.send(t, "HELLO", "2"); !strings.HasPrefix(ret, "-NOAUTH HELLO must be called") {
+		t.Errorf("expected HELLO refused before authenticating, got %q", ret)
+	}
+	assertReply(t, c.send(t, "HELLO", "2", "AUTH", "default", "wrong"),
+		"-WRONGPASS invalid username-password pair or user is disabled.\r\n")
+
+	ret := c.send(t, "HELLO", "2", "AUTH", "default", "secret", "SETNAME", "app")
+	for _, field := range []string{"$6\r\nserver\r\n$5\r\nredis\r\n", "$5\r\nproto\r\n:2\r\n", "$4\r\nmode\r\n$10\r\nstandalone\r\n", "$4\r\nrole\r\n$6\r\nmaster\r\n"} {
+		if !strings.Contains(ret, field) {
+			t.Errorf("expected %q in the reply of HELLO, got %q", field, ret)
+		}
+	}
+	assertReply(t, c.send(t, "CLIENT", "GETNAME"), "$3\r\napp\r\n")
+}
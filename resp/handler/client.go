@@ -0,0 +1,437 @@
+package handler
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go-redis/acl"
+	"go-redis/database"
+	"go-redis/interface/resp"
+	"go-redis/resp/connection"
+	"go-redis/resp/reply"
+)
+
+var errNoSuchClient = reply.MakeStandardErrReply("ERR No such client")
+
+// clientPause blocks the commands of clients until the pause ends, see CLIENT PAUSE.
+// Replicas are never paused so the replication stream keeps flowing during a failover.
+type clientPause struct {
+	mu  sync.Mutex
+	end time.Time
+	// all pauses every command, otherwise only the commands which may modify the dataset
+	all bool
+	// changed is closed when the pause is changed or lifted, waking up the paused clients
+	changed chan struct{}
+}
+
+func makeClientPause() *clientPause {
+	return &clientPause{
+		changed: make(chan struct{}),
+	}
+}
+
+// pause pauses the clients until end, an ongoing pause is only extended or made stricter
+func (p *clientPause) pause(end time.Time, all bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if time.Now().Before(p.end) {
+		all = all || p.all
+		if end.Before(p.end) {
+			end = p.end
+		}
+	}
+	p.end = end
+	p.all = all
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// unpause resumes the paused clients
+func (p *clientPause) unpause() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.end = time.Time{}
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// wait blocks until the command of the client is no longer paused or the server is closed
+func (p *clientPause) wait(c *connection.Connection, args [][]byte, closed <-chan struct{}) {
+	if c.IsReplica() {
+		return
+	}
+	for {
+		p.mu.Lock()
+		remaining := time.Until(p.end)
+		paused := remaining > 0 && (p.all || mayWrite(c, args))
+		changed := p.changed
+		p.mu.Unlock()
+		if !paused {
+			return
+		}
+		timer := time.NewTimer(remaining)
+		select {
+		case <-timer.C:
+		case <-changed:
+		case <-closed:
+			timer.Stop()
+			return
+		}
+		timer.Stop()
+	}
+}
+
+// mayWrite tells whether the command may modify the dataset or be propagated to replicas,
+// such commands are paused by CLIENT PAUSE WRITE. Commands queued by MULTI are checked by EXEC.
+func mayWrite(c *connection.Connection, args [][]byte) bool {
+	cmdName := strings.ToLower(string(args[0]))
+	if cmdName == "publish" {
+		return true
+	}
+	if !c.InMultiState() {
+		return database.IsWriteCommand(args)
+	}
+	if cmdName != "exec" {
+		return false
+	}
+	for _, cmdLine := range c.GetQueuedCmdLine() {
+		if strings.ToLower(string(cmdLine[0])) == "publish" || database.IsWriteCommand(cmdLine) {
+			return true
+		}
+	}
+	return false
+}
+
+// commandName returns the name of the command shown by CLIENT LIST and ACL LOG, e.g. client|list
+func commandName(args [][]byte) string {
+	cmdName := strings.ToLower(string(args[0]))
+	if subcommandCommands[cmdName] && len(args) > 1 {
+		cmdName += "|" + strings.ToLower(string(args[1]))
+	}
+	return cmdName
+}
+
+// clientType returns the type of CLIENT LIST TYPE and CLIENT KILL TYPE
+func clientType(info *connection.Info) string {
+	switch {
+	case info.Replica:
+		return "replica"
+	case info.Sub+info.PSub > 0:
+		return "pubsub"
+	}
+	return "normal"
+}
+
+// formatClient describes the client by a line of CLIENT LIST.
+// Replies are written synchronously and requests are buffered by the parser, so the buffers are reported empty.
+func formatClient(info *connection.Info) string {
+	flags := ""
+	if info.Replica {
+		flags += "S"
+	}
+	if info.Sub+info.PSub > 0 {
+		flags += "P"
+	}
+	if info.Multi >= 0 {
+		flags += "x"
+	}
+	if info.NoEvict {
+		flags += "e"
+	}
+	if flags == "" {
+		flags = "N"
+	}
+	user := info.User
+	if user == "" {
+		user = acl.DefaultUser
+	}
+	fields := []string{
+		"id=" + strconv.FormatUint(info.ID, 10),
+		"addr=" + info.Addr,
+		"laddr=" + info.LocalAddr,
+		"name=" + info.Name,
+		"age=" + strconv.FormatInt(int64(time.Since(info.CreatedAt)/time.Second), 10),
+		"idle=" + strconv.FormatInt(int64(info.Idle/time.Second), 10),
+		"flags=" + flags,
+		"db=" + strconv.Itoa(info.DB),
+		"sub=" + strconv.Itoa(info.Sub),
+		"psub=" + strconv.Itoa(info.PSub),
+		"multi=" + strconv.Itoa(info.Multi),
+		"qbuf=0",
+		"qbuf-free=0",
+		"argv-mem=" + strconv.Itoa(info.ArgvMem),
+		"multi-mem=" + strconv.Itoa(info.MultiMem),
+		"obl=0",
+		"oll=0",
+		"omem=0",
+		"tot-mem=" + strconv.Itoa(info.ArgvMem+info.MultiMem),
+		"cmd=" + info.LastCmd,
+		"user=" + user,
+		"redir=-1",
+		"resp=2",
+	}
+	return strings.Join(fields, " ")
+}
+
+// clientList returns the connected clients ordered by id
+func (r *RespHandler) clientList() []*connection.Connection {
+	var list []*connection.Connection
+	r.activeConn.Range(func(key, _ interface{}) bool {
+		list = append(list, key.(*connection.Connection))
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ID() < list[j].ID()
+	})
+	return list
+}
+
+// validClientName tells whether the name of CLIENT SETNAME has no spaces, newlines or special characters
+func validClientName(name string) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] < '!' || name[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+var errClientName = reply.MakeStandardErrReply("ERR Client names cannot contain spaces, newlines or special characters.")
+
+// execClient CLIENT subcommand [args ...]
+func (r *RespHandler) execClient(c *connection.Connection, args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("client")
+	}
+	subCmd := strings.ToLower(string(args[1]))
+	argNumErr := reply.MakeStandardErrReply("ERR wrong number of arguments for 'client|" + subCmd + "' command")
+	switch subCmd {
+	case "id":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		return reply.MakeIntReply(int64(c.ID()))
+	case "info":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		info := c.Info()
+		return reply.MakeBulkReply([]byte(formatClient(&info) + "\n"))
+	case "list":
+		return r.clientListReply(args[2:])
+	case "kill":
+		if len(args) < 3 {
+			return argNumErr
+		}
+		return r.clientKill(c, args[2:])
+	case "setname":
+		if len(args) != 3 {
+			return argNumErr
+		}
+		name := string(args[2])
+		if !validClientName(name) {
+			return errClientName
+		}
+		c.SetName(name)
+		return reply.MakeOKReply()
+	case "getname":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		name := c.GetName()
+		if name == "" {
+			return reply.MakeNullBulkReply()
+		}
+		return reply.MakeBulkReply([]byte(name))
+	case "pause":
+		if len(args) != 3 && len(args) != 4 {
+			return argNumErr
+		}
+		timeout, err := strconv.ParseInt(string(args[2]), 10, 64)
+		if err != nil {
+			return reply.MakeStandardErrReply("ERR timeout is not an integer or out of range")
+		}
+		if timeout < 0 {
+			return reply.MakeStandardErrReply("ERR timeout is negative")
+		}
+		all := true
+		if len(args) == 4 {
+			switch strings.ToLower(string(args[3])) {
+			case "all":
+			case "write":
+				all = false
+			default:
+				return reply.MakeSyntaxErrReply()
+			}
+		}
+		r.pause.pause(time.Now().Add(time.Duration(timeout)*time.Millisecond), all)
+		return reply.MakeOKReply()
+	case "unpause":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		r.pause.unpause()
+		return reply.MakeOKReply()
+	case "no-evict":
+		if len(args) != 3 {
+			return argNumErr
+		}
+		switch strings.ToLower(string(args[2])) {
+		case "on":
+			c.SetNoEvict(true)
+		case "off":
+			c.SetNoEvict(false)
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+		return reply.MakeOKReply()
+	case "reply":
+		if len(args) != 3 {
+			return argNumErr
+		}
+		switch strings.ToLower(string(args[2])) {
+		case "on":
+			c.SetReplyMode(connection.ReplyOn)
+		case "off":
+			c.SetReplyMode(connection.ReplyOff)
+		case "skip":
+			c.SetReplyMode(connection.ReplySkip)
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+		// only ON is replied, the handler drops the reply otherwise
+		return reply.MakeOKReply()
+	}
+	return reply.MakeStandardErrReply("ERR unknown subcommand '" + subCmd + "'. Try CLIENT HELP.")
+}
+
+// clientListReply CLIENT LIST [TYPE normal|master|replica|pubsub] [ID client-id ...]
+func (r *RespHandler) clientListReply(args [][]byte) resp.Reply {
+	typ := ""
+	var ids map[uint64]bool
+	switch {
+	case len(args) == 0:
+	case len(args) == 2 && strings.EqualFold(string(args[0]), "type"):
+		typ = strings.ToLower(string(args[1]))
+		if typ == "slave" {
+			typ = "replica"
+		}
+		if typ != "normal" && typ != "master" && typ != "replica" && typ != "pubsub" {
+			return reply.MakeStandardErrReply("ERR Unknown client type '" + string(args[1]) + "'")
+		}
+	case len(args) >= 2 && strings.EqualFold(string(args[0]), "id"):
+		ids = make(map[uint64]bool)
+		for _, arg := range args[1:] {
+			id, err := strconv.ParseUint(string(arg), 10, 64)
+			if err != nil || id == 0 {
+				return reply.MakeStandardErrReply("ERR Invalid client ID")
+			}
+			ids[id] = true
+		}
+	default:
+		return reply.MakeSyntaxErrReply()
+	}
+
+	var sb strings.Builder
+	for _, client := range r.clientList() {
+		info := client.Info()
+		if typ != "" && clientType(&info) != typ || ids != nil && !ids[info.ID] {
+			continue
+		}
+		sb.WriteString(formatClient(&info))
+		sb.WriteString("\n")
+	}
+	return reply.MakeBulkReply([]byte(sb.String()))
+}
+
+// clientKill CLIENT KILL ip:port, or
+// CLIENT KILL [ID client-id] [TYPE normal|master|replica|pubsub] [USER username] [ADDR ip:port] [LADDR ip:port] [SKIPME yes|no]
+func (r *RespHandler) clientKill(c *connection.Connection, args [][]byte) resp.Reply {
+	// the old form kills the client of the address only, including the caller
+	if len(args) == 1 {
+		addr := string(args[0])
+		for _, client := range r.clientList() {
+			if client.Info().Addr == addr {
+				r.killClient(c, client)
+				return reply.MakeOKReply()
+			}
+		}
+		return errNoSuchClient
+	}
+	if len(args)%2 != 0 {
+		return reply.MakeSyntaxErrReply()
+	}
+
+	var id uint64
+	typ, user, addr, laddr := "", "", "", ""
+	skipMe := true
+	for i := 0; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "id":
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil || n == 0 {
+				return reply.MakeStandardErrReply("ERR client-id should be greater than 0")
+			}
+			id = n
+		case "type":
+			typ = strings.ToLower(value)
+			if typ == "slave" {
+				typ = "replica"
+			}
+			if typ != "normal" && typ != "master" && typ != "replica" && typ != "pubsub" {
+				return reply.MakeStandardErrReply("ERR Unknown client type '" + value + "'")
+			}
+		case "user":
+			user = value
+		case "addr":
+			addr = value
+		case "laddr":
+			laddr = value
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				skipMe = true
+			case "no":
+				skipMe = false
+			default:
+				return reply.MakeSyntaxErrReply()
+			}
+		default:
+			return reply.MakeSyntaxErrReply()
+		}
+	}
+
+	killed := 0
+	for _, client := range r.clientList() {
+		info := client.Info()
+		clientUser := info.User
+		if clientUser == "" {
+			clientUser = acl.DefaultUser
+		}
+		if id != 0 && info.ID != id ||
+			typ != "" && clientType(&info) != typ ||
+			user != "" && clientUser != user ||
+			addr != "" && info.Addr != addr ||
+			laddr != "" && info.LocalAddr != laddr ||
+			skipMe && client == c {
+			continue
+		}
+		r.killClient(c, client)
+		killed++
+	}
+	return reply.MakeIntReply(int64(killed))
+}
+
+// killClient closes the client, the caller itself is closed once it gets the reply
+func (r *RespHandler) killClient(caller *connection.Connection, client *connection.Connection) {
+	if client == caller {
+		caller.SetCloseAfterReply()
+		return
+	}
+	// the goroutine serving the client cleans it up
+	_ = client.Close()
+}
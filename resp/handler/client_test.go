@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// clientID returns the id of the client as replied by CLIENT ID, e.g. 7
+func clientID(t *testing.T, c *testClient) string {
+	t.Helper()
+	ret := c.send(t, "CLIENT", "ID")
+	return strings.TrimSuffix(strings.TrimPrefix(ret, ":"), "\r\n")
+}
+
+// replied tells whether a reply arrives within the timeout, the reply is left to read
+func (c *testClient) replied(timeout time.Duration) bool {
+	_ = c.conn.SetReadDeadline(time.Now().Add(timeout))
+	_, err := c.reader.Peek(1)
+	return err == nil
+}
+
+func TestClientInfo(t *testing.T) {
+	h := newTestHandler(t, nil)
+	c := connect(t, h)
+	id := clientID(t, c)
+	assertReply(t, c.send(t, "CLIENT", "GETNAME"), "$-1\r\n")
+	assertReply(t, c.send(t, "CLIENT", "SETNAME", "my app"),
+		"-ERR Client names cannot contain spaces, newlines or special characters.\r\n")
+	assertReply(t, c.send(t, "CLIENT", "SETNAME", "app"), "+OK\r\n")
+	assertReply(t, c.send(t, "CLIENT", "GETNAME"), "$3\r\napp\r\n")
+	assertReply(t, c.send(t, "SELECT", "3"), "+OK\r\n")
+	assertReply(t, c.send(t, "CLIENT", "NO-EVICT", "on"), "+OK\r\n")
+	assertReply(t, c.send(t, "CLIENT", "NO-EVICT", "maybe"), "-Err syntax error\r\n")
+
+	info := c.send(t, "CLIENT", "INFO")
+	for _, field := range []string{"id=" + id + " ", " name=app ", " flags=e ", " db=3 ", " cmd=client|info ", " user=default "} {
+		if !strings.Contains(info, field) {
+			t.Errorf("expected %q in CLIENT INFO, got %q", field, info)
+		}
+	}
+
+	subscriber := connect(t, h)
+	subscriberID := clientID(t, subscriber)
+	subscriber.send(t, "SUBSCRIBE", "news")
+	list := c.send(t, "CLIENT", "LIST")
+	if !strings.Contains(list, "id="+id+" ") || !strings.Contains(list, "id="+subscriberID+" ") {
+		t.Errorf("expected both clients listed, got %q", list)
+	}
+	if list := c.send(t, "CLIENT", "LIST", "TYPE", "pubsub"); !strings.Contains(list, "id="+subscriberID+" ") ||
+		strings.Contains(list, "id="+id+" ") || !strings.Contains(list, " flags=P ") {
+		t.Errorf("expected the subscriber listed only, got %q", list)
+	}
+	if list := c.send(t, "CLIENT", "LIST", "ID", id); strings.Count(list, "id=") != 1 || !strings.Contains(list, "id="+id+" ") {
+		t.Errorf("expected the client of the id listed only, got %q", list)
+	}
+	assertReply(t, c.send(t, "CLIENT", "LIST", "TYPE", "other"), "-ERR Unknown client type 'other'\r\n")
+	assertReply(t, c.send(t, "CLIENT", "LIST", "ID", "0"), "-ERR Invalid client ID\r\n")
+	assertReply(t, c.send(t, "CLIENT", "FOO"), "-ERR unknown subcommand 'foo'. Try CLIENT HELP.\r\n")
+
+	// CLIENT is not queued by MULTI, it aborts the transaction instead of running at once
+	assertReply(t, c.send(t, "MULTI"), "+OK\r\n")
+	assertReply(t, c.send(t, "CLIENT", "SETNAME", "foo"), "-ERR CLIENT inside MULTI is not allowed\r\n")
+	assertReply(t, c.send(t, "EXEC"), "-EXECABORT Transaction discarded because of previous errors.\r\n")
+	assertReply(t, c.send(t, "CLIENT", "GETNAME"), "$3\r\napp\r\n")
+}
+
+func TestClientKill(t *testing.T) {
+	h := newTestHandler(t, nil)
+	c := connect(t, h)
+	assertReply(t, c.send(t, "ACL", "SETUSER", "bob", "on", "nopass", "+@all", "~*"), "+OK\r\n")
+	victim := connect(t, h)
+	victimID := clientID(t, victim)
+	bob := connect(t, h)
+	assertReply(t, bob.send(t, "AUTH", "bob", "any"), "+OK\r\n")
+
+	assertReply(t, c.send(t, "CLIENT", "KILL", "ID", "0"), "-ERR client-id should be greater than 0\r\n")
+	assertReply(t, c.send(t, "CLIENT", "KILL", "ID", victimID, "TYPE"), "-Err syntax error\r\n")
+	assertReply(t, c.send(t, "CLIENT", "KILL", "nosuch:1"), "-ERR No such client\r\n")
+	assertReply(t, c.send(t, "CLIENT", "KILL", "ID", victimID), ":1\r\n")
+	if !victim.closed(time.Second) {
+		t.Error("expected the client of the id killed")
+	}
+	assertReply(t, c.send(t, "CLIENT", "KILL", "USER", "bob"), ":1\r\n")
+	if !bob.closed(time.Second) {
+		t.Error("expected the client of bob killed")
+	}
+
+	// the caller is skipped unless SKIPME no, then it is closed after the reply
+	for i := 0; len(h.clientList()) > 1 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertReply(t, c.send(t, "CLIENT", "KILL", "TYPE", "normal"), ":0\r\n")
+	assertReply(t, c.send(t, "CLIENT", "KILL", "TYPE", "normal", "SKIPME", "no"), ":1\r\n")
+	if !c.closed(time.Second) {
+		t.Error("expected the caller killed")
+	}
+}
+
+func TestClientPause(t *testing.T) {
+	h := newTestHandler(t, nil)
+	admin := connect(t, h)
+	c := connect(t, h)
+	assertReply(t, admin.send(t, "CLIENT", "PAUSE", "-1"), "-ERR timeout is negative\r\n")
+	assertReply(t, admin.send(t, "CLIENT", "PAUSE", "10000", "READ"), "-Err syntax error\r\n")
+
+	// WRITE pauses the commands which may write only
+	assertReply(t, admin.send(t, "CLIENT", "PAUSE", "10000", "WRITE"), "+OK\r\n")
+	assertReply(t, c.send(t, "GET", "k"), "$-1\r\n")
+	c.write(t, "SET", "k", "v")
+	if c.replied(100 * time.Millisecond) {
+		t.Fatal("expected SET paused")
+	}
+	assertReply(t, admin.send(t, "CLIENT", "UNPAUSE"), "+OK\r\n")
+	assertReply(t, c.read(t), "+OK\r\n")
+
+	// ALL pauses every command until the timeout
+	assertReply(t, admin.send(t, "CLIENT", "PAUSE", "200"), "+OK\r\n")
+	start := time.Now()
+	assertReply(t, c.send(t, "GET", "k"), "$1\r\nv\r\n")
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Errorf("expected GET paused until the timeout, replied after %v", elapsed)
+	}
+}
+
+func TestClientReply(t *testing.T) {
+	h := newTestHandler(t, nil)
+	c := connect(t, h)
+	assertReply(t, c.send(t, "CLIENT", "REPLY", "MAYBE"), "-Err syntax error\r\n")
+
+	// the command after SKIP is not replied
+	c.write(t, "CLIENT", "REPLY", "SKIP")
+	c.write(t, "SET", "k", "1")
+	assertReply(t, c.send(t, "GET", "k"), "$1\r\n1\r\n")
+
+	// nothing is replied after OFF until ON
+	c.write(t, "CLIENT", "REPLY", "OFF")
+	c.write(t, "INCR", "k")
+	c.write(t, "GET", "k")
+	assertReply(t, c.send(t, "CLIENT", "REPLY", "ON"), "+OK\r\n")
+	assertReply(t, c.send(t, "GET", "k"), "$1\r\n2\r\n")
+}
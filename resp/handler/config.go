@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"strings"
+
+	"go-redis/config"
+	"go-redis/database"
+	"go-redis/interface/resp"
+	"go-redis/resp/reply"
+)
+
+// execConfig CONFIG GET pattern [pattern ...] | SET name value [name value ...] | RESETSTAT | REWRITE
+func (r *RespHandler) execConfig(args [][]byte) resp.Reply {
+	if len(args) < 2 {
+		return reply.MakeArgNumErrReply("config")
+	}
+	subCmd := strings.ToLower(string(args[1]))
+	argNumErr := reply.MakeStandardErrReply("ERR wrong number of arguments for 'config|" + subCmd + "' command")
+	switch subCmd {
+	case "get":
+		if len(args) < 3 {
+			return argNumErr
+		}
+		var lines [][]byte
+		for _, pair := range config.Get(toStrings(args[2:])) {
+			lines = append(lines, []byte(pair[0]), []byte(pair[1]))
+		}
+		return reply.MakeMultiBulkReply(lines)
+	case "set":
+		if len(args) < 4 || len(args)%2 != 0 {
+			return argNumErr
+		}
+		pairs := make([][2]string, 0, (len(args)-2)/2)
+		for i := 2; i < len(args); i += 2 {
+			pairs = append(pairs, [2]string{string(args[i]), string(args[i+1])})
+		}
+		if err := config.Set(pairs); err != nil {
+			return reply.MakeStandardErrReply("ERR " + err.Error())
+		}
+		return reply.MakeOKReply()
+	case "resetstat":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		r.stats.reset()
+		database.ResetStats()
+		return reply.MakeOKReply()
+	case "rewrite":
+		if len(args) != 2 {
+			return argNumErr
+		}
+		if err := config.Rewrite(); err != nil {
+			return reply.MakeStandardErrReply("ERR Rewriting config file: " + err.Error())
+		}
+		return reply.MakeOKReply()
+	}
+	return reply.MakeStandardErrReply("ERR unknown subcommand '" + subCmd + "'. Try CONFIG HELP.")
+}
+
+func toStrings(args [][]byte) []string {
+	values := make([]string, len(args))
+	for i, arg := range args {
+		values[i] = string(arg)
+	}
+	return values
+}
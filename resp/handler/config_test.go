@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go-redis/config"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+)
+
+func TestConfigInMulti(t *testing.T) {
+	h := newTestHandler(t, nil)
+	c := connect(t, h)
+	assertReply(t, c.send(t, "CONFIG", "SET", "maxclients", "100"), "+OK\r\n")
+
+	// CONFIG is not queued by MULTI, it aborts the transaction instead of running at once
+	assertReply(t, c.send(t, "MULTI"), "+OK\r\n")
+	assertReply(t, c.send(t, "CONFIG", "SET", "maxclients", "200"), "-ERR CONFIG inside MULTI is not allowed\r\n")
+	assertReply(t, c.send(t, "EXEC"), "-EXECABORT Transaction discarded because of previous errors.\r\n")
+	assertReply(t, c.send(t, "CONFIG", "GET", "maxclients"), "*2\r\n$10\r\nmaxclients\r\n$3\r\n100\r\n")
+}
+
+// exchange sends the command and reads its reply, unlike send it may be called by other goroutines than the test
+func (c *testClient) exchange(args ...string) (string, error) {
+	deadline := time.Now().Add(2 * time.Second)
+	_ = c.conn.SetDeadline(deadline)
+	if _, err := c.conn.Write(reply.MakeMultiBulkReply(utils.ToCmdLine(args...)).ToBytes()); err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	err := c.readReply(&sb)
+	return sb.String(), err
+}
+
+// TestConfigSetDuringTraffic changes settings read by clients and background jobs while they run, for go test -race
+func TestConfigSetDuringTraffic(t *testing.T) {
+	h := newTestHandler(t, func(props *config.ServerProperties) {
+		props.AppendOnly = true
+		props.AppendFsync = "everysec"
+	})
+	admin := connect(t, h)
+	clients := make([]*testClient, 4)
+	for i := range clients {
+		clients[i] = connect(t, h)
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func(i int, c *testClient) {
+			defer wg.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if ret, err := c.exchange("SET", "key:"+strconv.Itoa(i), strconv.Itoa(n)); err != nil || ret != "+OK\r\n" {
+					t.Errorf("SET replied %q, %v", ret, err)
+					return
+				}
+			}
+		}(i, c)
+	}
+	// new clients check maxclients and requirepass
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			c := connect(t, h)
+			if _, err := c.exchange("PING"); err != nil {
+				t.Errorf("PING failed: %v", err)
+				return
+			}
+			_ = c.conn.Close()
+		}
+	}()
+
+	// the idle clients reaper and the aof cron tick every second
+	values := [][]string{
+		{"appendfsync", "always", "everysec"},
+		{"timeout", "100", "0"},
+		{"maxclients", "1000", "0"},
+		{"requirepass", "secret", ""},
+	}
+	for end, i := time.Now().Add(1500*time.Millisecond), 0; time.Now().Before(end); i++ {
+		for _, v := range values {
+			assertReply(t, admin.send(t, "CONFIG", "SET", v[0], v[1+i%2]), "+OK\r\n")
+		}
+	}
+	close(stop)
+	wg.Wait()
+	for i := range clients {
+		assertReply(t, admin.send(t, "EXISTS", "key:"+strconv.Itoa(i)), ":1\r\n")
+	}
+}
@@ -3,14 +3,17 @@ package handler
 import (
 	"context"
 	"fmt"
+	"go-redis/acl"
 	"go-redis/cluster"
 	"go-redis/config"
 	"io"
 	"net"
 	"strings"
 	"sync"
+	"time"
 
 	"go-redis/database"
+	"go-redis/interface/resp"
 	"go-redis/lib/logger"
 	"go-redis/lib/sync/atomic"
 	"go-redis/resp/connection"
@@ -23,19 +26,31 @@ import (
 // RespHandler handlers information that complies with the RESP protocol
 type RespHandler struct {
 	activeConn sync.Map
+	clients    atomic.Int32 // number of connected clients
 	db         databaseface.Database
 	closing    atomic.Boolean
+	closed     chan struct{}
+	pause      *clientPause
+	stats      handlerStats
 }
 
 func MakeRespHandler() *RespHandler {
-	rh := &RespHandler{}
+	rh := &RespHandler{
+		closed: make(chan struct{}),
+		pause:  makeClientPause(),
+	}
 
-	if config.Properties.Self != "" && len(config.Properties.Peers) > 0 {
+	if err := acl.Init(); err != nil {
+		panic("load acl file: " + err.Error())
+	}
+	if config.Properties.ClusterEnabled || (config.Properties.Self != "" && len(config.Properties.Peers) > 0) {
 		rh.db = cluster.MakeClusterDatabase()
 	} else {
 		rh.db = database.NewStandaloneDatabase()
 	}
 
+	database.SetClientStatsProvider(rh.clientStats)
+	go rh.reapIdleClients()
 	return rh
 }
 
@@ -52,10 +67,29 @@ func (r *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 	// handler is closing, refuses connection
 	if r.closing.Get() {
 		_ = conn.Close()
+		return
 	}
 
+	// refuses clients beyond maxClient
+	count := r.clients.Add(1)
+	defer r.clients.Add(-1)
+	if max := config.Snapshot().MaxClient; max > 0 && int(count) > max {
+		r.stats.rejected.Add(1)
+		_, _ = conn.Write(reply.MakeStandardErrReply("ERR max number of clients reached").ToBytes())
+		_ = conn.Close()
+		logger.Info(fmt.Sprintf("connection refused: %s, max number of clients reached", conn.RemoteAddr()))
+		return
+	}
+
+	r.stats.totalConnections.Add(1)
+	conn = &countingConn{Conn: conn, stats: &r.stats}
+
 	// adds connection to map
 	client := connection.NewConn(conn)
+	// clients connected while no password is required stay authenticated after CONFIG SET requirepass
+	if u := acl.GetUser(acl.DefaultUser); u != nil && u.Enabled && u.NoPass {
+		client.SetUser(acl.DefaultUser)
+	}
 	r.activeConn.Store(client, struct{}{})
 
 	// server connection
@@ -85,13 +119,15 @@ func (r *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 			err := client.Write(errReply.ToBytes())
 			if err != nil {
 				r.closeClient(client)
-				logger.Info("connection closed: %v", client.RemoteAddr())
+				logger.Info(fmt.Sprintf("connection closed: %s", client.RemoteAddr()))
 				return
 			}
 
 			continue
 		}
 
+		client.MarkActive()
+
 		// exec
 		if payload.Data == nil {
 			logger.Error("empty payload")
@@ -104,11 +140,47 @@ func (r *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 			continue
 		}
 
-		result := r.db.Exec(client, bulkReply.Args)
-		if result != nil {
+		if len(bulkReply.Args) > 0 && strings.ToLower(string(bulkReply.Args[0])) == "quit" {
+			_ = client.Write(reply.MakeOKReply().ToBytes())
+			r.closeClient(client)
+			logger.Info(fmt.Sprintf("connection closed: %s", client.RemoteAddr()))
+			return
+		}
+
+		r.pause.wait(client, bulkReply.Args, r.closed)
+		// a paused client is not idle
+		client.MarkActive()
+
+		// the reply of the command after CLIENT REPLY SKIP is dropped
+		replyMode := client.GetReplyMode()
+		if replyMode == connection.ReplySkip {
+			client.SetReplyMode(connection.ReplyOn)
+		}
+
+		client.StartCommand(commandName(bulkReply.Args), bulkReply.Args)
+		var result resp.Reply
+		switch strings.ToLower(string(bulkReply.Args[0])) {
+		case "auth":
+			result = execAuth(client, bulkReply.Args)
+		case "hello":
+			result = r.execHello(client, bulkReply.Args)
+		default:
+			result = r.exec(client, bulkReply.Args)
+		}
+		client.FinishCommand()
+
+		// CLIENT REPLY OFF or SKIP is not replied either
+		if replyMode != connection.ReplySkip && client.GetReplyMode() == connection.ReplyOn {
+			if result == nil {
+				result = reply.MakeUnknownErrReplay()
+			}
 			_ = client.Write(result.ToBytes())
-		} else {
-			_ = client.Write(reply.MakeUnknownErrReplay().ToBytes())
+		}
+
+		if client.IsCloseAfterReply() {
+			r.closeClient(client)
+			logger.Info(fmt.Sprintf("connection killed: %s", client.RemoteAddr()))
+			return
 		}
 	}
 }
@@ -116,7 +188,11 @@ func (r *RespHandler) Handle(ctx context.Context, conn net.Conn) {
 // Close closes handler, database and the connections
 func (r *RespHandler) Close() error {
 	logger.Info("handler shutting down...")
+	if r.closing.Get() {
+		return nil
+	}
 	r.closing.Set(true)
+	close(r.closed)
 	r.activeConn.Range(func(key, value interface{}) bool {
 		client := key.(*connection.Connection)
 		_ = client.Close()
@@ -125,3 +201,29 @@ func (r *RespHandler) Close() error {
 	_ = r.db.Close()
 	return nil
 }
+
+// reapIdleClients closes the clients sending no command for timeout seconds, except subscribers,
+// the connection is closed only and the goroutine serving the client cleans it up
+func (r *RespHandler) reapIdleClients() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.closed:
+			return
+		}
+		timeout := time.Duration(config.Snapshot().Timeout) * time.Second
+		if timeout <= 0 {
+			continue
+		}
+		r.activeConn.Range(func(key, _ interface{}) bool {
+			client := key.(*connection.Connection)
+			if !client.IsSubscriber() && client.IdleTime() > timeout {
+				logger.Info(fmt.Sprintf("closing idle client: %s", client.RemoteAddr()))
+				_ = client.Close()
+			}
+			return true
+		})
+	}
+}
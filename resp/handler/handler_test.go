@@ -0,0 +1,133 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"go-redis/config"
+	"go-redis/lib/utils"
+	"go-redis/resp/reply"
+)
+
+// newTestHandler makes a handler on a standalone database, setup may change the properties first.
+// The former properties are restored after the test.
+func newTestHandler(t *testing.T, setup func(props *config.ServerProperties)) *RespHandler {
+	t.Helper()
+	dir := t.TempDir()
+	former := config.Properties
+	props := &config.ServerProperties{
+		Databases:       16,
+		AppendFilename:  filepath.Join(dir, "appendonly.aof"),
+		DBFilename:      filepath.Join(dir, "dump.rdb"),
+		ReplBacklogSize: 1 << 20,
+		AclLogMaxLen:    128,
+	}
+	if setup != nil {
+		setup(props)
+	}
+	config.Properties = props
+	h := MakeRespHandler()
+	t.Cleanup(func() {
+		_ = h.Close()
+		config.Properties = former
+	})
+	return h
+}
+
+// testClient is a client connected to a handler through a pipe
+type testClient struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// connect connects a client, the connection is closed after the test once the handler is done with it
+func connect(t *testing.T, h *RespHandler) *testClient {
+	t.Helper()
+	server, conn := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		h.Handle(context.Background(), server)
+		close(done)
+	}()
+	t.Cleanup(func() {
+		_ = conn.Close()
+		<-done
+	})
+	return &testClient{conn: conn, reader: bufio.NewReader(conn)}
+}
+
+// write sends the command without waiting for the reply
+func (c *testClient) write(t *testing.T, args ...string) {
+	t.Helper()
+	_ = c.conn.SetWriteDeadline(time.Now().Add(time.Second))
+	if _, err := c.conn.Write(reply.MakeMultiBulkReply(utils.ToCmdLine(args...)).ToBytes()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// read waits for the next reply and returns it as sent, nested arrays included
+func (c *testClient) read(t *testing.T) string {
+	t.Helper()
+	_ = c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var sb strings.Builder
+	if err := c.readReply(&sb); err != nil {
+		t.Fatal(err)
+	}
+	return sb.String()
+}
+
+func (c *testClient) readReply(sb *strings.Builder) error {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	sb.WriteString(line)
+	if line[0] != '*' && line[0] != '$' {
+		return nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil || n < 0 {
+		return err
+	}
+	if line[0] == '$' {
+		body := make([]byte, n+2)
+		if _, err := io.ReadFull(c.reader, body); err != nil {
+			return err
+		}
+		sb.Write(body)
+		return nil
+	}
+	for i := 0; i < n; i++ {
+		if err := c.readReply(sb); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *testClient) send(t *testing.T, args ...string) string {
+	t.Helper()
+	c.write(t, args...)
+	return c.read(t)
+}
+
+// closed tells whether the server closed the connection within the timeout
+func (c *testClient) closed(timeout time.Duration) bool {
+	_ = c.conn.SetReadDeadline(time.Now().Add(timeout))
+	_, err := c.reader.ReadByte()
+	return err == io.EOF || err == io.ErrClosedPipe
+}
+
+func assertReply(t *testing.T, actual string, expected string) {
+	t.Helper()
+	if actual != expected {
+		t.Errorf("expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"go-redis/config"
+)
+
+func TestMaxClient(t *testing.T) {
+	h := newTestHandler(t, func(props *config.ServerProperties) {
+		props.MaxClient = 1
+	})
+	c := connect(t, h)
+	assertReply(t, c.send(t, "PING"), "+PONG\r\n")
+
+	refused := connect(t, h)
+	assertReply(t, refused.read(t), "-ERR max number of clients reached\r\n")
+	if !refused.closed(time.Second) {
+		t.Error("expected the refused connection closed")
+	}
+	if info := c.send(t, "INFO", "stats"); !strings.Contains(info, "rejected_connections:1\r\n") {
+		t.Errorf("expected the refused connection counted, got %q", info)
+	}
+
+	// the slot is free once the client quits
+	assertReply(t, c.send(t, "QUIT"), "+OK\r\n")
+	for i := 0; h.clients.Get() > 0 && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assertReply(t, connect(t, h).send(t, "PING"), "+PONG\r\n")
+}
+
+// TestIdleTimeout checks idle clients are closed after timeout seconds, subscribers are kept
+func TestIdleTimeout(t *testing.T) {
+	h := newTestHandler(t, func(props *config.ServerProperties) {
+		props.Timeout = 1
+	})
+	idle := connect(t, h)
+	assertReply(t, idle.send(t, "PING"), "+PONG\r\n")
+	subscriber := connect(t, h)
+	assertReply(t, subscriber.send(t, "SUBSCRIBE", "news"), "*3\r\n$9\r\nsubscribe\r\n$4\r\nnews\r\n:1\r\n")
+
+	if !idle.closed(3 * time.Second) {
+		t.Fatal("expected the idle client closed")
+	}
+	assertReply(t, subscriber.send(t, "PING"), "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"net"
+
+	"go-redis/config"
+	"go-redis/database"
+	"go-redis/lib/sync/atomic"
+)
+
+// handlerStats are the counters of the clients reported by INFO
+type handlerStats struct {
+	totalConnections atomic.Int64
+	rejected         atomic.Int64
+	netInput         atomic.Int64
+	netOutput        atomic.Int64
+}
+
+// reset resets the counters, connected clients are still counted
+func (stats *handlerStats) reset() {
+	stats.totalConnections.Set(0)
+	stats.rejected.Set(0)
+	stats.netInput.Set(0)
+	stats.netOutput.Set(0)
+}
+
+// countingConn counts the bytes read from and written to the client, including pushed messages
+type countingConn struct {
+	net.Conn
+	stats *handlerStats
+}
+
+func (c *countingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.stats.netInput.Add(int64(n))
+	return n, err
+}
+
+func (c *countingConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	c.stats.netOutput.Add(int64(n))
+	return n, err
+}
+
+// clientStats reports the counters to INFO
+func (r *RespHandler) clientStats() database.ClientStats {
+	return database.ClientStats{
+		Connected:        int(r.clients.Get()),
+		MaxClients:       config.Snapshot().MaxClient,
+		TotalConnections: r.stats.totalConnections.Get(),
+		Rejected:         r.stats.rejected.Get(),
+		NetInputBytes:    r.stats.netInput.Get(),
+		NetOutputBytes:   r.stats.netOutput.Get(),
+	}
+}
@@ -45,6 +45,10 @@ type readState struct {
 
 	// the length of data bulk
 	bulkLen int64
+
+	// the next line is the content of a bulk rather than a header,
+	// so a bulk starting with '$' or an empty bulk is not mistaken for a header
+	readingBulkBody bool
 }
 
 // finished checks the parser operation is finished or not
@@ -253,9 +257,10 @@ func parseBulkHeader(line []byte, state *readState) error {
 
 		// null bulk
 		return nil
-	} else if state.bulkLen > 0 {
+	} else if state.bulkLen >= 0 {
 		state.msgType = line[0]
 		state.readingMultiLine = true
+		state.readingBulkBody = true
 		state.expectedArgsCount = 1
 		state.args = make([][]byte, 0, 1)
 		return nil
@@ -300,16 +305,27 @@ func readBody(line []byte, state *readState) error {
 	line = line[0 : len(line)-2]
 	var err error
 
+	// hedon
+	if state.readingBulkBody {
+		state.args = append(state.args, line)
+		state.readingBulkBody = false
+		return nil
+	}
+
 	// $3
-	if line[0] == '$' {
+	if len(line) > 0 && line[0] == '$' {
 		// $3 -> 3
 		state.bulkLen, err = strconv.ParseInt(string(line[1:]), 10, 64)
 		if err != nil {
 			return fmt.Errorf("protocol error: %s", string(line))
 		}
-		if state.bulkLen <= 0 { //$0\r\n
-			state.args = append(state.args, []byte{})
+		if state.bulkLen == -1 { //$-1\r\n
+			state.args = append(state.args, nil)
 			state.bulkLen = 0
+		} else if state.bulkLen < -1 {
+			return fmt.Errorf("protocol error: %s", string(line))
+		} else { //$0\r\n is followed by an empty line
+			state.readingBulkBody = true
 		}
 	} else {
 		// SET\r\n
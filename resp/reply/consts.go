@@ -56,7 +56,7 @@ func MakeNullBulkReply() *NullBulkReply {
 type EmptyMultiBulkReply struct {
 }
 
-var emptyMultiBulkBytes = []byte("*0\r\r")
+var emptyMultiBulkBytes = []byte("*0\r\n")
 
 func (e *EmptyMultiBulkReply) ToBytes() []byte {
 	return emptyMultiBulkBytes
@@ -68,6 +68,22 @@ func MakeEmptyMultiBulkReply() *EmptyMultiBulkReply {
 	return theEmptyMultiBulkReply
 }
 
+// NullMultiBulkReply null array
+type NullMultiBulkReply struct {
+}
+
+var nullMultiBulkBytes = []byte("*-1\r\n")
+
+func (n *NullMultiBulkReply) ToBytes() []byte {
+	return nullMultiBulkBytes
+}
+
+var theNullMultiBulkReply = new(NullMultiBulkReply)
+
+func MakeNullMultiBulkReply() *NullMultiBulkReply {
+	return theNullMultiBulkReply
+}
+
 // NoReply no reply
 type NoReply struct {
 }
@@ -65,10 +65,10 @@ func MakeSyntaxErrReply() *SyntaxErrReply {
 type WrongTypeErrReply struct {
 }
 
-var wrongTypeErrBytes = []byte("-Err Wrong type operation against a key holding the wrong kind of value\r\n")
+var wrongTypeErrBytes = []byte("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n")
 
 func (w *WrongTypeErrReply) Error() string {
-	return "Err Wrong type operation against a key holding the wrong kind of value"
+	return "WRONGTYPE Operation against a key holding the wrong kind of value"
 }
 
 func (w *WrongTypeErrReply) ToBytes() []byte {
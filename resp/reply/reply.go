@@ -19,8 +19,8 @@ type BulkReply struct {
 }
 
 func (b *BulkReply) ToBytes() []byte {
-	if len(b.Arg) == 0 {
-		return nullBulkReplyBytes
+	if b.Arg == nil {
+		return nullBulkBytes
 	}
 	// hedon -> $5\r\nhedon\r\n
 	return []byte(buildStringReply(b.Arg))
@@ -40,7 +40,7 @@ type MultiBulkReply struct {
 func (m *MultiBulkReply) ToBytes() []byte {
 	argLen := len(m.Args)
 	if argLen == 0 {
-		return nullBulkReplyBytes
+		return emptyMultiBulkBytes
 	}
 	// SET key value
 	// ->
@@ -48,7 +48,7 @@ func (m *MultiBulkReply) ToBytes() []byte {
 	var buf bytes.Buffer
 	buf.WriteString(fmt.Sprintf("*%d%s", argLen, CRLF))
 	for i := 0; i < argLen; i++ { //$3\r\nSET\r\n
-		if len(m.Args[i]) == 0 {
+		if m.Args[i] == nil {
 			buf.WriteString(string(nullBulkReplyBytes) + CRLF)
 		} else {
 			buf.WriteString(buildStringReply(m.Args[i]))
@@ -63,6 +63,27 @@ func MakeMultiBulkReply(args [][]byte) *MultiBulkReply {
 	}
 }
 
+// MultiRawReply represents an array whose elements can be replies of any type,
+// e.g. the cursor and the nested array replied by SCAN
+type MultiRawReply struct {
+	Replies []resp.Reply
+}
+
+func (m *MultiRawReply) ToBytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("*%d%s", len(m.Replies), CRLF))
+	for _, r := range m.Replies {
+		buf.Write(r.ToBytes())
+	}
+	return buf.Bytes()
+}
+
+func MakeMultiRawReply(replies []resp.Reply) *MultiRawReply {
+	return &MultiRawReply{
+		Replies: replies,
+	}
+}
+
 // StatusReply replies a status
 type StatusReply struct {
 	Status string
@@ -124,5 +145,6 @@ func buildStringReply(bs []byte) string {
 
 // IsErrReply checks the reply is error reply or not
 func IsErrReply(reply resp.Reply) bool {
-	return reply.ToBytes()[0] == '-'
+	bs := reply.ToBytes()
+	return len(bs) > 0 && bs[0] == '-'
 }
@@ -7,6 +7,7 @@ import (
 	"os/signal"
 	"sync"
 	"syscall"
+	"time"
 
 	"go-redis/interface/tcp"
 	"go-redis/lib/logger"
@@ -14,6 +15,8 @@ import (
 
 type Config struct {
 	Address string
+	// KeepAlive is the period of TCP keepalive probes of accepted connections, 0 disables keepalive
+	KeepAlive time.Duration
 }
 
 // ListenAndServeWithSignal binds port and handle requests, blocking until receive stop signal
@@ -25,6 +28,9 @@ func ListenAndServeWithSignal(cfg *Config, handler tcp.Handler) error {
 	}
 
 	logger.Info("start to listen", cfg.Address)
+	if tcpListener, ok := listener.(*net.TCPListener); ok {
+		listener = &keepAliveListener{TCPListener: tcpListener, period: cfg.KeepAlive}
+	}
 
 	closeChan := make(chan struct{})
 	go handleSystemSignal(closeChan)
@@ -71,7 +77,27 @@ func ListenAndServe(listener net.Listener, handler tcp.Handler, closeChan <-chan
 	}
 
 	// wait for all connections to close
-	waitDone.Done()
+	waitDone.Wait()
+}
+
+// keepAliveListener sets TCP keepalive of accepted connections
+type keepAliveListener struct {
+	*net.TCPListener
+	period time.Duration
+}
+
+func (l *keepAliveListener) Accept() (net.Conn, error) {
+	conn, err := l.AcceptTCP()
+	if err != nil {
+		return nil, err
+	}
+	if l.period > 0 {
+		_ = conn.SetKeepAlive(true)
+		_ = conn.SetKeepAlivePeriod(l.period)
+	} else {
+		_ = conn.SetKeepAlive(false)
+	}
+	return conn, nil
 }
 
 // handleSystemSignal handles the operator system signal